@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	apiFormatJSON = "json"
+	apiFormatXML  = "xml"
+)
+
+const apiDirName = "api"
+
+// APIConfig makes the site an api endpoint, its payloads are saved pretty printed instead of parsed as html and
+// the next pages are found by a JSONPath rule
+type APIConfig struct {
+	Format   string `json:"format,omitempty"`
+	NextLink string `json:"next_link,omitempty"`
+	MaxPages int    `json:"max_pages,omitempty"`
+}
+
+// getAPIFormat returns the format of the payload, by the api config, the content type or the first character
+func getAPIFormat(config *APIConfig, contentType string, content []byte) string {
+	if config.Format != "" {
+		return config.Format
+	}
+
+	contentType = strings.ToLower(contentType)
+
+	if strings.Contains(contentType, "json") {
+		return apiFormatJSON
+	}
+
+	if strings.Contains(contentType, "xml") {
+		return apiFormatXML
+	}
+
+	if trimmed := bytes.TrimSpace(content); len(trimmed) > 0 && trimmed[0] == '<' {
+		return apiFormatXML
+	}
+
+	return apiFormatJSON
+}
+
+// getPrettyAPIContent returns the payload indented, the payloads that are not valid are returned as they are
+func getPrettyAPIContent(format string, content []byte) ([]byte, error) {
+	if format == apiFormatXML {
+		return getPrettyXML(content)
+	}
+
+	result := &bytes.Buffer{}
+
+	if err := json.Indent(result, content, "", "\t"); err != nil {
+		return content, err
+	}
+
+	result.WriteString("\n")
+
+	return result.Bytes(), nil
+}
+
+func getPrettyXML(content []byte) ([]byte, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	decoder.Strict = false
+	result := &bytes.Buffer{}
+	encoder := xml.NewEncoder(result)
+	encoder.Indent("", "\t")
+
+	for {
+		token, err := decoder.Token()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return content, err
+		}
+
+		// the indentation replaces the whitespace between the elements
+		if charData, ok := token.(xml.CharData); ok && len(bytes.TrimSpace(charData)) == 0 {
+			continue
+		}
+
+		if err := encoder.EncodeToken(xml.CopyToken(token)); err != nil {
+			return content, err
+		}
+	}
+
+	if err := encoder.Flush(); err != nil {
+		return content, err
+	}
+
+	result.WriteString("\n")
+
+	return result.Bytes(), nil
+}
+
+// getJSONPathValue returns the value of a JSONPath of dot and bracket steps, like $.links.next or
+// $.data['next'] or $.pages[0].url
+func getJSONPathValue(data interface{}, path string) (interface{}, error) {
+	path = strings.TrimPrefix(strings.TrimSpace(path), "$")
+	value := data
+
+	for path != "" {
+		var step string
+
+		switch path[0] {
+		case '.':
+			path = path[1:]
+			end := strings.IndexAny(path, ".[")
+
+			if end < 0 {
+				end = len(path)
+			}
+
+			step, path = path[:end], path[end:]
+		case '[':
+			end := strings.Index(path, "]")
+
+			if end < 0 {
+				return nil, errors.New("unclosed bracket in JSONPath")
+			}
+
+			step, path = strings.Trim(path[1:end], "'\""), path[end+1:]
+		default:
+			return nil, errors.New("invalid JSONPath step: " + path)
+		}
+
+		switch node := value.(type) {
+		case map[string]interface{}:
+			value = node[step]
+		case []interface{}:
+			index, err := strconv.Atoi(step)
+
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, nil
+			}
+
+			value = node[index]
+		default:
+			return nil, nil
+		}
+	}
+
+	return value, nil
+}
+
+// getAPINextURL returns the next page of the payload by the next link rule, resolved from the page url
+func getAPINextURL(config *APIConfig, pageURL string, content []byte) (string, error) {
+	var data interface{}
+
+	if err := json.Unmarshal(content, &data); err != nil {
+		return "", err
+	}
+
+	value, err := getJSONPathValue(data, config.NextLink)
+
+	if err != nil {
+		return "", err
+	}
+
+	nextLink, ok := value.(string)
+
+	if !ok || strings.TrimSpace(nextLink) == "" {
+		return "", nil
+	}
+
+	baseURL, err := url.Parse(pageURL)
+
+	if err != nil {
+		return "", err
+	}
+
+	nextURL, err := baseURL.Parse(strings.TrimSpace(nextLink))
+
+	if err != nil {
+		return "", err
+	}
+
+	return nextURL.String(), nil
+}
+
+// crawlSiteAPI saves the payload of the site and of its next pages, each one is a page of the site
+func crawlSiteAPI(site *Site, siteDir string, content []byte, contentType string, fetcher Fetcher) {
+	maxPages := site.API.MaxPages
+
+	if maxPages <= 0 {
+		maxPages = defaultMaxPages
+	}
+
+	// the next links are in the scope of the site like the links of the pages
+	seedURL, err := url.Parse(site.URL)
+
+	if err != nil {
+		return
+	}
+
+	format := getAPIFormat(site.API, contentType, content)
+	pages := []*Page{}
+	visitedURLs := map[string]bool{}
+	pageURL := site.URL
+	statusCode := site.StatusCode
+
+	for {
+		visitedURLs[normalizeURL(pageURL)] = true
+
+		page := &Page{
+			URL:         pageURL,
+			Depth:       len(pages),
+			FileName:    "index." + format,
+			StatusCode:  statusCode,
+			ContentHash: getContentHash(content),
+			FetchedAt:   time.Now().UTC(),
+		}
+
+		if len(pages) > 0 {
+			page.FileName = fmt.Sprintf("%s/page-%d.%s", apiDirName, len(pages)+1, format)
+		}
+
+		pages = append(pages, page)
+		page.FetchSuccess = saveAPIContent(siteDir, page, format, content)
+
+		if site.API.NextLink == "" || format != apiFormatJSON || len(pages) >= maxPages {
+			break
+		}
+
+		nextURL, err := getAPINextURL(site.API, pageURL, content)
+
+		if err != nil {
+			printError("Unable to get api next link:", pageURL, err)
+			break
+		}
+
+		if nextURL == "" || visitedURLs[normalizeURL(nextURL)] {
+			break
+		}
+
+		if !isURLInScope(site, seedURL, nextURL) {
+			printError("Api next link out of scope:", nextURL)
+			emitEvent("page_skipped", site, nextURL, nil, map[string]interface{}{"skip_reason": "out of scope"})
+			break
+		}
+
+		printInfo(fmt.Sprintf("Getting api page %d of %d - %s...", len(pages)+1, maxPages, nextURL))
+
+		content, statusCode, err = fetchPage(fetcher, nextURL)
+
+		if err != nil {
+			printError("Unable to fetch api page:", nextURL, err)
+			pages = append(pages, &Page{URL: nextURL, Depth: len(pages), StatusCode: statusCode})
+			emitEvent("page_failed", site, nextURL, err, nil)
+			break
+		}
+
+		crawledBytes += int64(len(content))
+		pageURL = nextURL
+		emitEvent("page_fetched", site, pageURL, nil, map[string]interface{}{"bytes": len(content), "depth": len(pages)})
+	}
+
+	site.Pages = pages
+}
+
+func saveAPIContent(siteDir string, page *Page, format string, content []byte) bool {
+	prettyContent, err := getPrettyAPIContent(format, content)
+
+	if err != nil {
+		printError("Unable to format api payload, saving it as it is:", page.URL, err)
+	}
+
+	fileName := siteDir + string(filepath.Separator) + filepath.FromSlash(page.FileName)
+	err = os.MkdirAll(filepath.Dir(fileName), dirMode)
+
+	if err == nil {
+		err = writeFile(fileName, prettyContent, fileMode)
+	}
+
+	if err != nil {
+		printError("Unable to save api payload:", err)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const defaultArchiveAddress = "127.0.0.1:8080"
+const archiveSitesPath = "/sites/"
+
+// the policy of the archived files, the scripts of the sites never run and the references that were not archived
+// are not fetched by the browser
+const archiveContentSecurityPolicy = "default-src 'self' data:; style-src 'self' 'unsafe-inline'; script-src 'none'; object-src 'none'; form-action 'none'; base-uri 'none'"
+
+var cssURLPattern = regexp.MustCompile(`url\(\s*(['"]?)([^'")]+)['"]?\s*\)`)
+
+// ArchiveIndex maps the original urls of the archived pages to their local paths and back, and the hosts of the
+// sites to their dirs
+type ArchiveIndex struct {
+	OutputDir    string
+	LocalPaths   map[string]string
+	OriginalURLs map[string]string
+	SiteDirNames map[string]string
+}
+
+type archiveSite struct {
+	Site      *Site
+	Path      string
+	Snapshots []*archiveSnapshot
+}
+
+type archiveSnapshot struct {
+	Name string
+	Path string
+}
+
+type archiveGroup struct {
+	Name  string
+	Sites []*archiveSite
+}
+
+var archiveIndexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>go-tor-crawler archive</title>
+</head>
+<body>
+<h1>Archive</h1>
+{{range .}}{{if .Name}}<h2>{{.Name}}</h2>
+{{end}}<table>
+<tr><th>Site</th><th>Title</th><th>Categories</th><th>Fetched</th><th>Pages</th><th>Images</th><th>Snapshots</th></tr>
+{{range .Sites}}<tr>
+<td><a href="{{.Path}}">{{.Site.URL}}</a></td>
+<td>{{.Site.Title}}</td>
+<td>{{range .Site.Categories}}{{.}} {{end}}</td>
+<td>{{.Site.FetchSuccess}}</td>
+<td>{{len .Site.Pages}}</td>
+<td>{{len .Site.Images}}</td>
+<td>{{range .Snapshots}}<a href="{{.Path}}">{{.Name}}</a> {{end}}</td>
+</tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`))
+
+func newArchiveIndex(outputDir string) *ArchiveIndex {
+	index := &ArchiveIndex{
+		OutputDir:    outputDir,
+		LocalPaths:   map[string]string{},
+		OriginalURLs: map[string]string{},
+		SiteDirNames: map[string]string{},
+	}
+
+	for _, site := range configuration.Sites {
+		siteDirName := getSiteDirName(site)
+
+		// the payload of api sites is their first page
+		if site.API == nil {
+			index.add(site.URL, archiveSitesPath+siteDirName+"/index.html")
+		}
+
+		if _, exists := index.SiteDirNames[getURLHost(site.URL)]; !exists {
+			index.SiteDirNames[getURLHost(site.URL)] = siteDirName
+		}
+
+		for _, page := range site.Pages {
+			if page.FetchSuccess && !strings.HasSuffix(page.FileName, quarantineSuffix) {
+				index.add(page.URL, archiveSitesPath+siteDirName+"/"+page.FileName)
+			}
+		}
+
+		for _, image := range site.Images {
+			if image.FetchSuccess && !image.Quarantined {
+				index.add(site.URL+"/"+image.URL, archiveSitesPath+siteDirName+"/"+image.URL)
+			}
+		}
+
+		for _, frame := range site.Frames {
+			if frame.FetchSuccess {
+				index.add(frame.URL, archiveSitesPath+siteDirName+"/"+frame.FileName)
+			}
+		}
+
+		for _, feed := range site.Feeds {
+			for _, entry := range feed.Entries {
+				if entry.FetchSuccess {
+					index.add(entry.URL, archiveSitesPath+siteDirName+"/"+entry.FileName)
+				}
+			}
+		}
+	}
+
+	return index
+}
+
+func (index *ArchiveIndex) add(originalURL string, localPath string) {
+	if _, exists := index.LocalPaths[normalizeURL(originalURL)]; !exists {
+		index.LocalPaths[normalizeURL(originalURL)] = localPath
+	}
+
+	index.OriginalURLs[localPath] = originalURL
+}
+
+// getArchivedPath returns the path of the page in the archive and the snapshot prefix of the path, so links of
+// snapshot pages point to the same snapshot
+func getArchivedPath(localPath string) (string, string) {
+	parts := strings.SplitN(strings.TrimPrefix(localPath, archiveSitesPath), "/", 4)
+
+	if len(parts) == 4 && parts[1] == snapshotsDirName {
+		return archiveSitesPath + parts[0] + "/" + parts[3], archiveSitesPath + parts[0] + "/" + snapshotsDirName + "/" + parts[2] + "/"
+	}
+
+	return localPath, ""
+}
+
+// rewriteArchivedHTML changes the links to archived pages and the archived images to their local paths
+func (index *ArchiveIndex) rewriteArchivedHTML(content []byte, localPath string) ([]byte, error) {
+	archivedPath, snapshotPrefix := getArchivedPath(localPath)
+	originalURL, exists := index.OriginalURLs[archivedPath]
+
+	if !exists {
+		return content, nil
+	}
+
+	baseURL, err := url.Parse(originalURL)
+
+	if err != nil {
+		return content, nil
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(content))
+
+	if err != nil {
+		return nil, err
+	}
+
+	siteDirPrefix := strings.Join(strings.SplitN(archivedPath, "/", 4)[:3], "/") + "/"
+
+	// getLocalPath returns the local path of an archived url, or the url when it was not archived
+	getLocalPath := func(value string) string {
+		linkURL, err := baseURL.Parse(strings.TrimSpace(value))
+
+		if err != nil {
+			return value
+		}
+
+		targetPath, exists := index.LocalPaths[normalizeURL(linkURL.String())]
+
+		if !exists {
+			return value
+		}
+
+		if snapshotPrefix != "" && strings.HasPrefix(targetPath, siteDirPrefix) {
+			targetPath = snapshotPrefix + strings.TrimPrefix(targetPath, siteDirPrefix)
+		}
+
+		if linkURL.Fragment != "" {
+			targetPath += "#" + linkURL.Fragment
+		}
+
+		return targetPath
+	}
+
+	doc.Find("a[href], link[href], area[href]").Each(func(_ int, selection *goquery.Selection) {
+		selection.SetAttr("href", getLocalPath(selection.AttrOr("href", "")))
+	})
+
+	doc.Find("img[src], script[src], iframe[src], frame[src], source[src], video[src], audio[src], embed[src], input[src]").Each(func(_ int, selection *goquery.Selection) {
+		selection.SetAttr("src", getLocalPath(selection.AttrOr("src", "")))
+	})
+
+	doc.Find("img[srcset], source[srcset]").Each(func(_ int, selection *goquery.Selection) {
+		selection.SetAttr("srcset", rewriteSrcset(selection.AttrOr("srcset", ""), getLocalPath))
+	})
+
+	doc.Find("[style]").Each(func(_ int, selection *goquery.Selection) {
+		selection.SetAttr("style", rewriteCSSURLs(selection.AttrOr("style", ""), getLocalPath))
+	})
+
+	doc.Find("style").Each(func(_ int, selection *goquery.Selection) {
+		selection.SetHtml(rewriteCSSURLs(selection.Text(), getLocalPath))
+	})
+
+	html, err := doc.Html()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(html), nil
+}
+
+// rewriteSrcset changes the urls of the candidates of a srcset, keeping their descriptors
+func rewriteSrcset(srcset string, getLocalPath func(string) string) string {
+	candidates := strings.Split(srcset, ",")
+
+	for candidateIndex, candidate := range candidates {
+		fields := strings.Fields(candidate)
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		fields[0] = getLocalPath(fields[0])
+		candidates[candidateIndex] = strings.Join(fields, " ")
+	}
+
+	return strings.Join(candidates, ", ")
+}
+
+// rewriteCSSURLs changes the urls of the url() of the css
+func rewriteCSSURLs(css string, getLocalPath func(string) string) string {
+	return cssURLPattern.ReplaceAllStringFunc(css, func(match string) string {
+		parts := cssURLPattern.FindStringSubmatch(match)
+		return "url(" + parts[1] + getLocalPath(parts[2]) + parts[1] + ")"
+	})
+}
+
+func (index *ArchiveIndex) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if request.URL.Path == "/" {
+		index.serveIndex(writer)
+		return
+	}
+
+	if !strings.HasPrefix(request.URL.Path, archiveSitesPath) {
+		http.NotFound(writer, request)
+		return
+	}
+
+	localPath := path.Clean(request.URL.Path)
+	writer.Header().Set("Content-Security-Policy", archiveContentSecurityPolicy)
+
+	// the files flagged by the scanner are never served
+	if strings.HasSuffix(localPath, quarantineSuffix) {
+		http.NotFound(writer, request)
+		return
+	}
+
+	if strings.HasSuffix(localPath, ".html") {
+		file, err := http.Dir(index.OutputDir).Open(strings.TrimPrefix(localPath, archiveSitesPath[:len(archiveSitesPath)-1]))
+
+		if err != nil {
+			http.NotFound(writer, request)
+			return
+		}
+
+		content, err := ioutil.ReadAll(file)
+		file.Close()
+
+		if err == nil {
+			content, err = index.rewriteArchivedHTML(content, localPath)
+		}
+
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+		writer.Write(content)
+		return
+	}
+
+	http.StripPrefix(archiveSitesPath[:len(archiveSitesPath)-1], http.FileServer(http.Dir(index.OutputDir))).ServeHTTP(writer, request)
+}
+
+// serveIndex lists the sites grouped by tag, when the sites have tags
+func (index *ArchiveIndex) serveIndex(writer http.ResponseWriter) {
+	groups := []*archiveGroup{}
+	siteGroups := getSiteGroups(configuration.Sites)
+
+	if len(siteGroups) == 1 && siteGroups[untaggedGroupName] != nil {
+		groups = append(groups, &archiveGroup{Sites: index.getArchiveSites(configuration.Sites)})
+	} else {
+		for _, name := range getSiteGroupNames(siteGroups) {
+			groups = append(groups, &archiveGroup{Name: name, Sites: index.getArchiveSites(siteGroups[name])})
+		}
+	}
+
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := archiveIndexTemplate.Execute(writer, groups)
+
+	if err != nil {
+		printError("Unable to render archive index:", err)
+	}
+}
+
+func (index *ArchiveIndex) getArchiveSites(sites []*Site) []*archiveSite {
+	result := []*archiveSite{}
+
+	for _, site := range sites {
+		siteDirName := getSiteDirName(site)
+		snapshots := []*archiveSnapshot{}
+
+		for _, snapshotName := range getSnapshotNames(index.OutputDir + string(filepath.Separator) + siteDirName + string(filepath.Separator) + snapshotsDirName) {
+			snapshots = append(snapshots, &archiveSnapshot{
+				Name: snapshotName,
+				Path: archiveSitesPath + siteDirName + "/" + snapshotsDirName + "/" + snapshotName + "/index.html",
+			})
+		}
+
+		result = append(result, &archiveSite{
+			Site:      site,
+			Path:      archiveSitesPath + siteDirName + "/index.html",
+			Snapshots: snapshots,
+		})
+	}
+
+	return result
+}
+
+func runServeArchiveCommand(args []string) {
+	if len(args) < 1 || len(args) > 2 {
+		fmt.Printf("Usage : %s serve-archive <configuration file> [address] \n", os.Args[0])
+		os.Exit(exitCodeConfigError)
+	}
+
+	configurationFileName = args[0]
+	address := defaultArchiveAddress
+
+	if len(args) == 2 {
+		address = args[1]
+	}
+
+	loadConfigurationFile()
+
+	currentDir, err := os.Getwd()
+
+	if err != nil {
+		fmt.Println("Unable to get current directory:", err)
+		os.Exit(exitCodeError)
+	}
+
+	index := newArchiveIndex(getOutputDir(currentDir))
+
+	fmt.Println(fmt.Sprintf("Serving archive of %d sites on http://%s", len(configuration.Sites), address))
+
+	err = http.ListenAndServe(address, index)
+
+	if err != nil {
+		fmt.Println("Unable to serve archive:", err)
+		os.Exit(exitCodeError)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	assetProbeHead  = "head"
+	assetProbeRange = "range"
+)
+
+const assetSkipReasonTooLarge = "too large"
+
+type assetProbeKey struct{}
+
+// withAssetProbe returns a context whose GET requests are changed to the probe: a HEAD request, or a GET of the
+// first byte that returns the size in the Content-Range header, for the servers that don't answer HEAD
+func withAssetProbe(ctx context.Context, probe string) context.Context {
+	return context.WithValue(ctx, assetProbeKey{}, probe)
+}
+
+func getAssetProbe(ctx context.Context) string {
+	probe, _ := ctx.Value(assetProbeKey{}).(string)
+	return probe
+}
+
+// setAssetProbe changes the request to the probe of its context
+func setAssetProbe(request *http.Request) {
+	switch getAssetProbe(request.Context()) {
+	case assetProbeHead:
+		request.Method = "HEAD"
+	case assetProbeRange:
+		request.Header.Set("Range", "bytes=0-0")
+	}
+}
+
+func isAssetProbeEnabled() bool {
+	return configuration.AssetProbe != "" && configuration.MaxAssetBytes > 0
+}
+
+// getAssetSize asks the size of the asset without downloading it, returning -1 when the server doesn't tell it
+func getAssetSize(fetcher Fetcher, url string) int64 {
+	probe := configuration.AssetProbe
+	method := "GET"
+
+	if probe == assetProbeHead {
+		method = "HEAD"
+	}
+
+	response, err := doURLRequest(method, url, func(ctx context.Context) (*http.Response, error) {
+		return fetcher.Get(withAssetProbe(ctx, probe), url)
+	})
+
+	if err != nil {
+		return -1
+	}
+
+	response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusPartialContent:
+		return getContentRangeSize(response.Header.Get("Content-Range"))
+	case http.StatusOK:
+		return response.ContentLength
+	}
+
+	return -1
+}
+
+// getContentRangeSize returns the complete length of a "bytes 0-0/12345" header, or -1 when it is unknown
+func getContentRangeSize(contentRange string) int64 {
+	index := strings.LastIndex(contentRange, "/")
+
+	if index < 0 {
+		return -1
+	}
+
+	size, err := strconv.ParseInt(strings.TrimSpace(contentRange[index+1:]), 10, 64)
+
+	if err != nil {
+		return -1
+	}
+
+	return size
+}
+
+// isAssetTooLarge probes the asset when enabled and returns if it is above the max asset size, with its size. The
+// assets of unknown size are downloaded, the download stops at the max asset size
+func isAssetTooLarge(url string) (bool, int64) {
+	if !isAssetProbeEnabled() {
+		return false, -1
+	}
+
+	size := getAssetSize(newFetcher(), url)
+
+	return size > configuration.MaxAssetBytes, size
+}
+
+// skipLargeImage records the image as skipped, the size is the probed size or -1 when the download stopped at the
+// max asset size
+func skipLargeImage(site *Site, image *Image, imageURL string, size int64) {
+	image.FetchSuccess = false
+	image.SkipReason = assetSkipReasonTooLarge
+	data := map[string]interface{}{"skip_reason": image.SkipReason, "max_bytes": configuration.MaxAssetBytes}
+
+	if size >= 0 {
+		data["bytes"] = size
+		printInfo(fmt.Sprintf("Image skipped, too large (%s, max %s) - %s", formatBytes(size), formatBytes(configuration.MaxAssetBytes), imageURL))
+	} else {
+		printInfo(fmt.Sprintf("Image skipped, too large (above %s) - %s", formatBytes(configuration.MaxAssetBytes), imageURL))
+	}
+
+	emitEvent("asset_skipped", site, imageURL, nil, data)
+}
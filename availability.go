@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// sites that never came up after this number of attempts are not retried in the same run
+const deadSiteAttempts = 5
+
+type SiteAvailability struct {
+	Attempts    int       `json:"attempts"`
+	Successes   int       `json:"successes"`
+	LastSuccess time.Time `json:"last_success"`
+	LastFailure time.Time `json:"last_failure"`
+}
+
+var (
+	crawlQueue      []*Site
+	siteRetryCounts = map[*Site]int{}
+)
+
+func (availability *SiteAvailability) Uptime() float64 {
+	if availability == nil || availability.Attempts == 0 {
+		return 0
+	}
+
+	return float64(availability.Successes) / float64(availability.Attempts)
+}
+
+func recordSiteAvailability(site *Site, success bool) {
+	if site.Availability == nil {
+		site.Availability = &SiteAvailability{}
+	}
+
+	site.Availability.Attempts++
+
+	if success {
+		site.Availability.Successes++
+		site.Availability.LastSuccess = crawlerClock.Now().UTC()
+	} else {
+		site.Availability.LastFailure = crawlerClock.Now().UTC()
+	}
+}
+
+// getSiteRetries returns how many times a failed site is retried at the end of the crawl, flaky sites that
+// were up before get all retries, sites that were never up get one retry and dead sites get none
+func getSiteRetries(site *Site) int {
+	if configuration.SiteRetries <= 0 {
+		return 0
+	}
+
+	availability := site.Availability
+
+	if availability == nil || availability.Successes == 0 {
+		if availability != nil && availability.Attempts >= deadSiteAttempts {
+			return 0
+		}
+
+		return 1
+	}
+
+	return configuration.SiteRetries
+}
+
+// scheduleSiteRetry adds the failed site to the end of the crawl queue, so it doesn't block the other sites
+func scheduleSiteRetry(site *Site) {
+	if siteRetryCounts[site] >= getSiteRetries(site) {
+		return
+	}
+
+	siteRetryCounts[site]++
+	crawlQueue = append(crawlQueue, site)
+
+	printInfo(fmt.Sprintf("Site will be retried at the end of the crawl (retry %d, uptime %.0f%%): %s", siteRetryCounts[site], site.Availability.Uptime()*100, site.URL))
+}
+
+// setSiteFetchFailed marks the site fetch as failed, notifying and scheduling a retry by the policy of the class
+// of the error
+func setSiteFetchFailed(site *Site, err error, data map[string]interface{}) {
+	site.FetchSuccess = false
+	class := getErrorClass(err)
+
+	// the site was up when its files can't be saved
+	if class != errorClassStorage {
+		recordSiteAvailability(site, false)
+	}
+
+	entry := &SiteHistoryEntry{Error: err.Error(), TorErrorClass: getTorErrorClass(err)}
+
+	if statusCode, ok := data["status_code"].(int); ok {
+		entry.StatusCode = statusCode
+	}
+
+	if softError, ok := data["soft_error"].(string); ok {
+		entry.SoftError = softError
+	}
+
+	if latency, ok := data["latency_ms"].(int64); ok {
+		entry.LatencyMillis = latency
+	}
+
+	action := applyErrorPolicy(site, site.URL, class, err)
+
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+
+	data["error_class"] = class
+	data["error_action"] = action
+
+	recordSiteHistory(site, entry)
+	recordSiteFailure(site, entry)
+	emitEvent("site_failed", site, site.URL, err, data)
+	notifySiteFailure(site, err)
+
+	if action == errorActionRetry {
+		scheduleSiteRetry(site)
+	}
+}
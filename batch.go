@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BatchJob is a configuration file of the batch, crawled by its own process with the settings of the job
+type BatchJob struct {
+	Name              string
+	ConfigurationFile string
+	Configuration     *ConfigurationFile
+	Settings          []string
+	Args              []string
+	Duration          time.Duration
+	Err               error
+}
+
+// batchSharedState is a setting of the jobs that can't have the same value in the jobs that run at the same time,
+// like a managed Tor data dir. The jobs that share it get the value of the job, when it can be derived, as a setting
+// or as a flag
+type batchSharedState struct {
+	path   string
+	value  string
+	flag   bool
+	derive func(job *BatchJob) string
+}
+
+// lineWriter writes the output of a job with its name at the start of each line, the lines of the jobs are not
+// mixed since they are written whole
+type lineWriter struct {
+	prefix string
+	output io.Writer
+	mutex  *sync.Mutex
+	buffer []byte
+}
+
+func (writer *lineWriter) Write(data []byte) (int, error) {
+	writer.buffer = append(writer.buffer, data...)
+
+	for {
+		index := bytes.IndexByte(writer.buffer, '\n')
+
+		if index < 0 {
+			return len(data), nil
+		}
+
+		writer.mutex.Lock()
+		_, err := fmt.Fprintf(writer.output, "%s%s\n", writer.prefix, writer.buffer[:index])
+		writer.mutex.Unlock()
+
+		writer.buffer = writer.buffer[index+1:]
+
+		if err != nil {
+			return len(data), err
+		}
+	}
+}
+
+func (writer *lineWriter) Flush() {
+	if len(writer.buffer) > 0 {
+		writer.Write([]byte("\n"))
+	}
+}
+
+func runBatchCommand(args []string) {
+	flags := flag.NewFlagSet("batch", flag.ExitOnError)
+	parallel := flags.Int("parallel", 1, "crawl this number of configuration files at the same time")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 || *parallel < 1 {
+		fmt.Printf("Usage : %s batch [-parallel n] <configuration directory or glob> [crawl flags] \n", os.Args[0])
+		os.Exit(exitCodeConfigError)
+	}
+
+	jobs, err := getBatchJobs(flags.Arg(0))
+
+	if err != nil {
+		fmt.Println("Unable to get batch configuration files:", err)
+		os.Exit(exitCodeConfigError)
+	}
+
+	if len(jobs) == 0 {
+		fmt.Println("No configuration file found:", flags.Arg(0))
+		os.Exit(exitCodeConfigError)
+	}
+
+	executable, err := os.Executable()
+
+	if err != nil {
+		fmt.Println("Unable to get crawler executable:", err)
+		os.Exit(exitCodeError)
+	}
+
+	loadBatchJobConfigurations(jobs)
+
+	// the jobs that run at the same time can't share the state of the crawl
+	if *parallel > 1 {
+		if err := isolateBatchJobs(jobs, flags.Args()[1:]); err != nil {
+			fmt.Println("Unable to run jobs at the same time:", err)
+			os.Exit(exitCodeConfigError)
+		}
+	}
+
+	fmt.Println(fmt.Sprintf("Running %d jobs, %d at a time...", len(jobs), *parallel))
+
+	var outputMutex sync.Mutex
+	var waitGroup sync.WaitGroup
+	slots := make(chan bool, *parallel)
+
+	for _, job := range jobs {
+		slots <- true
+		waitGroup.Add(1)
+
+		go func(job *BatchJob) {
+			defer waitGroup.Done()
+			defer func() { <-slots }()
+
+			runBatchJob(executable, job, flags.Args()[1:], &outputMutex)
+		}(job)
+	}
+
+	waitGroup.Wait()
+	failed := printBatchSummary(jobs)
+
+	// the batch fails like a crawl, when some or all of its jobs failed
+	if failed == len(jobs) {
+		os.Exit(exitCodeTotalFailure)
+	} else if failed > 0 {
+		os.Exit(exitCodePartialFailure)
+	}
+}
+
+// getBatchJobs returns the jobs of the json files of the directory or of the files matched by the glob
+func getBatchJobs(pattern string) ([]*BatchJob, error) {
+	if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+		pattern = filepath.Join(pattern, "*.json")
+	}
+
+	fileNames, err := filepath.Glob(pattern)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(fileNames)
+	result := []*BatchJob{}
+
+	for _, fileName := range fileNames {
+		name := strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
+		result = append(result, &BatchJob{Name: name, ConfigurationFile: fileName})
+	}
+
+	return result, nil
+}
+
+// loadBatchJobConfigurations reads the configuration files of the jobs, the jobs without output dir are saved to a
+// dir of their own, named by the configuration file. The jobs that can't be read fail without running
+func loadBatchJobConfigurations(jobs []*BatchJob) {
+	for _, job := range jobs {
+		content, err := ioutil.ReadFile(job.ConfigurationFile)
+
+		if err == nil {
+			job.Configuration, err = parseConfiguration(content)
+		}
+
+		if err != nil {
+			job.Err = err
+			fmt.Println("Unable to read batch configuration file:", job.ConfigurationFile, err)
+			continue
+		}
+
+		if job.Configuration.OutputDir == "" {
+			job.Settings = append(job.Settings, "output_dir=sites"+string(filepath.Separator)+"${CONFIG_NAME}")
+		}
+	}
+}
+
+// isolateBatchJobs gives the jobs that run at the same time their own managed Tor data dir, control socket, frontier
+// run, output dir, audit log and events file. The state that can't be derived for each job, like a sqlite database
+// or the fixed ports of a managed Tor, returns an error when jobs share it
+func isolateBatchJobs(jobs []*BatchJob, crawlArgs []string) error {
+	states := map[string][]*BatchJob{}
+	sharedStates := []*batchSharedState{}
+
+	share := func(job *BatchJob, state *batchSharedState) {
+		key := state.path + "=" + state.value
+
+		if _, exists := states[key]; !exists {
+			sharedStates = append(sharedStates, state)
+		}
+
+		states[key] = append(states[key], job)
+	}
+
+	for _, job := range jobs {
+		config := job.Configuration
+
+		if config == nil || job.Err != nil {
+			continue
+		}
+
+		if config.ManagedTor != nil && config.ManagedTor.Enabled {
+			managedTorConfig := config.ManagedTor
+
+			// the ephemeral runs have their own dirs inside the data dir
+			if managedTorConfig.DataDir == "" {
+				share(job, &batchSharedState{path: "managed_tor.data_dir", value: defaultTorDataDirName, derive: func(job *BatchJob) string {
+					return defaultTorDataDirName + string(filepath.Separator) + job.Name
+				}})
+			} else if !managedTorConfig.Ephemeral {
+				dataDir, _ := filepath.Abs(managedTorConfig.DataDir)
+				share(job, &batchSharedState{path: "managed_tor.data_dir", value: dataDir})
+			}
+
+			if managedTorConfig.SocksPort > 0 {
+				share(job, &batchSharedState{path: "managed_tor.socks_port", value: strconv.Itoa(managedTorConfig.SocksPort)})
+			}
+
+			if managedTorConfig.ControlPort > 0 {
+				share(job, &batchSharedState{path: "managed_tor.control_port", value: strconv.Itoa(managedTorConfig.ControlPort)})
+			}
+		}
+
+		if controlSocket := config.ControlSocket; controlSocket != "" {
+			state := &batchSharedState{path: "control_socket", value: controlSocket}
+
+			if getControlNetwork(controlSocket) == "unix" {
+				state.derive = func(job *BatchJob) string {
+					return getBatchJobFileName(controlSocket, job)
+				}
+			}
+
+			share(job, state)
+		}
+
+		// the variables of the output dir can make it different for each job
+		if outputDir := config.OutputDir; outputDir != "" && !strings.Contains(outputDir, "${") {
+			absOutputDir, _ := filepath.Abs(outputDir)
+			share(job, &batchSharedState{path: "output_dir", value: absOutputDir, derive: func(job *BatchJob) string {
+				return outputDir + string(filepath.Separator) + job.Name
+			}})
+		}
+
+		if networkPolicyConfig := config.NetworkPolicy; networkPolicyConfig != nil && networkPolicyConfig.AuditLog != "" {
+			auditLog := networkPolicyConfig.AuditLog
+			absAuditLog, _ := filepath.Abs(auditLog)
+			share(job, &batchSharedState{path: "network_policy.audit_log", value: absAuditLog, derive: func(job *BatchJob) string {
+				return getBatchJobFileName(auditLog, job)
+			}})
+		}
+
+		// the events file is a flag of the batch, so every job has it
+		if eventsFileName := getFlagValue(crawlArgs, "events-file"); eventsFileName != "" && eventsFileName != "-" {
+			absEventsFileName, _ := filepath.Abs(eventsFileName)
+			share(job, &batchSharedState{path: "events-file", value: absEventsFileName, flag: true, derive: func(job *BatchJob) string {
+				return getBatchJobFileName(eventsFileName, job)
+			}})
+		}
+
+		// the variables of the dsn can make it different for each job
+		if config.Database != nil && config.Database.DSN != "" && config.Database.Driver != storageDriverPostgres && !strings.Contains(config.Database.DSN, "${") {
+			share(job, &batchSharedState{path: "database.dsn", value: config.Database.DSN})
+		}
+
+		if frontierConfig := config.Frontier; frontierConfig != nil && frontierConfig.Redis != "" {
+			share(job, &batchSharedState{path: "frontier.run_id", value: frontierConfig.Redis + " " + frontierConfig.RunID, derive: func(job *BatchJob) string {
+				return frontierConfig.RunID + "-" + job.Name
+			}})
+		}
+	}
+
+	for _, state := range sharedStates {
+		sharingJobs := states[state.path+"="+state.value]
+
+		if len(sharingJobs) < 2 {
+			continue
+		}
+
+		if state.derive == nil {
+			names := []string{}
+
+			for _, job := range sharingJobs {
+				names = append(names, job.Name)
+			}
+
+			return fmt.Errorf("the jobs %s share the %s %s, set one for each job or use -parallel 1", strings.Join(names, ", "), state.path, state.value)
+		}
+
+		for _, job := range sharingJobs {
+			if state.flag {
+				job.Args = append(job.Args, "-"+state.path, state.derive(job))
+			} else {
+				job.Settings = append(job.Settings, state.path+"="+state.derive(job))
+			}
+		}
+	}
+
+	return nil
+}
+
+// getBatchJobFileName returns the file name with the job name after its name, like "audit-forums.log"
+func getBatchJobFileName(fileName string, job *BatchJob) string {
+	return strings.TrimSuffix(fileName, filepath.Ext(fileName)) + "-" + job.Name + filepath.Ext(fileName)
+}
+
+// getFlagValue returns the last value of the flag in the args, given as "-name value" or "-name=value"
+func getFlagValue(args []string, name string) string {
+	value := ""
+
+	for i, arg := range args {
+		arg = strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+
+		if arg == name && i+1 < len(args) {
+			value = args[i+1]
+		} else if strings.HasPrefix(arg, name+"=") {
+			value = strings.TrimPrefix(arg, name+"=")
+		}
+	}
+
+	return value
+}
+
+// getBatchJobArgs returns the crawl flags of the job, with the settings of the job before them so the flags of
+// the batch still override them, and the flags of the job after them
+func getBatchJobArgs(job *BatchJob, crawlArgs []string) []string {
+	args := []string{}
+
+	for _, setting := range job.Settings {
+		args = append(args, "-set", setting)
+	}
+
+	args = append(args, crawlArgs...)
+
+	return append(args, job.Args...)
+}
+
+// runBatchJob crawls the configuration file in a new process, so the jobs don't share state
+func runBatchJob(executable string, job *BatchJob, crawlArgs []string, outputMutex *sync.Mutex) {
+	if job.Err != nil {
+		return
+	}
+
+	args := getBatchJobArgs(job, crawlArgs)
+
+	stdout := &lineWriter{prefix: "[" + job.Name + "] ", output: os.Stdout, mutex: outputMutex}
+	stderr := &lineWriter{prefix: "[" + job.Name + "] ", output: os.Stderr, mutex: outputMutex}
+
+	command := exec.Command(executable, append(args, job.ConfigurationFile)...)
+	command.Stdout = stdout
+	command.Stderr = stderr
+
+	startedAt := time.Now()
+	job.Err = command.Run()
+	job.Duration = time.Since(startedAt)
+
+	stdout.Flush()
+	stderr.Flush()
+}
+
+func printBatchSummary(jobs []*BatchJob) int {
+	fmt.Println("")
+	fmt.Println("Batch summary:")
+
+	failed := 0
+
+	for _, job := range jobs {
+		status := "OK"
+
+		if job.Err != nil {
+			status = "FAILED (" + job.Err.Error() + ")"
+			failed++
+		}
+
+		fmt.Println(fmt.Sprintf("  %s: %s in %s", job.Name, status, job.Duration.Round(time.Second)))
+	}
+
+	fmt.Println(fmt.Sprintf("%d of %d jobs completed", len(jobs)-failed, len(jobs)))
+
+	return failed
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const diskSpaceCheckInterval = 30 * time.Second
+
+var crawledBytes int64
+
+func isCrawlBudgetExceeded() bool {
+	return configuration.MaxCrawlBytes > 0 && crawledBytes >= configuration.MaxCrawlBytes
+}
+
+func isSiteBudgetExceeded(site *Site, siteBytes int64) bool {
+	return site.MaxBytes > 0 && siteBytes >= site.MaxBytes
+}
+
+// getRemainingBudget returns the bytes the site can still download by the site and the crawl budgets, and if it has
+// a budget
+func getRemainingBudget(site *Site, siteBytes int64) (int64, bool) {
+	remaining := int64(0)
+	hasBudget := false
+
+	if site.MaxBytes > 0 {
+		remaining = site.MaxBytes - siteBytes
+		hasBudget = true
+	}
+
+	if configuration.MaxCrawlBytes > 0 {
+		crawlRemaining := configuration.MaxCrawlBytes - crawledBytes
+
+		if !hasBudget || crawlRemaining < remaining {
+			remaining = crawlRemaining
+		}
+
+		hasBudget = true
+	}
+
+	return remaining, hasBudget
+}
+
+// getAssetReservation returns the bytes of the budget reserved for an asset download. The assets are at most
+// "max_asset_bytes", without it an asset can use all the remaining budget
+func getAssetReservation(remaining int64) int64 {
+	if configuration.MaxAssetBytes > 0 && configuration.MaxAssetBytes < remaining {
+		return configuration.MaxAssetBytes
+	}
+
+	return remaining
+}
+
+// waitForFreeDiskSpace pauses the crawl while the free space of the directory is below the configured minimum
+func waitForFreeDiskSpace(dir string) {
+	if configuration.MinFreeDiskSpace <= 0 {
+		return
+	}
+
+	notified := false
+
+	for {
+		freeSpace, err := getFreeDiskSpace(dir)
+
+		if err != nil {
+			printError("Unable to get free disk space:", err)
+			return
+		}
+
+		if freeSpace >= uint64(configuration.MinFreeDiskSpace) {
+			if notified {
+				printInfo("Free disk space is available again, resuming...")
+			}
+
+			return
+		}
+
+		if !notified {
+			printInfo(fmt.Sprintf("Free disk space is below %s (%s free), pausing...", formatBytes(configuration.MinFreeDiskSpace), formatBytes(int64(freeSpace))))
+			emitEvent("disk_space_low", nil, "", nil, map[string]interface{}{"free_bytes": freeSpace})
+			notified = true
+		}
+
+		time.Sleep(diskSpaceCheckInterval)
+	}
+}
+
+func printTruncatedSites() {
+	truncatedSites := []*Site{}
+
+	for _, site := range configuration.Sites {
+		if site.Truncated {
+			truncatedSites = append(truncatedSites, site)
+		}
+	}
+
+	if len(truncatedSites) == 0 {
+		return
+	}
+
+	printInfo(fmt.Sprintf("%d sites were truncated by the byte budget:", len(truncatedSites)))
+
+	for _, site := range truncatedSites {
+		printInfo("  " + site.URL)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const bundlesDirName = "bundles"
+
+const bundleExtension = ".sqlite"
+
+var bundleSchema = []string{
+	`CREATE TABLE metadata (name TEXT PRIMARY KEY, value TEXT NOT NULL)`,
+	`CREATE TABLE pages (
+		url TEXT NOT NULL,
+		path TEXT PRIMARY KEY,
+		content_type TEXT,
+		fetched_at TEXT,
+		size INTEGER NOT NULL,
+		sha256 TEXT NOT NULL,
+		content BLOB NOT NULL
+	)`,
+	`CREATE INDEX pages_url ON pages (url)`,
+	`CREATE TABLE files (
+		path TEXT PRIMARY KEY,
+		modified_at TEXT,
+		size INTEGER NOT NULL,
+		sha256 TEXT NOT NULL,
+		content BLOB NOT NULL
+	)`,
+}
+
+func getBundleFileName(bundlesDir string, site *Site) string {
+	return filepath.Join(bundlesDir, getSiteDirName(site)+bundleExtension)
+}
+
+// saveSiteBundle packs the archived files of the site into a sqlite file: the pages table has the pages, images,
+// frames and feed entries by their url, the files table has the other files of the site dir, like the metadata,
+// and the metadata table has the site metadata. The snapshots are not packed. The bundle is written to a temporary
+// file and renamed, so a bundle is never left incomplete
+func saveSiteBundle(site *Site, siteDir string, bundleFileName string) (int, error) {
+	if err := os.MkdirAll(filepath.Dir(bundleFileName), dirMode); err != nil {
+		return 0, err
+	}
+
+	temporaryFileName := bundleFileName + ".tmp"
+	os.Remove(temporaryFileName)
+
+	totalOfFiles, err := writeSiteBundle(site, siteDir, temporaryFileName)
+
+	if err != nil {
+		os.Remove(temporaryFileName)
+		return 0, err
+	}
+
+	return totalOfFiles, os.Rename(temporaryFileName, bundleFileName)
+}
+
+func writeSiteBundle(site *Site, siteDir string, fileName string) (int, error) {
+	db, err := sql.Open("sqlite3", fileName)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer db.Close()
+
+	tx, err := db.Begin()
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	for _, statement := range bundleSchema {
+		if _, err := tx.Exec(statement); err != nil {
+			return 0, err
+		}
+	}
+
+	siteJSON, err := json.Marshal(site)
+
+	if err != nil {
+		return 0, err
+	}
+
+	metadata := map[string]string{
+		"site_url":   site.URL,
+		"site":       string(siteJSON),
+		"created_at": crawlerClock.Now().UTC().Format(time.RFC3339),
+	}
+
+	for name, value := range metadata {
+		if _, err := tx.Exec(`INSERT INTO metadata (name, value) VALUES (?, ?)`, name, value); err != nil {
+			return 0, err
+		}
+	}
+
+	totalOfFiles := 0
+	packedFiles := map[string]bool{}
+
+	for _, resource := range getCDXResources([]*Site{site}, filepath.Dir(siteDir)) {
+		relativePath, err := filepath.Rel(siteDir, resource.FileName)
+
+		if err != nil {
+			return 0, err
+		}
+
+		relativePath = filepath.ToSlash(relativePath)
+
+		if packedFiles[relativePath] {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(resource.FileName)
+
+		if err != nil {
+			return 0, err
+		}
+
+		hash := sha256.Sum256(content)
+
+		_, err = tx.Exec(`INSERT INTO pages (url, path, content_type, fetched_at, size, sha256, content) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			resource.URL, relativePath, resource.ContentType, resource.Time.Format(time.RFC3339), len(content), fmt.Sprintf("%x", hash), content)
+
+		if err != nil {
+			return 0, err
+		}
+
+		packedFiles[relativePath] = true
+		totalOfFiles++
+	}
+
+	err = filepath.Walk(siteDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(siteDir, path)
+
+		if err != nil {
+			return err
+		}
+
+		relativePath = filepath.ToSlash(relativePath)
+
+		if info.IsDir() {
+			if relativePath == snapshotsDirName {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if packedFiles[relativePath] {
+			return nil
+		}
+
+		content, err := ioutil.ReadFile(path)
+
+		if err != nil {
+			return err
+		}
+
+		hash := sha256.Sum256(content)
+
+		_, err = tx.Exec(`INSERT INTO files (path, modified_at, size, sha256, content) VALUES (?, ?, ?, ?, ?)`,
+			relativePath, info.ModTime().UTC().Format(time.RFC3339), len(content), fmt.Sprintf("%x", hash), content)
+
+		if err != nil {
+			return err
+		}
+
+		totalOfFiles++
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return totalOfFiles, tx.Commit()
+}
+
+func runExportBundleCommand(args []string) {
+	flags := flag.NewFlagSet("export-bundle", flag.ExitOnError)
+	flags.Parse(args)
+
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		fmt.Printf("Usage : %s export-bundle <configuration file> [export dir] \n", os.Args[0])
+		os.Exit(exitCodeConfigError)
+	}
+
+	configurationFileName = flags.Arg(0)
+
+	loadConfigurationFile()
+
+	currentDir, err := os.Getwd()
+
+	if err != nil {
+		fmt.Println("Unable to get current directory:", err)
+		os.Exit(exitCodeError)
+	}
+
+	outputDir := getOutputDir(currentDir)
+	exportDir := outputDir + string(filepath.Separator) + bundlesDirName
+
+	if flags.NArg() == 2 {
+		exportDir = flags.Arg(1)
+	}
+
+	totalOfBundles := 0
+	failedBundles := 0
+
+	for _, site := range configuration.Sites {
+		siteDir := outputDir + string(filepath.Separator) + getSiteDirName(site)
+
+		if _, err := os.Stat(siteDir); os.IsNotExist(err) {
+			continue
+		}
+
+		bundleFileName := getBundleFileName(exportDir, site)
+		files, err := saveSiteBundle(site, siteDir, bundleFileName)
+
+		if err != nil {
+			fmt.Println("Unable to export site bundle:", site.URL, err)
+			failedBundles++
+			continue
+		}
+
+		fmt.Println(fmt.Sprintf("%s - %d files packed to %s", site.URL, files, bundleFileName))
+		totalOfBundles++
+	}
+
+	fmt.Println(fmt.Sprintf("Exported %d site bundles to %s", totalOfBundles, exportDir))
+
+	if failedBundles > 0 {
+		os.Exit(exitCodeError)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var defaultIgnoredQueryParams = []string{"ref", "utm_source", "utm_medium", "utm_campaign", "utm_term", "utm_content"}
+
+func normalizeURL(rawURL string) string {
+	parsedURL, err := url.Parse(strings.TrimSpace(rawURL))
+
+	if err != nil {
+		return rawURL
+	}
+
+	parsedURL.Scheme = strings.ToLower(parsedURL.Scheme)
+	parsedURL.Host = strings.ToLower(parsedURL.Host)
+	parsedURL.Fragment = ""
+	parsedURL.RawFragment = ""
+
+	// default ports are the same url
+	if (parsedURL.Scheme == "http" && parsedURL.Port() == "80") || (parsedURL.Scheme == "https" && parsedURL.Port() == "443") {
+		parsedURL.Host = parsedURL.Hostname()
+	}
+
+	// trailing slashes are ignored, except for the root path
+	parsedURL.Path = strings.TrimRight(parsedURL.Path, "/")
+	parsedURL.RawPath = ""
+
+	if parsedURL.Path == "" {
+		parsedURL.Path = "/"
+	}
+
+	// tracking params are removed and the others sorted
+	query := parsedURL.Query()
+
+	for key := range query {
+		if isIgnoredQueryParam(key) {
+			query.Del(key)
+		}
+	}
+
+	keys := []string{}
+
+	for key := range query {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	params := []string{}
+
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+
+		for _, value := range values {
+			params = append(params, url.QueryEscape(key)+"="+url.QueryEscape(value))
+		}
+	}
+
+	parsedURL.RawQuery = strings.Join(params, "&")
+	parsedURL.ForceQuery = false
+
+	return parsedURL.String()
+}
+
+func isIgnoredQueryParam(key string) bool {
+	ignoredQueryParams := defaultIgnoredQueryParams
+
+	if configuration.IgnoredQueryParams != nil {
+		ignoredQueryParams = configuration.IgnoredQueryParams
+	}
+
+	for _, ignoredQueryParam := range ignoredQueryParams {
+		if strings.EqualFold(ignoredQueryParam, key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func getContentHash(content []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(content))
+}
+
+// getSiteRequestHash returns a short hash of the method, content type and body of the request of the site, the
+// sites fetched with a plain GET have none
+func getSiteRequestHash(site *Site) string {
+	if (site.Method == "" || site.Method == "GET") && site.Body == "" {
+		return ""
+	}
+
+	return getContentHash([]byte(site.Method + "\n" + site.ContentType + "\n" + site.Body))[:12]
+}
+
+// getSiteKey returns the identity of the site, its normalized url and the hash of its request, so the POST
+// requests of one url with different bodies are different sites
+func getSiteKey(site *Site) string {
+	if requestHash := getSiteRequestHash(site); requestHash != "" {
+		return normalizeURL(site.URL) + "#" + requestHash
+	}
+
+	return normalizeURL(site.URL)
+}
+
+// getDuplicatedSites returns the sites whose identity was already used by a previous site, with the url of the
+// first one
+func getDuplicatedSites(sites []*Site) map[*Site]string {
+	result := map[*Site]string{}
+	visited := map[string]string{}
+
+	for _, site := range sites {
+		siteKey := getSiteKey(site)
+
+		if firstURL, exists := visited[siteKey]; exists {
+			result[site] = firstURL
+			continue
+		}
+
+		visited[siteKey] = site.URL
+	}
+
+	return result
+}
+
+// getContentHashes returns the content hash of every site that isn't a duplicate
+func getContentHashes(sites []*Site) map[string]string {
+	result := map[string]string{}
+
+	for _, site := range sites {
+		if site.ContentHash == "" || site.DuplicateOf != "" {
+			continue
+		}
+
+		if _, exists := result[site.ContentHash]; !exists {
+			result[site.ContentHash] = site.URL
+		}
+	}
+
+	return result
+}
+
+// getCanonicalURLFromDocument returns the absolute url of the canonical link of the page
+func getCanonicalURLFromDocument(doc *goquery.Document, pageURL string) string {
+	href := strings.TrimSpace(doc.Find("link[rel~=canonical][href]").First().AttrOr("href", ""))
+
+	if href == "" {
+		return ""
+	}
+
+	baseURL, err := url.Parse(pageURL)
+
+	if err != nil {
+		return ""
+	}
+
+	canonicalURL, err := baseURL.Parse(href)
+
+	if err != nil {
+		return ""
+	}
+
+	return canonicalURL.String()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const defaultCategoryTitleWeight = 3
+
+// CategoryRule assigns the category to the sites whose title and text have enough of its keywords, each
+// keyword found in the text adds 1 to the score and each keyword found in the title adds the title weight
+type CategoryRule struct {
+	Name        string   `json:"name"`
+	Keywords    []string `json:"keywords"`
+	MinScore    int      `json:"min_score,omitempty"`
+	TitleWeight int      `json:"title_weight,omitempty"`
+}
+
+// getCategoriesFromDocument returns the categories of the page sorted by score, the best category first
+func getCategoriesFromDocument(doc *goquery.Document, rules []*CategoryRule) []string {
+	result := []string{}
+
+	if len(rules) == 0 {
+		return result
+	}
+
+	title := getCategoryText(doc.Find("title").Text())
+	text := getCategoryText(getVisibleText(doc.Find("body")))
+	scores := map[string]int{}
+
+	for _, rule := range rules {
+		score := getCategoryScore(rule, title, text)
+		minScore := rule.MinScore
+
+		if minScore <= 0 {
+			minScore = 1
+		}
+
+		if score >= minScore && score > scores[rule.Name] {
+			if _, exists := scores[rule.Name]; !exists {
+				result = append(result, rule.Name)
+			}
+
+			scores[rule.Name] = score
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return scores[result[i]] > scores[result[j]]
+	})
+
+	return result
+}
+
+func getCategoryScore(rule *CategoryRule, title string, text string) int {
+	score := 0
+	titleWeight := rule.TitleWeight
+
+	if titleWeight <= 0 {
+		titleWeight = defaultCategoryTitleWeight
+	}
+
+	for _, keyword := range rule.Keywords {
+		keyword = getCategoryText(keyword)
+
+		if keyword == " " {
+			continue
+		}
+
+		if strings.Contains(title, keyword) {
+			score += titleWeight
+		}
+
+		if strings.Contains(text, keyword) {
+			score++
+		}
+	}
+
+	return score
+}
+
+// getCategoryText returns the lowercase words of the text separated by one space and with spaces around, so
+// keywords only match whole words
+func getCategoryText(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	return " " + strings.Join(words, " ") + " "
+}
+
+// getCategorySummary prints the number of sites of each category and returns them for the crawl summary
+func getCategorySummary(sites []*Site) map[string]int {
+	result := map[string]int{}
+
+	for _, site := range sites {
+		for _, category := range site.Categories {
+			result[category]++
+		}
+	}
+
+	names := []string{}
+
+	for name := range result {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		printInfo(fmt.Sprintf("Category %s - %d sites", name, result[name]))
+	}
+
+	return result
+}
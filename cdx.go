@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	cdxFormatCDX  = "cdx"
+	cdxFormatCDXJ = "cdxj"
+)
+
+const cdxTimestampLayout = "20060102150405"
+
+const cdxExportDirName = "cdx"
+
+// the dirs of a pywb collection, the exported dir can be copied to the collections dir of pywb
+const (
+	cdxArchiveDirName = "archive"
+	cdxIndexesDirName = "indexes"
+)
+
+// CDXResource is an archived file with the url it was fetched from
+type CDXResource struct {
+	URL         string
+	FileName    string
+	ContentType string
+	Time        time.Time
+}
+
+// CDXRecord is a line of the index, pointing to the record of the resource in the warc file
+type CDXRecord struct {
+	URLKey    string
+	Timestamp string
+	URL       string
+	Mime      string
+	Status    string
+	Digest    string
+	Length    int64
+	Offset    int64
+	FileName  string
+}
+
+// countingWriter counts the bytes written to the warc file, the offsets of the records are positions in it
+type countingWriter struct {
+	writer io.Writer
+	count  int64
+}
+
+func (writer *countingWriter) Write(data []byte) (int, error) {
+	count, err := writer.writer.Write(data)
+	writer.count += int64(count)
+	return count, err
+}
+
+// getCDXResources returns the archived files of the sites: the site pages, pages, images, frames and feed entries
+func getCDXResources(sites []*Site, outputDir string) []*CDXResource {
+	result := []*CDXResource{}
+
+	for _, site := range sites {
+		siteDir := outputDir + string(filepath.Separator) + getSiteDirName(site) + string(filepath.Separator)
+
+		add := func(resourceURL string, fileName string, contentType string, fetchedAt time.Time) {
+			fileName = siteDir + filepath.FromSlash(fileName)
+			info, err := os.Stat(fileName)
+
+			if err != nil || info.IsDir() {
+				return
+			}
+
+			if contentType == "" {
+				contentType = mime.TypeByExtension(filepath.Ext(fileName))
+			}
+
+			if fetchedAt.IsZero() {
+				fetchedAt = info.ModTime()
+			}
+
+			result = append(result, &CDXResource{URL: resourceURL, FileName: fileName, ContentType: contentType, Time: fetchedAt.UTC()})
+		}
+
+		if site.FetchSuccess && site.API == nil {
+			add(site.URL, "index.html", "text/html; charset=utf-8", time.Time{})
+		}
+
+		for _, page := range site.Pages {
+			if page.FetchSuccess && !strings.HasSuffix(page.FileName, quarantineSuffix) {
+				add(page.URL, page.FileName, getPageContentType(page), page.FetchedAt)
+			}
+		}
+
+		for _, image := range site.Images {
+			if image.FetchSuccess && !image.Quarantined && image.DataURI == "" {
+				add(site.URL+"/"+image.URL, image.URL, image.ContentType, time.Time{})
+			}
+		}
+
+		for _, frame := range site.Frames {
+			if frame.FetchSuccess {
+				add(frame.URL, frame.FileName, "text/html; charset=utf-8", time.Time{})
+			}
+		}
+
+		for _, feed := range site.Feeds {
+			for _, entry := range feed.Entries {
+				if entry.FetchSuccess {
+					add(entry.URL, entry.FileName, "text/html; charset=utf-8", time.Time{})
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// getPageContentType returns the type of the saved page, the html pages are saved in utf-8
+func getPageContentType(page *Page) string {
+	if isHTMLContentType(page.ContentType) {
+		return "text/html; charset=utf-8"
+	}
+
+	return page.ContentType
+}
+
+// getSURT returns the sort-friendly url key of the cdx index, like onion,example)/path?query
+func getSURT(rawURL string) string {
+	parsedURL, err := url.Parse(rawURL)
+
+	if err != nil || parsedURL.Host == "" {
+		return strings.ToLower(rawURL)
+	}
+
+	hostParts := strings.Split(strings.TrimPrefix(strings.ToLower(parsedURL.Hostname()), "www."), ".")
+
+	for i, j := 0, len(hostParts)-1; i < j; i, j = i+1, j-1 {
+		hostParts[i], hostParts[j] = hostParts[j], hostParts[i]
+	}
+
+	result := strings.Join(hostParts, ",")
+
+	if port := parsedURL.Port(); port != "" && !(parsedURL.Scheme == "http" && port == "80") && !(parsedURL.Scheme == "https" && port == "443") {
+		result += ":" + port
+	}
+
+	path := parsedURL.EscapedPath()
+
+	if path == "" {
+		path = "/"
+	}
+
+	result += ")" + path
+
+	if parsedURL.RawQuery != "" {
+		query := strings.Split(parsedURL.RawQuery, "&")
+		sort.Strings(query)
+		result += "?" + strings.Join(query, "&")
+	}
+
+	return strings.ToLower(result)
+}
+
+// writeWARCRecord writes the record as its own gzip member, so each record can be read from its offset
+func writeWARCRecord(output *countingWriter, header []string, block []byte) (int64, error) {
+	offset := output.count
+	writer := gzip.NewWriter(output)
+
+	header = append([]string{"WARC/1.0"}, header...)
+	header = append(header, "Content-Length: "+strconv.Itoa(len(block)))
+
+	writer.Write([]byte(strings.Join(header, "\r\n") + "\r\n\r\n"))
+	writer.Write(block)
+	writer.Write([]byte("\r\n\r\n"))
+
+	if err := writer.Close(); err != nil {
+		return 0, err
+	}
+
+	return output.count - offset, nil
+}
+
+func getWARCRecordID() string {
+	data := make([]byte, 16)
+	rand.Read(data)
+
+	// version 4 uuid
+	data[6] = (data[6] & 0x0f) | 0x40
+	data[8] = (data[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", data[0:4], data[4:6], data[6:8], data[8:10], data[10:16])
+}
+
+func getWARCDigest(content []byte) string {
+	hash := sha1.Sum(content)
+	return "sha1:" + base32.StdEncoding.EncodeToString(hash[:])
+}
+
+// exportWARC writes the resources to a warc file as response records, with a http response made of the archived
+// file and its content type, and returns the cdx records of the resources
+func exportWARC(resources []*CDXResource, warcFileName string) ([]*CDXRecord, error) {
+	file, err := createFile(warcFileName, fileMode)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	output := &countingWriter{writer: file}
+	info := []byte("software: go-tor-crawler\r\nformat: WARC File Format 1.0\r\n")
+
+	_, err = writeWARCRecord(output, []string{
+		"WARC-Type: warcinfo",
+		"WARC-Record-ID: " + getWARCRecordID(),
+		"WARC-Date: " + time.Now().UTC().Format(time.RFC3339),
+		"WARC-Filename: " + filepath.Base(warcFileName),
+		"Content-Type: application/warc-fields",
+	}, info)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*CDXRecord{}
+
+	for _, resource := range resources {
+		content, err := ioutil.ReadFile(resource.FileName)
+
+		if err != nil {
+			printError("Unable to read archived file:", err)
+			continue
+		}
+
+		var block bytes.Buffer
+		block.WriteString("HTTP/1.1 200 OK\r\n")
+
+		if resource.ContentType != "" {
+			block.WriteString("Content-Type: " + resource.ContentType + "\r\n")
+		}
+
+		block.WriteString("Content-Length: " + strconv.Itoa(len(content)) + "\r\n\r\n")
+		block.Write(content)
+
+		digest := getWARCDigest(content)
+		offset := output.count
+
+		length, err := writeWARCRecord(output, []string{
+			"WARC-Type: response",
+			"WARC-Record-ID: " + getWARCRecordID(),
+			"WARC-Date: " + resource.Time.Format(time.RFC3339),
+			"WARC-Target-URI: " + resource.URL,
+			"WARC-Payload-Digest: " + digest,
+			"Content-Type: application/http; msgtype=response",
+		}, block.Bytes())
+
+		if err != nil {
+			return nil, err
+		}
+
+		mimeType := strings.TrimSpace(strings.Split(resource.ContentType, ";")[0])
+
+		if mimeType == "" {
+			mimeType = "unk"
+		}
+
+		result = append(result, &CDXRecord{
+			URLKey:    getSURT(resource.URL),
+			Timestamp: resource.Time.Format(cdxTimestampLayout),
+			URL:       resource.URL,
+			Mime:      mimeType,
+			Status:    "200",
+			Digest:    strings.TrimPrefix(digest, "sha1:"),
+			Length:    length,
+			Offset:    offset,
+			FileName:  filepath.Base(warcFileName),
+		})
+	}
+
+	return result, file.Close()
+}
+
+// getCDXLine returns the record in the format of the index: the 11 fields of the cdx format of OpenWayback, or
+// the json fields of the cdxj format of pywb
+func getCDXLine(record *CDXRecord, format string) (string, error) {
+	if format == cdxFormatCDX {
+		return strings.Join([]string{record.URLKey, record.Timestamp, record.URL, record.Mime, record.Status, record.Digest, "-", "-", strconv.FormatInt(record.Length, 10), strconv.FormatInt(record.Offset, 10), record.FileName}, " "), nil
+	}
+
+	fields, err := json.Marshal(map[string]string{
+		"url":      record.URL,
+		"mime":     record.Mime,
+		"status":   record.Status,
+		"digest":   record.Digest,
+		"length":   strconv.FormatInt(record.Length, 10),
+		"offset":   strconv.FormatInt(record.Offset, 10),
+		"filename": record.FileName,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return record.URLKey + " " + record.Timestamp + " " + string(fields), nil
+}
+
+// writeCDXIndex writes the records sorted by url key and timestamp, like the indexes of the wayback tools
+func writeCDXIndex(records []*CDXRecord, fileName string, format string) error {
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].URLKey != records[j].URLKey {
+			return records[i].URLKey < records[j].URLKey
+		}
+
+		return records[i].Timestamp < records[j].Timestamp
+	})
+
+	content := []string{}
+
+	if format == cdxFormatCDX {
+		content = append(content, " CDX N b a m s k r M S V g")
+	}
+
+	for _, record := range records {
+		line, err := getCDXLine(record, format)
+
+		if err != nil {
+			return err
+		}
+
+		content = append(content, line)
+	}
+
+	return writeFile(fileName, []byte(strings.Join(content, "\n")+"\n"), fileMode)
+}
+
+func runExportCDXCommand(args []string) {
+	flags := flag.NewFlagSet("export-cdx", flag.ExitOnError)
+	format := flags.String("format", cdxFormatCDXJ, "format of the index (cdxj, cdx)")
+	collection := flags.String("collection", "onion", "name of the warc and index files")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 || flags.NArg() > 2 || (*format != cdxFormatCDX && *format != cdxFormatCDXJ) {
+		fmt.Printf("Usage : %s export-cdx [-format cdxj|cdx] [-collection name] <configuration file> [export dir] \n", os.Args[0])
+		os.Exit(exitCodeConfigError)
+	}
+
+	configurationFileName = flags.Arg(0)
+
+	loadConfigurationFile()
+
+	currentDir, err := os.Getwd()
+
+	if err != nil {
+		fmt.Println("Unable to get current directory:", err)
+		os.Exit(exitCodeError)
+	}
+
+	outputDir := getOutputDir(currentDir)
+	exportDir := outputDir + string(filepath.Separator) + cdxExportDirName
+
+	if flags.NArg() == 2 {
+		exportDir = flags.Arg(1)
+	}
+
+	archiveDir := filepath.Join(exportDir, cdxArchiveDirName)
+	indexesDir := filepath.Join(exportDir, cdxIndexesDirName)
+
+	for _, dir := range []string{archiveDir, indexesDir} {
+		if err := os.MkdirAll(dir, dirMode); err != nil {
+			fmt.Println("Unable to create export directory:", err)
+			os.Exit(exitCodeError)
+		}
+	}
+
+	resources := getCDXResources(configuration.Sites, outputDir)
+	records, err := exportWARC(resources, filepath.Join(archiveDir, *collection+".warc.gz"))
+
+	if err != nil {
+		fmt.Println("Unable to export warc file:", err)
+		os.Exit(exitCodeError)
+	}
+
+	indexFileName := filepath.Join(indexesDir, "index."+*format)
+	err = writeCDXIndex(records, indexFileName, *format)
+
+	if err != nil {
+		fmt.Println("Unable to save cdx index:", err)
+		os.Exit(exitCodeError)
+	}
+
+	fmt.Println(fmt.Sprintf("Exported %d records to %s", len(records), exportDir))
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const certificatesFileName = "certificates.pem"
+
+// policy of the extended validation certificates, in the certificates of the onion services issued by the CAs
+var extendedValidationPolicy = asn1.ObjectIdentifier{2, 23, 140, 1, 1}
+
+// SiteTLS is the tls connection of a https onion service, with the certificate chain it presented
+type SiteTLS struct {
+	Version     string         `json:"version"`
+	Protocol    string         `json:"protocol,omitempty"`
+	CipherSuite string         `json:"cipher_suite"`
+	Verified    bool           `json:"verified"`
+	VerifyError string         `json:"verify_error,omitempty"`
+	Chain       []*Certificate `json:"chain"`
+	CapturedAt  time.Time      `json:"captured_at"`
+}
+
+type Certificate struct {
+	Subject            string    `json:"subject"`
+	Issuer             string    `json:"issuer"`
+	SerialNumber       string    `json:"serial_number"`
+	DNSNames           []string  `json:"dns_names,omitempty"`
+	NotBefore          time.Time `json:"not_before"`
+	NotAfter           time.Time `json:"not_after"`
+	SHA256Fingerprint  string    `json:"sha256_fingerprint"`
+	SHA1Fingerprint    string    `json:"sha1_fingerprint"`
+	SignatureAlgorithm string    `json:"signature_algorithm"`
+	PublicKeyAlgorithm string    `json:"public_key_algorithm"`
+	ExtendedValidation bool      `json:"extended_validation,omitempty"`
+}
+
+func isHTTPSOnionURL(siteURL string) bool {
+	parsedURL, err := url.Parse(siteURL)
+
+	return err == nil && parsedURL.Scheme == "https" && strings.HasSuffix(parsedURL.Hostname(), ".onion")
+}
+
+// getSiteTLS connects to the site through tor and returns the presented chain, the chain is captured even when
+// it is not valid, since onion services usually have self-signed certificates
+func getSiteTLS(siteURL string) (*SiteTLS, []*x509.Certificate, error) {
+	parsedURL, err := url.Parse(siteURL)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	port := parsedURL.Port()
+
+	if port == "" {
+		port = "443"
+	}
+
+	timeouts := getTimeoutsConfig()
+	ctx, cancel := context.WithTimeout(context.Background(), getTimeout(timeouts.RequestSeconds, timeout))
+	defer cancel()
+
+	conn, err := getTorDialContext(getTimeout(timeouts.DialSeconds, timeout))(ctx, "tcp", net.JoinHostPort(parsedURL.Hostname(), port))
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer conn.Close()
+
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: parsedURL.Hostname(), InsecureSkipVerify: true, NextProtos: getALPNProtocols()})
+
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	state := tlsConn.ConnectionState()
+
+	if len(state.PeerCertificates) == 0 {
+		return nil, nil, errors.New("site presented no certificate")
+	}
+
+	siteTLS := &SiteTLS{
+		Version:     tls.VersionName(state.Version),
+		Protocol:    state.NegotiatedProtocol,
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		CapturedAt:  time.Now().UTC(),
+	}
+
+	intermediates := x509.NewCertPool()
+
+	for _, certificate := range state.PeerCertificates[1:] {
+		intermediates.AddCert(certificate)
+	}
+
+	_, err = state.PeerCertificates[0].Verify(x509.VerifyOptions{DNSName: parsedURL.Hostname(), Intermediates: intermediates})
+
+	if err != nil {
+		siteTLS.VerifyError = err.Error()
+	} else {
+		siteTLS.Verified = true
+	}
+
+	for _, certificate := range state.PeerCertificates {
+		siteTLS.Chain = append(siteTLS.Chain, getCertificate(certificate))
+	}
+
+	return siteTLS, state.PeerCertificates, nil
+}
+
+func getCertificate(certificate *x509.Certificate) *Certificate {
+	result := &Certificate{
+		Subject:            certificate.Subject.String(),
+		Issuer:             certificate.Issuer.String(),
+		SerialNumber:       fmt.Sprintf("%X", certificate.SerialNumber),
+		DNSNames:           certificate.DNSNames,
+		NotBefore:          certificate.NotBefore.UTC(),
+		NotAfter:           certificate.NotAfter.UTC(),
+		SHA256Fingerprint:  fmt.Sprintf("%X", sha256.Sum256(certificate.Raw)),
+		SHA1Fingerprint:    fmt.Sprintf("%X", sha1.Sum(certificate.Raw)),
+		SignatureAlgorithm: certificate.SignatureAlgorithm.String(),
+		PublicKeyAlgorithm: certificate.PublicKeyAlgorithm.String(),
+	}
+
+	for _, policy := range certificate.PolicyIdentifiers {
+		if policy.Equal(extendedValidationPolicy) {
+			result.ExtendedValidation = true
+		}
+	}
+
+	return result
+}
+
+// updateSiteTLS captures the certificate chain of a https onion service and saves it in pem format
+func updateSiteTLS(site *Site, siteDir string) {
+	siteTLS, certificates, err := getSiteTLS(site.URL)
+
+	if err != nil {
+		printError("Unable to capture site certificate:", err)
+		emitEvent("certificate_failed", site, site.URL, err, nil)
+		return
+	}
+
+	content := []byte{}
+
+	for _, certificate := range certificates {
+		content = append(content, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw})...)
+	}
+
+	err = writeFile(siteDir+string(filepath.Separator)+certificatesFileName, content, fileMode)
+
+	if err != nil {
+		printError("Unable to save site certificates:", err)
+	}
+
+	if site.TLS != nil && len(site.TLS.Chain) > 0 && site.TLS.Chain[0].SHA256Fingerprint != siteTLS.Chain[0].SHA256Fingerprint {
+		emitEvent("site_certificate_changed", site, site.URL, nil, map[string]interface{}{"sha256_fingerprint": siteTLS.Chain[0].SHA256Fingerprint})
+	}
+
+	site.TLS = siteTLS
+}
+
+func hasSameCertificate(site *Site, otherSite *Site) bool {
+	if site.TLS == nil || otherSite.TLS == nil || len(site.TLS.Chain) == 0 || len(otherSite.TLS.Chain) == 0 {
+		return false
+	}
+
+	return site.TLS.Chain[0].SHA256Fingerprint == otherSite.TLS.Chain[0].SHA256Fingerprint
+}
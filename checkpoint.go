@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const checkpointFileSuffix = ".checkpoint"
+
+// CheckpointsConfig saves the progress of the crawl every "every_pages" pages or "every_seconds" seconds, instead
+// of saving the whole configuration file after every site. Each checkpoint appends the sites changed since the
+// previous one to a checkpoint file next to the configuration file, that is merged into it at the end of the crawl
+type CheckpointsConfig struct {
+	EveryPages   int `json:"every_pages,omitempty"`
+	EverySeconds int `json:"every_seconds,omitempty"`
+}
+
+type checkpointState struct {
+	mutex        sync.Mutex
+	changedSites []*Site
+	pages        int
+	savedAt      time.Time
+}
+
+var checkpoints = &checkpointState{savedAt: time.Now()}
+
+func isCheckpointsEnabled() bool {
+	return configuration.Checkpoints != nil && (configuration.Checkpoints.EveryPages > 0 || configuration.Checkpoints.EverySeconds > 0)
+}
+
+// getCheckpointFileName returns the checkpoint file of the configuration file, each project has its own
+func getCheckpointFileName() string {
+	if configurationProject != "" {
+		return configurationFileName + "." + configurationProject + checkpointFileSuffix
+	}
+
+	return configurationFileName + checkpointFileSuffix
+}
+
+// checkpointSite saves the progress after the site was crawled, the whole configuration file is saved when the
+// checkpoints are disabled
+func checkpointSite(site *Site) {
+	if !isCheckpointsEnabled() {
+		saveConfigurationFile()
+		return
+	}
+
+	checkpoints.mutex.Lock()
+	defer checkpoints.mutex.Unlock()
+
+	checkpoints.addChangedSite(site)
+	checkpoints.saveIfDue(false)
+}
+
+// checkpointPage saves the progress of long site crawls, the pages crawled so far are saved with the site so a
+// resumed crawl doesn't fetch them again
+func checkpointPage(site *Site, pages []*Page) {
+	if !isCheckpointsEnabled() {
+		return
+	}
+
+	checkpoints.mutex.Lock()
+	defer checkpoints.mutex.Unlock()
+
+	checkpoints.pages++
+
+	if !checkpoints.isDue() {
+		return
+	}
+
+	// the checkpoint has a copy of the site with the pages of the previous run that were not crawled again yet, the
+	// site itself is not changed while the crawl uses it
+	checkpointedSite := *site
+	checkpointedSite.Pages = mergePages(pages, site.Pages)
+	checkpoints.addChangedSite(&checkpointedSite)
+	checkpoints.saveIfDue(true)
+}
+
+// addChangedSite adds the site to the next checkpoint, replacing the site of the same url
+func (state *checkpointState) addChangedSite(site *Site) {
+	for index, changedSite := range state.changedSites {
+		if changedSite.URL == site.URL {
+			state.changedSites[index] = site
+			return
+		}
+	}
+
+	state.changedSites = append(state.changedSites, site)
+}
+
+func (state *checkpointState) isDue() bool {
+	config := configuration.Checkpoints
+
+	if config.EveryPages > 0 && state.pages >= config.EveryPages {
+		return true
+	}
+
+	return config.EverySeconds > 0 && time.Since(state.savedAt) >= time.Duration(config.EverySeconds)*time.Second
+}
+
+func (state *checkpointState) saveIfDue(force bool) {
+	if len(state.changedSites) == 0 || (!force && !state.isDue()) {
+		return
+	}
+
+	err := appendCheckpoint(state.changedSites)
+
+	if err != nil {
+		printError("Unable to save checkpoint:", err)
+		return
+	}
+
+	printVerbose(fmt.Sprintf("Checkpoint saved with %d sites", len(state.changedSites)))
+
+	state.changedSites = nil
+	state.pages = 0
+	state.savedAt = time.Now()
+
+	// the checkpoint file is merged when it is bigger than the configuration file, so loading it stays fast
+	checkpointInfo, err := os.Stat(getCheckpointFileName())
+	configurationInfo, configurationErr := os.Stat(configurationFileName)
+
+	if err == nil && configurationErr == nil && checkpointInfo.Size() > configurationInfo.Size() {
+		saveConfigurationFile()
+	}
+}
+
+// appendCheckpoint appends the sites to the checkpoint file, one json line for each site
+func appendCheckpoint(sites []*Site) error {
+	file, err := os.OpenFile(getCheckpointFileName(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, configurationFileMode)
+
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+
+	for _, site := range sites {
+		siteJSON, err := json.Marshal(site)
+
+		if err != nil {
+			file.Close()
+			return err
+		}
+
+		writer.Write(siteJSON)
+		writer.WriteByte('\n')
+	}
+
+	err = writer.Flush()
+
+	if err == nil {
+		err = file.Sync()
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// loadCheckpoint applies the crawl state of the sites of the checkpoint file of an interrupted crawl to the
+// configuration, the last line of each site wins. The settings of the sites come from the configuration, so they can
+// be changed before the crawl is resumed, and the new sites of the crawl are added. A line cut by the interruption is
+// ignored
+func loadCheckpoint() (int, error) {
+	file, err := os.Open(getCheckpointFileName())
+
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	defer file.Close()
+
+	sitesByURL := map[string]int{}
+
+	for index, site := range configuration.Sites {
+		sitesByURL[site.URL] = index
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	total := 0
+
+	for scanner.Scan() {
+		site := &Site{}
+
+		if json.Unmarshal(scanner.Bytes(), site) != nil || site.URL == "" {
+			continue
+		}
+
+		if index, exists := sitesByURL[site.URL]; exists {
+			mergeSiteCrawlState(configuration.Sites[index], site)
+		} else {
+			sitesByURL[site.URL] = len(configuration.Sites)
+			configuration.Sites = append(configuration.Sites, site)
+		}
+
+		total++
+	}
+
+	return total, scanner.Err()
+}
+
+// mergeSiteCrawlState sets the crawl state of the checkpointed site to the site, the fields that the crawl sets and
+// not the settings of the site
+func mergeSiteCrawlState(site *Site, checkpointedSite *Site) {
+	site.Title = checkpointedSite.Title
+	site.Language = checkpointedSite.Language
+	site.Categories = checkpointedSite.Categories
+	site.FetchSuccess = checkpointedSite.FetchSuccess
+	site.ContentHash = checkpointedSite.ContentHash
+	site.FaviconHash = checkpointedSite.FaviconHash
+	site.DuplicateOf = checkpointedSite.DuplicateOf
+	site.FailureCount = checkpointedSite.FailureCount
+	site.StatusCode = checkpointedSite.StatusCode
+	site.Protocol = checkpointedSite.Protocol
+	site.SoftError = checkpointedSite.SoftError
+	site.Truncated = checkpointedSite.Truncated
+	site.BodyTruncated = checkpointedSite.BodyTruncated
+	site.LastSnapshot = checkpointedSite.LastSnapshot
+	site.Robots = checkpointedSite.Robots
+	site.CrawlDelay = checkpointedSite.CrawlDelay
+	site.Canonical = checkpointedSite.Canonical
+	site.Pages = checkpointedSite.Pages
+	site.Frames = checkpointedSite.Frames
+	site.Feeds = checkpointedSite.Feeds
+	site.Mirrors = checkpointedSite.Mirrors
+	site.Images = checkpointedSite.Images
+	site.Availability = checkpointedSite.Availability
+	site.SkipReason = checkpointedSite.SkipReason
+	site.Article = checkpointedSite.Article
+	site.Forms = checkpointedSite.Forms
+	site.ScreenshotHash = checkpointedSite.ScreenshotHash
+	site.ScreenshotDiff = checkpointedSite.ScreenshotDiff
+	site.PGPKeys = checkpointedSite.PGPKeys
+	site.OnionService = checkpointedSite.OnionService
+	site.TLS = checkpointedSite.TLS
+	site.Fingerprint = checkpointedSite.Fingerprint
+}
+
+// removeCheckpoint removes the checkpoint file after the configuration file was saved with all the progress
+func removeCheckpoint() {
+	err := os.Remove(getCheckpointFileName())
+
+	if err != nil && !os.IsNotExist(err) {
+		printError("Unable to remove checkpoint file:", err)
+	}
+}
+
+// mergePages returns the pages with the pages of the other list that are not in it
+func mergePages(pages []*Page, otherPages []*Page) []*Page {
+	result := append([]*Page{}, pages...)
+	urls := map[string]bool{}
+
+	for _, page := range pages {
+		urls[normalizeURL(page.URL)] = true
+	}
+
+	for _, page := range otherPages {
+		if !urls[normalizeURL(page.URL)] {
+			result = append(result, page)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strings"
+)
+
+const defaultCircuitRetries = 1
+
+// classes of the failures of tor requests, by the socks reply of tor. The onion service codes (0xF0-0xF7) are sent
+// by tor with the ExtendedErrors flag of the SocksPort
+var socksReplyErrorClasses = map[string]string{
+	"general SOCKS server failure":      "general_failure",
+	"connection not allowed by ruleset": "not_allowed",
+	"network unreachable":               "network_unreachable",
+	"host unreachable":                  "host_unreachable",
+	"connection refused":                "connection_refused",
+	"TTL expired":                       "ttl_expired",
+	"unknown code: 240":                 "descriptor_not_found",
+	"unknown code: 241":                 "descriptor_invalid",
+	"unknown code: 242":                 "introduction_failed",
+	"unknown code: 243":                 "rendezvous_failed",
+	"unknown code: 244":                 "client_authorization_missing",
+	"unknown code: 245":                 "client_authorization_wrong",
+	"unknown code: 246":                 "invalid_address",
+	"unknown code: 247":                 "introduction_timeout",
+}
+
+// failures that another circuit can fix, a refused connection or a wrong address fail again on any circuit
+var circuitErrorClasses = map[string]bool{
+	"general_failure":      true,
+	"host_unreachable":     true,
+	"ttl_expired":          true,
+	"descriptor_not_found": true,
+	"descriptor_invalid":   true,
+	"introduction_failed":  true,
+	"rendezvous_failed":    true,
+	"introduction_timeout": true,
+	"timeout":              true,
+}
+
+type circuitIsolationKey struct{}
+
+// getTorErrorClass returns the class of the failure of a request, or an empty string for the other errors
+func getTorErrorClass(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	message := err.Error()
+
+	// the socks client of x/net returns the reply of tor as "unknown error <reply>"
+	if index := strings.Index(message, "unknown error "); index >= 0 {
+		reply := message[index+len("unknown error "):]
+
+		for text, class := range socksReplyErrorClasses {
+			if strings.HasPrefix(reply, text) {
+				return class
+			}
+		}
+	}
+
+	var netError net.Error
+
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netError) && netError.Timeout()) {
+		return "timeout"
+	}
+
+	return ""
+}
+
+// getCircuitRetries returns how many times a request that failed by its circuit is retried on a new one, a
+// negative value disables the retries
+func getCircuitRetries() int {
+	if configuration.CircuitRetries < 0 || isReplaying() {
+		return 0
+	}
+
+	if configuration.CircuitRetries == 0 {
+		return defaultCircuitRetries
+	}
+
+	return configuration.CircuitRetries
+}
+
+// withNewCircuit returns a context whose connections use new socks credentials, tor isolates the streams of
+// other credentials (IsolateSOCKSAuth) so they are built on a new circuit
+func withNewCircuit(ctx context.Context) context.Context {
+	key := make([]byte, 16)
+
+	if _, err := crawlerRandom.Read(key); err != nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, circuitIsolationKey{}, hex.EncodeToString(key))
+}
+
+func getCircuitIsolation(ctx context.Context) string {
+	isolation, _ := ctx.Value(circuitIsolationKey{}).(string)
+	return isolation
+}
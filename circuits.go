@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const circuitsFileName = "circuits.jsonl"
+
+const circuitPurposeRendezvous = "HS_CLIENT_REND"
+
+// TorCircuit is the circuit of tor that served a request, with its relays by their role
+type TorCircuit struct {
+	ID              string   `json:"id"`
+	Status          string   `json:"status"`
+	Purpose         string   `json:"purpose,omitempty"`
+	HSState         string   `json:"hs_state,omitempty"`
+	RendQuery       string   `json:"rend_query,omitempty"`
+	Guard           string   `json:"guard,omitempty"`
+	Middles         []string `json:"middles,omitempty"`
+	Exit            string   `json:"exit,omitempty"`
+	RendezvousPoint string   `json:"rendezvous_point,omitempty"`
+	StreamID        string   `json:"stream_id,omitempty"`
+}
+
+// CircuitLogEntry is a request of the crawl in the circuits log, with the circuit that served it
+type CircuitLogEntry struct {
+	Time    time.Time   `json:"time"`
+	URL     string      `json:"url"`
+	Circuit *TorCircuit `json:"circuit,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+var (
+	requestCircuits      = map[string]*TorCircuit{}
+	requestCircuitsMutex sync.Mutex
+)
+
+func isCircuitLoggingEnabled() bool {
+	return configuration.TorControl != nil && configuration.TorControl.Circuits && !isReplaying()
+}
+
+// recordRequestCircuit finds the circuit of the request by its stream in the tor control port, or by the
+// rendezvous circuit of the onion service when the stream was closed, and appends it to the circuits log
+func recordRequestCircuit(requestURL string, requestErr error) {
+	circuit, err := getRequestCircuit(requestURL)
+
+	if err != nil {
+		printError("Unable to get request circuit:", err)
+	}
+
+	requestCircuitsMutex.Lock()
+	requestCircuits[normalizeURL(requestURL)] = circuit
+	requestCircuitsMutex.Unlock()
+
+	entry := &CircuitLogEntry{Time: time.Now().UTC(), URL: requestURL, Circuit: circuit}
+
+	if requestErr != nil {
+		entry.Error = requestErr.Error()
+	}
+
+	if err := appendCircuitLogEntry(entry); err != nil {
+		printError("Unable to save circuits log:", err)
+	}
+}
+
+// getRecordedRequestCircuit returns the circuit of the last request of the url
+func getRecordedRequestCircuit(requestURL string) *TorCircuit {
+	requestCircuitsMutex.Lock()
+	defer requestCircuitsMutex.Unlock()
+
+	return requestCircuits[normalizeURL(requestURL)]
+}
+
+func getRequestCircuit(requestURL string) (*TorCircuit, error) {
+	parsedURL, err := url.Parse(requestURL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	port := parsedURL.Port()
+
+	if port == "" {
+		port = "80"
+
+		if parsedURL.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	target := net.JoinHostPort(parsedURL.Hostname(), port)
+	replies, err := sendTorControlCommands(configuration.TorControl, "GETINFO stream-status", "GETINFO circuit-status")
+
+	if err != nil {
+		return nil, err
+	}
+
+	circuitID := ""
+	streamID := ""
+
+	for _, line := range getTorControlValues(replies[0], "stream-status") {
+		// StreamID StreamStatus CircuitID Target
+		fields := strings.Fields(line)
+
+		if len(fields) >= 4 && strings.EqualFold(fields[3], target) {
+			streamID, circuitID = fields[0], fields[2]
+
+			if fields[1] == "SUCCEEDED" {
+				break
+			}
+		}
+	}
+
+	onionAddress := ""
+
+	if strings.HasSuffix(parsedURL.Hostname(), ".onion") {
+		labels := strings.Split(strings.TrimSuffix(parsedURL.Hostname(), ".onion"), ".")
+		onionAddress = labels[len(labels)-1]
+	}
+
+	var rendezvousCircuit *TorCircuit
+
+	for _, line := range getTorControlValues(replies[1], "circuit-status") {
+		circuit := parseTorCircuit(line)
+
+		if circuit == nil {
+			continue
+		}
+
+		if circuitID != "" && circuit.ID == circuitID {
+			circuit.StreamID = streamID
+			return circuit, nil
+		}
+
+		if onionAddress != "" && circuit.RendQuery == onionAddress && circuit.Purpose == circuitPurposeRendezvous {
+			rendezvousCircuit = circuit
+		}
+	}
+
+	if rendezvousCircuit != nil {
+		return rendezvousCircuit, nil
+	}
+
+	return nil, errors.New("no circuit for " + target)
+}
+
+// getTorControlValues returns the values of a GETINFO key, that has one value in the key line or many values in
+// the data lines
+func getTorControlValues(lines []string, key string) []string {
+	result := []string{}
+
+	for index, line := range lines {
+		if index == 0 {
+			line = strings.TrimPrefix(line, key+"=")
+		}
+
+		if line != "" && line != "OK" {
+			result = append(result, line)
+		}
+	}
+
+	return result
+}
+
+// parseTorCircuit parses a circuit-status line, "CircuitID CircStatus [Path] [key=value...]", the path has the
+// relays as "$fingerprint~nickname"
+func parseTorCircuit(line string) *TorCircuit {
+	fields := strings.Fields(line)
+
+	if len(fields) < 2 {
+		return nil
+	}
+
+	circuit := &TorCircuit{ID: fields[0], Status: fields[1]}
+	path := []string{}
+
+	for _, field := range fields[2:] {
+		if strings.HasPrefix(field, "$") {
+			path = strings.Split(field, ",")
+			continue
+		}
+
+		parts := strings.SplitN(field, "=", 2)
+
+		if len(parts) != 2 {
+			continue
+		}
+
+		switch parts[0] {
+		case "PURPOSE":
+			circuit.Purpose = parts[1]
+		case "HS_STATE":
+			circuit.HSState = parts[1]
+		case "REND_QUERY":
+			circuit.RendQuery = parts[1]
+		}
+	}
+
+	if len(path) == 0 {
+		return circuit
+	}
+
+	circuit.Guard = path[0]
+
+	if len(path) > 1 {
+		circuit.Middles = path[1 : len(path)-1]
+
+		// the last relay of a rendezvous circuit is where the client meets the onion service
+		if circuit.Purpose == circuitPurposeRendezvous {
+			circuit.RendezvousPoint = path[len(path)-1]
+		} else {
+			circuit.Exit = path[len(path)-1]
+		}
+	}
+
+	return circuit
+}
+
+func appendCircuitLogEntry(entry *CircuitLogEntry) error {
+	currentDir, err := os.Getwd()
+
+	if err != nil {
+		return err
+	}
+
+	outputDir := getOutputDir(currentDir)
+	err = os.MkdirAll(outputDir, dirMode)
+
+	if err != nil {
+		return err
+	}
+
+	entryJSON, err := json.Marshal(entry)
+
+	if err != nil {
+		return err
+	}
+
+	requestCircuitsMutex.Lock()
+	defer requestCircuitsMutex.Unlock()
+
+	file, err := os.OpenFile(outputDir+string(filepath.Separator)+circuitsFileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, fileMode)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	_, err = file.Write(append(entryJSON, '\n'))
+
+	return err
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/rand"
+	mathrand "math/rand"
+	"sync"
+	"time"
+)
+
+// Clock is the time of the crawler: the delays of the load control and of robots.txt, the crawl windows, the
+// retention and the snapshot names use it, so they can be run with the fixed clock of -clock instead of waiting
+type Clock interface {
+	Now() time.Time
+	Sleep(duration time.Duration)
+}
+
+// Random is the source of the random values of the crawler, like the circuit isolation credentials and the trace ids
+type Random interface {
+	Read(buffer []byte) (int, error)
+}
+
+// the clock and the random source of the crawler, replaced by the -clock and -random-seed flags
+var (
+	crawlerClock  Clock  = systemClock{}
+	crawlerRandom Random = rand.Reader
+)
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) Sleep(duration time.Duration) {
+	time.Sleep(duration)
+}
+
+// setupClock uses a fixed clock from the start time of -clock, and a seeded random source with the seed of
+// -random-seed, so the schedules of a configuration can be checked without waiting and a run can be repeated
+func setupClock(start string, seed int64) error {
+	if start != "" {
+		now, err := time.Parse(time.RFC3339, start)
+
+		if err != nil {
+			return err
+		}
+
+		crawlerClock = newFixedClock(now)
+		runStartedAt = now.UTC()
+	}
+
+	if seed != 0 {
+		crawlerRandom = newSeededRandom(seed)
+	}
+
+	return nil
+}
+
+// fixedClock is a clock that only moves when it sleeps, the sleeps return at once
+type fixedClock struct {
+	mutex sync.Mutex
+	now   time.Time
+	total time.Duration
+}
+
+func newFixedClock(now time.Time) *fixedClock {
+	return &fixedClock{now: now}
+}
+
+func (clock *fixedClock) Now() time.Time {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	return clock.now
+}
+
+func (clock *fixedClock) Sleep(duration time.Duration) {
+	if duration <= 0 {
+		return
+	}
+
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	clock.now = clock.now.Add(duration)
+	clock.total += duration
+}
+
+// slept returns the total of the sleeps, like the delays of the back off
+func (clock *fixedClock) slept() time.Duration {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	return clock.total
+}
+
+// seededRandom is a random source that returns the same values for the same seed
+type seededRandom struct {
+	mutex  sync.Mutex
+	source *mathrand.Rand
+}
+
+func newSeededRandom(seed int64) Random {
+	return &seededRandom{source: mathrand.New(mathrand.NewSource(seed))}
+}
+
+func (random *seededRandom) Read(buffer []byte) (int, error) {
+	random.mutex.Lock()
+	defer random.mutex.Unlock()
+
+	return random.source.Read(buffer)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+func runConfigCommand(args []string) {
+	if len(args) < 1 {
+		printConfigUsage()
+		os.Exit(exitCodeConfigError)
+	}
+
+	switch args[0] {
+	case "merge":
+		runConfigMergeCommand(args[1:])
+		return
+	case "validate":
+		runConfigValidateCommand(args[1:])
+		return
+	}
+
+	printConfigUsage()
+	os.Exit(exitCodeConfigError)
+}
+
+func printConfigUsage() {
+	fmt.Printf("Usage : %s config merge <output file> <configuration file> <configuration file>... \n", os.Args[0])
+	fmt.Printf("        %s config validate <configuration file> \n", os.Args[0])
+}
+
+// runConfigMergeCommand combines configuration files, the settings of the first file that has them are used and
+// the sites are deduplicated by the normalized url, keeping the freshest state of each site
+func runConfigMergeCommand(args []string) {
+	if len(args) < 3 {
+		printConfigUsage()
+		os.Exit(exitCodeConfigError)
+	}
+
+	outputFileName := args[0]
+	configuration = &ConfigurationFile{}
+	settings := map[string]json.RawMessage{}
+	sites := []*Site{}
+	sitesByURL := map[string]int{}
+
+	for _, fileName := range args[1:] {
+		content, err := ioutil.ReadFile(fileName)
+
+		if err != nil {
+			fmt.Println("Unable to read configuration file:", err)
+			os.Exit(exitCodeConfigError)
+		}
+
+		fileSettings := map[string]json.RawMessage{}
+		err = json.Unmarshal(content, &fileSettings)
+
+		if err != nil {
+			fmt.Println("Unable to parse configuration file:", fileName, err)
+			os.Exit(exitCodeConfigError)
+		}
+
+		for key, value := range fileSettings {
+			if _, exists := settings[key]; !exists && key != "sites" {
+				settings[key] = value
+			}
+		}
+
+		fileSites := []*Site{}
+
+		if value, exists := fileSettings["sites"]; exists {
+			err = json.Unmarshal(value, &fileSites)
+
+			if err != nil {
+				fmt.Println("Unable to parse configuration file sites:", fileName, err)
+				os.Exit(exitCodeConfigError)
+			}
+		}
+
+		added := 0
+
+		for _, site := range fileSites {
+			siteKey := getSiteKey(site)
+			index, exists := sitesByURL[siteKey]
+
+			if !exists {
+				sitesByURL[siteKey] = len(sites)
+				sites = append(sites, site)
+				added++
+				continue
+			}
+
+			if isFresherSite(site, sites[index]) {
+				sites[index] = site
+			}
+		}
+
+		fmt.Println(fmt.Sprintf("Merged %s - %d sites, %d new", fileName, len(fileSites), added))
+	}
+
+	// the merged settings are read as a configuration so the output has the usual format
+	settingsJSON, err := json.Marshal(settings)
+
+	if err == nil {
+		err = json.Unmarshal(settingsJSON, configuration)
+	}
+
+	if err != nil {
+		fmt.Println("Unable to merge configuration settings:", err)
+		os.Exit(exitCodeConfigError)
+	}
+
+	configuration.Sites = sites
+	configurationFileName = outputFileName
+	saveConfigurationFile()
+
+	fmt.Println(fmt.Sprintf("Configuration saved to %s with %d sites", outputFileName, len(sites)))
+}
+
+// isFresherSite checks if the site state is newer than the other site state, by the last fetch attempt and
+// by the last snapshot, and a fetched site is fresher than a site that was never fetched
+func isFresherSite(site *Site, otherSite *Site) bool {
+	siteTime := getSiteStateTime(site)
+	otherSiteTime := getSiteStateTime(otherSite)
+
+	if !siteTime.Equal(otherSiteTime) {
+		return siteTime.After(otherSiteTime)
+	}
+
+	return site.FetchSuccess && !otherSite.FetchSuccess
+}
+
+func getSiteStateTime(site *Site) time.Time {
+	result := time.Time{}
+
+	if site.Availability != nil {
+		result = site.Availability.LastSuccess
+
+		if site.Availability.LastFailure.After(result) {
+			result = site.Availability.LastFailure
+		}
+	}
+
+	if snapshotTime, err := time.Parse(snapshotNameLayout, site.LastSnapshot); err == nil && snapshotTime.After(result) {
+		result = snapshotTime
+	}
+
+	return result
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Controller struct {
+	mutex        sync.Mutex
+	paused       bool
+	skipSite     bool
+	currentIndex int
+	currentSite  string
+	totalOfSites int
+	pendingURLs  []string
+}
+
+type ControllerStatus struct {
+	Paused       bool     `json:"paused"`
+	CurrentIndex int      `json:"current_index"`
+	CurrentSite  string   `json:"current_site"`
+	TotalOfSites int      `json:"total_of_sites"`
+	PendingURLs  []string `json:"pending_urls"`
+}
+
+var controller *Controller
+
+// setupController listens for commands on a unix socket path or a localhost host:port address
+func setupController(address string) error {
+	if address == "" {
+		return nil
+	}
+
+	network := getControlNetwork(address)
+
+	if err := checkControlAddress(address); err != nil {
+		return err
+	}
+
+	// remove a socket left by a previous run, the other files of the path are kept
+	if info, err := os.Lstat(address); network == "unix" && err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return errors.New("control socket path exists and is not a socket: " + address)
+		}
+
+		os.Remove(address)
+	}
+
+	listener, err := net.Listen(network, address)
+
+	if err != nil {
+		return err
+	}
+
+	controller = &Controller{}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				printError("Unable to accept control connection:", err)
+				return
+			}
+
+			go controller.handleConnection(conn)
+		}
+	}()
+
+	printInfo("Control socket listening on:", address)
+
+	return nil
+}
+
+func getControlNetwork(address string) string {
+	if !strings.HasPrefix(address, "/") && !strings.HasPrefix(address, ".") {
+		return "tcp"
+	}
+
+	return "unix"
+}
+
+// checkControlAddress returns an error for the tcp addresses that are not on the loopback, the commands have no
+// authentication and any peer could add urls to the crawl
+func checkControlAddress(address string) error {
+	if getControlNetwork(address) != "tcp" {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+
+	if err != nil {
+		return err
+	}
+
+	if !isLoopbackHost(host) {
+		return errors.New("control socket must listen on a loopback address, like 127.0.0.1:9000: " + address)
+	}
+
+	return nil
+}
+
+func (controller *Controller) handleConnection(conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		response := controller.runCommand(fields[0], fields[1:])
+		fmt.Fprintln(conn, response)
+	}
+}
+
+func (controller *Controller) runCommand(command string, args []string) string {
+	controller.mutex.Lock()
+	defer controller.mutex.Unlock()
+
+	switch command {
+	case "pause":
+		controller.paused = true
+		return "OK paused"
+	case "resume":
+		controller.paused = false
+		return "OK resumed"
+	case "skip-current-site":
+		if controller.currentSite == "" {
+			return "ERROR no site is being crawled"
+		}
+
+		controller.skipSite = true
+		return "OK skipping " + controller.currentSite
+	case "add-url":
+		if len(args) != 1 {
+			return "ERROR usage: add-url <url>"
+		}
+
+		scheme := getURLScheme(args[0])
+
+		if scheme != "http" && scheme != "https" {
+			return "ERROR invalid url: " + args[0]
+		}
+
+		controller.pendingURLs = append(controller.pendingURLs, args[0])
+		return "OK added " + args[0]
+	case "status":
+		status := &ControllerStatus{
+			Paused:       controller.paused,
+			CurrentIndex: controller.currentIndex,
+			CurrentSite:  controller.currentSite,
+			TotalOfSites: controller.totalOfSites,
+			PendingURLs:  controller.pendingURLs,
+		}
+
+		statusJSON, err := json.Marshal(status)
+
+		if err != nil {
+			return "ERROR " + err.Error()
+		}
+
+		return string(statusJSON)
+	case "help":
+		return "OK commands: pause, resume, skip-current-site, add-url <url>, status"
+	}
+
+	return "ERROR unknown command: " + command
+}
+
+func (controller *Controller) setCurrentSite(index int, site *Site) {
+	if controller == nil {
+		return
+	}
+
+	controller.mutex.Lock()
+	defer controller.mutex.Unlock()
+
+	controller.currentIndex = index
+	controller.totalOfSites = len(crawlQueue)
+	controller.currentSite = ""
+	controller.skipSite = false
+
+	if site != nil {
+		controller.currentSite = site.URL
+	}
+}
+
+func (controller *Controller) waitWhilePaused() {
+	if controller == nil {
+		return
+	}
+
+	notified := false
+
+	for {
+		controller.mutex.Lock()
+		paused := controller.paused && !controller.skipSite
+		controller.mutex.Unlock()
+
+		if !paused || isCrawlAborted() {
+			if notified {
+				printInfo("Crawl resumed")
+			}
+
+			return
+		}
+
+		if !notified {
+			printInfo("Crawl paused")
+			notified = true
+		}
+
+		time.Sleep(time.Second)
+	}
+}
+
+func (controller *Controller) shouldSkipSite() bool {
+	if controller == nil {
+		return false
+	}
+
+	controller.mutex.Lock()
+	defer controller.mutex.Unlock()
+
+	return controller.skipSite
+}
+
+// addPendingSites appends the urls added by the control socket to the site list
+func (controller *Controller) addPendingSites() {
+	if controller == nil {
+		return
+	}
+
+	controller.mutex.Lock()
+	pendingURLs := controller.pendingURLs
+	controller.pendingURLs = nil
+	controller.mutex.Unlock()
+
+	for _, pendingURL := range pendingURLs {
+		exists := false
+
+		for _, site := range configuration.Sites {
+			if normalizeURL(site.URL) == normalizeURL(pendingURL) {
+				exists = true
+				break
+			}
+		}
+
+		if exists {
+			printInfo("Site added by control socket already exists:", pendingURL)
+			continue
+		}
+
+		site := &Site{URL: pendingURL, Project: configurationProject}
+		configuration.Sites = append(configuration.Sites, site)
+		crawlQueue = append(crawlQueue, site)
+		printInfo("Site added by control socket:", pendingURL)
+	}
+}
+
+func hasNextSite(index int) bool {
+	controller.addPendingSites()
+	return index < len(crawlQueue)
+}
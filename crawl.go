@@ -0,0 +1,635 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/metal3d/go-slugify"
+)
+
+const defaultMaxPages = 100
+const pagesDirName = "pages"
+const maxLinkContextLength = 300
+
+type Page struct {
+	URL          string `json:"url"`
+	Depth        int    `json:"depth"`
+	FileName     string `json:"file_name"`
+	FetchSuccess bool   `json:"fetch_success"`
+	StatusCode   int    `json:"status_code,omitempty"`
+	ContentType  string `json:"content_type,omitempty"`
+	ContentHash  string `json:"content_hash,omitempty"`
+	CircuitID    string `json:"circuit_id,omitempty"`
+
+	BodyTruncated bool `json:"body_truncated,omitempty"`
+
+	FetchedAt time.Time `json:"fetched_at"`
+	Article   *Article  `json:"article,omitempty"`
+	Robots    []string  `json:"robots,omitempty"`
+	Forms     []*Form   `json:"forms,omitempty"`
+
+	Canonical   string `json:"canonical,omitempty"`
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+}
+
+type Link struct {
+	URL     string   `json:"url"`
+	Page    string   `json:"page"`
+	Text    string   `json:"text"`
+	Title   string   `json:"title,omitempty"`
+	Context string   `json:"context,omitempty"`
+	Rel     []string `json:"rel,omitempty"`
+}
+
+type pageQueueItem struct {
+	URL   string
+	Depth int
+}
+
+func getLinksFromDocument(doc *goquery.Document, pageURL string) []*Link {
+	result := []*Link{}
+	baseURL, err := url.Parse(pageURL)
+
+	if err != nil {
+		return result
+	}
+
+	doc.Find("a[href]").Each(func(_ int, selection *goquery.Selection) {
+		href, _ := selection.Attr("href")
+		href = strings.TrimSpace(href)
+
+		if href == "" || strings.HasPrefix(href, "#") {
+			return
+		}
+
+		scheme := getURLScheme(href)
+
+		if scheme != "" && !isAllowedScheme(scheme) {
+			return
+		}
+
+		linkURL, err := baseURL.Parse(href)
+
+		if err != nil {
+			return
+		}
+
+		link := &Link{
+			URL:     linkURL.String(),
+			Page:    pageURL,
+			Text:    getCleanText(selection.Text()),
+			Context: getLinkContext(selection),
+		}
+
+		link.Title, _ = selection.Attr("title")
+
+		if rel, exists := selection.Attr("rel"); exists {
+			link.Rel = strings.Fields(strings.ToLower(rel))
+		}
+
+		result = append(result, link)
+	})
+
+	return result
+}
+
+// getLinkContext returns the text of the block that contains the link, like its paragraph or list item
+func getLinkContext(selection *goquery.Selection) string {
+	block := selection.Closest("p, li, td, th, dd, blockquote, article, section, div")
+
+	if block.Length() == 0 {
+		return ""
+	}
+
+	context := getCleanText(block.Text())
+
+	if len(context) > maxLinkContextLength {
+		context = strings.TrimSpace(context[:maxLinkContextLength]) + "..."
+	}
+
+	return context
+}
+
+func getCleanText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// isURLInScope checks if the link is on the same host of the seed and inside the site path prefix
+func isURLInScope(site *Site, seedURL *url.URL, link string) bool {
+	linkURL, err := url.Parse(link)
+
+	if err != nil {
+		return false
+	}
+
+	if !strings.EqualFold(linkURL.Hostname(), seedURL.Hostname()) {
+		return false
+	}
+
+	if site.PathPrefix == "" {
+		return true
+	}
+
+	path := linkURL.Path
+
+	if path == "" {
+		path = "/"
+	}
+
+	prefix := site.PathPrefix
+
+	if !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+
+	// the prefix ends at a segment, "/forum" and "/forum/" match "/forum" and "/forum/topic" but not "/forums"
+	prefix = strings.TrimSuffix(prefix, "/")
+
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// getPageFileName returns the file name of the page url with a short hash of the url, the slugs of different urls
+// can be the same, like "/a-b" and "/a/b". In deterministic mode the name is made from the normalized url, so the
+// same page always has the same name
+func getPageFileName(pageURL string) string {
+	if isPageLayoutMirror() {
+		return getPageMirrorFileName(pageURL)
+	}
+
+	if configuration.Deterministic {
+		pageURL = normalizeURL(pageURL)
+	}
+
+	name := strings.TrimSuffix(getPageFileNameFromURL(pageURL), ".html")
+
+	return name + "-" + getContentHash([]byte(pageURL))[:8] + ".html"
+}
+
+func getPageFileNameFromURL(pageURL string) string {
+	parsedURL, err := url.Parse(pageURL)
+
+	if err != nil {
+		return slugify.Marshal(pageURL) + ".html"
+	}
+
+	name := strings.Trim(parsedURL.Path, "/")
+
+	if parsedURL.RawQuery != "" {
+		name += "-" + parsedURL.RawQuery
+	}
+
+	if name == "" {
+		name = "index"
+	}
+
+	return slugify.Marshal(name) + ".html"
+}
+
+// crawlSitePages follows the links of the seed page inside the site scope, until the max depth or the max pages,
+// and returns the links found in all pages
+func crawlSitePages(site *Site, siteDir string, seedDoc *goquery.Document, fetcher Fetcher, siteBytes int64) []*Link {
+	allLinks := getLinksFromDocument(seedDoc, site.URL)
+	robotsPolicy := getRobotsPolicy(site)
+	site.Robots = nil
+	site.Canonical = getCanonicalURLFromDocument(seedDoc, site.URL)
+
+	if robotsPolicy != robotsPolicyIgnore {
+		site.Robots = getRobotsDirectivesFromDocument(seedDoc)
+	}
+
+	// sites without max depth or max pages use the configuration ones
+	maxDepth := site.MaxDepth
+
+	if maxDepth <= 0 {
+		maxDepth = configuration.MaxDepth
+	}
+
+	if maxDepth <= 0 {
+		return allLinks
+	}
+
+	seedURL, err := url.Parse(site.URL)
+
+	if err != nil {
+		return allLinks
+	}
+
+	maxPages := site.MaxPages
+
+	if maxPages <= 0 {
+		maxPages = configuration.MaxPages
+	}
+
+	if maxPages <= 0 {
+		maxPages = defaultMaxPages
+	}
+
+	// pages from a previous run are reused
+	pagesByURL := map[string]*Page{}
+
+	for _, page := range site.Pages {
+		pagesByURL[normalizeURL(page.URL)] = page
+	}
+
+	frontier, err := newFrontier(site)
+
+	if err != nil {
+		printError("Unable to create site frontier:", err)
+		return allLinks
+	}
+
+	defer frontier.Close()
+
+	addLinks := func(links []*Link, depth int) {
+		if depth >= maxDepth {
+			return
+		}
+
+		for _, link := range links {
+			if !isURLInScope(site, seedURL, link.URL) {
+				continue
+			}
+
+			if robotsPolicy == robotsPolicyRespect && isNofollowLink(link) {
+				continue
+			}
+
+			isNew, err := frontier.Visit(link.URL)
+
+			if err == nil && isNew {
+				err = frontier.Push(&pageQueueItem{URL: link.URL, Depth: depth + 1})
+			}
+
+			if err != nil {
+				printError("Unable to add page to site frontier:", err)
+			}
+		}
+	}
+
+	if _, err := frontier.Visit(site.URL); err != nil {
+		printError("Unable to add page to site frontier:", err)
+	}
+
+	// pages with the same canonical url are the same page, the first one is archived
+	canonicalPages := map[string]string{}
+
+	getCanonicalKey := func(pageURL string, canonicalURL string) string {
+		if configuration.CanonicalDedup && canonicalURL != "" && isURLInScope(site, seedURL, canonicalURL) {
+			return normalizeURL(canonicalURL)
+		}
+
+		return normalizeURL(pageURL)
+	}
+
+	canonicalPages[getCanonicalKey(site.URL, site.Canonical)] = site.URL
+
+	if canonicalKey := getCanonicalKey(site.URL, site.Canonical); canonicalKey != normalizeURL(site.URL) {
+		if _, err := frontier.Visit(site.Canonical); err != nil {
+			printError("Unable to add page to site frontier:", err)
+		}
+	}
+
+	if robotsPolicy != robotsPolicyRespect || !hasString(site.Robots, "nofollow") {
+		addLinks(allLinks, 0)
+	}
+
+	pages := []*Page{}
+
+	for len(pages) < maxPages {
+		controller.waitWhilePaused()
+
+		// the frontier pauses when the crawl window closes and resumes when one opens
+		waitForCrawlWindows(crawlWindows)
+
+		if controller.shouldSkipSite() || isCrawlBudgetExceeded() || isCrawlAborted() {
+			break
+		}
+
+		// the site may have reached its budget with its images
+		if isSiteBudgetExceeded(site, siteBytes) {
+			if !site.Truncated {
+				printInfo("Site byte budget was reached:", site.URL)
+				site.Truncated = true
+				emitEvent("site_truncated", site, site.URL, nil, map[string]interface{}{"bytes": siteBytes})
+			}
+
+			break
+		}
+
+		item, err := frontier.Next()
+
+		if err != nil {
+			printError("Unable to get next page of site frontier:", err)
+			break
+		}
+
+		if item == nil {
+			break
+		}
+
+		page := pagesByURL[normalizeURL(item.URL)]
+
+		if page == nil {
+			page = &Page{URL: item.URL}
+		}
+
+		page.Depth = item.Depth
+
+		// the pages saved by the processor of their type keep their file
+		if isHTMLContentType(page.ContentType) {
+			page.FileName = pagesDirName + "/" + getPageFileName(item.URL)
+		}
+		pages = append(pages, page)
+
+		content, doc := getSitePageContent(site, siteDir, page, fetcher, len(pages), maxPages, &siteBytes)
+
+		if content != nil {
+			page.ContentHash = getContentHash(content)
+			page.Canonical = getCanonicalURLFromDocument(doc, page.URL)
+			page.DuplicateOf = ""
+			canonicalKey := getCanonicalKey(page.URL, page.Canonical)
+
+			if firstURL, exists := canonicalPages[canonicalKey]; exists {
+				printInfo("Page is a duplicate by its canonical url of:", firstURL)
+				page.DuplicateOf = firstURL
+				removeSitePageFiles(siteDir, page)
+				emitEvent("page_skipped", site, page.URL, nil, map[string]interface{}{"duplicate_of": firstURL})
+				frontier.Done(item)
+				continue
+			}
+
+			canonicalPages[canonicalKey] = page.URL
+
+			// the canonical url is not fetched again when a link has it
+			if canonicalKey != normalizeURL(page.URL) {
+				if _, err := frontier.Visit(page.Canonical); err != nil {
+					printError("Unable to add page to site frontier:", err)
+				}
+			}
+
+			if configuration.Articles {
+				page.Article = getArticleFromDocument(doc)
+			}
+
+			if configuration.Forms {
+				page.Forms = getFormsFromDocument(doc, page.URL)
+			}
+
+			links := getLinksFromDocument(doc, page.URL)
+			allLinks = append(allLinks, links...)
+
+			if robotsPolicy != robotsPolicyRespect || !hasString(page.Robots, "nofollow") {
+				addLinks(links, page.Depth)
+			}
+		}
+
+		frontier.Done(item)
+		checkpointPage(site, pages)
+	}
+
+	// the other processes of a shared frontier crawl the other pages of the site, so the pages of the previous runs
+	// are kept
+	if _, isShared := frontier.(*RedisFrontier); isShared {
+		pages = mergeSitePages(site.Pages, pages)
+	}
+
+	site.Pages = pages
+
+	if isPageLayoutMirror() {
+		if err := savePagesIndex(site, siteDir); err != nil {
+			printError("Unable to save pages index:", err)
+		}
+	}
+
+	return allLinks
+}
+
+// mergeSitePages returns the crawled pages with the previous pages that were not crawled again
+func mergeSitePages(previousPages []*Page, pages []*Page) []*Page {
+	crawledURLs := map[string]bool{}
+
+	for _, page := range pages {
+		crawledURLs[normalizeURL(page.URL)] = true
+	}
+
+	for _, page := range previousPages {
+		if !crawledURLs[normalizeURL(page.URL)] {
+			pages = append(pages, page)
+		}
+	}
+
+	return pages
+}
+
+// getSitePageContent returns the saved content of the page, or fetches and saves it, with its parsed document,
+// adding the fetched bytes to the bytes of the site. It returns nil when the page can't be fetched
+func getSitePageContent(site *Site, siteDir string, page *Page, fetcher Fetcher, pageNumber int, maxPages int, siteBytes *int64) ([]byte, *goquery.Document) {
+	pageFileName := siteDir + string(filepath.Separator) + filepath.FromSlash(page.FileName)
+
+	// with snapshots every run fetches the pages again
+	if page.FetchSuccess && !configuration.Snapshots && !isHTMLContentType(page.ContentType) {
+		if _, err := os.Stat(pageFileName); err == nil {
+			return nil, nil
+		}
+
+		page.FetchSuccess = false
+	}
+
+	if page.FetchSuccess && !configuration.Snapshots {
+		content, err := ioutil.ReadFile(pageFileName)
+
+		if err == nil {
+			doc, err := parseHTML(content)
+
+			if err == nil {
+				return content, doc
+			}
+		}
+
+		page.FetchSuccess = false
+	}
+
+	printInfo(fmt.Sprintf("Getting page %d of %d (depth %d) - %s...", pageNumber, maxPages, page.Depth, page.URL))
+
+	content, contentType, statusCode, err := fetchSitePage(site, fetcher, page.URL)
+	page.StatusCode = statusCode
+
+	if circuit := getRecordedRequestCircuit(page.URL); circuit != nil {
+		page.CircuitID = circuit.ID
+	}
+
+	if skipError, ok := err.(*SkipError); ok {
+		printInfo("Page skipped by rule:", page.URL, skipError.Reason)
+		page.FetchSuccess = false
+		emitEvent("page_skipped", site, page.URL, nil, map[string]interface{}{"skip_reason": skipError.Reason})
+		return nil, nil
+	}
+
+	var doc *goquery.Document
+
+	if err == nil {
+		crawledBytes += int64(len(content))
+		*siteBytes += int64(len(content))
+		page.BodyTruncated = checkPageBodyTruncated(site, page.URL)
+
+		// the content is handled by the processor of its type, only the html pages have a document. The pages
+		// without a content type are html
+		if contentType == "" {
+			contentType = "text/html"
+		}
+
+		fetched := &FetchedContent{Site: site, SiteDir: siteDir, URL: page.URL, ContentType: contentType, Content: content, FileName: pageFileName}
+		err = processFetchedContent(fetched)
+		page.ContentType = fetched.ContentType
+		doc = fetched.Document
+
+		if err == nil && doc == nil {
+			setProcessedPage(site, siteDir, page, fetched)
+			return nil, nil
+		}
+	}
+
+	// the pages are not retried, only the alerts and the abort of the policies apply to them
+	if err != nil {
+		printError("Unable to fetch page:", page.URL, err)
+		page.FetchSuccess = false
+		class := getErrorClass(err)
+		applyErrorPolicy(site, page.URL, class, err)
+		emitEvent("page_failed", site, page.URL, err, map[string]interface{}{"error_class": class})
+		return nil, nil
+	}
+
+	robotsPolicy := getRobotsPolicy(site)
+	page.Robots = nil
+
+	if robotsPolicy != robotsPolicyIgnore {
+		page.Robots = getRobotsDirectivesFromDocument(doc)
+	}
+
+	// pages that ask to not be indexed are not archived, but their links are followed
+	if robotsPolicy == robotsPolicyRespect && hasString(page.Robots, "noindex") {
+		printInfo("Page is not archived by its robots meta tag:", page.URL)
+		page.FetchSuccess = false
+		emitEvent("page_skipped", site, page.URL, nil, map[string]interface{}{"robots": page.Robots})
+		return content, doc
+	}
+
+	err = os.MkdirAll(filepath.Dir(pageFileName), dirMode)
+
+	if err == nil {
+		htmlContent := content
+
+		if isFramesEnabled() {
+			framesPath := strings.Repeat("../", strings.Count(page.FileName, "/")) + framesDirName + "/"
+			htmlContent = captureFrames(site, siteDir, framesPath, page.URL, content, fetcher)
+		}
+
+		err = saveHTMLFile(pageFileName, page.URL, htmlContent)
+	}
+
+	if err != nil {
+		printError("Unable to save page content:", err)
+		page.FetchSuccess = false
+		err = newStorageError(err)
+		applyErrorPolicy(site, page.URL, errorClassStorage, err)
+		emitEvent("page_failed", site, page.URL, err, map[string]interface{}{"error_class": errorClassStorage})
+		return nil, nil
+	}
+
+	page.FetchSuccess = true
+	page.FetchedAt = time.Now().UTC()
+	emitEvent("page_fetched", site, page.URL, nil, map[string]interface{}{"bytes": len(content), "depth": page.Depth})
+	publishFetched("page_fetched", site, page.URL, map[string]interface{}{"status_code": page.StatusCode, "depth": page.Depth, "content_hash": getContentHash(content)}, getBytesContent(content))
+
+	return content, doc
+}
+
+// setProcessedPage sets the page saved by the processor of its type
+func setProcessedPage(site *Site, siteDir string, page *Page, fetched *FetchedContent) {
+	if fileName, err := filepath.Rel(siteDir, fetched.FileName); err == nil {
+		page.FileName = filepath.ToSlash(fileName)
+	}
+
+	page.FetchSuccess = true
+	page.FetchedAt = time.Now().UTC()
+	page.ContentHash = getContentHash(fetched.Content)
+
+	if fetched.Quarantined {
+		printInfo("Page was quarantined:", page.URL, fetched.ContentType, fetched.ScanResult)
+		emitEvent("page_quarantined", site, page.URL, nil, map[string]interface{}{"content_type": fetched.ContentType, "scan_result": fetched.ScanResult})
+		return
+	}
+
+	emitEvent("page_fetched", site, page.URL, nil, map[string]interface{}{"bytes": len(fetched.Content), "depth": page.Depth, "content_type": fetched.ContentType})
+	publishFetched("page_fetched", site, page.URL, map[string]interface{}{"status_code": page.StatusCode, "depth": page.Depth, "content_hash": page.ContentHash}, getBytesContent(fetched.Content))
+}
+
+// setProcessedSite archives the site whose content is not html as its first page, with the file saved by the
+// processor of its type
+func setProcessedSite(site *Site, siteDir string, fetched *FetchedContent) {
+	page := &Page{URL: site.URL, ContentType: fetched.ContentType, StatusCode: site.StatusCode, FetchSuccess: true, FetchedAt: time.Now().UTC(), ContentHash: getContentHash(fetched.Content)}
+
+	if fileName, err := filepath.Rel(siteDir, fetched.FileName); err == nil {
+		page.FileName = filepath.ToSlash(fileName)
+	}
+
+	if fetched.Quarantined {
+		printInfo("Site content was quarantined:", site.URL, fetched.ContentType, fetched.ScanResult)
+		emitEvent("page_quarantined", site, site.URL, nil, map[string]interface{}{"content_type": fetched.ContentType, "scan_result": fetched.ScanResult})
+	}
+
+	site.Pages = []*Page{page}
+	site.ContentHash = page.ContentHash
+	site.FetchSuccess = true
+	site.FailureCount = 0
+}
+
+// isProcessedSite returns if the site content is not html, it was saved by the processor of its type as the first
+// page of the site
+func isProcessedSite(site *Site) bool {
+	return site.API == nil && len(site.Pages) > 0 && site.Pages[0].URL == site.URL && !isHTMLContentType(site.Pages[0].ContentType)
+}
+
+// removeSitePageFiles removes the saved files of a page that is not archived
+func removeSitePageFiles(siteDir string, page *Page) {
+	pageFileName := siteDir + string(filepath.Separator) + filepath.FromSlash(page.FileName)
+
+	os.Remove(pageFileName)
+	os.Remove(strings.TrimSuffix(pageFileName, ".html") + ".md")
+	page.FetchSuccess = false
+}
+
+func saveLinks(fileName string, links []*Link) error {
+	linksJSON, err := json.MarshalIndent(links, "", "\t")
+
+	if err != nil {
+		return err
+	}
+
+	return writeFile(fileName, linksJSON, fileMode)
+}
+
+func fetchPage(fetcher Fetcher, pageURL string) ([]byte, int, error) {
+	response, err := getURL(fetcher, pageURL)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer response.Body.Close()
+
+	if !isSuccessStatusCode(response.StatusCode) {
+		return nil, response.StatusCode, &StatusError{URL: pageURL, StatusCode: response.StatusCode}
+	}
+
+	content, err := readPageBody(response.Body, pageURL)
+
+	return content, response.StatusCode, err
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const dataURIModeDecode = "decode"
+const dataURIDirName = "data-uri"
+
+var defaultAllowedSchemes = []string{"http", "https"}
+
+var dataURIImageExtensions = map[string]string{
+	"image/png":     "png",
+	"image/jpeg":    "jpg",
+	"image/jpg":     "jpg",
+	"image/gif":     "gif",
+	"image/svg+xml": "svg",
+	"image/x-icon":  "ico",
+}
+
+func getURLScheme(value string) string {
+	// relative urls have no scheme
+	index := strings.Index(value, ":")
+
+	if index <= 0 || strings.ContainsAny(value[:index], "/?#") {
+		return ""
+	}
+
+	return strings.ToLower(value[:index])
+}
+
+func isAllowedScheme(scheme string) bool {
+	allowedSchemes := defaultAllowedSchemes
+
+	if len(configuration.AllowedSchemes) > 0 {
+		allowedSchemes = configuration.AllowedSchemes
+	}
+
+	for _, allowedScheme := range allowedSchemes {
+		if strings.EqualFold(allowedScheme, scheme) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func getImageFromDataURI(value string) *Image {
+	if configuration.DataURIMode != dataURIModeDecode {
+		return nil
+	}
+
+	mediaType, data, err := parseDataURI(value)
+
+	if err != nil {
+		printError("Invalid data URI:", err)
+		return nil
+	}
+
+	extension, exists := dataURIImageExtensions[mediaType]
+
+	if !exists {
+		printInfo("Data URI media type is not an image:", mediaType)
+		return nil
+	}
+
+	// name the file by its content so the same data uri is saved only once
+	hash := sha256.Sum256(data)
+
+	return &Image{
+		URL:     fmt.Sprintf("%s/%x.%s", dataURIDirName, hash[:8], extension),
+		DataURI: value,
+	}
+}
+
+func parseDataURI(value string) (string, []byte, error) {
+	if getURLScheme(value) != "data" {
+		return "", nil, errors.New("not a data URI")
+	}
+
+	// data:[<media type>][;base64],<data>
+	value = value[len("data:"):]
+	index := strings.Index(value, ",")
+
+	if index < 0 {
+		return "", nil, errors.New("data URI without data")
+	}
+
+	header := value[:index]
+	content := value[index+1:]
+	isBase64 := false
+
+	if strings.HasSuffix(strings.ToLower(header), ";base64") {
+		isBase64 = true
+		header = header[:len(header)-len(";base64")]
+	}
+
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(header, ";")[0]))
+
+	if mediaType == "" {
+		mediaType = "text/plain"
+	}
+
+	if isBase64 {
+		// whitespace is common inside base64 data uris
+		content = strings.Join(strings.Fields(content), "")
+		data, err := base64.StdEncoding.DecodeString(content)
+
+		if err != nil {
+			data, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(content, "="))
+		}
+
+		return mediaType, data, err
+	}
+
+	data, err := url.PathUnescape(content)
+
+	return mediaType, []byte(data), err
+}
+
+func saveDataURI(fileName string, value string) error {
+	_, data, err := parseDataURI(value)
+
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(fileName), dirMode)
+
+	if err != nil {
+		return err
+	}
+
+	return writeFile(fileName, data, fileMode)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// assetDownloads makes each asset be downloaded once per run: the images with the same normalized url, in the same
+// page or in other sites, wait for the first download and share its result
+var assetDownloads = struct {
+	sync.Mutex
+	downloads map[string]*assetDownload
+}{downloads: map[string]*assetDownload{}}
+
+type assetDownload struct {
+	done     chan struct{}
+	image    *Image
+	fileName string
+}
+
+// startAssetDownload returns the download of the url and if the caller is the first one, that must download it
+func startAssetDownload(url string) (*assetDownload, bool) {
+	key := normalizeURL(url)
+
+	assetDownloads.Lock()
+	defer assetDownloads.Unlock()
+
+	if download, exists := assetDownloads.downloads[key]; exists {
+		return download, false
+	}
+
+	download := &assetDownload{done: make(chan struct{})}
+	assetDownloads.downloads[key] = download
+
+	return download, true
+}
+
+// finishAssetDownload shares the result of the download with the waiting images, the failed downloads are
+// forgotten so a later attempt of the run can try again
+func finishAssetDownload(url string, download *assetDownload, image *Image, fileName string) {
+	imageCopy := *image
+	download.image = &imageCopy
+	download.fileName = fileName
+
+	if !image.FetchSuccess && image.SkipReason == "" {
+		assetDownloads.Lock()
+		delete(assetDownloads.downloads, normalizeURL(url))
+		assetDownloads.Unlock()
+	}
+
+	close(download.done)
+}
+
+// useAssetDownload waits for the first download of the image and copies its result, returning if the image is
+// done and if it was downloaded. The images of other site dirs get a link to the downloaded file and are not done,
+// so their thumbnail is created
+func useAssetDownload(download *assetDownload, image *Image, fileName string) (bool, bool) {
+	<-download.done
+	first := download.image
+
+	if !first.FetchSuccess {
+		image.FetchSuccess = false
+		image.SkipReason = first.SkipReason
+		return true, false
+	}
+
+	image.FetchSuccess = true
+	image.ContentHash = first.ContentHash
+	image.ContentType = first.ContentType
+	image.Quarantined = first.Quarantined
+	image.ScanResult = first.ScanResult
+	image.Metadata = first.Metadata
+	image.PerceptualHash = first.PerceptualHash
+
+	if first.Quarantined {
+		fileName += quarantineSuffix
+	}
+
+	if filepath.Clean(fileName) == filepath.Clean(download.fileName) {
+		return true, true
+	}
+
+	if _, err := os.Stat(fileName); os.IsNotExist(err) {
+		if err := linkAssetFile(download.fileName, fileName); err != nil {
+			printError("Unable to link downloaded image:", err)
+			image.FetchSuccess = false
+			return true, false
+		}
+	}
+
+	return first.Quarantined, true
+}
+
+// linkAssetFile hard links the file, or copies it when the file system doesn't support links
+func linkAssetFile(sourceFileName string, targetFileName string) error {
+	if err := os.MkdirAll(filepath.Dir(targetFileName), dirMode); err != nil {
+		return err
+	}
+
+	if err := os.Link(sourceFileName, targetFileName); err == nil {
+		return nil
+	}
+
+	return copyFile(sourceFileName, targetFileName)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"golang.org/x/net/html"
+)
+
+const checksumsFileName = "SHA256SUMS"
+
+// saveHTMLFile saves a fetched page, in deterministic mode the html is saved in its canonical form and with
+// markdown enabled the markdown of the page is saved next to it
+func saveHTMLFile(fileName string, pageURL string, content []byte) error {
+	if configuration.Deterministic {
+		content = getCanonicalHTML(content)
+	}
+
+	err := writeFile(fileName, content, fileMode)
+
+	if err != nil {
+		return err
+	}
+
+	if configuration.SaveMarkdown {
+		if err := saveMarkdownFile(fileName, pageURL, content); err != nil {
+			printError("Unable to save page markdown:", err)
+		}
+	}
+
+	if configuration.SafeView {
+		if err := saveSafeViewFile(fileName, content); err != nil {
+			printError("Unable to save page safe view:", err)
+		}
+	}
+
+	return nil
+}
+
+// getCanonicalHTML renders the html again with the attributes of each element sorted by name, so pages with the
+// same content are always saved with the same bytes
+func getCanonicalHTML(content []byte) []byte {
+	doc, err := html.Parse(bytes.NewReader(content))
+
+	if err != nil {
+		return content
+	}
+
+	var sortAttributes func(node *html.Node)
+
+	sortAttributes = func(node *html.Node) {
+		if node.Type == html.ElementNode {
+			sort.SliceStable(node.Attr, func(i, j int) bool {
+				if node.Attr[i].Namespace != node.Attr[j].Namespace {
+					return node.Attr[i].Namespace < node.Attr[j].Namespace
+				}
+
+				return node.Attr[i].Key < node.Attr[j].Key
+			})
+		}
+
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			sortAttributes(child)
+		}
+	}
+
+	sortAttributes(doc)
+
+	buffer := &bytes.Buffer{}
+
+	if err := html.Render(buffer, doc); err != nil {
+		return content
+	}
+
+	return buffer.Bytes()
+}
+
+// saveChecksums writes the sha256 of every site file, sorted by path, so two crawls can be compared by this
+// file alone
+func saveChecksums(siteDir string) error {
+	snapshotsDir := filepath.Join(siteDir, snapshotsDirName)
+	checksumsFile := filepath.Join(siteDir, checksumsFileName)
+	buffer := &bytes.Buffer{}
+
+	err := filepath.Walk(siteDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if path == snapshotsDir {
+			return filepath.SkipDir
+		}
+
+		if info.IsDir() || path == checksumsFile {
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(siteDir, path)
+
+		if err != nil {
+			return err
+		}
+
+		file, err := os.Open(path)
+
+		if err != nil {
+			return err
+		}
+
+		defer file.Close()
+
+		hash := sha256.New()
+
+		if _, err := io.Copy(hash, file); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(buffer, "%x  %s\n", hash.Sum(nil), filepath.ToSlash(relativePath))
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return writeFile(checksumsFile, buffer.Bytes(), fileMode)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	approvalPending  = "pending"
+	approvalRejected = "rejected"
+)
+
+// isSiteApproved returns if the site can be crawled, the sites found in directories wait for their approval
+func isSiteApproved(site *Site) bool {
+	return site.Approval == ""
+}
+
+// harvestDirectorySites adds the onion sites linked by the directory site, from its seed page and its crawled
+// pages. The new sites are pending until approved, or crawled in this run with auto_approve_directories
+func harvestDirectorySites(site *Site, siteDir string, seedDoc *goquery.Document) {
+	docs := []*goquery.Document{seedDoc}
+
+	for _, page := range site.Pages {
+		if !page.FetchSuccess || !isHTMLContentType(page.ContentType) {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(siteDir + string(filepath.Separator) + filepath.FromSlash(page.FileName))
+
+		if err != nil {
+			continue
+		}
+
+		doc, err := parseHTML(content)
+
+		if err != nil {
+			continue
+		}
+
+		docs = append(docs, doc)
+	}
+
+	texts := []string{}
+
+	for _, doc := range docs {
+		texts = append(texts, getDocumentOnionTexts(doc)...)
+	}
+
+	existingURLs := map[string]bool{}
+
+	for _, existingSite := range configuration.Sites {
+		existingURLs[normalizeURL(existingSite.URL)] = true
+	}
+
+	added := 0
+
+	for _, siteURL := range getDiscoveredOnionURLs(texts, getURLHost(site.URL)) {
+		if existingURLs[normalizeURL(siteURL)] {
+			continue
+		}
+
+		existingURLs[normalizeURL(siteURL)] = true
+		newSite := &Site{URL: siteURL, Tags: append([]string{}, site.Tags...), DiscoveredFrom: site.URL, Project: site.Project}
+
+		if configuration.AutoApproveDirectories {
+			crawlQueue = append(crawlQueue, newSite)
+		} else {
+			newSite.Approval = approvalPending
+		}
+
+		configuration.Sites = append(configuration.Sites, newSite)
+		emitEvent("site_discovered", newSite, siteURL, nil, map[string]interface{}{"directory": site.URL, "approval": newSite.Approval})
+		added++
+	}
+
+	if added > 0 {
+		printInfo(fmt.Sprintf("Found %d new sites in directory", added))
+	}
+}
+
+func runApproveCommand(args []string) {
+	flags := flag.NewFlagSet("approve", flag.ExitOnError)
+	reject := flags.Bool("reject", false, "reject the sites, they are kept so they are not added again")
+	all := flags.Bool("all", false, "approve or reject all pending sites")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		fmt.Printf("Usage : %s approve [-reject] [-all] <configuration file> [url]... \n", os.Args[0])
+		os.Exit(exitCodeConfigError)
+	}
+
+	configurationFileName = flags.Arg(0)
+
+	loadConfigurationFile()
+
+	urls := map[string]bool{}
+
+	for _, value := range flags.Args()[1:] {
+		urls[normalizeURL(value)] = true
+	}
+
+	// without urls the pending sites are listed
+	if len(urls) == 0 && !*all {
+		pending := 0
+
+		for _, site := range configuration.Sites {
+			if site.Approval == approvalPending {
+				fmt.Println(fmt.Sprintf("%s (from %s)", site.URL, site.DiscoveredFrom))
+				pending++
+			}
+		}
+
+		fmt.Println(fmt.Sprintf("%d sites are pending", pending))
+		return
+	}
+
+	approval := ""
+
+	if *reject {
+		approval = approvalRejected
+	}
+
+	changed := 0
+
+	for _, site := range configuration.Sites {
+		if (*all && site.Approval == approvalPending) || urls[normalizeURL(site.URL)] {
+			delete(urls, normalizeURL(site.URL))
+
+			if site.Approval != approval {
+				site.Approval = approval
+				changed++
+			}
+		}
+	}
+
+	for value := range urls {
+		fmt.Println("Site not found:", value)
+	}
+
+	saveConfigurationFile()
+
+	if *reject {
+		fmt.Println(fmt.Sprintf("Rejected %d sites", changed))
+		return
+	}
+
+	fmt.Println(fmt.Sprintf("Approved %d sites", changed))
+}
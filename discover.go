@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	searchEngineFormatHTML = "html"
+	searchEngineFormatJSON = "json"
+)
+
+const searchEngineQueryPlaceholder = "{query}"
+
+// the onion service of Ahmia, used when the configuration has no search engine
+var defaultSearchEngines = []*SearchEngineConfig{
+	{Name: "ahmia", URL: "http://juhanurmihxlp77nkq76byazcldy2hlmovfu2epvl5ankdibsot4csyd.onion/search/?q=" + searchEngineQueryPlaceholder, Format: searchEngineFormatHTML},
+}
+
+// the onion urls of the results, with their scheme when they have one
+var discoveredOnionPattern = regexp.MustCompile(`(?i)\b(https?://)?((?:[a-z0-9-]+\.)*(?:[a-z2-7]{56}|[a-z2-7]{16})\.onion)\b`)
+
+// SearchEngineConfig is a search engine queried by the discover command, the url has a "{query}" placeholder
+// replaced by the keyword. The "html" format gets the onion urls of the links and text of the result page and the
+// "json" format gets them from the strings of the results of a search api
+type SearchEngineConfig struct {
+	Name   string `json:"name,omitempty"`
+	URL    string `json:"url"`
+	Format string `json:"format,omitempty"`
+}
+
+func getSearchEngines() []*SearchEngineConfig {
+	if len(configuration.SearchEngines) == 0 {
+		return defaultSearchEngines
+	}
+
+	return configuration.SearchEngines
+}
+
+func getSearchEngineName(engine *SearchEngineConfig) string {
+	if engine.Name != "" {
+		return engine.Name
+	}
+
+	return getURLHost(engine.URL)
+}
+
+// searchOnionURLs queries the search engine for the keyword through the fetcher of the crawl, so the engines are
+// reached over Tor
+func searchOnionURLs(fetcher Fetcher, engine *SearchEngineConfig, keyword string) ([]string, error) {
+	searchURL := strings.Replace(engine.URL, searchEngineQueryPlaceholder, url.QueryEscape(keyword), -1)
+	response, err := getURL(fetcher, searchURL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		return nil, fmt.Errorf("search engine returned status code %d", response.StatusCode)
+	}
+
+	content, err := ioutil.ReadAll(response.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	texts, err := getSearchResultTexts(content, engine.Format)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return getDiscoveredOnionURLs(texts, getURLHost(engine.URL)), nil
+}
+
+// getSearchResultTexts returns the texts of the result page where the onion urls are searched: the links, that
+// can be redirects of the engine with the url in their query, and the text of the html pages, or the strings of
+// the json results
+func getSearchResultTexts(content []byte, format string) ([]string, error) {
+	result := []string{}
+
+	if format == searchEngineFormatJSON {
+		var value interface{}
+
+		if err := json.Unmarshal(content, &value); err != nil {
+			return nil, err
+		}
+
+		var addStrings func(value interface{})
+
+		addStrings = func(value interface{}) {
+			switch value := value.(type) {
+			case string:
+				result = append(result, value)
+			case []interface{}:
+				for _, item := range value {
+					addStrings(item)
+				}
+			case map[string]interface{}:
+				for _, item := range value {
+					addStrings(item)
+				}
+			}
+		}
+
+		addStrings(value)
+
+		return result, nil
+	}
+
+	doc, err := parseHTML(content)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return getDocumentOnionTexts(doc), nil
+}
+
+// getDocumentOnionTexts returns the links of the page, unescaped so the urls in their query are found, and its text
+func getDocumentOnionTexts(doc *goquery.Document) []string {
+	result := []string{}
+
+	doc.Find("a[href]").Each(func(index int, link *goquery.Selection) {
+		href, _ := link.Attr("href")
+
+		if unescapedHref, err := url.QueryUnescape(href); err == nil {
+			href = unescapedHref
+		}
+
+		result = append(result, href)
+	})
+
+	return append(result, doc.Text())
+}
+
+// getDiscoveredOnionURLs returns the site urls of the onion addresses of the texts, without the host of the
+// engine or page, the addresses without scheme are fetched with http
+func getDiscoveredOnionURLs(texts []string, ignoredHost string) []string {
+	result := []string{}
+	foundURLs := map[string]bool{}
+
+	for _, text := range texts {
+		for _, match := range discoveredOnionPattern.FindAllStringSubmatch(text, -1) {
+			scheme := strings.ToLower(match[1])
+			host := strings.ToLower(match[2])
+
+			if scheme == "" {
+				scheme = "http://"
+			}
+
+			if host == ignoredHost || foundURLs[host] {
+				continue
+			}
+
+			foundURLs[host] = true
+			result = append(result, scheme+host)
+		}
+	}
+
+	return result
+}
+
+func runDiscoverCommand(args []string) {
+	flags := flag.NewFlagSet("discover", flag.ExitOnError)
+	engineName := flags.String("engine", "", "only query the search engine with this name")
+	tags := flags.String("tags", "", "comma separated tags of the discovered sites")
+	limit := flags.Int("limit", 0, "add at most this number of sites (0 adds all)")
+	dryRun := flags.Bool("dry-run", false, "only print the discovered sites, without adding them")
+	flags.Parse(args)
+
+	if flags.NArg() < 2 || *limit < 0 {
+		fmt.Printf("Usage : %s discover [-engine name] [-tags a,b] [-limit n] [-dry-run] <configuration file> <keyword>... \n", os.Args[0])
+		os.Exit(exitCodeConfigError)
+	}
+
+	configurationFileName = flags.Arg(0)
+
+	loadConfigurationFile()
+
+	engines := []*SearchEngineConfig{}
+
+	for _, engine := range getSearchEngines() {
+		if *engineName == "" || getSearchEngineName(engine) == *engineName {
+			engines = append(engines, engine)
+		}
+	}
+
+	if len(engines) == 0 {
+		fmt.Println("Unknown search engine:", *engineName)
+		os.Exit(exitCodeConfigError)
+	}
+
+	err := setupTorDialer()
+
+	if err != nil {
+		fmt.Println("Unable to setup Tor proxy:", err)
+		os.Exit(exitCodeConfigError)
+	}
+
+	fetcher := newFetcher()
+	existingURLs := map[string]bool{}
+
+	for _, site := range configuration.Sites {
+		existingURLs[normalizeURL(site.URL)] = true
+	}
+
+	added := 0
+	failedSearches := 0
+	keywords := flags.Args()[1:]
+
+	for _, keyword := range keywords {
+		for _, engine := range engines {
+			if *limit > 0 && added >= *limit {
+				break
+			}
+
+			siteURLs, err := searchOnionURLs(fetcher, engine, keyword)
+
+			if err != nil {
+				fmt.Println(fmt.Sprintf("Unable to search %s for %q: %v", getSearchEngineName(engine), keyword, err))
+				failedSearches++
+				continue
+			}
+
+			for _, siteURL := range siteURLs {
+				if existingURLs[normalizeURL(siteURL)] || (*limit > 0 && added >= *limit) {
+					continue
+				}
+
+				existingURLs[normalizeURL(siteURL)] = true
+				added++
+				fmt.Println(siteURL)
+
+				if !*dryRun {
+					configuration.Sites = append(configuration.Sites, &Site{URL: siteURL, Tags: getTags(*tags)})
+				}
+			}
+		}
+	}
+
+	if failedSearches == len(keywords)*len(engines) {
+		fmt.Println("Unable to discover sites, all searches failed")
+		os.Exit(exitCodeTotalFailure)
+	}
+
+	if *dryRun {
+		fmt.Println(fmt.Sprintf("Discovered %d new sites", added))
+		return
+	}
+
+	if added > 0 {
+		saveConfigurationFile()
+	}
+
+	fmt.Println(fmt.Sprintf("Discovered and added %d new sites", added))
+}
@@ -0,0 +1,33 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+func getFreeDiskSpace(dir string) (uint64, error) {
+	var freeBytesAvailable, totalBytes, totalFreeBytes uint64
+
+	dirPointer, err := syscall.UTF16PtrFromString(dir)
+
+	if err != nil {
+		return 0, err
+	}
+
+	getDiskFreeSpaceEx := syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+	result, _, err := getDiskFreeSpaceEx.Call(
+		uintptr(unsafe.Pointer(dirPointer)),
+		uintptr(unsafe.Pointer(&freeBytesAvailable)),
+		uintptr(unsafe.Pointer(&totalBytes)),
+		uintptr(unsafe.Pointer(&totalFreeBytes)),
+	)
+
+	if result == 0 {
+		return 0, err
+	}
+
+	return freeBytesAvailable, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// bodies above this size are truncated, so a huge page doesn't exhaust the memory of the crawl
+const defaultMaxPageBytes = 32 * 1024 * 1024
+
+// the urls of the last bodies that were truncated
+var (
+	truncatedPageBodies      = map[string]bool{}
+	truncatedPageBodiesMutex sync.Mutex
+)
+
+// getMaxPageBytes returns the max size of the bodies, a negative value reads the whole bodies
+func getMaxPageBytes() int64 {
+	if configuration.MaxPageBytes == 0 {
+		return defaultMaxPageBytes
+	}
+
+	return configuration.MaxPageBytes
+}
+
+// readPageBody reads the body up to the max page size, the rest of a bigger body is not downloaded
+func readPageBody(body io.Reader, pageURL string) ([]byte, error) {
+	maxPageBytes := getMaxPageBytes()
+
+	if maxPageBytes < 0 {
+		return ioutil.ReadAll(body)
+	}
+
+	// one more byte tells if the body is bigger than the limit
+	content, err := ioutil.ReadAll(io.LimitReader(body, maxPageBytes+1))
+	truncated := int64(len(content)) > maxPageBytes
+
+	if truncated {
+		printInfo(fmt.Sprintf("Page body is above %s and was truncated: %s", formatBytes(maxPageBytes), pageURL))
+		content = content[:maxPageBytes]
+	}
+
+	truncatedPageBodiesMutex.Lock()
+
+	if truncated {
+		truncatedPageBodies[normalizeURL(pageURL)] = true
+	} else {
+		delete(truncatedPageBodies, normalizeURL(pageURL))
+	}
+
+	truncatedPageBodiesMutex.Unlock()
+
+	return content, err
+}
+
+// checkPageBodyTruncated returns if the last body of the page was truncated by the max page size, emitting a
+// "page_truncated" event when it was
+func checkPageBodyTruncated(site *Site, pageURL string) bool {
+	truncatedPageBodiesMutex.Lock()
+	truncated := truncatedPageBodies[normalizeURL(pageURL)]
+	delete(truncatedPageBodies, normalizeURL(pageURL))
+	truncatedPageBodiesMutex.Unlock()
+
+	if truncated {
+		emitEvent("page_truncated", site, pageURL, nil, map[string]interface{}{"max_page_bytes": getMaxPageBytes()})
+	}
+
+	return truncated
+}
+
+// parseHTML parses the page once, its document is shared by the title, images, links and the other extractions
+// of the page instead of parsing the content again for each one
+func parseHTML(content []byte) (*goquery.Document, error) {
+	return goquery.NewDocumentFromReader(bytes.NewReader(content))
+}
+
+// getVisibleText returns the text of the selection without the script, style and noscript elements, without
+// removing them from the shared document
+func getVisibleText(selection *goquery.Selection) string {
+	var buffer strings.Builder
+	var walk func(node *html.Node)
+
+	walk = func(node *html.Node) {
+		if node.Type == html.TextNode {
+			buffer.WriteString(node.Data)
+			return
+		}
+
+		if node.Type == html.ElementNode && (node.Data == "script" || node.Data == "style" || node.Data == "noscript") {
+			return
+		}
+
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+
+	for _, node := range selection.Nodes {
+		walk(node)
+	}
+
+	return buffer.String()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// bytes that http.DetectContentType reads to sniff the type
+const sniffLength = 512
+
+// DownloadResult is what the download learned of the file while writing it, so the file is not read again to
+// get its hash, size and type
+type DownloadResult struct {
+	Bytes       int64
+	ContentHash string
+	ContentType string
+}
+
+// DownloadLimitError is returned for the files above the max asset size, that are removed
+type DownloadLimitError struct {
+	URL      string
+	MaxBytes int64
+}
+
+func (err *DownloadLimitError) Error() string {
+	return fmt.Sprintf("asset is above %s: %s", formatBytes(err.MaxBytes), err.URL)
+}
+
+// sniffWriter keeps the first bytes of the stream to detect its type
+type sniffWriter struct {
+	content []byte
+}
+
+func (writer *sniffWriter) Write(data []byte) (int, error) {
+	if missing := sniffLength - len(writer.content); missing > 0 {
+		if len(data) < missing {
+			missing = len(data)
+		}
+
+		writer.content = append(writer.content, data[:missing]...)
+	}
+
+	return len(data), nil
+}
+
+// streamToFile writes the body to the file in a single pass, hashing, counting and sniffing it on the way and
+// stopping when it is above the max asset size
+func streamToFile(out io.Writer, body io.Reader, url string) (*DownloadResult, error) {
+	contentHash := sha256.New()
+	sniffer := &sniffWriter{}
+	maxBytes := configuration.MaxAssetBytes
+
+	if maxBytes > 0 {
+		// one more byte tells if the body is bigger than the limit
+		body = io.LimitReader(body, maxBytes+1)
+	}
+
+	written, err := io.Copy(io.MultiWriter(out, contentHash, sniffer), body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if maxBytes > 0 && written > maxBytes {
+		return nil, &DownloadLimitError{URL: url, MaxBytes: maxBytes}
+	}
+
+	return &DownloadResult{
+		Bytes:       written,
+		ContentHash: fmt.Sprintf("%x", contentHash.Sum(nil)),
+		ContentType: http.DetectContentType(sniffer.content),
+	}, nil
+}
+
+func downloadFile(fileName string, url string) (*DownloadResult, error) {
+	// get the file data
+	resp, err := getURL(newFetcher(), url)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if !isSuccessStatusCode(resp.StatusCode) {
+		return nil, &StatusError{URL: url, StatusCode: resp.StatusCode}
+	}
+
+	// create the file
+	os.MkdirAll(filepath.Dir(fileName), dirMode)
+
+	out, err := createFile(fileName, fileMode)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// write the body to file
+	result, err := streamToFile(out, resp.Body, url)
+
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	// partial files are not kept
+	if err != nil {
+		os.Remove(fileName)
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const defaultTitleSimilarity = 0.8
+
+// sites are probable duplicates when the score of their evidence reaches this, the same content is enough but
+// the same favicon or a similar title need each other
+const duplicateMinScore = 2
+
+const (
+	duplicateReasonDuplicateOf = "duplicate_of"
+	duplicateReasonContent     = "content"
+	duplicateReasonFavicon     = "favicon"
+	duplicateReasonTitle       = "title"
+	duplicateReasonPGPKey      = "pgp_key"
+	duplicateReasonCertificate = "certificate"
+)
+
+var duplicateReasonScores = map[string]int{
+	duplicateReasonDuplicateOf: 2,
+	duplicateReasonContent:     2,
+	duplicateReasonFavicon:     1,
+	duplicateReasonTitle:       1,
+	duplicateReasonPGPKey:      2,
+	duplicateReasonCertificate: 2,
+}
+
+type DuplicateCluster struct {
+	Sites    []string             `json:"sites"`
+	Evidence []*DuplicateEvidence `json:"evidence"`
+}
+
+type DuplicateEvidence struct {
+	First   string   `json:"first"`
+	Second  string   `json:"second"`
+	Reasons []string `json:"reasons"`
+}
+
+// getDuplicateReasons compares two sites by their content hashes (of the seed and of the crawled pages), their
+// favicon hash, their pgp keys and certificates and the similarity of their titles
+func getDuplicateReasons(site *Site, otherSite *Site, minTitleSimilarity float64) []string {
+	result := []string{}
+
+	if site.DuplicateOf == otherSite.URL || otherSite.DuplicateOf == site.URL {
+		result = append(result, duplicateReasonDuplicateOf)
+	}
+
+	if hasSameContent(site, otherSite) {
+		result = append(result, duplicateReasonContent)
+	}
+
+	if site.FaviconHash != "" && site.FaviconHash == otherSite.FaviconHash {
+		result = append(result, duplicateReasonFavicon)
+	}
+
+	// the same key means the same operator
+	if hasSamePGPKey(site, otherSite) {
+		result = append(result, duplicateReasonPGPKey)
+	}
+
+	if hasSameCertificate(site, otherSite) {
+		result = append(result, duplicateReasonCertificate)
+	}
+
+	if getTitleSimilarity(site.Title, otherSite.Title) >= minTitleSimilarity {
+		result = append(result, duplicateReasonTitle)
+	}
+
+	return result
+}
+
+func hasSameContent(site *Site, otherSite *Site) bool {
+	// error pages are the same on many sites
+	if site.SoftError != "" || otherSite.SoftError != "" {
+		return false
+	}
+
+	hashes := getSiteContentHashes(site)
+
+	for hash := range getSiteContentHashes(otherSite) {
+		if hashes[hash] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func getSiteContentHashes(site *Site) map[string]bool {
+	result := map[string]bool{}
+
+	if site.ContentHash != "" {
+		result[site.ContentHash] = true
+	}
+
+	for _, page := range site.Pages {
+		if page.FetchSuccess && page.ContentHash != "" {
+			result[page.ContentHash] = true
+		}
+	}
+
+	return result
+}
+
+// getTitleSimilarity returns the jaccard similarity of the title words, from 0 to 1
+func getTitleSimilarity(title string, otherTitle string) float64 {
+	words := map[string]bool{}
+	otherWords := map[string]bool{}
+
+	for _, word := range strings.Fields(getCategoryText(title)) {
+		words[word] = true
+	}
+
+	for _, word := range strings.Fields(getCategoryText(otherTitle)) {
+		otherWords[word] = true
+	}
+
+	if len(words) == 0 || len(otherWords) == 0 {
+		return 0
+	}
+
+	common := 0
+
+	for word := range words {
+		if otherWords[word] {
+			common++
+		}
+	}
+
+	return float64(common) / float64(len(words)+len(otherWords)-common)
+}
+
+// getDuplicateClusters groups the sites that are probable duplicates of each other
+func getDuplicateClusters(sites []*Site, minTitleSimilarity float64) []*DuplicateCluster {
+	fetchedSites := []*Site{}
+
+	for _, site := range sites {
+		if site.FetchSuccess {
+			fetchedSites = append(fetchedSites, site)
+		}
+	}
+
+	// group sites using union find
+	parents := make([]int, len(fetchedSites))
+
+	for i := range parents {
+		parents[i] = i
+	}
+
+	var find func(i int) int
+
+	find = func(i int) int {
+		if parents[i] != i {
+			parents[i] = find(parents[i])
+		}
+
+		return parents[i]
+	}
+
+	evidence := []*DuplicateEvidence{}
+	evidenceSites := []int{}
+
+	for i := 0; i < len(fetchedSites); i++ {
+		for j := i + 1; j < len(fetchedSites); j++ {
+			reasons := getDuplicateReasons(fetchedSites[i], fetchedSites[j], minTitleSimilarity)
+			score := 0
+
+			for _, reason := range reasons {
+				score += duplicateReasonScores[reason]
+			}
+
+			if score < duplicateMinScore {
+				continue
+			}
+
+			parents[find(i)] = find(j)
+			evidence = append(evidence, &DuplicateEvidence{First: fetchedSites[i].URL, Second: fetchedSites[j].URL, Reasons: reasons})
+			evidenceSites = append(evidenceSites, i)
+		}
+	}
+
+	clusters := map[int]*DuplicateCluster{}
+	result := []*DuplicateCluster{}
+
+	for i, site := range fetchedSites {
+		root := find(i)
+		cluster, exists := clusters[root]
+
+		if !exists {
+			cluster = &DuplicateCluster{Sites: []string{}, Evidence: []*DuplicateEvidence{}}
+			clusters[root] = cluster
+			result = append(result, cluster)
+		}
+
+		cluster.Sites = append(cluster.Sites, site.URL)
+	}
+
+	for index, item := range evidence {
+		cluster := clusters[find(evidenceSites[index])]
+		cluster.Evidence = append(cluster.Evidence, item)
+	}
+
+	// sites without evidence are not duplicates
+	duplicates := []*DuplicateCluster{}
+
+	for _, cluster := range result {
+		if len(cluster.Sites) > 1 {
+			duplicates = append(duplicates, cluster)
+		}
+	}
+
+	sort.SliceStable(duplicates, func(i, j int) bool {
+		return len(duplicates[i].Sites) > len(duplicates[j].Sites)
+	})
+
+	return duplicates
+}
+
+func runFindDuplicatesCommand(args []string) {
+	if len(args) < 1 || len(args) > 2 {
+		fmt.Printf("Usage : %s find-duplicates <configuration file> [min title similarity] \n", os.Args[0])
+		os.Exit(exitCodeConfigError)
+	}
+
+	configurationFileName = args[0]
+	minTitleSimilarity := defaultTitleSimilarity
+
+	if len(args) == 2 {
+		similarity, err := strconv.ParseFloat(args[1], 64)
+
+		if err != nil || similarity <= 0 || similarity > 1 {
+			fmt.Println("Invalid min title similarity:", args[1])
+			os.Exit(exitCodeConfigError)
+		}
+
+		minTitleSimilarity = similarity
+	}
+
+	loadConfigurationFile()
+
+	currentDir, err := os.Getwd()
+
+	if err != nil {
+		fmt.Println("Unable to get current directory:", err)
+		os.Exit(exitCodeError)
+	}
+
+	clusters := getDuplicateClusters(configuration.Sites, minTitleSimilarity)
+
+	for index, cluster := range clusters {
+		fmt.Println(fmt.Sprintf("Cluster %d - %d sites:", index+1, len(cluster.Sites)))
+
+		for _, siteURL := range cluster.Sites {
+			fmt.Println("  " + siteURL)
+		}
+
+		for _, item := range cluster.Evidence {
+			fmt.Println(fmt.Sprintf("    %s = %s (%s)", item.First, item.Second, strings.Join(item.Reasons, ", ")))
+		}
+	}
+
+	clustersJSON, err := json.MarshalIndent(clusters, "", "\t")
+
+	if err != nil {
+		fmt.Println("Unable to create duplicates file:", err)
+		os.Exit(exitCodeError)
+	}
+
+	outputDir := getOutputDir(currentDir)
+	err = os.MkdirAll(outputDir, dirMode)
+
+	if err == nil {
+		err = writeFile(outputDir+string(filepath.Separator)+"duplicates.json", clustersJSON, fileMode)
+	}
+
+	if err != nil {
+		fmt.Println("Unable to save duplicates file:", err)
+		os.Exit(exitCodeError)
+	}
+
+	fmt.Println(fmt.Sprintf("Found %d clusters of duplicate sites", len(clusters)))
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// classes of the errors of the crawl, each class has its own policy
+const (
+	errorClassNetwork = "network"
+	errorClassProxy   = "proxy"
+	errorClassHTTP4xx = "http_4xx"
+	errorClassHTTP5xx = "http_5xx"
+	errorClassParse   = "parse"
+	errorClassStorage = "storage"
+)
+
+const (
+	errorActionRetry = "retry"
+	errorActionSkip  = "skip"
+	errorActionAbort = "abort"
+)
+
+// the actions of the classes without a policy, the failed sites are retried and the files that can't be saved
+// stop the crawl
+var defaultErrorActions = map[string]string{
+	errorClassNetwork: errorActionRetry,
+	errorClassProxy:   errorActionRetry,
+	errorClassHTTP4xx: errorActionRetry,
+	errorClassHTTP5xx: errorActionRetry,
+	errorClassParse:   errorActionRetry,
+	errorClassStorage: errorActionAbort,
+}
+
+// the tor replies that are failures of the proxy and not of the site
+var proxyTorErrorClasses = map[string]bool{
+	"general_failure":            true,
+	"not_allowed":                true,
+	"client_authorization_wrong": true,
+}
+
+type ErrorPolicy struct {
+	Action string `json:"action,omitempty"`
+	Alert  bool   `json:"alert,omitempty"`
+}
+
+// ClassifiedError is an error whose class is known where it happens, like the parse and the storage errors
+type ClassifiedError struct {
+	Class string
+	Err   error
+}
+
+// the class of the error that aborted the crawl
+var crawlAbortedBy string
+
+func (err *ClassifiedError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *ClassifiedError) Unwrap() error {
+	return err.Err
+}
+
+func newParseError(err error) error {
+	return &ClassifiedError{Class: errorClassParse, Err: err}
+}
+
+func newStorageError(err error) error {
+	return &ClassifiedError{Class: errorClassStorage, Err: err}
+}
+
+// getErrorClass returns the class of the error, the errors that are not classified where they happen are network
+// errors, or proxy errors when the proxy can't be reached or refuses the request
+func getErrorClass(err error) string {
+	var classifiedError *ClassifiedError
+
+	if errors.As(err, &classifiedError) {
+		return classifiedError.Class
+	}
+
+	var statusError *StatusError
+
+	if errors.As(err, &statusError) {
+		if statusError.StatusCode >= 500 {
+			return errorClassHTTP5xx
+		}
+
+		return errorClassHTTP4xx
+	}
+
+	if proxyTorErrorClasses[getTorErrorClass(err)] || strings.Contains(err.Error(), "dial tcp "+torProxyAddress) {
+		return errorClassProxy
+	}
+
+	var pathError *os.PathError
+
+	if errors.As(err, &pathError) {
+		return errorClassStorage
+	}
+
+	return errorClassNetwork
+}
+
+func isKnownErrorClass(class string) bool {
+	_, exists := defaultErrorActions[class]
+	return exists
+}
+
+func isKnownErrorAction(action string) bool {
+	return action == "" || action == errorActionRetry || action == errorActionSkip || action == errorActionAbort
+}
+
+// getErrorPolicy returns the policy of the class in the configuration, with the default action when it has none
+func getErrorPolicy(class string) *ErrorPolicy {
+	policy := &ErrorPolicy{}
+
+	if configured := configuration.ErrorPolicies[class]; configured != nil {
+		*policy = *configured
+	}
+
+	if policy.Action == "" {
+		policy.Action = defaultErrorActions[class]
+	}
+
+	return policy
+}
+
+// applyErrorPolicy sends the alert of the error when its policy has one and aborts the crawl when its action is
+// abort, returning the action
+func applyErrorPolicy(site *Site, url string, class string, err error) string {
+	policy := getErrorPolicy(class)
+
+	if policy.Alert {
+		notify(notificationEventErrorAlert, site, fmt.Sprintf("%s error: %v", class, err), map[string]interface{}{"url": url, "error_class": class})
+	}
+
+	if policy.Action == errorActionAbort && crawlAbortedBy == "" {
+		crawlAbortedBy = class
+		printError(fmt.Sprintf("Crawl aborted by a %s error:", class), url, err)
+		emitEvent("crawl_aborted", site, url, err, map[string]interface{}{"error_class": class})
+	}
+
+	return policy.Action
+}
+
+// isCrawlAborted returns if the crawl was aborted by an error policy or interrupted
+func isCrawlAborted() bool {
+	return crawlAbortedBy != "" || isCrawlInterrupted()
+}
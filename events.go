@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const eventsFormatJSONL = "jsonl"
+
+type Event struct {
+	Time  time.Time              `json:"time"`
+	Type  string                 `json:"type"`
+	Site  string                 `json:"site,omitempty"`
+	Tags  []string               `json:"tags,omitempty"`
+	URL   string                 `json:"url,omitempty"`
+	Error string                 `json:"error,omitempty"`
+	Data  map[string]interface{} `json:"data,omitempty"`
+}
+
+var (
+	eventsWriter io.Writer
+	eventsMutex  sync.Mutex
+)
+
+// setupEvents checks the events format and sets the events written to stdout, before any message is printed so the
+// messages go to stderr from the start
+func setupEvents(format string, fileName string) error {
+	if format == "" {
+		return nil
+	}
+
+	if format != eventsFormatJSONL {
+		return errors.New("unsupported events format: " + format)
+	}
+
+	if fileName == "" || fileName == "-" {
+		eventsWriter = os.Stdout
+		messagesToStderr = true
+	}
+
+	return nil
+}
+
+// openEventsFile opens the file of the events written to a file, after the configuration is loaded so it has the
+// file mode of the configuration
+func openEventsFile(format string, fileName string) error {
+	if format == "" || fileName == "" || fileName == "-" {
+		return nil
+	}
+
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, fileMode)
+
+	if err != nil {
+		return err
+	}
+
+	eventsWriter = file
+
+	return nil
+}
+
+func emitEvent(eventType string, site *Site, url string, err error, data map[string]interface{}) {
+	if eventsWriter == nil && tuiProgram == nil {
+		return
+	}
+
+	event := &Event{
+		Time: time.Now().UTC(),
+		Type: eventType,
+		URL:  url,
+		Data: data,
+	}
+
+	if site != nil {
+		event.Site = site.URL
+		event.Tags = site.Tags
+	}
+
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	sendTUIEvent(event)
+
+	if eventsWriter == nil {
+		return
+	}
+
+	eventJSON, err := json.Marshal(event)
+
+	if err != nil {
+		return
+	}
+
+	eventsMutex.Lock()
+	defer eventsMutex.Unlock()
+
+	eventsWriter.Write(append(eventJSON, '\n'))
+}
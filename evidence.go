@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	evidenceKeyTypePGP      = "pgp"
+	evidenceKeyTypeMinisign = "minisign"
+)
+
+const (
+	evidenceDirName          = "evidence"
+	evidenceManifestFileName = "manifest.json"
+)
+
+// EvidenceConfig enables the evidence mode: a manifest with the hash and fetch time of every site file, signed
+// with the key file and timestamped by the RFC 3161 timestamp authority. The time server is an http server, like an
+// onion service, whose Date header corrects the local clock
+type EvidenceConfig struct {
+	KeyFile       string `json:"key_file,omitempty"`
+	KeyType       string `json:"key_type,omitempty"`
+	PassphraseEnv string `json:"passphrase_env,omitempty"`
+	TimeServer    string `json:"time_server,omitempty"`
+
+	TimestampAuthority string `json:"timestamp_authority,omitempty"`
+	TimestampViaTor    bool   `json:"timestamp_via_tor,omitempty"`
+}
+
+// EvidenceManifest is the chain of custody of the files of a site
+type EvidenceManifest struct {
+	SiteURL   string          `json:"site_url"`
+	CreatedAt time.Time       `json:"created_at"`
+	Clock     *EvidenceClock  `json:"clock"`
+	Files     []*EvidenceFile `json:"files"`
+}
+
+// EvidenceClock is the source of the times of the manifest, the offset is added to the local clock
+type EvidenceClock struct {
+	Source         string `json:"source"`
+	OffsetMillis   int64  `json:"offset_ms"`
+	ErrorMillis    int64  `json:"error_ms,omitempty"`
+	SynchronizedAt string `json:"synchronized_at,omitempty"`
+}
+
+type EvidenceFile struct {
+	Path      string    `json:"path"`
+	SHA256    string    `json:"sha256"`
+	Size      int64     `json:"size"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+var evidenceClock = &EvidenceClock{Source: "local"}
+
+func isEvidenceEnabled() bool {
+	return configuration.Evidence != nil && (configuration.Evidence.KeyFile != "" || configuration.Evidence.TimestampAuthority != "")
+}
+
+// setupEvidenceClock gets the offset of the local clock from the Date header of the time server, the error is half
+// of the round trip plus the second of precision of the header
+func setupEvidenceClock(fetcher Fetcher) error {
+	if configuration.Evidence.TimeServer == "" {
+		return nil
+	}
+
+	startedAt := time.Now()
+	response, err := getURL(fetcher, configuration.Evidence.TimeServer)
+
+	if err != nil {
+		return err
+	}
+
+	response.Body.Close()
+	finishedAt := time.Now()
+
+	serverTime, err := http.ParseTime(response.Header.Get("Date"))
+
+	if err != nil {
+		return errors.New("time server has no valid Date header")
+	}
+
+	roundTrip := finishedAt.Sub(startedAt)
+	localTime := startedAt.Add(roundTrip / 2)
+
+	evidenceClock = &EvidenceClock{
+		Source:         configuration.Evidence.TimeServer,
+		OffsetMillis:   serverTime.Sub(localTime).Milliseconds(),
+		ErrorMillis:    (roundTrip/2 + time.Second).Milliseconds(),
+		SynchronizedAt: serverTime.UTC().Format(time.RFC3339),
+	}
+
+	return nil
+}
+
+// getEvidenceTime returns the local time corrected by the clock of the evidence
+func getEvidenceTime(localTime time.Time) time.Time {
+	return localTime.Add(time.Duration(evidenceClock.OffsetMillis) * time.Millisecond).UTC()
+}
+
+// getEvidenceManifest hashes every file of the site dir, except the snapshots and the evidence, the files are
+// saved when fetched so their modification time is the fetch time
+func getEvidenceManifest(siteURL string, siteDir string) (*EvidenceManifest, error) {
+	manifest := &EvidenceManifest{SiteURL: siteURL, CreatedAt: getEvidenceTime(time.Now()), Clock: evidenceClock, Files: []*EvidenceFile{}}
+
+	err := filepath.Walk(siteDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(siteDir, path)
+
+		if err != nil {
+			return err
+		}
+
+		relativePath = filepath.ToSlash(relativePath)
+
+		if info.IsDir() {
+			if relativePath == snapshotsDirName || relativePath == evidenceDirName {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		hash, err := getFileHash(path)
+
+		if err != nil {
+			return err
+		}
+
+		manifest.Files = append(manifest.Files, &EvidenceFile{
+			Path:      relativePath,
+			SHA256:    fmt.Sprintf("%x", hash),
+			Size:      info.Size(),
+			FetchedAt: getEvidenceTime(info.ModTime()),
+		})
+
+		return nil
+	})
+
+	return manifest, err
+}
+
+// saveEvidence saves the manifest of the site dir with its signature and timestamp token
+func saveEvidence(siteURL string, siteDir string) error {
+	manifest, err := getEvidenceManifest(siteURL, siteDir)
+
+	if err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(manifest, "", "\t")
+
+	if err != nil {
+		return err
+	}
+
+	evidenceDir := filepath.Join(siteDir, evidenceDirName)
+
+	if err := os.MkdirAll(evidenceDir, dirMode); err != nil {
+		return err
+	}
+
+	manifestFileName := filepath.Join(evidenceDir, evidenceManifestFileName)
+
+	if err := writeFile(manifestFileName, content, fileMode); err != nil {
+		return err
+	}
+
+	if configuration.Evidence.KeyFile != "" {
+		signature, extension, err := signEvidenceManifest(content)
+
+		if err == nil {
+			err = writeFile(manifestFileName+extension, signature, fileMode)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	// the timestamp proves when the manifest existed
+	if configuration.Evidence.TimestampAuthority != "" {
+		return saveManifestTimestamp(manifestFileName, content)
+	}
+
+	return nil
+}
+
+// signEvidenceManifest signs the manifest with the key file, returning the signature and the extension of its file
+func signEvidenceManifest(content []byte) ([]byte, string, error) {
+	config := configuration.Evidence
+	key, err := ioutil.ReadFile(config.KeyFile)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	passphrase := ""
+
+	if config.PassphraseEnv != "" {
+		passphrase = os.Getenv(config.PassphraseEnv)
+	}
+
+	switch config.KeyType {
+	case evidenceKeyTypePGP:
+		signature, err := signPGP(key, passphrase, content)
+		return signature, ".asc", err
+	case evidenceKeyTypeMinisign:
+		signature, err := signMinisign(key, content)
+		return signature, ".minisig", err
+	}
+
+	return nil, "", errors.New("unknown evidence key type: " + config.KeyType)
+}
+
+// signPGP returns the armored detached signature of the content, made by the first private key of the key file
+func signPGP(key []byte, passphrase string, content []byte) ([]byte, error) {
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(key))
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entity := range entities {
+		if entity.PrivateKey == nil {
+			continue
+		}
+
+		if entity.PrivateKey.Encrypted {
+			if err := entity.PrivateKey.Decrypt([]byte(passphrase)); err != nil {
+				return nil, errors.New("unable to decrypt pgp key, check the passphrase")
+			}
+		}
+
+		signature := &bytes.Buffer{}
+
+		if err := openpgp.ArmoredDetachSign(signature, entity, bytes.NewReader(content), nil); err != nil {
+			return nil, err
+		}
+
+		return signature.Bytes(), nil
+	}
+
+	return nil, errors.New("pgp key file has no private key")
+}
+
+// signMinisign returns the prehashed minisign signature of the content, made by an unencrypted minisign secret
+// key, like the keys created by "minisign -G -W"
+func signMinisign(key []byte, content []byte) ([]byte, error) {
+	lines := strings.Split(strings.TrimSpace(string(key)), "\n")
+
+	if len(lines) < 2 {
+		return nil, errors.New("invalid minisign secret key")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+
+	// algorithm, kdf, checksum algorithm, salt, ops and mem limits, key id, secret key and checksum
+	if err != nil || len(data) != 158 || string(data[:2]) != "Ed" {
+		return nil, errors.New("invalid minisign secret key")
+	}
+
+	if data[2] != 0 || data[3] != 0 {
+		return nil, errors.New("encrypted minisign keys are not supported, create the key with minisign -G -W")
+	}
+
+	keyID := data[54:62]
+	secretKey := ed25519.PrivateKey(data[62:126])
+	checksum := blake2b.Sum256(append(append([]byte("Ed"), keyID...), secretKey...))
+
+	if !bytes.Equal(checksum[:], data[126:158]) {
+		return nil, errors.New("invalid minisign secret key checksum")
+	}
+
+	hash := blake2b.Sum512(content)
+	signature := append(append([]byte("ED"), keyID...), ed25519.Sign(secretKey, hash[:])...)
+	trustedComment := fmt.Sprintf("timestamp:%d\tfile:%s\tprehashed", getEvidenceTime(time.Now()).Unix(), evidenceManifestFileName)
+	globalSignature := ed25519.Sign(secretKey, append(signature[10:], []byte(trustedComment)...))
+
+	result := &strings.Builder{}
+	result.WriteString(fmt.Sprintf("untrusted comment: signature from go-tor-crawler, key %016X\n", binary.LittleEndian.Uint64(keyID)))
+	result.WriteString(base64.StdEncoding.EncodeToString(signature) + "\n")
+	result.WriteString("trusted comment: " + trustedComment + "\n")
+	result.WriteString(base64.StdEncoding.EncodeToString(globalSignature) + "\n")
+
+	return []byte(result.String()), nil
+}
+
+// verifyEvidence returns the differences between the site files and the manifest of the site dir
+func verifyEvidence(siteDir string) ([]string, error) {
+	content, err := ioutil.ReadFile(filepath.Join(siteDir, evidenceDirName, evidenceManifestFileName))
+
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &EvidenceManifest{}
+
+	if err := json.Unmarshal(content, manifest); err != nil {
+		return nil, err
+	}
+
+	result := []string{}
+	files := map[string]bool{}
+
+	for _, file := range manifest.Files {
+		files[file.Path] = true
+		hash, err := getFileHash(filepath.Join(siteDir, filepath.FromSlash(file.Path)))
+
+		if err != nil {
+			result = append(result, "missing: "+file.Path)
+		} else if fmt.Sprintf("%x", hash) != file.SHA256 {
+			result = append(result, "changed: "+file.Path)
+		}
+	}
+
+	current, err := getEvidenceManifest(manifest.SiteURL, siteDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range current.Files {
+		if !files[file.Path] {
+			result = append(result, "added: "+file.Path)
+		}
+	}
+
+	return result, nil
+}
+
+func runVerifyEvidenceCommand(args []string) {
+	flags := flag.NewFlagSet("verify-evidence", flag.ExitOnError)
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fmt.Printf("Usage : %s verify-evidence <configuration file> \n", os.Args[0])
+		os.Exit(exitCodeConfigError)
+	}
+
+	configurationFileName = flags.Arg(0)
+
+	loadConfigurationFile()
+
+	currentDir, err := os.Getwd()
+
+	if err != nil {
+		fmt.Println("Unable to get current directory:", err)
+		os.Exit(exitCodeError)
+	}
+
+	outputDir := getOutputDir(currentDir)
+	failedSites := 0
+	verifiedSites := 0
+
+	for _, site := range configuration.Sites {
+		differences, err := verifyEvidence(outputDir + string(filepath.Separator) + getSiteDirName(site))
+
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			fmt.Println("Unable to verify site evidence:", site.URL, err)
+			failedSites++
+			continue
+		}
+
+		verifiedSites++
+
+		if len(differences) > 0 {
+			failedSites++
+		}
+
+		for _, difference := range differences {
+			fmt.Println(fmt.Sprintf("%s %s", site.URL, difference))
+		}
+	}
+
+	fmt.Println(fmt.Sprintf("Verified the evidence of %d sites, %d don't match", verifiedSites, failedSites))
+
+	if failedSites > 0 {
+		os.Exit(exitCodeError)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// exit codes of the crawler, so the scripts that run it can tell the failures apart
+const (
+	exitCodeSuccess          = 0
+	exitCodeError            = 1
+	exitCodeConfigError      = 2
+	exitCodeProxyUnreachable = 3
+	exitCodePartialFailure   = 4
+	exitCodeTotalFailure     = 5
+	exitCodeAborted          = 6
+	exitCodeInterrupted      = 130
+)
+
+const proxyCheckTimeout = 10 * time.Second
+
+// stopCrawl closes the publishers, flushing their messages, the network audit log, the tui and the managed tor
+func stopCrawl() {
+	closePublishers()
+	closeNetworkAudit()
+	stopTUI()
+	stopManagedTor()
+}
+
+// exitCrawl is the os.Exit of the crawl after its setup, the messages of the publishers are not lost and the
+// managed tor is stopped
+func exitCrawl(code int) {
+	stopCrawl()
+	os.Exit(code)
+}
+
+// FailureSummary is printed to stderr as json at the end of the crawl, with the sites that failed in the run
+type FailureSummary struct {
+	ExitCode     int            `json:"exit_code"`
+	Sites        int            `json:"sites"`
+	FetchedSites int            `json:"fetched_sites"`
+	FailedSites  []*SiteFailure `json:"failed_sites"`
+	AbortedBy    string         `json:"aborted_by,omitempty"`
+	Interrupted  bool           `json:"interrupted,omitempty"`
+}
+
+type SiteFailure struct {
+	URL           string `json:"url"`
+	Error         string `json:"error"`
+	TorErrorClass string `json:"tor_error_class,omitempty"`
+	StatusCode    int    `json:"status_code,omitempty"`
+	SoftError     string `json:"soft_error,omitempty"`
+}
+
+var (
+	siteFailures      = map[string]*SiteFailure{}
+	siteFailuresMutex sync.Mutex
+)
+
+// recordSiteFailure keeps the last failure of the site in the run for the failure summary
+func recordSiteFailure(site *Site, entry *SiteHistoryEntry) {
+	siteFailuresMutex.Lock()
+	defer siteFailuresMutex.Unlock()
+
+	siteFailures[site.URL] = &SiteFailure{
+		URL:           site.URL,
+		Error:         entry.Error,
+		TorErrorClass: entry.TorErrorClass,
+		StatusCode:    entry.StatusCode,
+		SoftError:     entry.SoftError,
+	}
+}
+
+// getFailureSummary returns the failed sites of the run, the sites fetched by a later retry are not failures, and
+// the exit code of the run
+func getFailureSummary(sites []*Site) *FailureSummary {
+	summary := &FailureSummary{ExitCode: exitCodeSuccess, Sites: len(sites), FailedSites: []*SiteFailure{}}
+
+	siteFailuresMutex.Lock()
+	defer siteFailuresMutex.Unlock()
+
+	for _, site := range sites {
+		if site.FetchSuccess {
+			summary.FetchedSites++
+		} else if failure := siteFailures[site.URL]; failure != nil {
+			summary.FailedSites = append(summary.FailedSites, failure)
+		}
+	}
+
+	if len(summary.FailedSites) > 0 {
+		summary.ExitCode = exitCodePartialFailure
+	}
+
+	if len(summary.FailedSites) > 0 && summary.FetchedSites == 0 {
+		summary.ExitCode = exitCodeTotalFailure
+
+		// a crawl without any site is usually a crawl without tor
+		if !isReplaying() && !isTorProxyReachable() {
+			summary.ExitCode = exitCodeProxyUnreachable
+		}
+	}
+
+	// the sites after the error that aborted the crawl, or after the interruption, were not fetched
+	if crawlAbortedBy != "" {
+		summary.ExitCode = exitCodeAborted
+		summary.AbortedBy = crawlAbortedBy
+	}
+
+	if isCrawlInterrupted() {
+		summary.ExitCode = exitCodeInterrupted
+		summary.Interrupted = true
+	}
+
+	return summary
+}
+
+func isTorProxyReachable() bool {
+	connection, err := net.DialTimeout("tcp", torProxyAddress, proxyCheckTimeout)
+
+	if err != nil {
+		return false
+	}
+
+	connection.Close()
+
+	return true
+}
+
+// printFailureSummary prints the summary to stderr in one json line, apart from the log of the crawl
+func printFailureSummary(summary *FailureSummary) {
+	summaryJSON, err := json.Marshal(summary)
+
+	if err != nil {
+		printError("Unable to get failure summary:", err)
+		return
+	}
+
+	fmt.Fprintln(os.Stderr, string(summaryJSON))
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/antchfx/htmlquery"
+	"golang.org/x/net/html"
+)
+
+type ExtractionRule struct {
+	Name      string `json:"name"`
+	Selector  string `json:"selector,omitempty"`
+	XPath     string `json:"xpath,omitempty"`
+	Attribute string `json:"attribute,omitempty"`
+}
+
+func getExtractedDataFromDocument(doc *goquery.Document, rules []*ExtractionRule) map[string][]string {
+	result := map[string][]string{}
+
+	for _, rule := range rules {
+		if rule.XPath != "" {
+			result[rule.Name] = getXPathValues(doc.Nodes[0], rule)
+			continue
+		}
+
+		values := []string{}
+
+		doc.Find(rule.Selector).Each(func(_ int, selection *goquery.Selection) {
+			var value string
+
+			// without attribute the element text is used
+			if rule.Attribute == "" {
+				value = selection.Text()
+			} else {
+				value, _ = selection.Attr(rule.Attribute)
+			}
+
+			value = strings.TrimSpace(value)
+
+			if value != "" {
+				values = append(values, value)
+			}
+		})
+
+		result[rule.Name] = values
+	}
+
+	return result
+}
+
+func getXPathValues(root *html.Node, rule *ExtractionRule) []string {
+	values := []string{}
+	nodes, err := htmlquery.QueryAll(root, rule.XPath)
+
+	if err != nil {
+		printError("Invalid XPath expression:", rule.XPath, err)
+		return values
+	}
+
+	for _, node := range nodes {
+		var value string
+
+		// without attribute the node text is used, which also covers expressions like //a/@href
+		if rule.Attribute == "" {
+			value = htmlquery.InnerText(node)
+		} else {
+			value = htmlquery.SelectAttr(node, rule.Attribute)
+		}
+
+		value = strings.TrimSpace(value)
+
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+func saveExtractedData(fileName string, data map[string][]string) error {
+	dataJSON, err := json.MarshalIndent(data, "", "\t")
+
+	if err != nil {
+		return err
+	}
+
+	return writeFile(fileName, dataJSON, fileMode)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// getFaviconURLFromDocument returns the url of the icon declared by the page, or the default /favicon.ico of the site
+func getFaviconURLFromDocument(doc *goquery.Document, pageURL string) string {
+	baseURL, err := url.Parse(pageURL)
+
+	if err != nil {
+		return ""
+	}
+
+	result := baseURL.ResolveReference(&url.URL{Path: "/favicon.ico"}).String()
+
+	doc.Find("link[rel][href]").EachWithBreak(func(_ int, selection *goquery.Selection) bool {
+		rel, _ := selection.Attr("rel")
+
+		for _, value := range strings.Fields(strings.ToLower(rel)) {
+			if value == "icon" {
+				href, _ := selection.Attr("href")
+
+				if iconURL, err := baseURL.Parse(strings.TrimSpace(href)); err == nil && !strings.HasPrefix(iconURL.Scheme, "data") {
+					result = iconURL.String()
+					return false
+				}
+			}
+		}
+
+		return true
+	})
+
+	return result
+}
+
+// updateSiteFavicon downloads the site icon and saves its hash, used to find clones of the site
+func updateSiteFavicon(site *Site, siteDir string, doc *goquery.Document, fetcher Fetcher) {
+	faviconURL := getFaviconURLFromDocument(doc, site.URL)
+
+	if faviconURL == "" {
+		return
+	}
+
+	content, _, err := fetchPage(fetcher, faviconURL)
+
+	if err != nil {
+		printError("Unable to fetch favicon:", faviconURL, err)
+		return
+	}
+
+	// sites without icon usually answer with an error page
+	if len(content) == 0 || strings.HasPrefix(http.DetectContentType(content), "text/html") {
+		return
+	}
+
+	extension := strings.ToLower(path.Ext(strings.SplitN(faviconURL, "?", 2)[0]))
+
+	if extension == "" || len(extension) > 5 {
+		extension = ".ico"
+	}
+
+	err = writeFile(siteDir+string(filepath.Separator)+"favicon"+extension, content, fileMode)
+
+	if err != nil {
+		printError("Unable to save favicon:", err)
+		return
+	}
+
+	site.FaviconHash = getContentHash(content)
+}
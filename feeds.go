@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+type Feed struct {
+	URL     string       `json:"url"`
+	Title   string       `json:"title"`
+	Entries []*FeedEntry `json:"entries,omitempty"`
+}
+
+type FeedEntry struct {
+	URL          string `json:"url"`
+	Title        string `json:"title"`
+	Published    string `json:"published,omitempty"`
+	FileName     string `json:"file_name,omitempty"`
+	FetchSuccess bool   `json:"fetch_success"`
+}
+
+// feedDocument reads both rss (channel/item) and atom (entry) documents
+type feedDocument struct {
+	Title   string `xml:"title"`
+	Channel struct {
+		Title string `xml:"title"`
+		Items []struct {
+			Title   string `xml:"title"`
+			Link    string `xml:"link"`
+			GUID    string `xml:"guid"`
+			PubDate string `xml:"pubDate"`
+		} `xml:"item"`
+	} `xml:"channel"`
+	Entries []struct {
+		Title string `xml:"title"`
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+		Published string `xml:"published"`
+		Updated   string `xml:"updated"`
+	} `xml:"entry"`
+}
+
+func getFeedURLsFromDocument(doc *goquery.Document, pageURL string) []string {
+	result := []string{}
+	baseURL, err := url.Parse(pageURL)
+
+	if err != nil {
+		return result
+	}
+
+	doc.Find("link[href]").Each(func(_ int, selection *goquery.Selection) {
+		rel, _ := selection.Attr("rel")
+		contentType, _ := selection.Attr("type")
+		href, _ := selection.Attr("href")
+
+		if !strings.Contains(strings.ToLower(rel), "alternate") {
+			return
+		}
+
+		contentType = strings.ToLower(strings.TrimSpace(contentType))
+
+		if contentType != "application/rss+xml" && contentType != "application/atom+xml" {
+			return
+		}
+
+		feedURL, err := baseURL.Parse(strings.TrimSpace(href))
+
+		if err != nil {
+			return
+		}
+
+		for _, value := range result {
+			if value == feedURL.String() {
+				return
+			}
+		}
+
+		result = append(result, feedURL.String())
+	})
+
+	return result
+}
+
+// parseFeed returns the feed title and its entries, with the entry urls resolved against the feed url
+func parseFeed(content []byte, feedURL string) (string, []*FeedEntry, error) {
+	document := &feedDocument{}
+	err := xml.Unmarshal(content, document)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	baseURL, err := url.Parse(feedURL)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	title := strings.TrimSpace(document.Channel.Title)
+	entries := []*FeedEntry{}
+
+	addEntry := func(link string, entryTitle string, published string) {
+		entryURL, err := baseURL.Parse(strings.TrimSpace(link))
+
+		if err != nil || strings.TrimSpace(link) == "" {
+			return
+		}
+
+		entries = append(entries, &FeedEntry{
+			URL:       entryURL.String(),
+			Title:     strings.TrimSpace(entryTitle),
+			Published: strings.TrimSpace(published),
+		})
+	}
+
+	for _, item := range document.Channel.Items {
+		link := item.Link
+
+		if link == "" {
+			link = item.GUID
+		}
+
+		addEntry(link, item.Title, item.PubDate)
+	}
+
+	if title == "" {
+		title = strings.TrimSpace(document.Title)
+	}
+
+	for _, entry := range document.Entries {
+		link := ""
+
+		for _, entryLink := range entry.Links {
+			if entryLink.Rel == "" || entryLink.Rel == "alternate" {
+				link = entryLink.Href
+				break
+			}
+		}
+
+		published := entry.Published
+
+		if published == "" {
+			published = entry.Updated
+		}
+
+		addEntry(link, entry.Title, published)
+	}
+
+	return title, entries, nil
+}
+
+// crawlSiteFeeds discovers the site feeds and fetches the entries that were not fetched in previous runs, the feeds
+// and the entries out of the scope of the site are skipped like the links
+func crawlSiteFeeds(site *Site, siteDir string, seedDoc *goquery.Document, fetcher Fetcher) {
+	if !site.CrawlFeeds {
+		return
+	}
+
+	seedURL, err := url.Parse(site.URL)
+
+	if err != nil {
+		return
+	}
+
+	feedsByURL := map[string]*Feed{}
+
+	for _, feed := range site.Feeds {
+		feedsByURL[normalizeURL(feed.URL)] = feed
+	}
+
+	for _, feedURL := range getFeedURLsFromDocument(seedDoc, site.URL) {
+		if !isURLInScope(site, seedURL, feedURL) {
+			continue
+		}
+
+		if feedsByURL[normalizeURL(feedURL)] == nil {
+			feed := &Feed{URL: feedURL}
+			feedsByURL[normalizeURL(feedURL)] = feed
+			site.Feeds = append(site.Feeds, feed)
+			printInfo("Feed found:", feedURL)
+		}
+	}
+
+	pagesDir := siteDir + string(filepath.Separator) + pagesDirName
+
+	for _, feed := range site.Feeds {
+		controller.waitWhilePaused()
+
+		if controller.shouldSkipSite() || isCrawlBudgetExceeded() {
+			return
+		}
+
+		content, _, err := fetchPage(fetcher, feed.URL)
+
+		if err != nil {
+			printError("Unable to fetch feed:", feed.URL, err)
+			emitEvent("feed_failed", site, feed.URL, err, nil)
+			continue
+		}
+
+		crawledBytes += int64(len(content))
+
+		title, entries, err := parseFeed(content, feed.URL)
+
+		if err != nil {
+			printError("Unable to parse feed:", feed.URL, err)
+			emitEvent("feed_failed", site, feed.URL, err, nil)
+			continue
+		}
+
+		feed.Title = title
+
+		entriesByURL := map[string]*FeedEntry{}
+
+		for _, entry := range feed.Entries {
+			entriesByURL[normalizeURL(entry.URL)] = entry
+		}
+
+		newEntries := 0
+
+		for _, entry := range entries {
+			if !isURLInScope(site, seedURL, entry.URL) {
+				printVerbose("Feed entry out of scope:", entry.URL)
+				continue
+			}
+
+			if entriesByURL[normalizeURL(entry.URL)] == nil {
+				entriesByURL[normalizeURL(entry.URL)] = entry
+				feed.Entries = append(feed.Entries, entry)
+			}
+		}
+
+		for _, entry := range feed.Entries {
+			if entry.FetchSuccess || !isURLInScope(site, seedURL, entry.URL) {
+				continue
+			}
+
+			controller.waitWhilePaused()
+
+			if controller.shouldSkipSite() || isCrawlBudgetExceeded() {
+				return
+			}
+
+			printInfo("Getting feed entry:", entry.URL)
+
+			entryContent, _, err := fetchPage(fetcher, entry.URL)
+
+			if err != nil {
+				printError("Unable to fetch feed entry:", entry.URL, err)
+				emitEvent("feed_entry_failed", site, entry.URL, err, nil)
+				continue
+			}
+
+			crawledBytes += int64(len(entryContent))
+
+			entry.FileName = pagesDirName + "/" + getPageFileName(entry.URL)
+			err = os.MkdirAll(pagesDir, dirMode)
+
+			if err == nil {
+				err = saveHTMLFile(siteDir+string(filepath.Separator)+filepath.FromSlash(entry.FileName), entry.URL, entryContent)
+			}
+
+			if err != nil {
+				printError("Unable to save feed entry content:", err)
+				exitCrawl(exitCodeError)
+			}
+
+			entry.FetchSuccess = true
+			newEntries++
+			emitEvent("feed_entry_fetched", site, entry.URL, nil, map[string]interface{}{"bytes": len(entryContent), "feed": feed.URL})
+			publishFetched("page_fetched", site, entry.URL, map[string]interface{}{"feed": feed.URL, "title": entry.Title, "content_hash": getContentHash(entryContent)}, getBytesContent(entryContent))
+		}
+
+		printInfo(fmt.Sprintf("Feed %s has %d new entries", feed.URL, newEntries))
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const defaultPostContentType = "application/x-www-form-urlencoded"
+
+// Fetcher gets the content of urls, every request of the crawl is done by a fetcher so other networks,
+// recorded responses or mocks can be used instead of the Tor SOCKS proxy
+type Fetcher interface {
+	Get(ctx context.Context, url string) (*http.Response, error)
+	Post(ctx context.Context, url string, contentType string, body []byte) (*http.Response, error)
+}
+
+// TorFetcher gets the urls through the Tor SOCKS proxy
+type TorFetcher struct {
+	Client *http.Client
+}
+
+func NewTorFetcher() *TorFetcher {
+	return &TorFetcher{Client: newTorHTTPClient()}
+}
+
+func (fetcher *TorFetcher) Get(ctx context.Context, url string) (*http.Response, error) {
+	return getTracedURL(ctx, fetcher.Client, url)
+}
+
+func (fetcher *TorFetcher) Post(ctx context.Context, url string, contentType string, body []byte) (*http.Response, error) {
+	return postTracedURL(ctx, fetcher.Client, url, contentType, body)
+}
+
+// RoutingFetcher uses the fetcher of the network of each url, like I2P for .i2p hosts, and the default fetcher
+// for the other urls
+type RoutingFetcher struct {
+	Default Fetcher
+	Routes  []*FetcherRoute
+}
+
+type FetcherRoute struct {
+	Match   func(url string) bool
+	Fetcher Fetcher
+}
+
+func (fetcher *RoutingFetcher) Get(ctx context.Context, url string) (*http.Response, error) {
+	return fetcher.getRouteFetcher(url).Get(ctx, url)
+}
+
+func (fetcher *RoutingFetcher) Post(ctx context.Context, url string, contentType string, body []byte) (*http.Response, error) {
+	return fetcher.getRouteFetcher(url).Post(ctx, url, contentType, body)
+}
+
+func (fetcher *RoutingFetcher) getRouteFetcher(url string) Fetcher {
+	for _, route := range fetcher.Routes {
+		if route.Match(url) {
+			return route.Fetcher
+		}
+	}
+
+	return fetcher.Default
+}
+
+// newFetcher returns the fetcher used by the crawl
+func newFetcher() Fetcher {
+	// gateways are checked first, since their prefixes can be more specific than a network
+	routes := getGatewayRoutes()
+	routes = append(routes, &FetcherRoute{Match: isI2PURL, Fetcher: NewI2PFetcher(configuration.I2P)})
+
+	var fetcher Fetcher = &RoutingFetcher{Default: NewTorFetcher(), Routes: routes}
+
+	if isReplaying() {
+		return &ReplayFetcher{Dir: replayDir}
+	}
+
+	if recordDir != "" {
+		return &RecordingFetcher{Fetcher: fetcher, Dir: recordDir}
+	}
+
+	return fetcher
+}
+
+// getURL is used by every request of the crawl, so the load control sees all results
+func getURL(fetcher Fetcher, url string) (*http.Response, error) {
+	return doURLRequest("GET", url, func(ctx context.Context) (*http.Response, error) {
+		return fetcher.Get(ctx, url)
+	})
+}
+
+// postURL is the getURL of the POST requests
+func postURL(fetcher Fetcher, url string, contentType string, body []byte) (*http.Response, error) {
+	return doURLRequest("POST", url, func(ctx context.Context) (*http.Response, error) {
+		return fetcher.Post(ctx, url, contentType, body)
+	})
+}
+
+// doURLRequest does the request of the url, the requests that failed by their circuit are retried on a new one
+func doURLRequest(method string, url string, request func(ctx context.Context) (*http.Response, error)) (*http.Response, error) {
+	ctx := context.Background()
+
+	for retry := 0; ; retry++ {
+		if !isReplaying() {
+			loadControl.waitDelay()
+			hostDelays.wait(url)
+		}
+
+		startedAt := time.Now()
+		response, err := request(ctx)
+		loadControl.recordResult(err)
+		printRequestDetail(method, url, response, err, time.Since(startedAt))
+
+		if isCircuitLoggingEnabled() {
+			recordRequestCircuit(url, err)
+		}
+
+		errorClass := getTorErrorClass(err)
+
+		if err == nil || !circuitErrorClasses[errorClass] || retry >= getCircuitRetries() {
+			return response, err
+		}
+
+		printInfo(fmt.Sprintf("Request failed by its circuit (%s), retrying on a new circuit: %s", errorClass, url))
+		emitEvent("circuit_retry", nil, url, err, map[string]interface{}{"tor_error_class": errorClass, "retry": retry + 1})
+		ctx = withNewCircuit(ctx)
+	}
+}
+
+// printRequestDetail prints each request with its result, only shown by -verbose
+func printRequestDetail(method string, url string, response *http.Response, err error, duration time.Duration) {
+	if outputLevel < outputLevelVerbose {
+		return
+	}
+
+	duration = duration.Round(time.Millisecond)
+
+	if err != nil {
+		printVerbose(fmt.Sprintf("%s %s - failed in %s (%s)", method, url, duration, err))
+		return
+	}
+
+	size := "unknown size"
+
+	if response.ContentLength >= 0 {
+		size = formatBytes(response.ContentLength)
+	}
+
+	printVerbose(fmt.Sprintf("%s %s - %s %d %s, %s in %s", method, url, response.Proto, response.StatusCode, response.Header.Get("Content-Type"), size, duration))
+}
+
+// getSiteURL gets the site url with the method of the site, the POST sites send their body, like the query of
+// a search
+func getSiteURL(fetcher Fetcher, site *Site) (*http.Response, error) {
+	if site.Method != "POST" {
+		return getURL(fetcher, site.URL)
+	}
+
+	contentType := site.ContentType
+
+	if contentType == "" {
+		contentType = defaultPostContentType
+	}
+
+	return postURL(fetcher, site.URL, contentType, []byte(site.Body))
+}
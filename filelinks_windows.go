@@ -0,0 +1,11 @@
+//go:build windows
+// +build windows
+
+package main
+
+import "os"
+
+// getFileLinks returns 1 on windows, where the link count is not in the file info
+func getFileLinks(info os.FileInfo) uint64 {
+	return 1
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type Scanner struct {
+	Name     string
+	Pattern  *regexp.Regexp
+	Validate func(value string) bool
+}
+
+var scanners = []*Scanner{
+	{
+		Name:     "emails",
+		Pattern:  regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+		Validate: isValidEmail,
+	},
+	{
+		Name:     "bitcoin",
+		Pattern:  regexp.MustCompile(`\b(?:bc1[ac-hj-np-z02-9]{25,87}|[13][a-km-zA-HJ-NP-Z1-9]{25,34})\b`),
+		Validate: isValidBitcoinAddress,
+	},
+	{
+		Name:    "ethereum",
+		Pattern: regexp.MustCompile(`\b0x[a-fA-F0-9]{40}\b`),
+	},
+	{
+		Name:    "monero",
+		Pattern: regexp.MustCompile(`\b[48][0-9AB][1-9A-HJ-NP-Za-km-z]{93}\b`),
+	},
+	{
+		Name:    "pgp_keys",
+		Pattern: regexp.MustCompile(`(?s)-----BEGIN PGP (?:PUBLIC|PRIVATE) KEY BLOCK-----.*?-----END PGP (?:PUBLIC|PRIVATE) KEY BLOCK-----`),
+	},
+	{
+		Name:     "phones",
+		Pattern:  regexp.MustCompile(`\+\d{1,3}[\s.\-]?\(?\d{1,4}\)?(?:[\s.\-]?\d{2,4}){2,4}`),
+		Validate: isValidPhone,
+	},
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+const bech32Alphabet = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+func getFindingsFromHTML(html string, scannerNames []string) map[string][]string {
+	result := map[string][]string{}
+
+	for _, scanner := range scanners {
+		if !isScannerEnabled(scanner.Name, scannerNames) {
+			continue
+		}
+
+		found := map[string]bool{}
+		values := []string{}
+
+		for _, value := range scanner.Pattern.FindAllString(html, -1) {
+			value = strings.TrimSpace(value)
+
+			if found[value] {
+				continue
+			}
+
+			if scanner.Validate != nil && !scanner.Validate(value) {
+				continue
+			}
+
+			found[value] = true
+			values = append(values, value)
+		}
+
+		sort.Strings(values)
+		result[scanner.Name] = values
+	}
+
+	return result
+}
+
+func saveFindings(fileName string, findings map[string][]string) error {
+	findingsJSON, err := json.MarshalIndent(findings, "", "\t")
+
+	if err != nil {
+		return err
+	}
+
+	return writeFile(fileName, findingsJSON, fileMode)
+}
+
+func isScannerEnabled(name string, scannerNames []string) bool {
+	for _, scannerName := range scannerNames {
+		if scannerName == "all" || scannerName == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isValidEmail(value string) bool {
+	// image names like "logo@2x.png" look like emails
+	extension := strings.ToLower(value[strings.LastIndex(value, ".")+1:])
+
+	switch extension {
+	case "png", "jpg", "jpeg", "gif", "svg", "ico", "webp":
+		return false
+	}
+
+	return true
+}
+
+func isValidPhone(value string) bool {
+	digits := 0
+
+	for _, r := range value {
+		if r >= '0' && r <= '9' {
+			digits++
+		}
+	}
+
+	return digits >= 8 && digits <= 15
+}
+
+func isValidBitcoinAddress(value string) bool {
+	if strings.HasPrefix(value, "bc1") {
+		return isValidBech32(value)
+	}
+
+	return isValidBase58Check(value)
+}
+
+func isValidBase58Check(value string) bool {
+	number := big.NewInt(0)
+	base := big.NewInt(58)
+
+	for _, r := range value {
+		index := strings.IndexRune(base58Alphabet, r)
+
+		if index < 0 {
+			return false
+		}
+
+		number.Mul(number, base)
+		number.Add(number, big.NewInt(int64(index)))
+	}
+
+	// leading ones are leading zero bytes
+	decoded := number.Bytes()
+
+	for _, r := range value {
+		if r != '1' {
+			break
+		}
+
+		decoded = append([]byte{0}, decoded...)
+	}
+
+	if len(decoded) != 25 {
+		return false
+	}
+
+	first := sha256.Sum256(decoded[:21])
+	second := sha256.Sum256(first[:])
+
+	return string(second[:4]) == string(decoded[21:])
+}
+
+func isValidBech32(value string) bool {
+	separator := strings.LastIndex(value, "1")
+
+	if separator < 1 || separator+7 > len(value) {
+		return false
+	}
+
+	hrp := value[:separator]
+	values := []int{}
+
+	for _, r := range hrp {
+		values = append(values, int(r)>>5)
+	}
+
+	values = append(values, 0)
+
+	for _, r := range hrp {
+		values = append(values, int(r)&31)
+	}
+
+	for _, r := range value[separator+1:] {
+		index := strings.IndexRune(bech32Alphabet, r)
+
+		if index < 0 {
+			return false
+		}
+
+		values = append(values, index)
+	}
+
+	generator := []int{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	checksum := 1
+
+	for _, v := range values {
+		top := checksum >> 25
+		checksum = (checksum&0x1ffffff)<<5 ^ v
+
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				checksum ^= generator[i]
+			}
+		}
+	}
+
+	// bech32 (segwit v0) and bech32m (taproot) constants
+	return checksum == 1 || checksum == 0x2bc830a3
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// path that no site has, so the answer is the not found page of the server
+const fingerprintNotFoundPath = "/.well-known/go-tor-crawler-not-found"
+
+// headers that change on every response and are not part of the fingerprint
+var volatileFingerprintHeaders = map[string]bool{
+	"age":            true,
+	"content-length": true,
+	"date":           true,
+	"etag":           true,
+	"expires":        true,
+	"last-modified":  true,
+	"set-cookie":     true,
+}
+
+// headers whose values identify the server software and its configuration
+var fingerprintValueHeaders = []string{
+	"server",
+	"x-powered-by",
+	"via",
+	"x-generator",
+	"x-aspnet-version",
+	"content-security-policy",
+	"strict-transport-security",
+	"x-frame-options",
+	"x-content-type-options",
+	"referrer-policy",
+	"onion-location",
+}
+
+// ResponseFingerprint identifies the hosting stack of a site by its response headers, its cookies and its not
+// found page, so sites of the same operator can be linked
+type ResponseFingerprint struct {
+	Server        string   `json:"server,omitempty"`
+	PoweredBy     string   `json:"powered_by,omitempty"`
+	Headers       []string `json:"headers"`
+	HeadersHash   string   `json:"headers_hash"`
+	Cookies       []string `json:"cookies,omitempty"`
+	CookiesHash   string   `json:"cookies_hash,omitempty"`
+	ErrorStatus   int      `json:"error_status,omitempty"`
+	ErrorPageHash string   `json:"error_page_hash,omitempty"`
+	Hash          string   `json:"hash"`
+}
+
+// getResponseFingerprint returns the fingerprint of the response of the site, fetching its not found page
+func getResponseFingerprint(site *Site, response *http.Response, fetcher Fetcher) *ResponseFingerprint {
+	fingerprint := &ResponseFingerprint{
+		Server:    response.Header.Get("Server"),
+		PoweredBy: response.Header.Get("X-Powered-By"),
+	}
+
+	headerValues := []string{}
+
+	for name := range response.Header {
+		name = strings.ToLower(name)
+
+		if !volatileFingerprintHeaders[name] {
+			fingerprint.Headers = append(fingerprint.Headers, name)
+		}
+	}
+
+	sort.Strings(fingerprint.Headers)
+
+	for _, name := range fingerprintValueHeaders {
+		if value := response.Header.Get(name); value != "" {
+			headerValues = append(headerValues, name+": "+value)
+		}
+	}
+
+	fingerprint.HeadersHash = getContentHash([]byte(strings.Join(fingerprint.Headers, "\n") + "\n\n" + strings.Join(headerValues, "\n")))
+
+	// cookie names and attributes are kept, the values are sessions
+	cookies := []string{}
+
+	for _, cookie := range response.Cookies() {
+		fingerprint.Cookies = append(fingerprint.Cookies, cookie.Name)
+		cookies = append(cookies, fmt.Sprintf("%s path=%s httponly=%t secure=%t samesite=%d", cookie.Name, cookie.Path, cookie.HttpOnly, cookie.Secure, cookie.SameSite))
+	}
+
+	sort.Strings(fingerprint.Cookies)
+	sort.Strings(cookies)
+
+	if len(cookies) > 0 {
+		fingerprint.CookiesHash = getContentHash([]byte(strings.Join(cookies, "\n")))
+	}
+
+	fingerprint.ErrorStatus, fingerprint.ErrorPageHash = getErrorPageFingerprint(site, fetcher)
+	fingerprint.Hash = getContentHash([]byte(fingerprint.HeadersHash + fingerprint.CookiesHash + fingerprint.ErrorPageHash))
+
+	return fingerprint
+}
+
+// getErrorPageFingerprint returns the status and the hash of the not found page, without the requested url that
+// servers usually show in it
+func getErrorPageFingerprint(site *Site, fetcher Fetcher) (int, string) {
+	siteURL, err := url.Parse(site.URL)
+
+	if err != nil {
+		return 0, ""
+	}
+
+	errorURL := siteURL.ResolveReference(&url.URL{Path: fingerprintNotFoundPath})
+	response, err := getURL(fetcher, errorURL.String())
+
+	if err != nil {
+		return 0, ""
+	}
+
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+
+	if err != nil {
+		return 0, ""
+	}
+
+	body = []byte(strings.Replace(string(body), errorURL.String(), "", -1))
+	body = []byte(strings.Replace(string(body), fingerprintNotFoundPath, "", -1))
+	body = []byte(strings.Replace(string(body), siteURL.Host, "", -1))
+
+	return response.StatusCode, getContentHash([]byte(fmt.Sprintf("%d\n%s", response.StatusCode, body)))
+}
+
+// getFingerprintMatches returns the parts of the fingerprints that are the same, the hash of the whole
+// fingerprint is enough to link sites and the parts are weaker evidence
+func getFingerprintMatches(fingerprint *ResponseFingerprint, otherFingerprint *ResponseFingerprint) []string {
+	result := []string{}
+
+	if fingerprint.Hash == otherFingerprint.Hash {
+		return []string{"hash"}
+	}
+
+	if fingerprint.HeadersHash == otherFingerprint.HeadersHash {
+		result = append(result, "headers")
+	}
+
+	if fingerprint.CookiesHash != "" && fingerprint.CookiesHash == otherFingerprint.CookiesHash {
+		result = append(result, "cookies")
+	}
+
+	if fingerprint.ErrorPageHash != "" && fingerprint.ErrorPageHash == otherFingerprint.ErrorPageHash {
+		result = append(result, "error_page")
+	}
+
+	return result
+}
+
+func runFindFingerprintCommand(args []string) {
+	if len(args) < 1 || len(args) > 2 {
+		fmt.Printf("Usage : %s find-fingerprint <configuration file> [url or hash] \n", os.Args[0])
+		os.Exit(exitCodeConfigError)
+	}
+
+	configurationFileName = args[0]
+	loadConfigurationFile()
+
+	// without a site the sites are grouped by their fingerprint hash
+	if len(args) == 1 {
+		groups := map[string][]*Site{}
+		hashes := []string{}
+
+		for _, site := range configuration.Sites {
+			if site.Fingerprint == nil {
+				continue
+			}
+
+			if _, exists := groups[site.Fingerprint.Hash]; !exists {
+				hashes = append(hashes, site.Fingerprint.Hash)
+			}
+
+			groups[site.Fingerprint.Hash] = append(groups[site.Fingerprint.Hash], site)
+		}
+
+		sort.SliceStable(hashes, func(i, j int) bool {
+			return len(groups[hashes[i]]) > len(groups[hashes[j]])
+		})
+
+		for _, hash := range hashes {
+			sites := groups[hash]
+
+			if len(sites) < 2 {
+				continue
+			}
+
+			fmt.Println(fmt.Sprintf("Fingerprint %s - %d sites (server: %s):", hash[:16], len(sites), sites[0].Fingerprint.Server))
+
+			for _, site := range sites {
+				fmt.Println("  " + site.URL)
+			}
+		}
+
+		return
+	}
+
+	var fingerprint *ResponseFingerprint
+
+	for _, site := range configuration.Sites {
+		if site.Fingerprint == nil {
+			continue
+		}
+
+		if normalizeURL(site.URL) == normalizeURL(args[1]) || strings.HasPrefix(site.Fingerprint.Hash, strings.ToLower(args[1])) {
+			fingerprint = site.Fingerprint
+			break
+		}
+	}
+
+	if fingerprint == nil {
+		fmt.Println("No site has the fingerprint:", args[1])
+		os.Exit(exitCodeError)
+	}
+
+	fmt.Println(fmt.Sprintf("Fingerprint %s (server: %s, headers: %s, cookies: %s)", fingerprint.Hash[:16], fingerprint.Server, strings.Join(fingerprint.Headers, " "), strings.Join(fingerprint.Cookies, " ")))
+
+	for _, site := range configuration.Sites {
+		if site.Fingerprint == nil || normalizeURL(site.URL) == normalizeURL(args[1]) {
+			continue
+		}
+
+		if matches := getFingerprintMatches(fingerprint, site.Fingerprint); len(matches) > 0 {
+			fmt.Println(fmt.Sprintf("  %s (%s)", site.URL, strings.Join(matches, ", ")))
+		}
+	}
+}
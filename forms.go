@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	formKindLogin  = "login"
+	formKindSearch = "search"
+	formKindUpload = "upload"
+	formKindOther  = "other"
+)
+
+// Form is a form of a page, with the url it is submitted to and its fields
+type Form struct {
+	Action  string       `json:"action"`
+	Method  string       `json:"method"`
+	Enctype string       `json:"enctype,omitempty"`
+	Kind    string       `json:"kind"`
+	Inputs  []*FormInput `json:"inputs"`
+}
+
+type FormInput struct {
+	Name     string `json:"name,omitempty"`
+	Type     string `json:"type"`
+	Required bool   `json:"required,omitempty"`
+}
+
+// getFormsFromDocument returns the forms of the page, the action is resolved from the page url and a form without
+// action is submitted to the page itself
+func getFormsFromDocument(doc *goquery.Document, pageURL string) []*Form {
+	result := []*Form{}
+	baseURL, err := url.Parse(pageURL)
+
+	if err != nil {
+		return result
+	}
+
+	if href, exists := doc.Find("base[href]").First().Attr("href"); exists {
+		if documentBaseURL, err := baseURL.Parse(strings.TrimSpace(href)); err == nil {
+			baseURL = documentBaseURL
+		}
+	}
+
+	doc.Find("form").Each(func(_ int, selection *goquery.Selection) {
+		form := &Form{
+			Method:  strings.ToUpper(strings.TrimSpace(selection.AttrOr("method", "get"))),
+			Enctype: strings.ToLower(strings.TrimSpace(selection.AttrOr("enctype", ""))),
+			Inputs:  []*FormInput{},
+		}
+
+		if form.Method != "POST" {
+			form.Method = "GET"
+		}
+
+		if actionURL, err := baseURL.Parse(strings.TrimSpace(selection.AttrOr("action", ""))); err == nil {
+			actionURL.Fragment = ""
+			form.Action = actionURL.String()
+		}
+
+		selection.Find("input, select, textarea, button").Each(func(_ int, field *goquery.Selection) {
+			input := &FormInput{
+				Name:     strings.TrimSpace(field.AttrOr("name", "")),
+				Type:     goquery.NodeName(field),
+				Required: field.AttrOr("required", "-") != "-",
+			}
+
+			if input.Type == "input" || input.Type == "button" {
+				input.Type = strings.ToLower(strings.TrimSpace(field.AttrOr("type", getDefaultInputType(input.Type))))
+			}
+
+			// the buttons without name are not submitted
+			if input.Name == "" && (input.Type == "submit" || input.Type == "button" || input.Type == "reset" || input.Type == "image") {
+				return
+			}
+
+			form.Inputs = append(form.Inputs, input)
+		})
+
+		form.Kind = getFormKind(form)
+		result = append(result, form)
+	})
+
+	return result
+}
+
+func getDefaultInputType(nodeName string) string {
+	if nodeName == "button" {
+		return "submit"
+	}
+
+	return "text"
+}
+
+// getFormKind returns the kind of the form by its fields, so login, search and upload forms can be found
+func getFormKind(form *Form) string {
+	hasPassword := false
+	hasSearch := false
+
+	for _, input := range form.Inputs {
+		name := strings.ToLower(input.Name)
+
+		switch {
+		case input.Type == "file":
+			return formKindUpload
+		case input.Type == "password":
+			hasPassword = true
+		case input.Type == "search" || name == "q" || name == "query" || name == "search" || name == "s":
+			hasSearch = true
+		}
+	}
+
+	if hasPassword {
+		return formKindLogin
+	}
+
+	if hasSearch {
+		return formKindSearch
+	}
+
+	return formKindOther
+}
+
+func runFindFormsCommand(args []string) {
+	if len(args) < 1 || len(args) > 2 {
+		fmt.Printf("Usage : %s find-forms <configuration file> [kind] \n", os.Args[0])
+		os.Exit(exitCodeConfigError)
+	}
+
+	configurationFileName = args[0]
+	loadConfigurationFile()
+
+	kind := ""
+
+	if len(args) == 2 {
+		kind = strings.ToLower(args[1])
+	}
+
+	printForms := func(pageURL string, forms []*Form) {
+		for _, form := range forms {
+			if kind != "" && form.Kind != kind {
+				continue
+			}
+
+			inputs := []string{}
+
+			for _, input := range form.Inputs {
+				inputs = append(inputs, input.Name+":"+input.Type)
+			}
+
+			fmt.Println(fmt.Sprintf("%s - %s %s %s (%s)", pageURL, form.Kind, form.Method, form.Action, strings.Join(inputs, " ")))
+		}
+	}
+
+	for _, site := range configuration.Sites {
+		printForms(site.URL, site.Forms)
+
+		for _, page := range site.Pages {
+			printForms(page.URL, page.Forms)
+		}
+	}
+}
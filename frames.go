@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/metal3d/go-slugify"
+)
+
+const framesDirName = "frames"
+const defaultFramesMaxDepth = 2
+
+type FramesConfig struct {
+	Enabled     bool `json:"enabled"`
+	CrossOrigin bool `json:"cross_origin,omitempty"`
+	MaxDepth    int  `json:"max_depth,omitempty"`
+}
+
+// Frame is a document of a frame or an iframe of the site pages, saved in the frames dir of the site
+type Frame struct {
+	URL          string `json:"url"`
+	FileName     string `json:"file_name"`
+	FetchSuccess bool   `json:"fetch_success"`
+	StatusCode   int    `json:"status_code,omitempty"`
+	ContentHash  string `json:"content_hash,omitempty"`
+}
+
+func isFramesEnabled() bool {
+	return configuration.Frames != nil && configuration.Frames.Enabled
+}
+
+// getFrameURLsFromHTML returns the urls of the frames and iframes of the page, without the inline ones
+func getFrameURLsFromHTML(content []byte, pageURL string) []string {
+	result := []string{}
+	baseURL, err := url.Parse(pageURL)
+
+	if err != nil {
+		return result
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(content))
+
+	if err != nil {
+		return result
+	}
+
+	doc.Find("frame[src], iframe[src]").Each(func(_ int, selection *goquery.Selection) {
+		frameURL, err := baseURL.Parse(strings.TrimSpace(selection.AttrOr("src", "")))
+
+		if err != nil || (frameURL.Scheme != "http" && frameURL.Scheme != "https") {
+			return
+		}
+
+		frameURL.Fragment = ""
+
+		if !hasString(result, frameURL.String()) {
+			result = append(result, frameURL.String())
+		}
+	})
+
+	return result
+}
+
+// isFrameAllowed returns if the frame can be captured, by default only the frames of the same origin of the page
+func isFrameAllowed(pageURL string, frameURL string) bool {
+	if configuration.Frames.CrossOrigin {
+		return true
+	}
+
+	parsedPageURL, err := url.Parse(pageURL)
+
+	if err != nil {
+		return false
+	}
+
+	parsedFrameURL, err := url.Parse(frameURL)
+
+	if err != nil {
+		return false
+	}
+
+	return parsedPageURL.Scheme == parsedFrameURL.Scheme && strings.EqualFold(parsedPageURL.Host, parsedFrameURL.Host)
+}
+
+// getFrameFileName returns the file name of the frame in the frames dir, the frames of other hosts have the host
+// in the name so they don't replace the site ones
+func getFrameFileName(site *Site, frameURL string) string {
+	fileName := getPageFileName(frameURL)
+
+	if getURLHost(frameURL) != getURLHost(site.URL) {
+		fileName = slugify.Marshal(getURLHost(frameURL)) + "-" + fileName
+	}
+
+	return fileName
+}
+
+func getSiteFrame(site *Site, frameURL string) *Frame {
+	for _, frame := range site.Frames {
+		if normalizeURL(frame.URL) == normalizeURL(frameURL) {
+			return frame
+		}
+	}
+
+	return nil
+}
+
+// captureFrames fetches and saves the frames of the page and returns the page with the frames pointing to the saved
+// ones, framesPath is the path of the frames dir from the dir of the page
+func captureFrames(site *Site, siteDir string, framesPath string, pageURL string, content []byte, fetcher Fetcher) []byte {
+	return captureFramesWithDepth(site, siteDir, framesPath, pageURL, content, fetcher, 1)
+}
+
+func captureFramesWithDepth(site *Site, siteDir string, framesPath string, pageURL string, content []byte, fetcher Fetcher, depth int) []byte {
+	maxDepth := configuration.Frames.MaxDepth
+
+	if maxDepth <= 0 {
+		maxDepth = defaultFramesMaxDepth
+	}
+
+	localPaths := map[string]string{}
+
+	for _, frameURL := range getFrameURLsFromHTML(content, pageURL) {
+		if !isFrameAllowed(pageURL, frameURL) {
+			continue
+		}
+
+		frame := getSiteFrame(site, frameURL)
+
+		// frames are fetched once per run, like the frames of the navigation shared by all pages
+		if frame == nil {
+			frame = &Frame{URL: frameURL, FileName: framesDirName + "/" + getFrameFileName(site, frameURL)}
+			site.Frames = append(site.Frames, frame)
+			fetchFrame(site, siteDir, frame, fetcher, depth, maxDepth)
+		}
+
+		if frame.FetchSuccess {
+			localPaths[normalizeURL(frameURL)] = framesPath + strings.TrimPrefix(frame.FileName, framesDirName+"/")
+		}
+	}
+
+	if len(localPaths) == 0 {
+		return content
+	}
+
+	return rewriteFrameURLs(content, pageURL, localPaths)
+}
+
+func fetchFrame(site *Site, siteDir string, frame *Frame, fetcher Fetcher, depth int, maxDepth int) {
+	printInfo("Getting frame:", frame.URL)
+
+	content, statusCode, err := fetchPage(fetcher, frame.URL)
+	frame.StatusCode = statusCode
+
+	if err != nil {
+		printError("Unable to fetch frame:", frame.URL, err)
+		emitEvent("frame_failed", site, frame.URL, err, nil)
+		return
+	}
+
+	crawledBytes += int64(len(content))
+	frame.ContentHash = getContentHash(content)
+
+	// the frames of the frame are in the same dir
+	if depth < maxDepth {
+		content = captureFramesWithDepth(site, siteDir, "", frame.URL, content, fetcher, depth+1)
+	}
+
+	frameFileName := siteDir + string(filepath.Separator) + filepath.FromSlash(frame.FileName)
+	err = os.MkdirAll(filepath.Dir(frameFileName), dirMode)
+
+	if err == nil {
+		err = writeFile(frameFileName, content, fileMode)
+	}
+
+	if err != nil {
+		printError("Unable to save frame content:", err)
+		return
+	}
+
+	if configuration.SafeView {
+		if err := saveSafeViewFile(frameFileName, content); err != nil {
+			printError("Unable to save frame safe view:", err)
+		}
+	}
+
+	frame.FetchSuccess = true
+	emitEvent("frame_fetched", site, frame.URL, nil, map[string]interface{}{"bytes": len(content), "depth": depth})
+}
+
+// rewriteFrameURLs changes the src of the frames and iframes to the local paths of the saved frames
+func rewriteFrameURLs(content []byte, pageURL string, localPaths map[string]string) []byte {
+	baseURL, err := url.Parse(pageURL)
+
+	if err != nil {
+		return content
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(content))
+
+	if err != nil {
+		return content
+	}
+
+	doc.Find("frame[src], iframe[src]").Each(func(_ int, selection *goquery.Selection) {
+		frameURL, err := baseURL.Parse(strings.TrimSpace(selection.AttrOr("src", "")))
+
+		if err != nil {
+			return
+		}
+
+		fragment := frameURL.Fragment
+		frameURL.Fragment = ""
+		localPath, exists := localPaths[normalizeURL(frameURL.String())]
+
+		if !exists {
+			return
+		}
+
+		if fragment != "" {
+			localPath += "#" + fragment
+		}
+
+		selection.SetAttr("src", localPath)
+	})
+
+	html, err := doc.Html()
+
+	if err != nil {
+		return content
+	}
+
+	return []byte(html)
+}
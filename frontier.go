@@ -0,0 +1,68 @@
+package main
+
+// Frontier is the queue of the pages to crawl of a site and the set of the visited urls, the memory frontier is
+// used by one process and the redis frontier is shared by the processes that crawl the same site
+type Frontier interface {
+	// Visit marks the url as visited, returning false when it was already visited
+	Visit(url string) (bool, error)
+	// Push queues a page, the pages with the lowest depth are crawled first
+	Push(item *pageQueueItem) error
+	// Next returns the next page to crawl, or nil when there are no more pages
+	Next() (*pageQueueItem, error)
+	// Done is called after the links of the page were added
+	Done(item *pageQueueItem)
+	Close() error
+}
+
+type MemoryFrontier struct {
+	visited map[string]bool
+	queue   []*pageQueueItem
+}
+
+func NewMemoryFrontier() *MemoryFrontier {
+	return &MemoryFrontier{visited: map[string]bool{}}
+}
+
+func (frontier *MemoryFrontier) Visit(url string) (bool, error) {
+	normalizedURL := normalizeURL(url)
+
+	if frontier.visited[normalizedURL] {
+		return false, nil
+	}
+
+	frontier.visited[normalizedURL] = true
+
+	return true, nil
+}
+
+// Push keeps the queue in breadth first order, since the links are added after their page
+func (frontier *MemoryFrontier) Push(item *pageQueueItem) error {
+	frontier.queue = append(frontier.queue, item)
+	return nil
+}
+
+func (frontier *MemoryFrontier) Next() (*pageQueueItem, error) {
+	if len(frontier.queue) == 0 {
+		return nil, nil
+	}
+
+	item := frontier.queue[0]
+	frontier.queue = frontier.queue[1:]
+
+	return item, nil
+}
+
+func (frontier *MemoryFrontier) Done(item *pageQueueItem) {
+}
+
+func (frontier *MemoryFrontier) Close() error {
+	return nil
+}
+
+func newFrontier(site *Site) (Frontier, error) {
+	if configuration.Frontier == nil || configuration.Frontier.Redis == "" {
+		return NewMemoryFrontier(), nil
+	}
+
+	return NewRedisFrontier(configuration.Frontier, site.URL)
+}
@@ -0,0 +1,9 @@
+//go:build windows
+// +build windows
+
+package main
+
+// directories can't be synced on windows, the names of the files are durable with the files
+func syncDir(dir string) error {
+	return nil
+}
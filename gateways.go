@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// GatewayConfig routes the urls that start with the prefix to a gateway of another network, like Hyphanet
+// FProxy or ZeroNet, when the url is set the prefix is replaced by it
+type GatewayConfig struct {
+	Prefix string `json:"prefix"`
+	URL    string `json:"url,omitempty"`
+	ViaTor bool   `json:"via_tor,omitempty"`
+}
+
+// GatewayFetcher gets the urls from a local gateway, directly or through Tor for remote gateways
+type GatewayFetcher struct {
+	Config *GatewayConfig
+	Client *http.Client
+}
+
+func NewGatewayFetcher(config *GatewayConfig) *GatewayFetcher {
+	if config.ViaTor {
+		return &GatewayFetcher{Config: config, Client: newTorHTTPClient()}
+	}
+
+	dialContext := getDirectDialContext(getTimeout(getTimeoutsConfig().DialSeconds, timeout))
+
+	return &GatewayFetcher{Config: config, Client: newHTTPClient(&http.Transport{DialContext: dialContext})}
+}
+
+func (fetcher *GatewayFetcher) Get(ctx context.Context, url string) (*http.Response, error) {
+	return getTracedURL(ctx, fetcher.Client, getGatewayURL(fetcher.Config, url))
+}
+
+func (fetcher *GatewayFetcher) Post(ctx context.Context, url string, contentType string, body []byte) (*http.Response, error) {
+	return postTracedURL(ctx, fetcher.Client, getGatewayURL(fetcher.Config, url), contentType, body)
+}
+
+func (fetcher *GatewayFetcher) Match(url string) bool {
+	return fetcher.Config.Prefix != "" && strings.HasPrefix(url, fetcher.Config.Prefix)
+}
+
+func getGatewayURL(config *GatewayConfig, url string) string {
+	if config.URL == "" {
+		return url
+	}
+
+	return config.URL + strings.TrimPrefix(url, config.Prefix)
+}
+
+func getGatewayRoutes() []*FetcherRoute {
+	result := []*FetcherRoute{}
+
+	for _, gateway := range configuration.Gateways {
+		fetcher := NewGatewayFetcher(gateway)
+		result = append(result, &FetcherRoute{Match: fetcher.Match, Fetcher: fetcher})
+	}
+
+	return result
+}
+
+func isGatewayURL(url string) bool {
+	for _, gateway := range configuration.Gateways {
+		if gateway.Prefix != "" && strings.HasPrefix(url, gateway.Prefix) {
+			return true
+		}
+	}
+
+	return false
+}
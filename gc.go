@@ -0,0 +1,198 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const thumbnailsDirName = "thumbs"
+
+// dirs of the site with files that are not assets, they are never collected
+var gcSkippedDirs = []string{snapshotsDirName, errorsDirName, pgpKeysDirName, apiDirName, evidenceDirName}
+
+// dirs of the site where every file is an asset
+var gcAssetDirs = []string{pagesDirName, framesDirName, thumbnailsDirName, dataURIDirName}
+
+// OrphanedFile is an asset of the site dir that is not referenced by the site anymore
+type OrphanedFile struct {
+	Path  string
+	Size  int64
+	Links uint64
+}
+
+// isReclaimable returns if removing the file frees its space, the files linked by snapshots are kept by them
+func (file *OrphanedFile) isReclaimable() bool {
+	return file.Links <= 1
+}
+
+// getSiteReferencedFiles returns the files of the site state, relative to the site dir and without extension, so
+// the markdown and the safe view saved next to a page are referenced by it too. The favicon is referenced by any
+// extension
+func getSiteReferencedFiles(site *Site) map[string]bool {
+	fileNames := []string{"index.html", "favicon.ico", screenshotFileName, previousScreenshotFileName}
+
+	for _, image := range site.Images {
+		fileNames = append(fileNames, image.URL, image.URL+quarantineSuffix, thumbnailsDirName+"/"+image.URL)
+	}
+
+	for _, page := range site.Pages {
+		fileNames = append(fileNames, page.FileName)
+	}
+
+	for _, frame := range site.Frames {
+		fileNames = append(fileNames, frame.FileName)
+	}
+
+	for _, feed := range site.Feeds {
+		for _, entry := range feed.Entries {
+			fileNames = append(fileNames, entry.FileName)
+		}
+	}
+
+	result := map[string]bool{}
+
+	for _, fileName := range fileNames {
+		if fileName != "" {
+			result[getGCFileKey(fileName)] = true
+		}
+	}
+
+	return result
+}
+
+func getGCFileKey(fileName string) string {
+	fileName = filepath.ToSlash(filepath.Clean(filepath.FromSlash(fileName)))
+	fileName = strings.TrimSuffix(fileName, quarantineSuffix)
+	fileName = strings.TrimSuffix(fileName, safeViewSuffix)
+
+	return strings.TrimSuffix(fileName, filepath.Ext(fileName))
+}
+
+// isGCAsset returns if the file of the site dir is an asset: the pages, frames, thumbnails and images
+func isGCAsset(relativePath string) bool {
+	dirName := strings.SplitN(relativePath, "/", 2)[0]
+
+	for _, assetDir := range gcAssetDirs {
+		if dirName == assetDir && dirName != relativePath {
+			return true
+		}
+	}
+
+	return isImageExtension(filepath.Ext(strings.TrimSuffix(relativePath, quarantineSuffix)))
+}
+
+// getOrphanedFiles returns the assets of the site dir that are not referenced by the site, like the images and
+// pages removed from the site since they were saved
+func getOrphanedFiles(site *Site, siteDir string) ([]*OrphanedFile, error) {
+	result := []*OrphanedFile{}
+	referencedFiles := getSiteReferencedFiles(site)
+
+	err := filepath.Walk(siteDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		relativePath, err := filepath.Rel(siteDir, path)
+
+		if err != nil {
+			return err
+		}
+
+		relativePath = filepath.ToSlash(relativePath)
+
+		if info.IsDir() {
+			if hasString(gcSkippedDirs, relativePath) {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if !isGCAsset(relativePath) || referencedFiles[getGCFileKey(relativePath)] {
+			return nil
+		}
+
+		result = append(result, &OrphanedFile{Path: path, Size: info.Size(), Links: getFileLinks(info)})
+
+		return nil
+	})
+
+	return result, err
+}
+
+func runGCCommand(args []string) {
+	flags := flag.NewFlagSet("gc", flag.ExitOnError)
+	deleteFiles := flags.Bool("delete", false, "delete the orphaned files, instead of only printing them")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fmt.Printf("Usage : %s gc [-delete] <configuration file> \n", os.Args[0])
+		os.Exit(exitCodeConfigError)
+	}
+
+	configurationFileName = flags.Arg(0)
+
+	loadConfigurationFile()
+
+	currentDir, err := os.Getwd()
+
+	if err != nil {
+		fmt.Println("Unable to get current directory:", err)
+		os.Exit(exitCodeError)
+	}
+
+	outputDir := getOutputDir(currentDir)
+	totalOfFiles := 0
+	var reclaimableBytes int64
+
+	for _, site := range configuration.Sites {
+		// the state of the sites that were not fetched can miss their files
+		if !site.FetchSuccess {
+			continue
+		}
+
+		files, err := getOrphanedFiles(site, outputDir+string(filepath.Separator)+getSiteDirName(site))
+
+		if err != nil {
+			fmt.Println("Unable to get site orphaned files:", site.URL, err)
+			continue
+		}
+
+		for _, file := range files {
+			details := formatBytes(file.Size)
+
+			if !file.isReclaimable() {
+				details += ", linked by snapshots"
+			}
+
+			fmt.Println(fmt.Sprintf("%s (%s)", file.Path, details))
+
+			if *deleteFiles {
+				if err := os.Remove(file.Path); err != nil {
+					fmt.Println("Unable to delete orphaned file:", err)
+					continue
+				}
+			}
+
+			totalOfFiles++
+
+			if file.isReclaimable() {
+				reclaimableBytes += file.Size
+			}
+		}
+	}
+
+	if *deleteFiles {
+		fmt.Println(fmt.Sprintf("Deleted %d orphaned files, %s reclaimed", totalOfFiles, formatBytes(reclaimableBytes)))
+		return
+	}
+
+	fmt.Println(fmt.Sprintf("Found %d orphaned files, %s can be reclaimed with -delete", totalOfFiles, formatBytes(reclaimableBytes)))
+}
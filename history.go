@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const historyFileName = "history.jsonl"
+
+// SiteHistoryEntry is one crawl attempt of the site, saved as a line of the site history file
+type SiteHistoryEntry struct {
+	Time          time.Time `json:"time"`
+	Success       bool      `json:"success"`
+	StatusCode    int       `json:"status_code,omitempty"`
+	Bytes         int64     `json:"bytes,omitempty"`
+	ContentHash   string    `json:"content_hash,omitempty"`
+	SoftError     string    `json:"soft_error,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	TorErrorClass string    `json:"tor_error_class,omitempty"`
+
+	LatencyMillis int64 `json:"latency_ms,omitempty"`
+
+	Circuit *TorCircuit `json:"circuit,omitempty"`
+}
+
+func getSiteHistoryFileName(site *Site) (string, error) {
+	currentDir, err := os.Getwd()
+
+	if err != nil {
+		return "", err
+	}
+
+	return getOutputDir(currentDir) + string(filepath.Separator) + getSiteDirName(site) + string(filepath.Separator) + historyFileName, nil
+}
+
+// recordSiteHistory appends the crawl attempt to the site history file, the deterministic output has no history
+// since it has the time of the attempts
+func recordSiteHistory(site *Site, entry *SiteHistoryEntry) {
+	if configuration.Deterministic {
+		return
+	}
+
+	entry.Time = time.Now().UTC()
+
+	if isCircuitLoggingEnabled() {
+		entry.Circuit = getRecordedRequestCircuit(site.URL)
+	}
+
+	fileName, err := getSiteHistoryFileName(site)
+
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(fileName), dirMode)
+	}
+
+	if err != nil {
+		printError("Unable to save site history:", err)
+		return
+	}
+
+	entryJSON, err := json.Marshal(entry)
+
+	if err != nil {
+		printError("Unable to save site history:", err)
+		return
+	}
+
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, fileMode)
+
+	if err != nil {
+		printError("Unable to save site history:", err)
+		return
+	}
+
+	defer file.Close()
+
+	_, err = file.Write(append(entryJSON, '\n'))
+
+	if err != nil {
+		printError("Unable to save site history:", err)
+	}
+}
+
+func getSiteHistory(site *Site) ([]*SiteHistoryEntry, error) {
+	result := []*SiteHistoryEntry{}
+	fileName, err := getSiteHistoryFileName(site)
+
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(fileName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		entry := &SiteHistoryEntry{}
+
+		// lines of an interrupted write are ignored
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			continue
+		}
+
+		// the entries saved before "tor_error_class" have the tor class in "error_class"
+		if entry.TorErrorClass == "" && !entry.Success {
+			legacyEntry := struct {
+				ErrorClass string `json:"error_class"`
+			}{}
+
+			if json.Unmarshal(scanner.Bytes(), &legacyEntry) == nil {
+				entry.TorErrorClass = legacyEntry.ErrorClass
+			}
+		}
+
+		result = append(result, entry)
+	}
+
+	return result, scanner.Err()
+}
+
+func runHistoryCommand(args []string) {
+	if len(args) != 2 {
+		fmt.Printf("Usage : %s history <configuration file> <url> \n", os.Args[0])
+		os.Exit(exitCodeConfigError)
+	}
+
+	configurationFileName = args[0]
+	siteURL := args[1]
+
+	loadConfigurationFile()
+
+	// the site of the configuration is used, so the site dir is the same of the crawl
+	site := &Site{URL: siteURL}
+
+	for _, configuredSite := range configuration.Sites {
+		if normalizeURL(configuredSite.URL) == normalizeURL(siteURL) {
+			site = configuredSite
+			break
+		}
+	}
+
+	history, err := getSiteHistory(site)
+
+	if err != nil {
+		fmt.Println("Unable to read site history:", err)
+		os.Exit(exitCodeError)
+	}
+
+	successes := 0
+	changes := 0
+	lastContentHash := ""
+
+	for _, entry := range history {
+		status := "down"
+		details := entry.Error
+
+		if entry.Success {
+			successes++
+			status = "up"
+			details = formatBytes(entry.Bytes)
+
+			if lastContentHash != "" && entry.ContentHash != lastContentHash {
+				changes++
+				details += " changed"
+			}
+
+			lastContentHash = entry.ContentHash
+		}
+
+		statusCode := "-"
+
+		if entry.StatusCode > 0 {
+			statusCode = fmt.Sprintf("%d", entry.StatusCode)
+		}
+
+		fmt.Println(fmt.Sprintf("%s  %-4s  %-3s  %s", entry.Time.Local().Format("2006-01-02 15:04:05"), status, statusCode, details))
+	}
+
+	if len(history) == 0 {
+		fmt.Println("Site has no history:", siteURL)
+		return
+	}
+
+	fmt.Println(fmt.Sprintf("%d attempts, %d up (%.0f%%), %d content changes", len(history), successes, float64(successes)*100/float64(len(history)), changes))
+}
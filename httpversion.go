@@ -0,0 +1,41 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+)
+
+// forceHTTP1 is set by the -http1 flag, for the servers with a broken HTTP/2
+var forceHTTP1 bool
+
+func isHTTP1Forced() bool {
+	return forceHTTP1 || (configuration != nil && configuration.ForceHTTP1)
+}
+
+// getALPNProtocols returns the protocols offered in the tls handshake
+func getALPNProtocols() []string {
+	if isHTTP1Forced() {
+		return []string{"http/1.1"}
+	}
+
+	return []string{"h2", "http/1.1"}
+}
+
+// setupHTTPVersion enables HTTP/2 on the transports with a custom dialer, like the Tor SOCKS dialer, where go only
+// uses HTTP/1.1 by default. The version is negotiated with ALPN, so HTTP/2 is only used on https when the server
+// offers it. With HTTP/1.1 forced the upgrade is disabled
+func setupHTTPVersion(transport *http.Transport) {
+	if !isHTTP1Forced() {
+		transport.ForceAttemptHTTP2 = true
+		return
+	}
+
+	transport.ForceAttemptHTTP2 = false
+	transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+
+	transport.TLSClientConfig.NextProtos = getALPNProtocols()
+}
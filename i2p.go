@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const defaultI2PHTTPProxy = "127.0.0.1:4444"
+
+type I2PConfig struct {
+	HTTPProxy string `json:"http_proxy,omitempty"`
+}
+
+// I2PFetcher gets eepsites through the I2P router HTTP proxy
+type I2PFetcher struct {
+	Client *http.Client
+}
+
+func NewI2PFetcher(config *I2PConfig) *I2PFetcher {
+	proxyAddress := defaultI2PHTTPProxy
+
+	if config != nil && config.HTTPProxy != "" {
+		proxyAddress = config.HTTPProxy
+	}
+
+	proxyURL := &url.URL{Scheme: "http", Host: proxyAddress}
+	i2pTransport := &http.Transport{
+		Proxy:       http.ProxyURL(proxyURL),
+		DialContext: getDirectDialContext(getTimeout(getTimeoutsConfig().DialSeconds, timeout)),
+	}
+
+	return &I2PFetcher{Client: newHTTPClient(i2pTransport)}
+}
+
+func (fetcher *I2PFetcher) Get(ctx context.Context, url string) (*http.Response, error) {
+	return getTracedURL(ctx, fetcher.Client, url)
+}
+
+func (fetcher *I2PFetcher) Post(ctx context.Context, url string, contentType string, body []byte) (*http.Response, error) {
+	return postTracedURL(ctx, fetcher.Client, url, contentType, body)
+}
+
+func isI2PURL(rawURL string) bool {
+	return strings.HasSuffix(getURLHost(rawURL), ".i2p")
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+// set when the crawl was interrupted, by a signal or by closing the tui, the main loop stops like an aborted crawl
+// and saves the configuration before it exits
+var crawlInterrupted int32
+
+func interruptCrawl() {
+	if atomic.SwapInt32(&crawlInterrupted, 1) == 0 {
+		printInfo("Crawl interrupted, stopping after the current page...")
+	}
+}
+
+func isCrawlInterrupted() bool {
+	return atomic.LoadInt32(&crawlInterrupted) == 1
+}
+
+// setupInterrupts interrupts the crawl on the first SIGINT or SIGTERM, a second one exits at once without saving
+func setupInterrupts() {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-signals
+		interruptCrawl()
+
+		<-signals
+		os.Exit(exitCodeInterrupted)
+	}()
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// stopwords used to guess the language of a page when it doesn't declare one
+var languageStopwords = map[string][]string{
+	"en": {"the", "and", "is", "of", "to", "in", "that", "it", "for", "you", "with", "this", "are", "on", "not"},
+	"pt": {"de", "que", "não", "para", "com", "uma", "os", "no", "se", "na", "por", "mais", "as", "do", "você"},
+	"es": {"de", "que", "el", "la", "los", "las", "por", "con", "para", "una", "es", "del", "se", "no", "más"},
+	"fr": {"le", "la", "les", "des", "est", "et", "une", "pour", "que", "dans", "pas", "vous", "sur", "du", "avec"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "ein", "eine", "mit", "sie", "auf", "für", "den", "von", "zu"},
+	"it": {"il", "di", "che", "la", "per", "non", "una", "sono", "del", "con", "gli", "le", "della", "è", "anche"},
+	"nl": {"de", "het", "een", "en", "van", "is", "niet", "dat", "op", "te", "voor", "met", "zijn", "ook", "je"},
+}
+
+// unicode scripts that identify a language on their own
+var languageScripts = []struct {
+	language string
+	table    *unicode.RangeTable
+}{
+	{"ru", unicode.Cyrillic},
+	{"ar", unicode.Arabic},
+	{"zh", unicode.Han},
+	{"ja", unicode.Hiragana},
+	{"ko", unicode.Hangul},
+	{"el", unicode.Greek},
+	{"he", unicode.Hebrew},
+}
+
+func getLanguageFromDocument(doc *goquery.Document, defaultResult string) string {
+	// declared language has priority
+	if lang, exists := doc.Find("html").Attr("lang"); exists {
+		if language := normalizeLanguageCode(lang); language != "" {
+			return language
+		}
+	}
+
+	if lang, exists := doc.Find("meta[http-equiv='content-language' i]").Attr("content"); exists {
+		if language := normalizeLanguageCode(lang); language != "" {
+			return language
+		}
+	}
+
+	// guess from the visible text
+	language := detectLanguageFromText(getVisibleText(doc.Find("body")))
+
+	if language == "" {
+		return defaultResult
+	}
+
+	return language
+}
+
+func detectLanguageFromText(text string) string {
+	// count letters by script first
+	letters := 0
+	scriptCount := map[string]int{}
+
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+
+		letters++
+
+		for _, script := range languageScripts {
+			if unicode.Is(script.table, r) {
+				scriptCount[script.language]++
+				break
+			}
+		}
+	}
+
+	if letters == 0 {
+		return ""
+	}
+
+	// kana is a better hint for japanese than han alone
+	if scriptCount["ja"] > 0 {
+		scriptCount["ja"] += scriptCount["zh"]
+	}
+
+	bestScript := ""
+
+	for _, script := range languageScripts {
+		if scriptCount[script.language] > scriptCount[bestScript] {
+			bestScript = script.language
+		}
+	}
+
+	if bestScript != "" && scriptCount[bestScript]*2 > letters {
+		return bestScript
+	}
+
+	// latin based languages are scored by stopword hits
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+
+	wordCount := map[string]int{}
+
+	for _, word := range words {
+		wordCount[word]++
+	}
+
+	bestLanguage := ""
+	bestScore := 0
+
+	for language, stopwords := range languageStopwords {
+		score := 0
+
+		for _, stopword := range stopwords {
+			score += wordCount[stopword]
+		}
+
+		// ties are resolved by name so the result is stable
+		if score > bestScore || (score == bestScore && score > 0 && language < bestLanguage) {
+			bestLanguage = language
+			bestScore = score
+		}
+	}
+
+	return bestLanguage
+}
+
+func normalizeLanguageCode(code string) string {
+	code = strings.TrimSpace(strings.ToLower(code))
+
+	// use the first language of a list like "en, pt"
+	if index := strings.IndexAny(code, ",;"); index >= 0 {
+		code = strings.TrimSpace(code[:index])
+	}
+
+	// strip the region of codes like "pt-br" or "en_US"
+	if index := strings.IndexAny(code, "-_"); index >= 0 {
+		code = code[:index]
+	}
+
+	if len(code) < 2 || len(code) > 3 {
+		return ""
+	}
+
+	for _, r := range code {
+		if r < 'a' || r > 'z' {
+			return ""
+		}
+	}
+
+	return code
+}
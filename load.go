@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const defaultLoadControlWindow = 20
+const defaultLoadControlFailureRate = 0.5
+const defaultLoadControlRecoveryRate = 0.1
+const defaultLoadControlMaxDelay = 30
+const loadControlBaseDelay = time.Second
+
+// tor refuses NEWNYM signals sent too often
+const newTorCircuitsInterval = 10 * time.Second
+
+type LoadControlConfig struct {
+	Enabled         bool    `json:"enabled"`
+	Window          int     `json:"window,omitempty"`
+	FailureRate     float64 `json:"failure_rate,omitempty"`
+	RecoveryRate    float64 `json:"recovery_rate,omitempty"`
+	MaxDelaySeconds int     `json:"max_delay_seconds,omitempty"`
+	NewCircuits     bool    `json:"new_circuits,omitempty"`
+}
+
+// LoadControl limits the parallel downloads and the delay between requests, backing off when the requests
+// start failing and ramping back up when they recover
+type LoadControl struct {
+	mutex          sync.Mutex
+	cond           *sync.Cond
+	config         *LoadControlConfig
+	results        []bool
+	concurrency    int
+	maxConcurrency int
+	active         int
+	delay          time.Duration
+	lastNewCircuit time.Time
+}
+
+var loadControl *LoadControl
+
+func setupLoadControl(maxConcurrency int, config *LoadControlConfig) {
+	if maxConcurrency <= 0 {
+		maxConcurrency = 1
+	}
+
+	// the defaults aren't saved to the configuration file
+	loadControlConfig := LoadControlConfig{}
+
+	if config != nil {
+		loadControlConfig = *config
+	}
+
+	config = &loadControlConfig
+
+	if config.Window <= 0 {
+		config.Window = defaultLoadControlWindow
+	}
+
+	if config.FailureRate <= 0 {
+		config.FailureRate = defaultLoadControlFailureRate
+	}
+
+	if config.RecoveryRate <= 0 {
+		config.RecoveryRate = defaultLoadControlRecoveryRate
+	}
+
+	if config.MaxDelaySeconds <= 0 {
+		config.MaxDelaySeconds = defaultLoadControlMaxDelay
+	}
+
+	loadControl = &LoadControl{
+		config:         config,
+		concurrency:    maxConcurrency,
+		maxConcurrency: maxConcurrency,
+	}
+
+	loadControl.cond = sync.NewCond(&loadControl.mutex)
+}
+
+// acquire waits until a download can start with the current concurrency
+func (loadControl *LoadControl) acquire() {
+	if loadControl == nil {
+		return
+	}
+
+	loadControl.mutex.Lock()
+	defer loadControl.mutex.Unlock()
+
+	for loadControl.active >= loadControl.concurrency {
+		loadControl.cond.Wait()
+	}
+
+	loadControl.active++
+}
+
+func (loadControl *LoadControl) release() {
+	if loadControl == nil {
+		return
+	}
+
+	loadControl.mutex.Lock()
+	defer loadControl.mutex.Unlock()
+
+	loadControl.active--
+	loadControl.cond.Broadcast()
+}
+
+func (loadControl *LoadControl) waitDelay() {
+	if loadControl == nil {
+		return
+	}
+
+	loadControl.mutex.Lock()
+	delay := loadControl.delay
+	loadControl.mutex.Unlock()
+
+	if delay > 0 {
+		crawlerClock.Sleep(delay)
+	}
+}
+
+// recordResult adds the request result to the window and changes the load when the failure rate of the window
+// goes above the failure rate or below the recovery rate
+func (loadControl *LoadControl) recordResult(err error) {
+	if loadControl == nil || !loadControl.config.Enabled {
+		return
+	}
+
+	loadControl.mutex.Lock()
+	defer loadControl.mutex.Unlock()
+
+	loadControl.results = append(loadControl.results, err != nil)
+
+	if len(loadControl.results) < loadControl.config.Window {
+		return
+	}
+
+	failures := 0
+
+	for _, failed := range loadControl.results {
+		if failed {
+			failures++
+		}
+	}
+
+	failureRate := float64(failures) / float64(len(loadControl.results))
+	loadControl.results = nil
+
+	if failureRate >= loadControl.config.FailureRate {
+		loadControl.backOff(failureRate)
+	} else if failureRate <= loadControl.config.RecoveryRate {
+		loadControl.rampUp(failureRate)
+	}
+}
+
+func (loadControl *LoadControl) backOff(failureRate float64) {
+	maxDelay := time.Duration(loadControl.config.MaxDelaySeconds) * time.Second
+
+	loadControl.concurrency = loadControl.concurrency / 2
+
+	if loadControl.concurrency < 1 {
+		loadControl.concurrency = 1
+	}
+
+	if loadControl.delay == 0 {
+		loadControl.delay = loadControlBaseDelay
+	} else {
+		loadControl.delay *= 2
+	}
+
+	if loadControl.delay > maxDelay {
+		loadControl.delay = maxDelay
+	}
+
+	printInfo(fmt.Sprintf("Tor overloaded (%.0f%% of requests failed), using concurrency %d and delay %s", failureRate*100, loadControl.concurrency, loadControl.delay))
+	emitEvent("load_backoff", nil, "", nil, map[string]interface{}{"failure_rate": failureRate, "concurrency": loadControl.concurrency, "delay_ms": loadControl.delay.Milliseconds()})
+
+	if loadControl.config.NewCircuits && !isReplaying() && crawlerClock.Now().Sub(loadControl.lastNewCircuit) >= newTorCircuitsInterval {
+		loadControl.lastNewCircuit = crawlerClock.Now()
+
+		go func() {
+			err := requestNewTorCircuits(configuration.TorControl)
+
+			if err != nil {
+				printError("Unable to request new Tor circuits:", err)
+				return
+			}
+
+			printInfo("New Tor circuits requested")
+		}()
+	}
+}
+
+func (loadControl *LoadControl) rampUp(failureRate float64) {
+	if loadControl.concurrency == loadControl.maxConcurrency && loadControl.delay == 0 {
+		return
+	}
+
+	if loadControl.concurrency < loadControl.maxConcurrency {
+		loadControl.concurrency++
+		loadControl.cond.Broadcast()
+	}
+
+	loadControl.delay /= 2
+
+	if loadControl.delay < loadControlBaseDelay {
+		loadControl.delay = 0
+	}
+
+	printInfo(fmt.Sprintf("Tor recovered (%.0f%% of requests failed), using concurrency %d and delay %s", failureRate*100, loadControl.concurrency, loadControl.delay))
+	emitEvent("load_recovered", nil, "", nil, map[string]interface{}{"failure_rate": failureRate, "concurrency": loadControl.concurrency, "delay_ms": loadControl.delay.Milliseconds()})
+}
@@ -1,15 +1,17 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"sync"
 	"time"
 
 	"strings"
@@ -21,161 +23,869 @@ import (
 
 type Site struct {
 	URL          string   `json:"url"`
+	Method       string   `json:"method,omitempty"`
+	Body         string   `json:"body,omitempty"`
+	ContentType  string   `json:"content_type,omitempty"`
+	Tags         []string `json:"tags,omitempty"`
 	Title        string   `json:"title"`
+	Language     string   `json:"language"`
+	Categories   []string `json:"categories,omitempty"`
 	FetchSuccess bool     `json:"fetch_success"`
+	ContentHash  string   `json:"content_hash"`
+	FaviconHash  string   `json:"favicon_hash,omitempty"`
+	DuplicateOf  string   `json:"duplicate_of,omitempty"`
+	FailureCount int      `json:"failure_count"`
+	StatusCode   int      `json:"status_code,omitempty"`
+	Protocol     string   `json:"protocol,omitempty"`
+	SoftError    string   `json:"soft_error,omitempty"`
+	MaxBytes     int64    `json:"max_bytes,omitempty"`
+	Truncated    bool     `json:"truncated,omitempty"`
+	LastSnapshot string   `json:"last_snapshot,omitempty"`
+	PathPrefix   string   `json:"path_prefix,omitempty"`
+	MaxDepth     int      `json:"max_depth,omitempty"`
+	MaxPages     int      `json:"max_pages,omitempty"`
+	RobotsPolicy string   `json:"robots_policy,omitempty"`
+	Robots       []string `json:"robots,omitempty"`
+	CrawlDelay   float64  `json:"crawl_delay,omitempty"`
+	Canonical    string   `json:"canonical,omitempty"`
+	Pages        []*Page  `json:"pages,omitempty"`
+	Frames       []*Frame `json:"frames,omitempty"`
+	CrawlFeeds   bool     `json:"crawl_feeds,omitempty"`
+	Feeds        []*Feed  `json:"feeds,omitempty"`
+	Mirrors      []string `json:"mirrors,omitempty"`
 	Images       []*Image `json:"images"`
+
+	ExtractionRules []*ExtractionRule `json:"extraction_rules,omitempty"`
+	Availability    *SiteAvailability `json:"availability,omitempty"`
+	API             *APIConfig        `json:"api,omitempty"`
+	SkipRules       []*SkipRule       `json:"skip_rules,omitempty"`
+	SkipReason      string            `json:"skip_reason,omitempty"`
+	Article         *Article          `json:"article,omitempty"`
+	Forms           []*Form           `json:"forms,omitempty"`
+
+	ScreenshotHash string          `json:"screenshot_hash,omitempty"`
+	ScreenshotDiff *ScreenshotDiff `json:"screenshot_diff,omitempty"`
+
+	PGPKeys      []*PGPKey     `json:"pgp_keys,omitempty"`
+	OnionService *OnionService `json:"onion_service,omitempty"`
+	TLS          *SiteTLS      `json:"tls,omitempty"`
+
+	Fingerprint *ResponseFingerprint `json:"fingerprint,omitempty"`
+
+	Directory      bool   `json:"directory,omitempty"`
+	Approval       string `json:"approval,omitempty"`
+	DiscoveredFrom string `json:"discovered_from,omitempty"`
+
+	TLSFingerprint string `json:"tls_fingerprint,omitempty"`
+	BodyTruncated  bool   `json:"body_truncated,omitempty"`
+
+	Project string `json:"project,omitempty"`
 }
 
 type Image struct {
-	URL          string `json:"url"`
-	FetchSuccess bool   `json:"fetch_success"`
+	URL          string         `json:"url"`
+	FetchSuccess bool           `json:"fetch_success"`
+	Metadata     *ImageMetadata `json:"metadata,omitempty"`
+
+	PerceptualHash string `json:"perceptual_hash,omitempty"`
+	ContentHash    string `json:"content_hash,omitempty"`
+	ContentType    string `json:"content_type,omitempty"`
+	Quarantined    bool   `json:"quarantined,omitempty"`
+	ScanResult     string `json:"scan_result,omitempty"`
+	SkipReason     string `json:"skip_reason,omitempty"`
+	ThumbnailError string `json:"thumbnail_error,omitempty"`
+	DataURI        string `json:"-"`
 }
 
 type ConfigurationFile struct {
-	Sites []*Site `json:"sites"`
+	Sites    []*Site  `json:"sites"`
+	Scanners []string `json:"scanners,omitempty"`
+
+	Profile   string `json:"profile,omitempty"`
+	TorProxy  string `json:"tor_proxy,omitempty"`
+	OutputDir string `json:"output_dir,omitempty"`
+	MaxDepth  int    `json:"max_depth,omitempty"`
+	MaxPages  int    `json:"max_pages,omitempty"`
+
+	SiteDirTemplate string `json:"site_dir_template,omitempty"`
+	PageLayout      string `json:"page_layout,omitempty"`
+
+	RobotsPolicy string           `json:"robots_policy,omitempty"`
+	RobotsTxt    *RobotsTxtConfig `json:"robots_txt,omitempty"`
+	SkipRules    []*SkipRule      `json:"skip_rules,omitempty"`
+
+	ThumbnailMaxDimension int               `json:"thumbnail_max_dimension,omitempty"`
+	Quarantine            *QuarantineConfig `json:"quarantine,omitempty"`
+	AllowedSchemes        []string          `json:"allowed_schemes,omitempty"`
+	DataURIMode           string            `json:"data_uri_mode,omitempty"`
+	IgnoredQueryParams    []string          `json:"ignored_query_params,omitempty"`
+	CanonicalDedup        bool              `json:"canonical_dedup,omitempty"`
+	CrawlWindows          []string          `json:"crawl_windows,omitempty"`
+	Tracing               *TracingConfig    `json:"tracing,omitempty"`
+
+	Notifications                []*NotificationConfig `json:"notifications,omitempty"`
+	NotificationFailureThreshold int                   `json:"notification_failure_threshold,omitempty"`
+	NotificationKeywords         []string              `json:"notification_keywords,omitempty"`
+
+	ControlSocket string `json:"control_socket,omitempty"`
+
+	MaxCrawlBytes    int64 `json:"max_crawl_bytes,omitempty"`
+	MaxPageBytes     int64 `json:"max_page_bytes,omitempty"`
+	MaxAssetBytes    int64 `json:"max_asset_bytes,omitempty"`
+	MinFreeDiskSpace int64 `json:"min_free_disk_space,omitempty"`
+
+	AssetProbe string `json:"asset_probe,omitempty"`
+
+	Snapshots     bool `json:"snapshots,omitempty"`
+	SaveLinks     bool `json:"save_links,omitempty"`
+	Deterministic bool `json:"deterministic,omitempty"`
+	SaveMarkdown  bool `json:"save_markdown,omitempty"`
+	Articles      bool `json:"articles,omitempty"`
+	Forms         bool `json:"forms,omitempty"`
+	SafeView      bool `json:"safe_view,omitempty"`
+	Bundles       bool `json:"bundles,omitempty"`
+
+	SnapshotRetention *RetentionConfig `json:"snapshot_retention,omitempty"`
+
+	Frames *FramesConfig `json:"frames,omitempty"`
+
+	Screenshots *ScreenshotConfig `json:"screenshots,omitempty"`
+
+	PGPKeys       bool `json:"pgp_keys,omitempty"`
+	OnionServices bool `json:"onion_services,omitempty"`
+	Fingerprints  bool `json:"fingerprints,omitempty"`
+
+	Concurrency int                `json:"concurrency,omitempty"`
+	LoadControl *LoadControlConfig `json:"load_control,omitempty"`
+	TorControl  *TorControlConfig  `json:"tor_control,omitempty"`
+	ManagedTor  *ManagedTorConfig  `json:"managed_tor,omitempty"`
+	Timeouts    *TimeoutsConfig    `json:"timeouts,omitempty"`
+	Writes      *WritesConfig      `json:"writes,omitempty"`
+	Permissions *PermissionsConfig `json:"permissions,omitempty"`
+	Sandbox     *SandboxConfig     `json:"sandbox,omitempty"`
+	Checkpoints *CheckpointsConfig `json:"checkpoints,omitempty"`
+	I2P         *I2PConfig         `json:"i2p,omitempty"`
+	Gateways    []*GatewayConfig   `json:"gateways,omitempty"`
+	SiteRetries int                `json:"site_retries,omitempty"`
+	Evidence    *EvidenceConfig    `json:"evidence,omitempty"`
+
+	CircuitRetries int `json:"circuit_retries,omitempty"`
+
+	ErrorPolicies map[string]*ErrorPolicy `json:"error_policies,omitempty"`
+
+	ContentProcessors map[string]string `json:"content_processors,omitempty"`
+
+	RequestHeaders map[string]string `json:"request_headers,omitempty"`
+
+	NetworkPolicy *NetworkPolicyConfig `json:"network_policy,omitempty"`
+
+	ForceHTTP1     bool   `json:"force_http1,omitempty"`
+	TLSFingerprint string `json:"tls_fingerprint,omitempty"`
+
+	AcceptedStatusCodes []int    `json:"accepted_status_codes,omitempty"`
+	NotFoundPhrases     []string `json:"not_found_phrases,omitempty"`
+	ParkedPhrases       []string `json:"parked_phrases,omitempty"`
+
+	Categories []*CategoryRule `json:"categories,omitempty"`
+	Database   *DatabaseConfig `json:"database,omitempty"`
+	Frontier   *FrontierConfig `json:"frontier,omitempty"`
+
+	Publishers []*PublisherConfig `json:"publishers,omitempty"`
+
+	SearchEngines          []*SearchEngineConfig `json:"search_engines,omitempty"`
+	AutoApproveDirectories bool                  `json:"auto_approve_directories,omitempty"`
+
+	Projects []*ProjectConfig `json:"projects,omitempty"`
+
+	Variables map[string]string `json:"variables,omitempty"`
 }
 
 var (
 	configuration         *ConfigurationFile
 	torDialer             proxy.Dialer
 	timeout               time.Duration = (30 * time.Second)
-	fileMode              os.FileMode   = 0777
+	fileMode              os.FileMode   = defaultFileMode
+	dirMode               os.FileMode   = defaultDirMode
 	useAbsolutePath                     = false
 	configurationFileName string
+	configurationProfile  string
+	crawlWindows          []*CrawlWindow
+	torProxyAddress       = "127.0.0.1:9050"
 )
 
 func main() {
-	// read configuration arg
-	if len(os.Args) != 2 {
-		fmt.Printf("Usage : %s <configuration file> \n", os.Args[0])
-		os.Exit(0)
+	// run commands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "find-similar":
+			runFindSimilarCommand(os.Args[2:])
+			return
+		case "find-duplicates":
+			runFindDuplicatesCommand(os.Args[2:])
+			return
+		case "find-fingerprint":
+			runFindFingerprintCommand(os.Args[2:])
+			return
+		case "find-forms":
+			runFindFormsCommand(os.Args[2:])
+			return
+		case "history":
+			runHistoryCommand(os.Args[2:])
+			return
+		case "query":
+			runQueryCommand(os.Args[2:])
+			return
+		case "config":
+			runConfigCommand(os.Args[2:])
+			return
+		case "serve-archive":
+			runServeArchiveCommand(os.Args[2:])
+			return
+		case "replay-proxy":
+			runReplayProxyCommand(os.Args[2:])
+			return
+		case "batch":
+			runBatchCommand(os.Args[2:])
+			return
+		case "stats":
+			runStatsCommand(os.Args[2:])
+			return
+		case "prune":
+			runPruneCommand(os.Args[2:])
+			return
+		case "gc":
+			runGCCommand(os.Args[2:])
+			return
+		case "import-mirror":
+			runImportMirrorCommand(os.Args[2:])
+			return
+		case "export-cdx":
+			runExportCDXCommand(os.Args[2:])
+			return
+		case "export-single":
+			runExportSingleCommand(os.Args[2:])
+			return
+		case "verify-evidence":
+			runVerifyEvidenceCommand(os.Args[2:])
+			return
+		case "discover":
+			runDiscoverCommand(os.Args[2:])
+			return
+		case "approve":
+			runApproveCommand(os.Args[2:])
+			return
+		case "sanitize":
+			runSanitizeCommand(os.Args[2:])
+			return
+		case "export-bundle":
+			runExportBundleCommand(os.Args[2:])
+			return
+		case "projects":
+			runProjectsCommand(os.Args[2:])
+			return
+		}
 	}
 
-	configurationFileName = os.Args[1]
+	// read flags and configuration arg
+	eventsFormat := flag.String("events", "", "write crawl events in the given format (jsonl)")
+	eventsFileName := flag.String("events-file", "", "append crawl events to this file instead of stdout")
+	useTUI := flag.Bool("tui", false, "show an interactive progress dashboard")
+	tags := flag.String("tags", "", "only crawl the sites with one of these comma separated tags")
+	seedsFileName := flag.String("seeds", "", "import site urls from a text or csv file, or - for stdin")
+	seedsFormat := flag.String("seeds-format", "", "read the seeds as text or csv, instead of by the file extension")
+	crawlDelay := flag.Float64("crawl-delay", -1, "wait these seconds between the requests to each host, instead of the robots.txt crawl delay (0 disables it)")
+	flag.Var(&configurationSettings, "set", "override a setting, like timeouts.dial_seconds=20 (can be repeated)")
+	flag.StringVar(&recordDir, "record", "", "save the raw responses to this directory")
+	flag.StringVar(&replayDir, "replay", "", "answer the requests with the responses of a record directory, without network")
+	flag.StringVar(&configurationProfile, "profile", "", "use the settings of a profile ("+strings.Join(getProfileNames(), ", ")+")")
+	flag.StringVar(&configurationProject, "project", "", "only crawl the sites of a project, with its output dir and settings")
+	quiet := flag.Bool("quiet", false, "only print errors")
+	verbose := flag.Bool("verbose", false, "print the detail of each request")
+	disableColor := flag.Bool("no-color", false, "don't color the output, like the NO_COLOR environment variable")
+	flag.BoolVar(&forceHTTP1, "http1", false, "only use HTTP/1.1, for the servers with a broken HTTP/2")
+	clockStart := flag.String("clock", "", "run with a fixed clock from this RFC 3339 time, the delays and crawl windows don't wait")
+	randomSeed := flag.Int64("random-seed", 0, "use a seeded random source for the circuit credentials and trace ids")
+
+	flag.Usage = printUsage
+	flag.Parse()
+	setupOutput(*quiet, *verbose, *disableColor)
+
+	if flag.NArg() != 1 {
+		printUsage()
+		os.Exit(exitCodeConfigError)
+	}
+
+	configurationFileName = flag.Arg(0)
+
+	// the dashboard uses the terminal, the events can only be written to a file
+	if *useTUI && *eventsFormat != "" && (*eventsFileName == "" || *eventsFileName == "-") {
+		printError("The events can't be written to stdout with the TUI, use -events-file")
+		os.Exit(exitCodeConfigError)
+	}
+
+	if err := setupEvents(*eventsFormat, *eventsFileName); err != nil {
+		printError("Unable to setup events:", err)
+		os.Exit(exitCodeConfigError)
+	}
+
+	if err := setupClock(*clockStart, *randomSeed); err != nil {
+		printError("Invalid clock:", err)
+		os.Exit(exitCodeConfigError)
+	}
+
+	if *crawlDelay >= 0 {
+		crawlDelayOverride = time.Duration(*crawlDelay * float64(time.Second))
+	}
 
 	// read configuration file content
 	currentDir, err := os.Getwd()
 
 	if err != nil {
-		fmt.Println("Unable to get current directory:", err)
-		os.Exit(0)
+		printError("Unable to get current directory:", err)
+		os.Exit(exitCodeError)
 	}
 
-	// read configuration file content
-	file, e := ioutil.ReadFile(configurationFileName)
-
-	if e != nil {
-		fmt.Printf("Error while read configuration file: %v\n", e)
-		os.Exit(0)
+	// a new configuration file is created when importing seeds
+	if _, err := os.Stat(configurationFileName); os.IsNotExist(err) && *seedsFileName != "" {
+		configuration = &ConfigurationFile{}
+		applyOverrides()
+	} else {
+		loadConfigurationFile()
 	}
 
-	// parse configuration file
-	err = json.Unmarshal(file, &configuration)
+	// import seed urls
+	if *seedsFileName != "" {
+		added, err := importSeeds(*seedsFileName, *seedsFormat)
 
-	if err != nil {
-		fmt.Println("Unable to parse configuration file:", err)
-		os.Exit(0)
+		if err != nil {
+			printError("Unable to import seeds:", err)
+			os.Exit(exitCodeConfigError)
+		}
+
+		printInfo(fmt.Sprintf("Imported %d new sites", added))
+		saveConfigurationFile()
 	}
 
 	// check sites
 	if len(configuration.Sites) == 0 {
-		fmt.Println("Site list is empty")
-		os.Exit(0)
+		printError("Site list is empty")
+		os.Exit(exitCodeConfigError)
+	}
+
+	selectedTags = getTags(*tags)
+	selectedSites := getSelectedSites(configuration.Sites)
+
+	if len(selectedSites) == 0 && configurationProject != "" {
+		printError("No site in project:", configurationProject)
+		os.Exit(exitCodeConfigError)
+	}
+
+	if len(selectedSites) == 0 && len(selectedTags) == 0 && len(configuration.Projects) > 0 {
+		printError("No site without project, the projects are crawled with -project or the projects command")
+		os.Exit(exitCodeConfigError)
+	}
+
+	if len(selectedSites) == 0 {
+		printError("No site has the tags:", strings.Join(selectedTags, ", "))
+		os.Exit(exitCodeConfigError)
+	}
+
+	// refuse unsafe runs before any request
+	err = checkPrivileges()
+
+	if err != nil {
+		printError("Unable to crawl:", err)
+		os.Exit(exitCodeConfigError)
+	}
+
+	err = checkOutputDir(getOutputDir(currentDir))
+
+	if err != nil {
+		printError("Unable to crawl:", err)
+		os.Exit(exitCodeConfigError)
+	}
+
+	// parse crawl windows
+	for _, value := range configuration.CrawlWindows {
+		window, err := parseCrawlWindow(value)
+
+		if err != nil {
+			printError("Unable to parse crawl window:", err)
+			os.Exit(exitCodeConfigError)
+		}
+
+		crawlWindows = append(crawlWindows, window)
+	}
+
+	setupTracing(configuration.Tracing)
+
+	err = setupPublishers(configuration.Publishers)
+
+	if err != nil {
+		printError("Unable to setup publishers:", err)
+		exitCrawl(exitCodeConfigError)
+	}
+
+	storage, err = openStorage(configuration.Database)
+
+	if err != nil {
+		printError("Unable to open database:", err)
+		exitCrawl(exitCodeError)
+	}
+	setupLoadControl(configuration.Concurrency, configuration.LoadControl)
+	setupInterrupts()
+
+	setupMiddlewares(configuration)
+
+	err = setupContentProcessors(configuration.ContentProcessors)
+
+	if err != nil {
+		printError("Unable to setup content processors:", err)
+		exitCrawl(exitCodeConfigError)
+	}
+
+	err = setupController(configuration.ControlSocket)
+
+	if err != nil {
+		printError("Unable to setup control socket:", err)
+		exitCrawl(exitCodeError)
+	}
+
+	// the managed tor is started before the proxy is used, it has its own socks port
+	if isManagedTorEnabled() && !isReplaying() {
+		err = startManagedTor(configuration.ManagedTor)
+
+		if err != nil {
+			printError("Unable to start managed Tor:", err)
+			exitCrawl(exitCodeProxyUnreachable)
+		}
+	}
+
+	if *useTUI {
+		err = startTUI(torProxyAddress)
+
+		if err != nil {
+			printError("Unable to start TUI:", err)
+			exitCrawl(exitCodeError)
+		}
+	}
+
+	err = openEventsFile(*eventsFormat, *eventsFileName)
+
+	if err != nil {
+		printError("Unable to open events file:", err)
+		exitCrawl(exitCodeError)
 	}
 
 	// setup localhost TOR proxy
-	torProxyURL, err := url.Parse("socks5://127.0.0.1:9050")
+	err = setupTorDialer()
 
 	if err != nil {
-		fmt.Println("Unable to parse URL:", err)
-		os.Exit(0)
+		printError("Unable to setup Tor proxy:", err)
+		exitCrawl(exitCodeConfigError)
 	}
 
-	// setup a proxy dialer
-	torDialer, err = proxy.FromURL(torProxyURL, proxy.Direct)
+	err = setupNetworkAudit()
 
 	if err != nil {
-		fmt.Println("Unable to setup Tor proxy:", err)
-		os.Exit(0)
+		printError("Unable to open network audit log:", err)
+		exitCrawl(exitCodeConfigError)
+	}
+
+	setupLocalResolver()
+
+	// the fetch times of the evidence come from the clock of the time server
+	if isEvidenceEnabled() {
+		err = setupEvidenceClock(newFetcher())
+
+		if err != nil {
+			printError("Unable to get evidence time server clock:", err)
+			exitCrawl(exitCodeError)
+		}
+	}
+
+	outputDir := getOutputDir(currentDir)
+
+	// the sandbox is applied after the managed tor, the database and the events file are opened
+	if configuration.Sandbox != nil && configuration.Sandbox.Landlock {
+		err = os.MkdirAll(outputDir, dirMode)
+
+		if err == nil {
+			err = applySandbox(getSandboxWritePaths(currentDir, outputDir), getSandboxConnectPorts())
+		}
+
+		if err != nil {
+			printError("Unable to apply sandbox:", err)
+			exitCrawl(exitCodeError)
+		}
+
+		printInfo("Sandbox applied with landlock")
 	}
 
 	// get all page contents of site list
 	var totalOfSites = len(configuration.Sites)
 
-	for i, site := range configuration.Sites {
-		fmt.Println(fmt.Sprintf("Getting site %d of %d - %s...", i+1, totalOfSites, site.URL))
+	duplicatedSites := getDuplicatedSites(configuration.Sites)
+	contentHashes := getContentHashes(configuration.Sites)
+	mirrorHosts := getMirrorHosts(configuration.Sites)
+
+	// failed sites are retried at the end of the queue
+	crawlQueue = append(crawlQueue, selectedSites...)
+
+	for i := 0; hasNextSite(i); i++ {
+		site := crawlQueue[i]
+		totalOfSites = len(getSelectedSites(configuration.Sites))
+
+		// finish the trace of the previous site
+		currentSiteSpan.End()
+		exportSpans()
+
+		// a policy of an error class stopped the crawl
+		if isCrawlAborted() {
+			break
+		}
+
+		waitForCrawlWindows(crawlWindows)
+
+		controller.setCurrentSite(i+1, site)
+		controller.waitWhilePaused()
+
+		if isCrawlBudgetExceeded() {
+			printInfo("Crawl byte budget was reached:", formatBytes(crawledBytes))
+			emitEvent("crawl_budget_reached", nil, "", nil, map[string]interface{}{"bytes": crawledBytes})
+			break
+		}
+
+		currentSiteSpan = startSpan("site "+site.URL, nil)
+		currentSiteSpan.SetAttribute("site.url", site.URL)
+
+		printInfo(fmt.Sprintf("Getting site %d of %d - %s...", i+1, len(crawlQueue), site.URL))
+		emitEvent("site_started", site, site.URL, nil, map[string]interface{}{"index": i + 1, "total": len(crawlQueue), "retry": siteRetryCounts[site]})
+
+		if firstURL, exists := duplicatedSites[site]; exists {
+			printInfo("Site URL is a duplicate of:", firstURL)
+			site.DuplicateOf = firstURL
+			emitEvent("site_skipped", site, site.URL, nil, map[string]interface{}{"duplicate_of": firstURL})
+			continue
+		}
+
+		if firstURL, exists := mirrorHosts[getURLHost(site.URL)]; exists && firstURL != site.URL {
+			printInfo("Site URL is a mirror of:", firstURL)
+			site.DuplicateOf = firstURL
+			emitEvent("site_skipped", site, site.URL, nil, map[string]interface{}{"mirror_of": firstURL})
+			continue
+		}
+
+		if site.FetchSuccess && site.DuplicateOf != "" {
+			printInfo("Site already fetched as a duplicate of:", site.DuplicateOf)
+			emitEvent("site_skipped", site, site.URL, nil, map[string]interface{}{"duplicate_of": site.DuplicateOf})
+			continue
+		}
 
 		needDownloadHTML := true
 
-		if site.FetchSuccess {
+		// with snapshots every run fetches the site again
+		if site.FetchSuccess && !configuration.Snapshots {
 			needDownloadHTML = false
 		}
 
+		// api sites and the sites saved by the processor of their type are not parsed, so there is nothing to do
+		// with their saved content
+		if !needDownloadHTML && (site.API != nil || isProcessedSite(site)) {
+			printInfo("Site already fetched:", site.URL)
+			continue
+		}
+
 		// create structure
 		var pageContent []byte
+		var pageContentType string
+		var pageDoc *goquery.Document
+		var siteBytes int64
 
-		siteDirPreparedName := site.URL
-		siteDirPreparedName = strings.Replace(siteDirPreparedName, "http://", "", -1)
-		siteDirPreparedName = strings.Replace(siteDirPreparedName, "https://", "", -1)
-		siteDirPreparedName = strings.Replace(siteDirPreparedName, ".onion", "", -1)
-		siteDirPreparedName = slugify.Marshal(siteDirPreparedName)
+		site.Truncated = false
 
-		siteDir := currentDir + string(filepath.Separator) + "sites" + string(filepath.Separator) + siteDirPreparedName
+		siteDir := outputDir + string(filepath.Separator) + getSiteDirName(site)
 		siteFileName := siteDir + string(filepath.Separator) + "index.html"
 
-		if needDownloadHTML {
-			torTransport := &http.Transport{Dial: torDialer.Dial}
-			client := &http.Client{Transport: torTransport, Timeout: timeout}
+		fetcher := newFetcher()
 
+		if needDownloadHTML {
 			// get page data
-			response, err := client.Get(site.URL)
+			requestStartedAt := time.Now()
+			response, err := getSiteURL(fetcher, site)
+			latency := time.Since(requestStartedAt).Milliseconds()
 
 			if err != nil {
-				fmt.Println("Unable to fetch site:", site.URL)
-				site.FetchSuccess = false
+				printError("Unable to fetch site:", site.URL)
+				setSiteFetchFailed(site, err, nil)
 				continue
 			}
 
-			defer response.Body.Close()
+			// the skip rules are checked before the body is downloaded, or while it is downloaded for the responses
+			// without length
+			skipReason, skipLimit := getSkipReason(getSkipRules(site), response)
+			var body []byte
 
 			// get page body content
-			body, err := ioutil.ReadAll(response.Body)
+			if skipReason == "" {
+				body, skipReason, err = readSkipLimitedBody(response.Body, site.URL, skipLimit)
+			}
+
+			response.Body.Close()
+			site.SkipReason = skipReason
+
+			if site.SkipReason != "" {
+				site.FailureCount = 0
+				printInfo("Site skipped by rule:", site.URL, site.SkipReason)
+				emitEvent("site_skipped", site, site.URL, nil, map[string]interface{}{"skip_reason": site.SkipReason})
+				checkpointSite(site)
+				continue
+			}
 
 			if err != nil {
-				fmt.Println("Unable to get site content:", site.URL)
-				site.FetchSuccess = false
+				printError("Unable to get site content:", site.URL)
+				setSiteFetchFailed(site, err, nil)
+				continue
+			}
+
+			siteBytes += int64(len(body))
+			crawledBytes += int64(len(body))
+			site.BodyTruncated = checkPageBodyTruncated(site, site.URL)
+			site.StatusCode = response.StatusCode
+			site.Protocol = response.Proto
+
+			// fingerprint the server, error answers identify it too
+			if configuration.Fingerprints {
+				site.Fingerprint = getResponseFingerprint(site, response, fetcher)
+			}
+
+			// error pages are saved apart and don't replace the site content
+			if !isSuccessStatusCode(response.StatusCode) {
+				err = &StatusError{URL: site.URL, StatusCode: response.StatusCode}
+				printError("Unable to fetch site:", err)
+
+				if err := saveErrorPage(siteDir, strconv.Itoa(response.StatusCode), body); err != nil {
+					printError("Unable to save site error page:", err)
+				}
+
+				setSiteFetchFailed(site, err, map[string]interface{}{"status_code": response.StatusCode, "latency_ms": latency})
+				continue
+			}
+
+			// the content is handled by the processor of its type, the html is parsed once and its document is used
+			// by all the extractions. The api sites save their payloads themselves
+			var processed *FetchedContent
+
+			if site.API == nil {
+				processed = &FetchedContent{Site: site, SiteDir: siteDir, URL: site.URL, ContentType: response.Header.Get("Content-Type"), Content: body, FileName: siteFileName}
+
+				// the sites without a content type are html
+				if processed.ContentType == "" {
+					processed.ContentType = "text/html"
+				}
+
+				err = processFetchedContent(processed)
+				pageDoc = processed.Document
+			} else {
+				pageDoc, err = parseHTML(body)
+
+				if err != nil {
+					err = newParseError(err)
+				}
+			}
+
+			if err != nil {
+				printError("Unable to process site content:", site.URL, err)
+				setSiteFetchFailed(site, err, nil)
+				continue
+			}
+
+			// pages that are errors with a success status code are failures too
+			if pageDoc != nil {
+				site.SoftError = getSoftErrorFromDocument(pageDoc)
+			}
+
+			if site.SoftError != "" {
+				// error pages with a success status are client errors
+				err = &ClassifiedError{Class: errorClassHTTP4xx, Err: errors.New("soft error: " + site.SoftError)}
+				printError("Unable to fetch site:", site.URL, err)
+
+				if err := saveErrorPage(siteDir, "soft-"+site.SoftError, body); err != nil {
+					printError("Unable to save site error page:", err)
+				}
+
+				setSiteFetchFailed(site, err, map[string]interface{}{"status_code": response.StatusCode, "soft_error": site.SoftError, "latency_ms": latency})
 				continue
 			}
 
 			pageContent = body
+			pageContentType = response.Header.Get("Content-Type")
+			recordSiteAvailability(site, true)
+			recordSiteHistory(site, &SiteHistoryEntry{Success: true, StatusCode: response.StatusCode, Bytes: int64(len(body)), ContentHash: getContentHash(body), LatencyMillis: latency})
+			emitEvent("page_fetched", site, site.URL, nil, map[string]interface{}{"status_code": response.StatusCode, "bytes": len(body), "latency_ms": latency})
+			publishFetched("page_fetched", site, site.URL, map[string]interface{}{"status_code": response.StatusCode, "depth": 0, "content_hash": getContentHash(body)}, getBytesContent(body))
+
+			// the content that is not html was saved by its processor, the site has no links, images or extractions
+			if processed != nil && pageDoc == nil {
+				setProcessedSite(site, siteDir, processed)
+				syncPendingFiles()
+				emitEvent("site_completed", site, site.URL, nil, map[string]interface{}{"success": site.FetchSuccess, "content_type": processed.ContentType})
+				checkpointSite(site)
+				continue
+			}
 		} else {
 			// get existing index.html file
 			pageContent, err = ioutil.ReadFile(siteFileName)
 
 			if err != nil {
-				fmt.Println("Site index.html was not found:", err)
+				printError("Site index.html was not found:", err)
+				emitEvent("site_failed", site, site.URL, err, nil)
+				notifySiteFailure(site, err)
 				continue
 			}
 
-			fmt.Println("Site already fetched:", site.URL)
+			printInfo("Site already fetched:", site.URL)
+		}
+
+		if controller.shouldSkipSite() {
+			printInfo("Site skipped by control socket:", site.URL)
+			emitEvent("site_skipped", site, site.URL, nil, nil)
+			continue
+		}
+
+		// check if the same content was already fetched from another site
+		if needDownloadHTML || site.ContentHash == "" {
+			site.ContentHash = getContentHash(pageContent)
 		}
 
-		err = os.MkdirAll(siteDir, fileMode)
+		site.DuplicateOf = ""
+
+		if firstURL, exists := contentHashes[site.ContentHash]; exists && firstURL != site.URL {
+			printInfo("Site content is a duplicate of:", firstURL)
+			site.DuplicateOf = firstURL
+			site.FetchSuccess = true
+			site.FailureCount = 0
+			emitEvent("site_skipped", site, site.URL, nil, map[string]interface{}{"duplicate_of": firstURL})
+			checkpointSite(site)
+			continue
+		}
+
+		contentHashes[site.ContentHash] = site.URL
+
+		// the dir named by the title of the site is made when the site is parsed for the first time
+		if pageDoc != nil && isSiteDirNamePending(site) {
+			site.Title = getTagContentFromDocument(pageDoc, "title")
+			siteDir = nameParsedSiteDir(site, outputDir, siteDir)
+			siteFileName = siteDir + string(filepath.Separator) + "index.html"
+		}
+
+		err = os.MkdirAll(siteDir, dirMode)
 
 		if err != nil {
-			fmt.Println("Unable to create site directory:", err)
-			os.Exit(0)
+			printError("Unable to create site directory:", err)
+			setSiteFetchFailed(site, newStorageError(err), nil)
+			continue
+		}
+
+		waitForFreeDiskSpace(siteDir)
+
+		// get the crawl delay of the site before its pages
+		if configuration.RobotsTxt != nil && configuration.RobotsTxt.Enabled {
+			updateSiteRobotsTxt(site, siteDir, fetcher)
+		}
+
+		// api payloads are saved without the html processing
+		if site.API != nil {
+			crawlSiteAPI(site, siteDir, pageContent, pageContentType, fetcher)
+			site.FetchSuccess = len(site.Pages) > 0 && site.Pages[0].FetchSuccess
+			site.FailureCount = 0
+			syncPendingFiles()
+
+			emitEvent("site_completed", site, site.URL, nil, map[string]interface{}{
+				"success": site.FetchSuccess,
+				"pages":   len(site.Pages),
+			})
+
+			checkpointSite(site)
+			continue
 		}
 
+		// the saved page is parsed once too
+		if pageDoc == nil {
+			pageDoc, err = parseHTML(pageContent)
+
+			if err != nil {
+				printError("Unable to parse site content:", site.URL, err)
+				emitEvent("site_failed", site, site.URL, err, nil)
+				continue
+			}
+		}
+
+		pageHTML := string(pageContent)
+
 		// get page title
-		htmlTitle := getTagContentFromHTML(string(pageContent), "title", "")
+		htmlTitle := getTagContentFromDocument(pageDoc, "title")
 		site.Title = htmlTitle
 
+		// get site icon
+		if needDownloadHTML || site.FaviconHash == "" {
+			updateSiteFavicon(site, siteDir, pageDoc, fetcher)
+		}
+
+		// get page language
+		site.Language = getLanguageFromDocument(pageDoc, "")
+
+		// get page categories
+		if len(configuration.Categories) > 0 {
+			site.Categories = getCategoriesFromDocument(pageDoc, configuration.Categories)
+		}
+
+		// get page article
+		if configuration.Articles {
+			site.Article = getArticleFromDocument(pageDoc)
+		}
+
+		// get page forms
+		if configuration.Forms {
+			site.Forms = getFormsFromDocument(pageDoc, site.URL)
+		}
+
+		// check page keywords
+		if needDownloadHTML {
+			notifyKeywordsFound(site, pageDoc)
+		}
+
+		// extract data from configured rules
+		if len(site.ExtractionRules) > 0 {
+			extractedData := getExtractedDataFromDocument(pageDoc, site.ExtractionRules)
+			err = saveExtractedData(siteDir+string(filepath.Separator)+"extracted.json", extractedData)
+
+			if err != nil {
+				printError("Unable to save extracted data:", err)
+				setSiteFetchFailed(site, newStorageError(err), nil)
+				continue
+			}
+		}
+
+		// scan page content for findings
+		var findings map[string][]string
+
+		if len(configuration.Scanners) > 0 {
+			findings = getFindingsFromHTML(pageHTML, configuration.Scanners)
+			err = saveFindings(siteDir+string(filepath.Separator)+"findings.json", findings)
+
+			if err != nil {
+				printError("Unable to save findings:", err)
+				setSiteFetchFailed(site, newStorageError(err), nil)
+				continue
+			}
+		}
+
 		// get images
 		var images []*Image
 
 		if needDownloadHTML || site.Images == nil {
-			images = getAllImagesFromHTML(string(pageContent), site.URL)
+			images = getAllImagesFromDocument(pageDoc, site.URL)
 		} else {
 			images = site.Images
 		}
@@ -183,90 +893,507 @@ func main() {
 		totalOfImages := len(images)
 		downloadedImages := 0
 
+		emitEvent("site_images_found", site, site.URL, nil, map[string]interface{}{"images": totalOfImages})
+
+		// fix the image paths of the page
+		if len(images) > 0 {
+			if useAbsolutePath {
+				pageContent = []byte(strings.Replace(pageHTML, "src=\"", "src=\""+site.URL+"/", -1))
+			} else {
+				pageContent = []byte(strings.Replace(pageHTML, "src=\""+site.URL+"/", "src=\"", -1))
+			}
+		}
+
+		// images are downloaded in parallel up to the current concurrency, each download reserves its bytes of the
+		// budget before it starts so the downloads running at the same time don't go over it
+		var imagesMutex sync.Mutex
+		var imagesWaitGroup sync.WaitGroup
+		var reservedBytes int64
+
+		// the images of the page with the same file are downloaded once and share the result
+		imagesByFileName := map[string]*Image{}
+		duplicatedImages := map[*Image]*Image{}
+
 		for imageIndex, image := range images {
+			controller.waitWhilePaused()
+
+			// the downloads pause when the crawl window closes
+			waitForCrawlWindows(crawlWindows)
+
+			if controller.shouldSkipSite() || isCrawlAborted() {
+				break
+			}
+
+			imageFileKey := filepath.Clean(image.URL)
+
+			if firstImage, exists := imagesByFileName[imageFileKey]; exists {
+				duplicatedImages[image] = firstImage
+				continue
+			}
+
+			imagesByFileName[imageFileKey] = image
+
 			if image.FetchSuccess {
-				fmt.Println("Image already fetched:", image.URL)
+				printInfo("Image already fetched:", image.URL)
+				imagesMutex.Lock()
 				downloadedImages++
+				imagesMutex.Unlock()
 				continue
 			}
 
-			imageURL := site.URL + "/" + image.URL
-			imageFileName := siteDir + string(filepath.Separator) + image.URL
-			imageFileExists := false
+			imagesMutex.Lock()
+			remaining, hasBudget := getRemainingBudget(site, siteBytes)
 
-			if useAbsolutePath {
-				pageContent = []byte(strings.Replace(string(pageContent), "src=\"", "src=\""+site.URL+"/", -1))
-			} else {
-				pageContent = []byte(strings.Replace(string(pageContent), "src=\""+site.URL+"/", "src=\"", -1))
+			// the reserved bytes may not be used, the downloads running are waited before the budget is reached
+			if hasBudget && remaining-reservedBytes <= 0 && reservedBytes > 0 {
+				imagesMutex.Unlock()
+				imagesWaitGroup.Wait()
+				imagesMutex.Lock()
+				remaining, hasBudget = getRemainingBudget(site, siteBytes)
 			}
 
-			fmt.Println(fmt.Sprintf("Downloading image %d of %d - %s...", imageIndex+1, totalOfImages, imageURL))
+			reservation := int64(0)
 
-			if _, err := os.Stat(imageFileName); err == nil {
-				fmt.Println(fmt.Sprintf("Image %d of %d already exists - %s...", imageIndex+1, totalOfImages, imageURL))
-				imageFileExists = true
+			if hasBudget {
+				reservation = getAssetReservation(remaining - reservedBytes)
+				reservedBytes += reservation
 			}
 
-			if imageFileExists {
-				image.FetchSuccess = true
-				downloadedImages++
-			} else {
-				err = downloadFile(imageFileName, imageURL)
+			currentSiteBytes := siteBytes
+			imagesMutex.Unlock()
 
-				if err != nil {
-					fmt.Println("Unable to download image:", err)
-					continue
+			if hasBudget && reservation <= 0 {
+				printInfo("Site byte budget was reached:", site.URL)
+				site.Truncated = true
+				emitEvent("site_truncated", site, site.URL, nil, map[string]interface{}{"bytes": currentSiteBytes})
+				break
+			}
+
+			waitForFreeDiskSpace(siteDir)
+
+			loadControl.acquire()
+			imagesWaitGroup.Add(1)
+
+			go func(imageIndex int, image *Image, reservation int64) {
+				defer imagesWaitGroup.Done()
+				defer loadControl.release()
+
+				downloaded, imageBytes := downloadSiteImage(site, siteDir, image, imageIndex, totalOfImages)
+
+				imagesMutex.Lock()
+				defer imagesMutex.Unlock()
+
+				if downloaded {
+					downloadedImages++
 				}
 
-				image.FetchSuccess = true
+				reservedBytes -= reservation
+				siteBytes += imageBytes
+				crawledBytes += imageBytes
+			}(imageIndex, image, reservation)
+		}
+
+		imagesWaitGroup.Wait()
+
+		for image, firstImage := range duplicatedImages {
+			copyImageResult(image, firstImage)
+
+			if image.FetchSuccess {
 				downloadedImages++
 			}
 		}
-
 		// reload the images
 		site.Images = images
 
+		if controller.shouldSkipSite() {
+			printInfo("Site skipped by control socket:", site.URL)
+			emitEvent("site_skipped", site, site.URL, nil, nil)
+			checkpointSite(site)
+			continue
+		}
+
 		if downloadedImages == totalOfImages {
 			site.FetchSuccess = true
 		}
 
+		site.FailureCount = 0
+
 		// prepare and save html content
-		err = ioutil.WriteFile(siteFileName, pageContent, fileMode)
+		htmlContent := pageContent
+
+		if isFramesEnabled() && needDownloadHTML {
+			site.Frames = nil
+			htmlContent = captureFrames(site, siteDir, framesDirName+"/", site.URL, pageContent, fetcher)
+		}
+
+		err = saveHTMLFile(siteFileName, site.URL, htmlContent)
 
 		if err != nil {
-			fmt.Println("Unable to save site content:", err)
-			os.Exit(0)
+			printError("Unable to save site content:", err)
+			setSiteFetchFailed(site, newStorageError(err), nil)
+			continue
 		}
 
-		saveConfigurationFile()
+		// follow the site links
+		links := crawlSitePages(site, siteDir, pageDoc, fetcher, siteBytes)
+
+		if configuration.SaveLinks {
+			err = saveLinks(siteDir+string(filepath.Separator)+"links.json", links)
+
+			if err != nil {
+				printError("Unable to save site links:", err)
+				setSiteFetchFailed(site, newStorageError(err), nil)
+				continue
+			}
+		}
+
+		// fetch the new feed entries
+		crawlSiteFeeds(site, siteDir, pageDoc, fetcher)
+
+		// record the mirror addresses announced by the site
+		updateSiteMirrors(site, siteDir, pageDoc)
+		addSiteMirrorHosts(mirrorHosts, site)
+
+		// add the sites listed by the directory
+		if site.Directory {
+			harvestDirectorySites(site, siteDir, pageDoc)
+		}
+
+		// collect the identity of the site
+		if configuration.PGPKeys && needDownloadHTML {
+			updateSitePGPKeys(site, siteDir, pageDoc, links, fetcher)
+		}
+
+		if configuration.OnionServices && needDownloadHTML {
+			updateSiteOnionService(site, siteDir)
+		}
+
+		if isHTTPSOnionURL(site.URL) && needDownloadHTML {
+			updateSiteTLS(site, siteDir)
+		}
+
+		// compare the site screenshot with the previous one
+		if isScreenshotsEnabled() && needDownloadHTML {
+			updateSiteScreenshot(site, siteDir)
+		}
+
+		// save the site metadata to the database
+		if storage != nil {
+			err = storage.SaveSite(site, siteDir, links, findings)
+
+			if err != nil {
+				printError("Unable to save site to database:", err)
+			}
+		}
+
+		// save the checksums of the site files
+		if configuration.Deterministic {
+			err = saveChecksums(siteDir)
+
+			if err != nil {
+				printError("Unable to save site checksums:", err)
+			}
+		}
+
+		// save the signed manifest of the site files
+		if isEvidenceEnabled() {
+			err = saveEvidence(site.URL, siteDir)
+
+			if err != nil {
+				printError("Unable to save site evidence:", err)
+			}
+		}
+
+		// save a versioned copy of the site files
+		if configuration.Snapshots && needDownloadHTML {
+			snapshotName, err := createSnapshot(siteDir)
+
+			if err != nil {
+				printError("Unable to create site snapshot:", err)
+			} else {
+				site.LastSnapshot = snapshotName
+				pruneSiteSnapshots(siteDir)
+			}
+		}
+
+		// pack the site files into a single sqlite file
+		if configuration.Bundles && needDownloadHTML {
+			_, err = saveSiteBundle(site, siteDir, getBundleFileName(outputDir+string(filepath.Separator)+bundlesDirName, site))
+
+			if err != nil {
+				printError("Unable to save site bundle:", err)
+			}
+		}
+
+		// the files of the site are synced before it is completed
+		syncPendingFiles()
+
+		emitEvent("site_completed", site, site.URL, nil, map[string]interface{}{
+			"success":           site.FetchSuccess,
+			"images":            totalOfImages,
+			"downloaded_images": downloadedImages,
+			"categories":        site.Categories,
+		})
+
+		checkpointSite(site)
 	}
 
+	currentSiteSpan.End()
+	exportSpans()
+
+	controller.setCurrentSite(0, nil)
 	saveConfigurationFile()
+	syncPendingFiles()
 
-	fmt.Println("SUCCESS")
-}
+	printTruncatedSites()
 
-func getTagContentFromHTML(html string, tagName string, defaultResult string) string {
-	buffer := bytes.NewBufferString(html)
-	doc, err := goquery.NewDocumentFromReader(buffer)
+	emitEvent("crawl_completed", nil, "", nil, map[string]interface{}{"sites": totalOfSites})
 
-	if err != nil {
-		return defaultResult
+	// notify the crawl summary
+	fetchedSites := 0
+
+	selectedSites = getSelectedSites(configuration.Sites)
+
+	for _, site := range selectedSites {
+		if site.FetchSuccess {
+			fetchedSites++
+		}
+	}
+
+	visuallyChangedSites := printVisuallyChangedSites(selectedSites)
+
+	notify(notificationEventCrawlCompleted, nil, fmt.Sprintf("%d of %d sites fetched", fetchedSites, totalOfSites), map[string]interface{}{
+		"sites":                  totalOfSites,
+		"fetched_sites":          fetchedSites,
+		"tags":                   getTagSummary(selectedSites),
+		"categories":             getCategorySummary(selectedSites),
+		"visually_changed_sites": visuallyChangedSites,
+	})
+
+	// checked before tor is stopped, the proxy is tested when all the sites failed
+	failureSummary := getFailureSummary(selectedSites)
+
+	stopCrawl()
+
+	printFailureSummary(failureSummary)
+
+	if failureSummary.Interrupted {
+		printError(fmt.Sprintf("INTERRUPTED (%d of %d sites fetched)", failureSummary.FetchedSites, failureSummary.Sites))
+		exitCrawl(failureSummary.ExitCode)
 	}
 
-	title := doc.Find(tagName).Text()
-	return title
+	if failureSummary.AbortedBy != "" {
+		printError(fmt.Sprintf("ABORTED (by a %s error, %d of %d sites failed)", failureSummary.AbortedBy, len(failureSummary.FailedSites), failureSummary.Sites))
+		exitCrawl(failureSummary.ExitCode)
+	}
+
+	if failureSummary.ExitCode != exitCodeSuccess {
+		printError(fmt.Sprintf("FAILED (%d of %d sites failed)", len(failureSummary.FailedSites), failureSummary.Sites))
+		exitCrawl(failureSummary.ExitCode)
+	}
+
+	printSuccess("SUCCESS")
 }
 
-func getAllImagesFromHTML(html string, url string) []*Image {
-	result := []*Image{}
-	buffer := bytes.NewBufferString(html)
-	doc, err := goquery.NewDocumentFromReader(buffer)
+func printUsage() {
+	fmt.Printf("Usage : %s [options] <configuration file> \n", os.Args[0])
+	fmt.Printf("        %s find-similar <configuration file> [max distance] \n", os.Args[0])
+	fmt.Printf("        %s find-duplicates <configuration file> [min title similarity] \n", os.Args[0])
+	fmt.Printf("        %s find-fingerprint <configuration file> [url or hash] \n", os.Args[0])
+	fmt.Printf("        %s find-forms <configuration file> [kind] \n", os.Args[0])
+	fmt.Printf("        %s history <configuration file> <url> \n", os.Args[0])
+	fmt.Printf("        %s query <configuration file> <sql> \n", os.Args[0])
+	fmt.Printf("        %s config merge <output file> <configuration file> <configuration file>... \n", os.Args[0])
+	fmt.Printf("        %s config validate <configuration file> \n", os.Args[0])
+	fmt.Printf("        %s serve-archive <configuration file> [address] \n", os.Args[0])
+	fmt.Printf("        %s replay-proxy [-live] [-snapshot name] <configuration file> [address] \n", os.Args[0])
+	fmt.Printf("        %s batch [-parallel n] <configuration directory or glob> [crawl flags] \n", os.Args[0])
+	fmt.Printf("        %s stats [-json] [-top n] <configuration file> \n", os.Args[0])
+	fmt.Printf("        %s prune [-dry-run] [-keep-last n] [-keep-days n] <configuration file> \n", os.Args[0])
+	fmt.Printf("        %s gc [-delete] <configuration file> \n", os.Args[0])
+	fmt.Printf("        %s import-mirror [-scheme http] [-tags a,b] <configuration file> <mirror dir> \n", os.Args[0])
+	fmt.Printf("        %s export-cdx [-format cdxj|cdx] [-collection name] <configuration file> [export dir] \n", os.Args[0])
+	fmt.Printf("        %s discover [-engine name] [-tags a,b] [-limit n] [-dry-run] <configuration file> <keyword>... \n", os.Args[0])
+	fmt.Printf("        %s approve [-reject] [-all] <configuration file> [url]... \n", os.Args[0])
+	fmt.Printf("        %s sanitize <configuration file> \n", os.Args[0])
+	fmt.Printf("        %s export-single [-max-inline-bytes n] <configuration file> [export dir] \n", os.Args[0])
+	fmt.Printf("        %s verify-evidence <configuration file> \n", os.Args[0])
+	fmt.Printf("        %s export-bundle <configuration file> [export dir] \n", os.Args[0])
+	fmt.Printf("        %s projects [-parallel n] [-projects a,b] <configuration file> [crawl flags] \n", os.Args[0])
+	fmt.Println("")
+	fmt.Println("Options:")
+	flag.PrintDefaults()
+}
+
+// downloadSiteImage downloads, checks and processes one image of the site, returning if the image was
+// downloaded and the downloaded bytes
+func downloadSiteImage(site *Site, siteDir string, image *Image, imageIndex int, totalOfImages int) (bool, int64) {
+	imageURL := site.URL + "/" + image.URL
+	imageFileName := siteDir + string(filepath.Separator) + image.URL
+	imageFileExists := false
+
+	// the images with the same url are downloaded once per run
+	assetDownload, isFirstDownload := startAssetDownload(imageURL)
+
+	if !isFirstDownload {
+		if done, downloaded := useAssetDownload(assetDownload, image, imageFileName); done {
+			printInfo(fmt.Sprintf("Image %d of %d already downloaded in this run - %s...", imageIndex+1, totalOfImages, imageURL))
+			return downloaded, 0
+		}
+	} else {
+		defer func() {
+			finishAssetDownload(imageURL, assetDownload, image, imageFileName)
+		}()
+	}
+
+	printInfo(fmt.Sprintf("Downloading image %d of %d - %s...", imageIndex+1, totalOfImages, imageURL))
+
+	if _, err := os.Stat(imageFileName); err == nil {
+		printInfo(fmt.Sprintf("Image %d of %d already exists - %s...", imageIndex+1, totalOfImages, imageURL))
+		imageFileExists = true
+	}
+
+	var err error
+	var download *DownloadResult
+
+	image.SkipReason = ""
+
+	if imageFileExists {
+		image.FetchSuccess = true
+	} else if image.DataURI != "" {
+		err = saveDataURI(imageFileName, image.DataURI)
+
+		if err != nil {
+			printError("Unable to save data URI image:", err)
+			emitEvent("asset_failed", site, imageURL, err, nil)
+			return false, 0
+		}
+
+		image.FetchSuccess = true
+	} else if tooLarge, size := isAssetTooLarge(imageURL); tooLarge {
+		skipLargeImage(site, image, imageURL, size)
+		return false, 0
+	} else if configuration.Quarantine != nil && configuration.Quarantine.Enabled {
+		// download to the quarantine name and only place clean images
+		download, err = downloadFile(imageFileName+quarantineSuffix, imageURL)
+
+		if _, ok := err.(*DownloadLimitError); ok {
+			skipLargeImage(site, image, imageURL, -1)
+			return false, 0
+		}
+
+		if err != nil {
+			printError("Unable to download image:", err)
+			emitEvent("asset_failed", site, imageURL, err, nil)
+			return false, 0
+		}
+
+		imageFileName, image.ScanResult, err = placeQuarantinedFile(imageFileName, download.ContentType, configuration.Quarantine)
+
+		// the downloaded bytes count for the budgets even when the image is not placed
+		if err != nil {
+			printError("Unable to check quarantined image:", err)
+			emitEvent("asset_failed", site, imageURL, err, nil)
+			return false, download.Bytes
+		}
+
+		image.Quarantined = strings.HasSuffix(imageFileName, quarantineSuffix)
+		image.FetchSuccess = true
+
+		if image.Quarantined {
+			printInfo("Image was quarantined:", imageFileName, image.ScanResult)
+			emitEvent("asset_quarantined", site, imageURL, nil, map[string]interface{}{"scan_result": image.ScanResult})
+			return true, download.Bytes
+		}
+	} else {
+		download, err = downloadFile(imageFileName, imageURL)
+
+		if _, ok := err.(*DownloadLimitError); ok {
+			skipLargeImage(site, image, imageURL, -1)
+			return false, 0
+		}
+
+		if err != nil {
+			printError("Unable to download image:", err)
+			emitEvent("asset_failed", site, imageURL, err, nil)
+			return false, 0
+		}
+
+		image.FetchSuccess = true
+	}
+
+	var imageBytes int64
+
+	// downloaded images are known by their streamed download, the other ones by their file
+	if download != nil {
+		imageBytes = download.Bytes
+		image.ContentHash = download.ContentHash
+		image.ContentType = download.ContentType
+		emitEvent("asset_fetched", site, imageURL, nil, map[string]interface{}{"bytes": imageBytes, "content_hash": image.ContentHash, "content_type": image.ContentType})
+		publishFetched("asset_fetched", site, imageURL, map[string]interface{}{"bytes": imageBytes, "content_hash": image.ContentHash}, getFileContent(imageFileName))
+	} else if imageFileInfo, err := os.Stat(imageFileName); err == nil {
+		imageBytes = imageFileInfo.Size()
+		emitEvent("asset_fetched", site, imageURL, nil, map[string]interface{}{"bytes": imageBytes})
+		publishFetched("asset_fetched", site, imageURL, map[string]interface{}{"bytes": imageBytes}, getFileContent(imageFileName))
+	}
+
+	// the file is handled by the processor of its type, like the hashes and the thumbnail of the images
+	fetched := &FetchedContent{Site: site, SiteDir: siteDir, URL: imageURL, ContentType: image.ContentType, FileName: imageFileName, Image: image}
+	err = processFetchedContent(fetched)
 
 	if err != nil {
-		return result
+		printError("Unable to process image:", imageURL, err)
+	}
+
+	if fetched.Quarantined {
+		imageFileName = fetched.FileName
+		image.Quarantined = true
+		image.ScanResult = fetched.ScanResult
+		printInfo("Image was quarantined:", fetched.FileName, fetched.ContentType)
+		emitEvent("asset_quarantined", site, imageURL, nil, map[string]interface{}{"content_type": fetched.ContentType, "scan_result": image.ScanResult})
 	}
 
+	return true, imageBytes
+}
+
+// getOutputDir returns the directory of the sites, the sites directory by default
+func getOutputDir(currentDir string) string {
+	if configuration.OutputDir != "" {
+		return expandVariables(configuration.OutputDir, "")
+	}
+
+	return currentDir + string(filepath.Separator) + "sites"
+}
+
+// getSiteSlug returns the default name of the site dir, a slug of the url without the scheme and the onion suffix
+func getSiteSlug(siteURL string) string {
+	siteDirPreparedName := siteURL
+	siteDirPreparedName = strings.Replace(siteDirPreparedName, "http://", "", -1)
+	siteDirPreparedName = strings.Replace(siteDirPreparedName, "https://", "", -1)
+	siteDirPreparedName = strings.Replace(siteDirPreparedName, ".onion", "", -1)
+	siteDirPreparedName = slugify.Marshal(siteDirPreparedName)
+
+	return siteDirPreparedName
+}
+
+func getTagContentFromDocument(doc *goquery.Document, tagName string) string {
+	return doc.Find(tagName).Text()
+}
+
+// copyImageResult copies the download result of the image with the same file
+func copyImageResult(image *Image, firstImage *Image) {
+	image.FetchSuccess = firstImage.FetchSuccess
+	image.SkipReason = firstImage.SkipReason
+	image.ContentHash = firstImage.ContentHash
+	image.ContentType = firstImage.ContentType
+	image.Quarantined = firstImage.Quarantined
+	image.ScanResult = firstImage.ScanResult
+	image.Metadata = firstImage.Metadata
+	image.PerceptualHash = firstImage.PerceptualHash
+}
+
+func getAllImagesFromDocument(doc *goquery.Document, url string) []*Image {
+	result := []*Image{}
 	selection := doc.Find("img")
 
 	for _, node := range selection.Nodes {
@@ -275,6 +1402,22 @@ func getAllImagesFromHTML(html string, url string) []*Image {
 				attribVal := attrib.Val
 
 				if attribVal != "" {
+					scheme := getURLScheme(attribVal)
+
+					// data uris are decoded or skipped, other schemes must be allowed
+					if scheme == "data" {
+						if newImage := getImageFromDataURI(attribVal); newImage != nil {
+							result = append(result, newImage)
+						}
+
+						continue
+					}
+
+					if scheme != "" && !isAllowedScheme(scheme) {
+						printInfo("Image scheme is not allowed:", scheme)
+						continue
+					}
+
 					fileExt := filepath.Ext(attribVal)
 
 					if isValidImageExtension(fileExt) {
@@ -298,53 +1441,186 @@ func getAllImagesFromHTML(html string, url string) []*Image {
 	return result
 }
 
-func downloadFile(fileName string, url string) (err error) {
-	// create the file
-	os.MkdirAll(filepath.Dir(fileName), fileMode)
+// setupTorDialer creates the dialer of the localhost Tor proxy, the hostnames are resolved by the proxy (socks5h)
+func setupTorDialer() error {
+	torProxyURL, err := url.Parse("socks5h://" + torProxyAddress)
 
-	out, err := os.Create(fileName)
 	if err != nil {
 		return err
 	}
-	defer out.Close()
 
-	torTransport := &http.Transport{Dial: torDialer.Dial}
-	client := &http.Client{Transport: torTransport, Timeout: timeout}
+	torDialer, err = proxy.FromURL(torProxyURL, proxy.Direct)
+
+	return err
+}
+
+func newTorHTTPClient() *http.Client {
+	timeouts := getTimeoutsConfig()
+	torTransport := &http.Transport{DialContext: getTorDialContext(getTimeout(timeouts.DialSeconds, timeout))}
+
+	return newHTTPClient(torTransport)
+}
+
+// newHTTPClient returns a client with the configured timeouts for the transport
+func newHTTPClient(transport *http.Transport) *http.Client {
+	timeouts := getTimeoutsConfig()
+
+	transport.TLSHandshakeTimeout = getTimeout(timeouts.TLSHandshakeSeconds, defaultTLSHandshakeTimeout)
+	transport.ResponseHeaderTimeout = getTimeout(timeouts.ResponseHeaderSeconds, 0)
+	setupHTTPVersion(transport)
+	setupTLSFingerprint(transport)
+
+	client := &http.Client{Transport: transport, Timeout: getTimeout(timeouts.RequestSeconds, timeout)}
+
+	// abort transfers without progress
+	if timeouts.IdleReadSeconds > 0 {
+		client.Transport = &watchdogTransport{transport: transport, idleTimeout: getTimeout(timeouts.IdleReadSeconds, 0)}
+	}
+
+	client.Transport = applyMiddlewares(client.Transport)
+
+	return client
+}
+
+func loadConfigurationFile() {
+	// read configuration file content, the other projects of the file may be saving it
+	if isProjectSelected() {
+		unlock, err := lockConfigurationFile()
+
+		if err != nil {
+			printError("Unable to lock configuration file:", err)
+			os.Exit(exitCodeConfigError)
+		}
+
+		defer unlock()
+	}
+
+	file, err := ioutil.ReadFile(configurationFileName)
 
-	// get the file data
-	resp, err := client.Get(url)
 	if err != nil {
-		return err
+		printError("Unable to read configuration file:", err)
+		os.Exit(exitCodeConfigError)
 	}
-	defer resp.Body.Close()
 
-	// write the body to file
-	_, err = io.Copy(out, resp.Body)
+	// parse configuration file
+	configuration, err = parseConfiguration(file)
+
 	if err != nil {
-		return err
+		printError("Unable to parse configuration file:", err)
+		os.Exit(exitCodeConfigError)
+	}
+
+	// the progress of an interrupted crawl
+	checkpointSites, err := loadCheckpoint()
+
+	if err != nil {
+		printError("Unable to load checkpoint:", err)
+		os.Exit(exitCodeError)
+	}
+
+	if checkpointSites > 0 {
+		printInfo(fmt.Sprintf("Loaded %d site updates from checkpoint", checkpointSites))
 	}
 
-	return nil
+	applyOverrides()
+
+	err = applyPermissions()
+
+	if err != nil {
+		printError("Unable to apply permissions:", err)
+		os.Exit(exitCodeConfigError)
+	}
+}
+
+func applyOverrides() {
+	// the project settings are overridden by the environment variables and flags too
+	err := applyProject()
+
+	if err != nil {
+		printError("Unable to use project:", err)
+		os.Exit(exitCodeConfigError)
+	}
+
+	// environment variables and flags override the file settings
+	err = applyConfigurationOverrides()
+
+	if err != nil {
+		printError("Unable to override configuration:", err)
+		os.Exit(exitCodeConfigError)
+	}
+
+	// the profile only changes settings without value
+	profile := configuration.Profile
+
+	if configurationProfile != "" {
+		profile = configurationProfile
+	}
+
+	if profile != "" {
+		err = applyProfile(profile)
+
+		if err != nil {
+			printError("Unable to use profile:", err)
+			os.Exit(exitCodeConfigError)
+		}
+	}
+
+	if configuration.TorProxy != "" {
+		torProxyAddress = configuration.TorProxy
+	}
 }
 
 func saveConfigurationFile() {
+	configurationToSave := getConfigurationToSave()
+
+	// the other projects of the file can be crawled at the same time, only the sites of the project are saved
+	if configurationProject != "" {
+		unlock, err := lockConfigurationFile()
+
+		if err != nil {
+			printError("Unable to lock configuration file:", err)
+			exitCrawl(exitCodeError)
+		}
+
+		defer unlock()
+
+		configurationToSave, err = getProjectConfigurationToSave(configurationToSave)
+
+		if err != nil {
+			printError("Unable to get project sites to save:", err)
+			exitCrawl(exitCodeError)
+		}
+	}
+
 	// save the configuration file with the new sites and site data
-	configurationJSON, err := json.MarshalIndent(configuration, "", "\t")
+	configurationJSON, err := json.MarshalIndent(configurationToSave, "", "\t")
 
 	if err != nil {
-		fmt.Println("Unable to get configuration data to save:", err)
-		os.Exit(0)
+		printError("Unable to get configuration data to save:", err)
+		exitCrawl(exitCodeError)
 	}
 
-	err = ioutil.WriteFile(configurationFileName, configurationJSON, fileMode)
+	err = writeFileAtomically(configurationFileName, configurationJSON, configurationFileMode)
 
 	if err != nil {
-		fmt.Println("Unable to save configuration file content:", err)
-		os.Exit(0)
+		printError("Unable to save configuration file content:", err)
+		exitCrawl(exitCodeError)
 	}
+
+	removeCheckpoint()
 }
 
 func isValidImageExtension(extension string) bool {
+	if isImageExtension(extension) {
+		return true
+	}
+
+	printError("Image extension is invalid:", strings.Replace(extension, ".", "", -1))
+
+	return false
+}
+
+func isImageExtension(extension string) bool {
 	extension = strings.Replace(extension, ".", "", -1)
 
 	if strings.EqualFold("jpg", extension) {
@@ -361,7 +1637,5 @@ func isValidImageExtension(extension string) bool {
 		return true
 	}
 
-	fmt.Println("Image extension is invalid:", extension)
-
 	return false
 }
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultTorBinary = "tor"
+const defaultTorDataDirName = "tor-data"
+const defaultTorBootstrapTimeout = 3 * time.Minute
+const ephemeralTorDirName = "ephemeral"
+const torCacheDirName = "cache"
+
+// binaries of the pluggable transports used when the config has no transport for a bridge
+var defaultPluggableTransports = map[string][]string{
+	"obfs4":     {"lyrebird", "obfs4proxy"},
+	"meek_lite": {"lyrebird", "obfs4proxy"},
+	"webtunnel": {"lyrebird"},
+	"snowflake": {"snowflake-client"},
+}
+
+var socksListenerPattern = regexp.MustCompile(`Opened Socks listener.* on (\S+)$`)
+var bootstrapPattern = regexp.MustCompile(`Bootstrapped (\d+)%`)
+
+// ManagedTorConfig starts a tor process for the crawl, with the bridges and pluggable transports of the config
+// so the crawl works in censored networks without editing the torrc
+type ManagedTorConfig struct {
+	Enabled                 bool                  `json:"enabled"`
+	Binary                  string                `json:"binary,omitempty"`
+	DataDir                 string                `json:"data_dir,omitempty"`
+	SocksPort               int                   `json:"socks_port,omitempty"`
+	ControlPort             int                   `json:"control_port,omitempty"`
+	Ephemeral               bool                  `json:"ephemeral,omitempty"`
+	EphemeralCache          bool                  `json:"ephemeral_cache,omitempty"`
+	Bridges                 []string              `json:"bridges,omitempty"`
+	Transports              []*PluggableTransport `json:"transports,omitempty"`
+	BootstrapTimeoutSeconds int                   `json:"bootstrap_timeout_seconds,omitempty"`
+}
+
+type PluggableTransport struct {
+	Names []string `json:"names"`
+	Path  string   `json:"path"`
+	Args  []string `json:"args,omitempty"`
+}
+
+var (
+	managedTor      *exec.Cmd
+	ephemeralTorDir string
+)
+
+func isManagedTorEnabled() bool {
+	return configuration.ManagedTor != nil && configuration.ManagedTor.Enabled
+}
+
+// getBridgeTransport returns the transport of a bridge line, the bridges without transport are plain relays
+func getBridgeTransport(bridge string) string {
+	fields := strings.Fields(bridge)
+
+	if len(fields) == 0 || strings.ContainsAny(fields[0], ".:[") {
+		return ""
+	}
+
+	return fields[0]
+}
+
+// getTorrc returns the torrc of the managed tor, the tor process exits with the crawler since the crawler is its
+// owning controller
+func getTorrc(config *ManagedTorConfig, dataDir string, cacheDir string) (string, error) {
+	lines := []string{
+		"DataDirectory " + dataDir,
+		"__OwningControllerProcess " + strconv.Itoa(os.Getpid()),
+	}
+
+	if cacheDir != "" {
+		lines = append(lines, "CacheDirectory "+cacheDir)
+	}
+
+	socksPort := "auto"
+
+	if config.SocksPort > 0 {
+		socksPort = strconv.Itoa(config.SocksPort)
+	}
+
+	lines = append(lines, "SocksPort 127.0.0.1:"+socksPort+" ExtendedErrors")
+
+	if config.ControlPort > 0 {
+		lines = append(lines, "ControlPort 127.0.0.1:"+strconv.Itoa(config.ControlPort), "CookieAuthentication 1")
+	}
+
+	if len(config.Bridges) == 0 {
+		return strings.Join(lines, "\n") + "\n", nil
+	}
+
+	lines = append(lines, "UseBridges 1")
+	transports := map[string]bool{}
+
+	for _, transport := range config.Transports {
+		lines = append(lines, strings.TrimSpace(fmt.Sprintf("ClientTransportPlugin %s exec %s %s", strings.Join(transport.Names, ","), transport.Path, strings.Join(transport.Args, " "))))
+
+		for _, name := range transport.Names {
+			transports[name] = true
+		}
+	}
+
+	for _, bridge := range config.Bridges {
+		// the lines can be copied from the torrc, with the Bridge option
+		bridge = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(bridge), "Bridge "))
+		name := getBridgeTransport(bridge)
+
+		if name != "" && !transports[name] {
+			path, err := getDefaultPluggableTransportPath(name)
+
+			if err != nil {
+				return "", err
+			}
+
+			lines = append(lines, fmt.Sprintf("ClientTransportPlugin %s exec %s", name, path))
+			transports[name] = true
+		}
+
+		lines = append(lines, "Bridge "+bridge)
+	}
+
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+func getDefaultPluggableTransportPath(name string) (string, error) {
+	for _, binary := range defaultPluggableTransports[name] {
+		if path, err := exec.LookPath(binary); err == nil {
+			return path, nil
+		}
+	}
+
+	return "", errors.New("no pluggable transport for " + name + ", set its path in the managed tor transports")
+}
+
+// startManagedTor starts tor with the generated torrc and waits for its bootstrap, the crawl uses its socks port
+func startManagedTor(config *ManagedTorConfig) error {
+	currentDir, err := os.Getwd()
+
+	if err != nil {
+		return err
+	}
+
+	dataDir := config.DataDir
+
+	if dataDir == "" {
+		dataDir = currentDir + string(filepath.Separator) + defaultTorDataDirName
+	}
+
+	dataDir, err = filepath.Abs(dataDir)
+
+	if err != nil {
+		return err
+	}
+
+	// tor refuses a data dir that other users can read
+	err = os.MkdirAll(dataDir, 0700)
+
+	if err != nil {
+		return err
+	}
+
+	cacheDir := ""
+
+	if config.Ephemeral {
+		dataDir, cacheDir, err = createEphemeralTorDir(config, dataDir)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	torrc, err := getTorrc(config, dataDir, cacheDir)
+
+	if err != nil {
+		return err
+	}
+
+	torrcFileName := dataDir + string(filepath.Separator) + "torrc"
+	err = ioutil.WriteFile(torrcFileName, []byte(torrc), 0600)
+
+	if err != nil {
+		return err
+	}
+
+	binary := config.Binary
+
+	if binary == "" {
+		binary = defaultTorBinary
+	}
+
+	managedTor = exec.Command(binary, "-f", torrcFileName)
+	output, err := managedTor.StdoutPipe()
+
+	if err != nil {
+		return err
+	}
+
+	err = managedTor.Start()
+
+	if err != nil {
+		return err
+	}
+
+	printInfo("Starting managed Tor...")
+
+	result := make(chan error, 1)
+	socksAddress := ""
+
+	go func() {
+		scanner := bufio.NewScanner(output)
+		bootstrapped := false
+
+		for scanner.Scan() {
+			line := scanner.Text()
+
+			if bootstrapped {
+				continue
+			}
+
+			if matches := socksListenerPattern.FindStringSubmatch(line); matches != nil {
+				socksAddress = matches[1]
+			}
+
+			if matches := bootstrapPattern.FindStringSubmatch(line); matches != nil {
+				printInfo("Managed Tor bootstrapped " + matches[1] + "%")
+
+				if matches[1] == "100" {
+					bootstrapped = true
+					result <- nil
+				}
+			}
+
+			if strings.Contains(line, "[err]") {
+				printInfo("Managed Tor:", line)
+			}
+		}
+
+		if !bootstrapped {
+			result <- errors.New("managed tor exited before its bootstrap")
+		}
+	}()
+
+	select {
+	case err = <-result:
+	case <-time.After(getTimeout(config.BootstrapTimeoutSeconds, defaultTorBootstrapTimeout)):
+		err = errors.New("managed tor bootstrap timed out")
+	}
+
+	if err != nil {
+		stopManagedTor()
+		return err
+	}
+
+	if socksAddress == "" {
+		stopManagedTor()
+		return errors.New("managed tor has no socks listener")
+	}
+
+	torProxyAddress = socksAddress
+	printInfo("Managed Tor is ready:", torProxyAddress)
+
+	return nil
+}
+
+func stopManagedTor() {
+	if managedTor != nil && managedTor.Process != nil {
+		managedTor.Process.Kill()
+		managedTor.Wait()
+		managedTor = nil
+	}
+
+	if ephemeralTorDir != "" {
+		err := scrubDir(ephemeralTorDir)
+
+		if err != nil {
+			printError("Unable to remove ephemeral Tor data directory:", err)
+		}
+
+		ephemeralTorDir = ""
+	}
+}
+
+// createEphemeralTorDir creates the data dir of the run, without the guards, keys and state of other runs. The
+// consensus cache is public and is kept in the data dir so the bootstrap doesn't download it again, unless it
+// is ephemeral too
+func createEphemeralTorDir(config *ManagedTorConfig, dataDir string) (string, string, error) {
+	runsDir := dataDir + string(filepath.Separator) + ephemeralTorDirName
+
+	err := os.MkdirAll(runsDir, 0700)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	// the runs that exited before stopping tor left their dirs
+	if err := scrubStaleTorDirs(runsDir); err != nil {
+		return "", "", err
+	}
+
+	// the dir has the pid of the run, so the crawls that share the data dir keep the dirs of each other
+	ephemeralTorDir, err = ioutil.TempDir(runsDir, fmt.Sprintf("run-%d-", os.Getpid()))
+
+	if err != nil {
+		return "", "", err
+	}
+
+	if config.EphemeralCache {
+		return ephemeralTorDir, "", nil
+	}
+
+	cacheDir := dataDir + string(filepath.Separator) + torCacheDirName
+	err = os.MkdirAll(cacheDir, 0700)
+
+	return ephemeralTorDir, cacheDir, err
+}
+
+// scrubStaleTorDirs scrubs the dirs of the runs whose process is not running anymore, the dirs of older versions
+// have no pid and are scrubbed too
+func scrubStaleTorDirs(runsDir string) error {
+	files, err := ioutil.ReadDir(runsDir)
+
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		parts := strings.SplitN(file.Name(), "-", 3)
+
+		if !file.IsDir() || parts[0] != "run" {
+			continue
+		}
+
+		if pid, err := strconv.Atoi(parts[1]); err == nil && len(parts) == 3 && pid != os.Getpid() && isProcessAlive(pid) {
+			continue
+		}
+
+		if err := scrubDir(runsDir + string(filepath.Separator) + file.Name()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scrubDir overwrites the files of the dir with zeros before removing it, so the state of tor is not left on the
+// disk blocks of the files
+func scrubDir(dir string) error {
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+
+		file, err := os.OpenFile(path, os.O_WRONLY, 0)
+
+		if err != nil {
+			return err
+		}
+
+		defer file.Close()
+
+		_, err = file.Write(make([]byte, info.Size()))
+
+		if err == nil {
+			err = file.Sync()
+		}
+
+		return err
+	})
+
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return os.RemoveAll(dir)
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// getMarkdownFromHTML converts the article of the page to markdown, with the links resolved against the
+// page url
+func getMarkdownFromHTML(content []byte, pageURL string) (string, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(content))
+
+	if err != nil {
+		return "", err
+	}
+
+	baseURL, _ := url.Parse(pageURL)
+	buffer := &strings.Builder{}
+
+	article := getArticle(doc)
+
+	if article.Title != "" {
+		buffer.WriteString("# " + article.Title + "\n\n")
+	}
+
+	if byline := getArticleByline(article); byline != "" {
+		buffer.WriteString("*" + byline + "*\n\n")
+	}
+
+	for _, node := range article.Content.Nodes {
+		writeMarkdownNode(buffer, node, baseURL)
+	}
+
+	return cleanMarkdown(buffer.String()), nil
+}
+
+func getArticleByline(article *Article) string {
+	parts := []string{}
+
+	if article.Author != "" {
+		parts = append(parts, "By "+article.Author)
+	}
+
+	if article.Published != nil {
+		parts = append(parts, article.Published.Format("2006-01-02"))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func writeMarkdownNode(buffer *strings.Builder, node *html.Node, baseURL *url.URL) {
+	switch node.Type {
+	case html.TextNode:
+		buffer.WriteString(getCollapsedText(node.Data))
+		return
+	case html.ElementNode:
+	default:
+		writeMarkdownChildren(buffer, node, baseURL)
+		return
+	}
+
+	switch node.Data {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		buffer.WriteString("\n\n" + strings.Repeat("#", int(node.Data[1]-'0')) + " ")
+		writeMarkdownChildren(buffer, node, baseURL)
+		buffer.WriteString("\n\n")
+	case "p", "div", "section", "article", "main", "table":
+		buffer.WriteString("\n\n")
+		writeMarkdownChildren(buffer, node, baseURL)
+		buffer.WriteString("\n\n")
+	case "tr":
+		buffer.WriteString("\n|")
+		writeMarkdownChildren(buffer, node, baseURL)
+	case "td", "th":
+		buffer.WriteString(" ")
+		writeMarkdownChildren(buffer, node, baseURL)
+		buffer.WriteString(" |")
+	case "br":
+		buffer.WriteString("\n")
+	case "hr":
+		buffer.WriteString("\n\n---\n\n")
+	case "strong", "b":
+		buffer.WriteString("**")
+		writeMarkdownChildren(buffer, node, baseURL)
+		buffer.WriteString("**")
+	case "em", "i":
+		buffer.WriteString("*")
+		writeMarkdownChildren(buffer, node, baseURL)
+		buffer.WriteString("*")
+	case "code":
+		buffer.WriteString("`" + getNodeText(node) + "`")
+	case "pre":
+		buffer.WriteString("\n\n```\n" + strings.Trim(getNodeText(node), "\n") + "\n```\n\n")
+	case "blockquote":
+		inner := &strings.Builder{}
+		writeMarkdownChildren(inner, node, baseURL)
+		buffer.WriteString("\n\n")
+
+		for _, line := range strings.Split(cleanMarkdown(inner.String()), "\n") {
+			buffer.WriteString("> " + line + "\n")
+		}
+
+		buffer.WriteString("\n")
+	case "ul", "ol":
+		buffer.WriteString("\n\n")
+		index := 0
+
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode || child.Data != "li" {
+				continue
+			}
+
+			index++
+			item := &strings.Builder{}
+			writeMarkdownChildren(item, child, baseURL)
+
+			if node.Data == "ol" {
+				buffer.WriteString(fmt.Sprintf("%d. ", index))
+			} else {
+				buffer.WriteString("- ")
+			}
+
+			buffer.WriteString(strings.Replace(cleanMarkdown(item.String()), "\n", "\n  ", -1) + "\n")
+		}
+
+		buffer.WriteString("\n")
+	case "a":
+		inner := &strings.Builder{}
+		writeMarkdownChildren(inner, node, baseURL)
+		text := strings.TrimSpace(inner.String())
+		href := getMarkdownURL(getNodeAttribute(node, "href"), baseURL)
+
+		if href == "" || text == "" {
+			buffer.WriteString(text)
+		} else {
+			buffer.WriteString("[" + text + "](" + href + ")")
+		}
+	case "img":
+		if src := getMarkdownURL(getNodeAttribute(node, "src"), baseURL); src != "" {
+			buffer.WriteString("![" + getNodeAttribute(node, "alt") + "](" + src + ")")
+		}
+	default:
+		writeMarkdownChildren(buffer, node, baseURL)
+	}
+}
+
+func writeMarkdownChildren(buffer *strings.Builder, node *html.Node, baseURL *url.URL) {
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		writeMarkdownNode(buffer, child, baseURL)
+	}
+}
+
+func getNodeText(node *html.Node) string {
+	buffer := &strings.Builder{}
+
+	var write func(node *html.Node)
+
+	write = func(node *html.Node) {
+		if node.Type == html.TextNode {
+			buffer.WriteString(node.Data)
+		}
+
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			write(child)
+		}
+	}
+
+	write(node)
+
+	return buffer.String()
+}
+
+func getNodeAttribute(node *html.Node, name string) string {
+	for _, attribute := range node.Attr {
+		if attribute.Key == name {
+			return strings.TrimSpace(attribute.Val)
+		}
+	}
+
+	return ""
+}
+
+// getMarkdownURL resolves the url against the page url, data uris and scripts are ignored
+func getMarkdownURL(value string, baseURL *url.URL) string {
+	if value == "" || strings.HasPrefix(value, "data:") || strings.HasPrefix(strings.ToLower(value), "javascript:") {
+		return ""
+	}
+
+	if baseURL == nil {
+		return value
+	}
+
+	resolvedURL, err := baseURL.Parse(value)
+
+	if err != nil {
+		return value
+	}
+
+	return resolvedURL.String()
+}
+
+// getCollapsedText collapses the whitespace of the text like the browsers do, keeping one space at the ends
+func getCollapsedText(text string) string {
+	result := strings.Join(strings.Fields(text), " ")
+
+	if result == "" {
+		if text != "" {
+			return " "
+		}
+
+		return ""
+	}
+
+	if strings.TrimLeft(text, " \t\r\n") != text {
+		result = " " + result
+	}
+
+	if strings.TrimRight(text, " \t\r\n") != text {
+		result += " "
+	}
+
+	return result
+}
+
+// cleanMarkdown trims the lines outside the code blocks and keeps at most one empty line between blocks
+func cleanMarkdown(markdown string) string {
+	lines := []string{}
+	emptyLines := 0
+	codeBlock := false
+
+	for _, line := range strings.Split(markdown, "\n") {
+		if line == "```" {
+			codeBlock = !codeBlock
+		} else if codeBlock {
+			lines = append(lines, line)
+			continue
+		}
+
+		line = strings.TrimSpace(line)
+
+		if line == "" {
+			emptyLines++
+
+			if emptyLines > 1 || len(lines) == 0 {
+				continue
+			}
+		} else {
+			emptyLines = 0
+		}
+
+		lines = append(lines, line)
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// saveMarkdownFile saves the markdown of the page next to its html file
+func saveMarkdownFile(htmlFileName string, pageURL string, content []byte) error {
+	markdown, err := getMarkdownFromHTML(content, pageURL)
+
+	if err != nil {
+		return err
+	}
+
+	return writeFile(strings.TrimSuffix(htmlFileName, ".html")+".md", []byte(markdown+"\n"), fileMode)
+}
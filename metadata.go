@@ -0,0 +1,133 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+type ImageMetadata struct {
+	CameraMake  string            `json:"camera_make,omitempty"`
+	CameraModel string            `json:"camera_model,omitempty"`
+	Software    string            `json:"software,omitempty"`
+	DateTime    *time.Time        `json:"date_time,omitempty"`
+	Latitude    *float64          `json:"latitude,omitempty"`
+	Longitude   *float64          `json:"longitude,omitempty"`
+	XMP         map[string]string `json:"xmp,omitempty"`
+}
+
+var (
+	xmpPacketRegexp    = regexp.MustCompile(`(?s)<x:xmpmeta.*?</x:xmpmeta>`)
+	xmpAttributeRegexp = regexp.MustCompile(`([A-Za-z]+:[A-Za-z]+)="([^"]*)"`)
+	xmpElementRegexp   = regexp.MustCompile(`(?s)<([A-Za-z]+:[A-Za-z]+)>([^<]+)</[A-Za-z]+:[A-Za-z]+>`)
+)
+
+func getImageMetadata(fileName string) *ImageMetadata {
+	metadata := &ImageMetadata{}
+	found := false
+
+	if getEXIFMetadata(fileName, metadata) {
+		found = true
+	}
+
+	if getXMPMetadata(fileName, metadata) {
+		found = true
+	}
+
+	if !found {
+		return nil
+	}
+
+	return metadata
+}
+
+func getEXIFMetadata(fileName string, metadata *ImageMetadata) bool {
+	file, err := os.Open(fileName)
+
+	if err != nil {
+		return false
+	}
+
+	defer file.Close()
+
+	data, err := exif.Decode(file)
+
+	if err != nil {
+		return false
+	}
+
+	metadata.CameraMake = getEXIFString(data, exif.Make)
+	metadata.CameraModel = getEXIFString(data, exif.Model)
+	metadata.Software = getEXIFString(data, exif.Software)
+
+	if dateTime, err := data.DateTime(); err == nil {
+		metadata.DateTime = &dateTime
+	}
+
+	if latitude, longitude, err := data.LatLong(); err == nil {
+		metadata.Latitude = &latitude
+		metadata.Longitude = &longitude
+	}
+
+	return true
+}
+
+func getEXIFString(data *exif.Exif, field exif.FieldName) string {
+	tag, err := data.Get(field)
+
+	if err != nil {
+		return ""
+	}
+
+	value, err := tag.StringVal()
+
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(value)
+}
+
+func getXMPMetadata(fileName string, metadata *ImageMetadata) bool {
+	content, err := ioutil.ReadFile(fileName)
+
+	if err != nil {
+		return false
+	}
+
+	packet := xmpPacketRegexp.Find(content)
+
+	if packet == nil {
+		return false
+	}
+
+	values := map[string]string{}
+
+	// xmp properties can be written as attributes or as elements
+	for _, match := range xmpAttributeRegexp.FindAllSubmatch(packet, -1) {
+		values[string(match[1])] = strings.TrimSpace(string(match[2]))
+	}
+
+	for _, match := range xmpElementRegexp.FindAllSubmatch(packet, -1) {
+		values[string(match[1])] = strings.TrimSpace(string(match[2]))
+	}
+
+	// namespace declarations are not metadata
+	for key := range values {
+		if strings.HasPrefix(key, "xmlns:") || strings.HasPrefix(key, "x:") || strings.HasPrefix(key, "rdf:") {
+			delete(values, key)
+		}
+	}
+
+	if len(values) == 0 {
+		return false
+	}
+
+	metadata.XMP = values
+
+	return true
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+)
+
+// middleware wraps the transport of the http clients of the crawler, like the request headers of the configuration
+type middleware func(next http.RoundTripper) http.RoundTripper
+
+// roundTripperFunc makes a function a round tripper, like http.HandlerFunc
+type roundTripperFunc func(request *http.Request) (*http.Response, error)
+
+func (function roundTripperFunc) RoundTrip(request *http.Request) (*http.Response, error) {
+	return function(request)
+}
+
+// the middlewares of the crawler, in the order they were added
+var crawlerMiddlewares []middleware
+
+// useMiddleware adds middlewares to the clients made after it, the first middleware added is the first to get the
+// request and the last to get the response
+func useMiddleware(middlewares ...middleware) {
+	crawlerMiddlewares = append(crawlerMiddlewares, middlewares...)
+}
+
+func applyMiddlewares(transport http.RoundTripper) http.RoundTripper {
+	for index := len(crawlerMiddlewares) - 1; index >= 0; index-- {
+		transport = crawlerMiddlewares[index](transport)
+	}
+
+	return transport
+}
+
+// setupMiddlewares adds the middlewares of the configuration, before the clients of the crawl are made
+func setupMiddlewares(config *ConfigurationFile) {
+	if len(config.RequestHeaders) > 0 {
+		header := http.Header{}
+
+		for name, value := range config.RequestHeaders {
+			header.Set(name, value)
+		}
+
+		useMiddleware(newHeaderMiddleware(header))
+	}
+}
+
+// newHeaderMiddleware sets the headers on every request, replacing the headers of the crawler with the same name
+func newHeaderMiddleware(header http.Header) middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+			// a round tripper must not change the request it gets
+			request = request.Clone(request.Context())
+
+			for name, values := range header {
+				request.Header[name] = values
+			}
+
+			return next.RoundTrip(request)
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MirrorSite is a site of a wget or HTTrack mirror, wget -m saves each host to a dir named by it and HTTrack saves
+// the hosts of a project the same way, next to its hts-cache dir
+type MirrorSite struct {
+	Host string
+	Dir  string
+}
+
+// MirrorImport counts the files of a mirror site adopted by the archive
+type MirrorImport struct {
+	Pages   int
+	Images  int
+	Skipped int
+}
+
+// getMirrorSites returns the host dirs of the mirror, the mirror dir itself when it is a host dir
+func getMirrorSites(mirrorDir string) ([]*MirrorSite, error) {
+	mirrorDir, err := filepath.Abs(mirrorDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if isMirrorHostDir(mirrorDir) {
+		return []*MirrorSite{{Host: filepath.Base(mirrorDir), Dir: mirrorDir}}, nil
+	}
+
+	files, err := ioutil.ReadDir(mirrorDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*MirrorSite{}
+
+	for _, file := range files {
+		dir := filepath.Join(mirrorDir, file.Name())
+
+		if file.IsDir() && isMirrorHostDir(dir) {
+			result = append(result, &MirrorSite{Host: file.Name(), Dir: dir})
+		}
+	}
+
+	return result, nil
+}
+
+// isMirrorHostDir returns if the dir is a host of the mirror: a name like a host, not the HTTrack dirs, with an
+// index page
+func isMirrorHostDir(dir string) bool {
+	name := filepath.Base(dir)
+
+	if !strings.Contains(name, ".") || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "hts-") {
+		return false
+	}
+
+	return getMirrorIndexFileName(dir) != ""
+}
+
+func getMirrorIndexFileName(dir string) string {
+	for _, name := range []string{"index.html", "index.htm"} {
+		if info, err := os.Stat(filepath.Join(dir, name)); err == nil && !info.IsDir() {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// importMirrorSite copies the files of the mirror site to the site dir with the layout of the crawler: the index
+// page is the site index.html, the other pages are saved to the pages dir and the images keep their paths. Other
+// files, like styles and scripts, are not part of the site records and are skipped
+func importMirrorSite(site *Site, mirrorSite *MirrorSite, outputDir string) (*MirrorImport, error) {
+	result := &MirrorImport{}
+	siteDir := outputDir + string(filepath.Separator) + getSiteDirName(site)
+	indexFileName := getMirrorIndexFileName(mirrorSite.Dir)
+	pages := []*Page{}
+	images := []*Image{}
+
+	err := filepath.Walk(mirrorSite.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(mirrorSite.Dir, path)
+
+		if err != nil {
+			return err
+		}
+
+		relativePath = filepath.ToSlash(relativePath)
+
+		if info.IsDir() {
+			// the dirs of HTTrack, like its cache, are not files of the site
+			if relativePath != "." && strings.HasPrefix(info.Name(), "hts-") {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		extension := strings.ToLower(filepath.Ext(relativePath))
+
+		switch {
+		case relativePath == indexFileName:
+			content, err := ioutil.ReadFile(path)
+
+			if err != nil {
+				return err
+			}
+
+			doc, err := parseHTML(content)
+
+			if err != nil {
+				return err
+			}
+
+			site.Title = getTagContentFromDocument(doc, "title")
+			site.Language = getLanguageFromDocument(doc, "")
+			site.ContentHash = getContentHash(content)
+
+			return adoptMirrorFile(path, siteDir+string(filepath.Separator)+"index.html")
+		case extension == ".html" || extension == ".htm":
+			pagePath := strings.TrimSuffix(strings.TrimSuffix(relativePath, "index.html"), "index.htm")
+			pageURL := site.URL + "/" + pagePath
+			page := &Page{
+				URL:          pageURL,
+				Depth:        strings.Count(strings.Trim(pagePath, "/"), "/") + 1,
+				FileName:     pagesDirName + "/" + getPageFileName(pageURL),
+				FetchSuccess: true,
+				FetchedAt:    info.ModTime().UTC(),
+			}
+
+			hash, err := getFileHash(path)
+
+			if err != nil {
+				return err
+			}
+
+			page.ContentHash = fmt.Sprintf("%x", hash)
+			pages = append(pages, page)
+			result.Pages++
+
+			return adoptMirrorFile(path, siteDir+string(filepath.Separator)+filepath.FromSlash(page.FileName))
+		case isImageExtension(extension):
+			hash, err := getFileHash(path)
+
+			if err != nil {
+				return err
+			}
+
+			images = append(images, &Image{URL: relativePath, FetchSuccess: true, ContentHash: fmt.Sprintf("%x", hash)})
+			result.Images++
+
+			return adoptMirrorFile(path, siteDir+string(filepath.Separator)+filepath.FromSlash(relativePath))
+		}
+
+		result.Skipped++
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	site.FetchSuccess = true
+	site.Pages = pages
+	site.Images = images
+
+	return result, nil
+}
+
+// adoptMirrorFile copies the mirror file to the archive, the files are not linked since the crawler rewrites the
+// archive files in place. Files of the archive with the same content are kept
+func adoptMirrorFile(sourceFileName string, targetFileName string) error {
+	if _, err := os.Stat(targetFileName); err == nil {
+		if isSameFileContent(sourceFileName, targetFileName) {
+			return nil
+		}
+
+		return errors.New("archive file already exists with other content: " + targetFileName)
+	}
+
+	err := os.MkdirAll(filepath.Dir(targetFileName), dirMode)
+
+	if err != nil {
+		return err
+	}
+
+	return copyFile(sourceFileName, targetFileName)
+}
+
+func runImportMirrorCommand(args []string) {
+	flags := flag.NewFlagSet("import-mirror", flag.ExitOnError)
+	scheme := flags.String("scheme", "http", "scheme of the site urls, the mirrors don't keep it")
+	tags := flags.String("tags", "", "comma separated tags of the imported sites")
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		fmt.Printf("Usage : %s import-mirror [-scheme http] [-tags a,b] <configuration file> <mirror dir> \n", os.Args[0])
+		os.Exit(exitCodeConfigError)
+	}
+
+	configurationFileName = flags.Arg(0)
+
+	loadConfigurationFile()
+
+	mirrorSites, err := getMirrorSites(flags.Arg(1))
+
+	if err != nil {
+		fmt.Println("Unable to read mirror:", err)
+		os.Exit(exitCodeError)
+	}
+
+	if len(mirrorSites) == 0 {
+		fmt.Println("No wget or HTTrack site found in mirror:", flags.Arg(1))
+		os.Exit(exitCodeError)
+	}
+
+	currentDir, err := os.Getwd()
+
+	if err != nil {
+		fmt.Println("Unable to get current directory:", err)
+		os.Exit(exitCodeError)
+	}
+
+	outputDir := getOutputDir(currentDir)
+	existingSites := map[string]*Site{}
+
+	for _, site := range configuration.Sites {
+		existingSites[normalizeURL(site.URL)] = site
+	}
+
+	imported := 0
+
+	for _, mirrorSite := range mirrorSites {
+		siteURL := *scheme + "://" + mirrorSite.Host
+		site := existingSites[normalizeURL(siteURL)]
+
+		// fetched sites are maintained by the crawler and are not replaced by an older mirror
+		if site != nil && site.FetchSuccess {
+			fmt.Println("Site already fetched, skipping mirror:", site.URL)
+			continue
+		}
+
+		isNewSite := site == nil
+
+		if isNewSite {
+			site = &Site{URL: siteURL, Tags: getTags(*tags)}
+		}
+
+		result, err := importMirrorSite(site, mirrorSite, outputDir)
+
+		if err != nil {
+			fmt.Println("Unable to import mirror site:", siteURL, err)
+			continue
+		}
+
+		if isNewSite {
+			configuration.Sites = append(configuration.Sites, site)
+			existingSites[normalizeURL(siteURL)] = site
+		}
+
+		imported++
+		fmt.Println(fmt.Sprintf("Imported %s - %d pages, %d images, %d other files skipped", site.URL, result.Pages, result.Images, result.Skipped))
+	}
+
+	saveConfigurationFile()
+
+	fmt.Println(fmt.Sprintf("Imported %d of %d mirror sites", imported, len(mirrorSites)))
+}
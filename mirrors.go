@@ -0,0 +1,170 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const mirrorContextLength = 200
+
+var onionAddressPattern = regexp.MustCompile(`(?i)\b(?:[a-z2-7]{56}|[a-z2-7]{16})\.onion\b`)
+var mirrorKeywords = []string{"mirror", "alternative address", "alternative link", "alternate address", "backup address", "backup link", "alias"}
+
+func getURLHost(rawURL string) string {
+	parsedURL, err := url.Parse(rawURL)
+
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToLower(parsedURL.Hostname())
+}
+
+// getMirrorsFromDocument returns the onion hosts announced as mirrors of the page, from a canonical link to another
+// onion host or from onion addresses written near words like "mirror"
+func getMirrorsFromDocument(doc *goquery.Document, pageURL string) []string {
+	result := []string{}
+	siteHost := getURLHost(pageURL)
+
+	addMirror := func(host string) {
+		host = strings.ToLower(host)
+
+		if host == "" || host == siteHost || !strings.HasSuffix(host, ".onion") {
+			return
+		}
+
+		for _, value := range result {
+			if value == host {
+				return
+			}
+		}
+
+		result = append(result, host)
+	}
+
+	doc.Find("link[rel=canonical]").Each(func(_ int, selection *goquery.Selection) {
+		href, _ := selection.Attr("href")
+		addMirror(getURLHost(strings.TrimSpace(href)))
+	})
+
+	// links whose text announces a mirror
+	doc.Find("a[href]").Each(func(_ int, selection *goquery.Selection) {
+		href, _ := selection.Attr("href")
+
+		title, _ := selection.Attr("title")
+
+		if hasMirrorKeyword(selection.Text()) || hasMirrorKeyword(title) {
+			addMirror(getURLHost(strings.TrimSpace(href)))
+		}
+	})
+
+	// addresses in the text of each block, so the words of a block don't apply to the addresses of another
+	doc.Find("p, li, td, th, dd, dt, pre, blockquote, h1, h2, h3, h4, h5, h6, div:not(:has(div, p, li, table))").Each(func(_ int, selection *goquery.Selection) {
+		text := getCleanText(selection.Text())
+
+		for _, match := range onionAddressPattern.FindAllStringIndex(text, -1) {
+			start := match[0] - mirrorContextLength
+			end := match[1] + mirrorContextLength
+
+			if start < 0 {
+				start = 0
+			}
+
+			if end > len(text) {
+				end = len(text)
+			}
+
+			if hasMirrorKeyword(text[start:end]) {
+				addMirror(text[match[0]:match[1]])
+			}
+		}
+	})
+
+	return result
+}
+
+func hasMirrorKeyword(text string) bool {
+	text = strings.ToLower(text)
+
+	for _, keyword := range mirrorKeywords {
+		if strings.Contains(text, keyword) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// updateSiteMirrors adds the mirrors found in the seed page and in the crawled pages about mirrors to the site
+func updateSiteMirrors(site *Site, siteDir string, seedDoc *goquery.Document) {
+	mirrors := getMirrorsFromDocument(seedDoc, site.URL)
+
+	for _, page := range site.Pages {
+		if !page.FetchSuccess || !hasMirrorKeyword(page.URL) || !isHTMLContentType(page.ContentType) {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(siteDir + string(filepath.Separator) + filepath.FromSlash(page.FileName))
+
+		if err != nil {
+			continue
+		}
+
+		doc, err := parseHTML(content)
+
+		if err != nil {
+			continue
+		}
+
+		mirrors = append(mirrors, getMirrorsFromDocument(doc, page.URL)...)
+	}
+
+	for _, mirror := range mirrors {
+		exists := false
+
+		for _, value := range site.Mirrors {
+			if value == mirror {
+				exists = true
+				break
+			}
+		}
+
+		if !exists {
+			site.Mirrors = append(site.Mirrors, mirror)
+			emitEvent("site_mirror_found", site, site.URL, nil, map[string]interface{}{"mirror": mirror})
+		}
+	}
+}
+
+// getMirrorHosts returns the onion hosts that are mirrors of a site, with the url of that site, a site that is
+// itself a mirror of a previous site doesn't add its mirrors
+func getMirrorHosts(sites []*Site) map[string]string {
+	result := map[string]string{}
+
+	for _, site := range sites {
+		addSiteMirrorHosts(result, site)
+	}
+
+	return result
+}
+
+func addSiteMirrorHosts(mirrorHosts map[string]string, site *Site) {
+	if site.DuplicateOf != "" {
+		return
+	}
+
+	if _, exists := mirrorHosts[getURLHost(site.URL)]; exists {
+		return
+	}
+
+	for _, mirror := range site.Mirrors {
+		if _, exists := mirrorHosts[mirror]; !exists {
+			mirrorHosts[mirror] = site.URL
+		}
+	}
+}
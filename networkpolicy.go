@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	networkPolicySOCKSOnly = "socks_only"
+	networkPolicyOnionOnly = "onion_only"
+)
+
+const (
+	networkTransportSOCKS  = "socks5"
+	networkTransportDirect = "direct"
+	networkTransportDNS    = "dns"
+)
+
+// NetworkPolicyConfig checks every outbound connection of the crawler. With "socks_only" the direct connections
+// can only reach the loopback, like the local gateways, and with "onion_only" the Tor connections can only reach
+// onion services too. The allowed hosts are reached by any transport. Every attempt is written to the audit log
+type NetworkPolicyConfig struct {
+	Mode         string   `json:"mode,omitempty"`
+	AuditLog     string   `json:"audit_log,omitempty"`
+	AllowedHosts []string `json:"allowed_hosts,omitempty"`
+}
+
+// NetworkAuditEntry is a line of the audit log, the summary line is written when the crawl finishes
+type NetworkAuditEntry struct {
+	Type        string    `json:"type"`
+	Time        time.Time `json:"time"`
+	Transport   string    `json:"transport,omitempty"`
+	Network     string    `json:"network,omitempty"`
+	Destination string    `json:"destination,omitempty"`
+	Host        string    `json:"host,omitempty"`
+	Allowed     bool      `json:"allowed"`
+	Reason      string    `json:"reason,omitempty"`
+	Connections int       `json:"connections,omitempty"`
+	Blocked     int       `json:"blocked,omitempty"`
+	Direct      int       `json:"direct,omitempty"`
+	Lookups     int       `json:"dns_lookups,omitempty"`
+}
+
+var networkAudit = struct {
+	sync.Mutex
+	file        *os.File
+	connections int
+	blocked     int
+	direct      int
+	lookups     int
+}{}
+
+type localLookupKey struct{}
+
+// setupNetworkAudit opens the audit log, the entries are appended so the log of many crawls is kept
+func setupNetworkAudit() error {
+	if configuration.NetworkPolicy == nil || configuration.NetworkPolicy.AuditLog == "" {
+		return nil
+	}
+
+	file, err := os.OpenFile(configuration.NetworkPolicy.AuditLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, fileMode)
+
+	if err != nil {
+		return err
+	}
+
+	networkAudit.file = file
+
+	return nil
+}
+
+// closeNetworkAudit writes the summary of the connections of the crawl to the audit log
+func closeNetworkAudit() {
+	networkAudit.Lock()
+	defer networkAudit.Unlock()
+
+	if networkAudit.file == nil {
+		return
+	}
+
+	writeNetworkAuditEntry(&NetworkAuditEntry{
+		Type:        "summary",
+		Time:        time.Now().UTC(),
+		Allowed:     networkAudit.blocked == 0,
+		Connections: networkAudit.connections,
+		Blocked:     networkAudit.blocked,
+		Direct:      networkAudit.direct,
+		Lookups:     networkAudit.lookups,
+	})
+
+	networkAudit.file.Close()
+	networkAudit.file = nil
+
+	printInfo(fmt.Sprintf("Network audit: %d connections, %d direct, %d blocked, %d local dns lookups", networkAudit.connections, networkAudit.direct, networkAudit.blocked, networkAudit.lookups))
+}
+
+func writeNetworkAuditEntry(entry *NetworkAuditEntry) {
+	entryJSON, err := json.Marshal(entry)
+
+	if err != nil {
+		return
+	}
+
+	if _, err := networkAudit.file.Write(append(entryJSON, '\n')); err != nil {
+		printError("Unable to write network audit log:", err)
+	}
+}
+
+// checkConnection applies the policy to the connection and writes it to the audit log, the connections that are
+// not allowed return an error before any dns lookup or dial
+func checkConnection(transport string, network string, address string) error {
+	reason := getConnectionBlockReason(transport, address)
+
+	networkAudit.Lock()
+	defer networkAudit.Unlock()
+
+	networkAudit.connections++
+
+	if transport == networkTransportDirect {
+		networkAudit.direct++
+	}
+
+	if reason != "" {
+		networkAudit.blocked++
+	}
+
+	if networkAudit.file != nil {
+		writeNetworkAuditEntry(&NetworkAuditEntry{
+			Type:        "connection",
+			Time:        time.Now().UTC(),
+			Transport:   transport,
+			Network:     network,
+			Destination: address,
+			Allowed:     reason == "",
+			Reason:      reason,
+		})
+	}
+
+	if reason != "" {
+		return errors.New("connection blocked by network policy (" + reason + "): " + address)
+	}
+
+	return nil
+}
+
+// getConnectionBlockReason returns why the policy blocks the connection, or an empty string when it is allowed
+func getConnectionBlockReason(transport string, address string) string {
+	policy := configuration.NetworkPolicy
+
+	if policy == nil || policy.Mode == "" {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(address)
+
+	if err != nil {
+		host = address
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	if hasString(policy.AllowedHosts, host) || address == torProxyAddress {
+		return ""
+	}
+
+	if transport == networkTransportDirect {
+		if isLoopbackHost(host) {
+			return ""
+		}
+
+		return "direct connection"
+	}
+
+	if policy.Mode == networkPolicyOnionOnly && !strings.HasSuffix(host, ".onion") {
+		return "not an onion service"
+	}
+
+	return ""
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
+
+// getDirectDialContext returns the dial function of the connections that don't use Tor, checked by the policy
+func getDirectDialContext(dialTimeout time.Duration) func(ctx context.Context, network string, address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+
+	return func(ctx context.Context, network string, address string) (net.Conn, error) {
+		if err := checkConnection(networkTransportDirect, network, address); err != nil {
+			return nil, err
+		}
+
+		return dialer.DialContext(withLocalLookup(ctx, address), network, address)
+	}
+}
+
+// withLocalLookup returns a context that allows the local dns lookup of the host of the address, for the
+// connections already allowed by the policy
+func withLocalLookup(ctx context.Context, address string) context.Context {
+	host, _, err := net.SplitHostPort(address)
+
+	if err != nil {
+		host = address
+	}
+
+	return context.WithValue(ctx, localLookupKey{}, host)
+}
+
+func getLocalLookup(ctx context.Context) string {
+	host, _ := ctx.Value(localLookupKey{}).(string)
+	return host
+}
+
+// setupLocalResolver replaces the local resolver of the process with one that checks every dns query with the
+// policy. The urls of the crawl are sent to the Tor proxy without being resolved (socks5h), so the only local
+// lookups are of the proxy, of the direct connections allowed by the policy and of the allowed hosts, any other
+// lookup would leak a hostname to the local dns server and is blocked. Without a policy the lookups are only
+// counted, but the onion services are never resolved locally
+func setupLocalResolver() {
+	dialer := &net.Dialer{}
+
+	net.DefaultResolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, address)
+
+			if err != nil {
+				return nil, err
+			}
+
+			guard := &lookupGuard{network: network, server: address, host: getLocalLookup(ctx)}
+
+			// the resolver writes the udp messages without their length to the packet conns
+			if udpConn, ok := conn.(*net.UDPConn); ok {
+				return &lookupGuardUDPConn{UDPConn: udpConn, guard: guard}, nil
+			}
+
+			return &lookupGuardConn{Conn: conn, guard: guard}, nil
+		},
+	}
+}
+
+// lookupGuard checks the queries written to the dns server, from the lookups of the host
+type lookupGuard struct {
+	network string
+	server  string
+	host    string
+}
+
+func (guard *lookupGuard) check(message []byte) error {
+	parser := dnsmessage.Parser{}
+	name := ""
+
+	if _, err := parser.Start(message); err == nil {
+		if question, err := parser.Question(); err == nil {
+			name = strings.ToLower(strings.TrimSuffix(question.Name.String(), "."))
+		}
+	}
+
+	return checkLocalLookup(name, guard.host, guard.network, guard.server)
+}
+
+type lookupGuardUDPConn struct {
+	*net.UDPConn
+	guard *lookupGuard
+}
+
+func (conn *lookupGuardUDPConn) Write(data []byte) (int, error) {
+	if err := conn.guard.check(data); err != nil {
+		return 0, err
+	}
+
+	return conn.UDPConn.Write(data)
+}
+
+// lookupGuardConn is the guard of the tcp connections, where the messages start with their length
+type lookupGuardConn struct {
+	net.Conn
+	guard *lookupGuard
+}
+
+func (conn *lookupGuardConn) Write(data []byte) (int, error) {
+	if len(data) < 2 {
+		return conn.Conn.Write(data)
+	}
+
+	if err := conn.guard.check(data[2:]); err != nil {
+		return 0, err
+	}
+
+	return conn.Conn.Write(data)
+}
+
+// checkLocalLookup applies the policy to the query of the name and writes it to the audit log, the name can have
+// the search domain of the resolver after the host
+func checkLocalLookup(name string, allowedHost string, network string, server string) error {
+	reason := ""
+	policy := configuration.NetworkPolicy
+
+	if strings.HasSuffix(name, ".onion") || strings.Contains(name, ".onion.") {
+		reason = "onion service lookup"
+	} else if policy != nil && policy.Mode != "" && !isLookupAllowed(name, allowedHost) {
+		reason = "local dns lookup"
+	}
+
+	networkAudit.Lock()
+	defer networkAudit.Unlock()
+
+	networkAudit.lookups++
+
+	if reason != "" {
+		networkAudit.blocked++
+	}
+
+	if networkAudit.file != nil {
+		writeNetworkAuditEntry(&NetworkAuditEntry{
+			Type:        "dns",
+			Time:        time.Now().UTC(),
+			Transport:   networkTransportDNS,
+			Network:     network,
+			Destination: server,
+			Host:        name,
+			Allowed:     reason == "",
+			Reason:      reason,
+		})
+	}
+
+	if reason != "" {
+		return errors.New("dns lookup blocked by network policy, hostnames must be resolved by the Tor proxy: " + name)
+	}
+
+	return nil
+}
+
+func isLookupAllowed(name string, allowedHost string) bool {
+	if name == "" {
+		return false
+	}
+
+	for _, host := range append([]string{allowedHost, "localhost"}, configuration.NetworkPolicy.AllowedHosts...) {
+		host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+		if host != "" && (name == host || strings.HasPrefix(name, host+".")) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSOCKSProxy accepts the socks5 requests and records their destinations, every request fails after it is read
+type fakeSOCKSProxy struct {
+	listener     net.Listener
+	mutex        sync.Mutex
+	destinations []string
+	addressTypes []byte
+}
+
+func newFakeSOCKSProxy(t *testing.T) *fakeSOCKSProxy {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := &fakeSOCKSProxy{listener: listener}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			go proxy.serve(conn)
+		}
+	}()
+
+	return proxy
+}
+
+func (proxy *fakeSOCKSProxy) serve(conn net.Conn) {
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// greeting: version, number of methods and the methods, the reply selects no authentication
+	header := make([]byte, 2)
+
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return
+	}
+
+	if _, err := io.ReadFull(conn, make([]byte, header[1])); err != nil {
+		return
+	}
+
+	conn.Write([]byte{5, 0})
+
+	// request: version, command, reserved and the address type
+	request := make([]byte, 4)
+
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return
+	}
+
+	var host string
+
+	switch request[3] {
+	case 1, 4:
+		ip := make([]byte, map[byte]int{1: 4, 4: 16}[request[3]])
+
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return
+		}
+
+		host = net.IP(ip).String()
+	case 3:
+		length := make([]byte, 1)
+
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return
+		}
+
+		name := make([]byte, length[0])
+
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return
+		}
+
+		host = string(name)
+	default:
+		return
+	}
+
+	port := make([]byte, 2)
+
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return
+	}
+
+	proxy.mutex.Lock()
+	proxy.destinations = append(proxy.destinations, net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+	proxy.addressTypes = append(proxy.addressTypes, request[3])
+	proxy.mutex.Unlock()
+
+	// general failure, the test only needs the request
+	conn.Write([]byte{5, 1, 0, 1, 0, 0, 0, 0, 0, 0})
+}
+
+// TestTorDialerSkipsLocalResolver sends the url of every site of config.json, and of clearnet sites, through the dialer of the Tor proxy
+// with a local resolver that fails, the hostnames must reach the proxy without any local lookup (socks5h)
+func TestTorDialerSkipsLocalResolver(t *testing.T) {
+	content, err := ioutil.ReadFile("config.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configuration, err = parseConfiguration(content)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(configuration.Sites) == 0 {
+		t.Fatal("config.json has no sites")
+	}
+
+	proxy := newFakeSOCKSProxy(t)
+	defer proxy.listener.Close()
+
+	previousProxyAddress := torProxyAddress
+	previousResolver := net.DefaultResolver
+
+	defer func() {
+		torProxyAddress = previousProxyAddress
+		net.DefaultResolver = previousResolver
+		setupTorDialer()
+	}()
+
+	torProxyAddress = proxy.listener.Addr().String()
+
+	if err := setupTorDialer(); err != nil {
+		t.Fatal(err)
+	}
+
+	var resolverMutex sync.Mutex
+	resolverCalls := []string{}
+
+	net.DefaultResolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			resolverMutex.Lock()
+			resolverCalls = append(resolverCalls, address)
+			resolverMutex.Unlock()
+
+			return nil, errors.New("local resolver called")
+		},
+	}
+
+	dial := getTorDialContext(5 * time.Second)
+	expectedDestinations := []string{}
+
+	// the resolver of go never looks up the onion services, the clearnet urls check the lookups of the other hosts
+	siteURLs := []string{"http://example.com", "https://check.torproject.org:8443/path"}
+
+	for _, site := range configuration.Sites {
+		siteURLs = append(siteURLs, site.URL)
+	}
+
+	for _, rawURL := range siteURLs {
+		siteURL, err := url.Parse(rawURL)
+
+		if err != nil {
+			t.Fatal(rawURL, err)
+		}
+
+		port := siteURL.Port()
+
+		if port == "" {
+			port = map[string]string{"http": "80", "https": "443"}[siteURL.Scheme]
+		}
+
+		address := net.JoinHostPort(siteURL.Hostname(), port)
+		expectedDestinations = append(expectedDestinations, address)
+
+		if conn, err := dial(context.Background(), "tcp", address); err == nil {
+			conn.Close()
+			t.Fatal("the fake proxy connected:", address)
+		}
+	}
+
+	resolverMutex.Lock()
+	defer resolverMutex.Unlock()
+
+	if len(resolverCalls) > 0 {
+		t.Fatalf("the local resolver was called %d times: %v", len(resolverCalls), resolverCalls)
+	}
+
+	proxy.mutex.Lock()
+	defer proxy.mutex.Unlock()
+
+	if len(proxy.destinations) != len(expectedDestinations) {
+		t.Fatalf("the proxy got %d requests, expected %d", len(proxy.destinations), len(expectedDestinations))
+	}
+
+	for index, destination := range proxy.destinations {
+		if destination != expectedDestinations[index] {
+			t.Errorf("the proxy got %s, expected %s", destination, expectedDestinations[index])
+		}
+
+		if net.ParseIP(getURLHostname(expectedDestinations[index])) == nil && proxy.addressTypes[index] != 3 {
+			t.Errorf("%s was sent to the proxy resolved (address type %d)", destination, proxy.addressTypes[index])
+		}
+	}
+}
+
+// TestLocalResolverBlocksOnionLookups checks that the guard of the local resolver blocks the onion services without
+// a network policy
+func TestLocalResolverBlocksOnionLookups(t *testing.T) {
+	configuration = &ConfigurationFile{}
+
+	if err := checkLocalLookup("mobil7rab6nuf7vx.onion", "", "udp", "127.0.0.53:53"); err == nil {
+		t.Error("the onion service lookup was not blocked")
+	}
+
+	if err := checkLocalLookup("example.com", "", "udp", "127.0.0.53:53"); err != nil {
+		t.Error("the lookup without a policy was blocked:", err)
+	}
+}
+
+func getURLHostname(address string) string {
+	host, _, _ := net.SplitHostPort(address)
+	return host
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	notificationTypeWebhook  = "webhook"
+	notificationTypeTelegram = "telegram"
+	notificationTypeEmail    = "email"
+
+	notificationEventCrawlCompleted = "crawl_completed"
+	notificationEventSiteFailed     = "site_failed"
+	notificationEventKeywordFound   = "keyword_found"
+	notificationEventErrorAlert     = "error_alert"
+)
+
+const defaultNotificationTemplate = `[go-tor-crawler] {{.Event}}{{if .Site}} - {{.Site}}{{end}}: {{.Message}}`
+
+type NotificationConfig struct {
+	Type     string   `json:"type"`
+	Events   []string `json:"events"`
+	Template string   `json:"template"`
+	ViaTor   bool     `json:"via_tor"`
+
+	// webhook
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// telegram
+	BotToken string `json:"bot_token"`
+	ChatID   string `json:"chat_id"`
+
+	// email
+	SMTPHost string   `json:"smtp_host"`
+	SMTPPort int      `json:"smtp_port"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+}
+
+type NotificationData struct {
+	Event   string                 `json:"event"`
+	Site    string                 `json:"site,omitempty"`
+	Message string                 `json:"message"`
+	Time    time.Time              `json:"time"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+}
+
+func notify(event string, site *Site, message string, data map[string]interface{}) {
+	notificationData := &NotificationData{
+		Event:   event,
+		Message: message,
+		Time:    time.Now().UTC(),
+		Data:    data,
+	}
+
+	if site != nil {
+		notificationData.Site = site.URL
+	}
+
+	for _, notification := range configuration.Notifications {
+		if !isNotificationEventEnabled(notification, event) {
+			continue
+		}
+
+		err := sendNotification(notification, notificationData)
+
+		if err != nil {
+			printError("Unable to send notification:", notification.Type, err)
+		}
+	}
+}
+
+func isNotificationEventEnabled(notification *NotificationConfig, event string) bool {
+	// without events every event is sent
+	if len(notification.Events) == 0 {
+		return true
+	}
+
+	for _, notificationEvent := range notification.Events {
+		if notificationEvent == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// notifySiteFailure counts the consecutive failures of a site and notifies when the threshold is reached
+func notifySiteFailure(site *Site, err error) {
+	site.FailureCount++
+
+	threshold := configuration.NotificationFailureThreshold
+
+	if threshold <= 0 {
+		threshold = 1
+	}
+
+	if site.FailureCount != threshold {
+		return
+	}
+
+	message := fmt.Sprintf("site failed %d times in a row", site.FailureCount)
+
+	if err != nil {
+		message += ": " + err.Error()
+	}
+
+	notify(notificationEventSiteFailed, site, message, map[string]interface{}{"failure_count": site.FailureCount})
+}
+
+// notifyKeywordsFound notifies the configured keywords found in the page text
+func notifyKeywordsFound(site *Site, doc *goquery.Document) {
+	if len(configuration.NotificationKeywords) == 0 {
+		return
+	}
+
+	text := strings.ToLower(getTagContentFromDocument(doc, "body"))
+	keywords := []string{}
+
+	for _, keyword := range configuration.NotificationKeywords {
+		if strings.Contains(text, strings.ToLower(keyword)) {
+			keywords = append(keywords, keyword)
+		}
+	}
+
+	if len(keywords) == 0 {
+		return
+	}
+
+	message := "keywords found: " + strings.Join(keywords, ", ")
+	notify(notificationEventKeywordFound, site, message, map[string]interface{}{"keywords": keywords})
+}
+
+func sendNotification(notification *NotificationConfig, data *NotificationData) error {
+	text, err := getNotificationText(notification, data)
+
+	if err != nil {
+		return err
+	}
+
+	switch notification.Type {
+	case notificationTypeWebhook:
+		return sendWebhookNotification(notification, data, text)
+	case notificationTypeTelegram:
+		return sendTelegramNotification(notification, text)
+	case notificationTypeEmail:
+		return sendEmailNotification(notification, data, text)
+	}
+
+	return errors.New("unknown notification type: " + notification.Type)
+}
+
+// getNotificationText executes the template of the notification with its data. The ${NAME} variables of the
+// template are replaced by calls to a function with their values, so a value like a site title is never parsed as
+// template
+func getNotificationText(notification *NotificationConfig, data *NotificationData) (string, error) {
+	templateText := notification.Template
+
+	if templateText == "" {
+		templateText = defaultNotificationTemplate
+	}
+
+	templateText = variablePattern.ReplaceAllString(templateText, `{{variable "$1"}}`)
+
+	functions := template.FuncMap{
+		"variable": func(name string) string {
+			if value, exists := getVariable(name, data.Site, true); exists {
+				return value
+			}
+
+			return "${" + name + "}"
+		},
+	}
+
+	notificationTemplate, err := template.New("notification").Funcs(functions).Parse(templateText)
+
+	if err != nil {
+		return "", err
+	}
+
+	var buffer bytes.Buffer
+	err = notificationTemplate.Execute(&buffer, data)
+
+	if err != nil {
+		return "", err
+	}
+
+	return buffer.String(), nil
+}
+
+func getNotificationClient(notification *NotificationConfig) *http.Client {
+	if notification.ViaTor && torDialer != nil {
+		return newTorHTTPClient()
+	}
+
+	return &http.Client{Timeout: timeout, Transport: &http.Transport{DialContext: getDirectDialContext(timeout)}}
+}
+
+// getNotificationDialContext returns the dialer of the connections of the notification, through tor with "via_tor"
+// and direct otherwise, both checked by the network policy
+func getNotificationDialContext(notification *NotificationConfig) func(ctx context.Context, network string, address string) (net.Conn, error) {
+	if notification.ViaTor && torDialer != nil {
+		return getTorDialContext(timeout)
+	}
+
+	return getDirectDialContext(timeout)
+}
+
+func sendWebhookNotification(notification *NotificationConfig, data *NotificationData, text string) error {
+	var payload []byte
+	contentType := "application/json"
+
+	// without template the notification data is sent as json
+	if notification.Template == "" {
+		dataJSON, err := json.Marshal(data)
+
+		if err != nil {
+			return err
+		}
+
+		payload = dataJSON
+	} else {
+		payload = []byte(text)
+
+		if !json.Valid(payload) {
+			contentType = "text/plain; charset=utf-8"
+		}
+	}
+
+	request, err := http.NewRequest(http.MethodPost, expandVariables(notification.URL, data.Site), bytes.NewReader(payload))
+
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", contentType)
+
+	for name, value := range notification.Headers {
+		request.Header.Set(name, expandVariables(value, data.Site))
+	}
+
+	response, err := getNotificationClient(notification).Do(request)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		return errors.New("webhook returned " + response.Status)
+	}
+
+	return nil
+}
+
+func sendTelegramNotification(notification *NotificationConfig, text string) error {
+	apiURL := "https://api.telegram.org/bot" + expandVariables(notification.BotToken, "") + "/sendMessage"
+	values := url.Values{"chat_id": {notification.ChatID}, "text": {text}}
+
+	response, err := getNotificationClient(notification).PostForm(apiURL, values)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		return errors.New("telegram returned " + response.Status)
+	}
+
+	return nil
+}
+
+func sendEmailNotification(notification *NotificationConfig, data *NotificationData, text string) error {
+	port := notification.SMTPPort
+
+	if port == 0 {
+		port = 587
+	}
+
+	var auth smtp.Auth
+
+	if notification.Username != "" {
+		auth = smtp.PlainAuth("", notification.Username, expandVariables(notification.Password, ""), notification.SMTPHost)
+	}
+
+	subject := "[go-tor-crawler] " + data.Event
+
+	if data.Site != "" {
+		subject += " - " + data.Site
+	}
+
+	message := "From: " + notification.From + "\r\n" +
+		"To: " + strings.Join(notification.To, ", ") + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" + text + "\r\n"
+
+	address := net.JoinHostPort(notification.SMTPHost, strconv.Itoa(port))
+
+	return sendSMTPMail(notification, address, auth, []byte(message))
+}
+
+// sendSMTPMail sends the message like smtp.SendMail, on a connection of the dialer of the notification
+func sendSMTPMail(notification *NotificationConfig, address string, auth smtp.Auth, message []byte) error {
+	conn, err := getNotificationDialContext(notification)(context.Background(), "tcp", address)
+
+	if err != nil {
+		return err
+	}
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	client, err := smtp.NewClient(conn, notification.SMTPHost)
+
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: notification.SMTPHost}); err != nil {
+			return err
+		}
+	}
+
+	if auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("smtp server doesn't support AUTH")
+		}
+
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(notification.From); err != nil {
+		return err
+	}
+
+	for _, to := range notification.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	writer, err := client.Data()
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := writer.Write(message); err != nil {
+		return err
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/sha3"
+)
+
+const onionDescriptorFileName = "onion-descriptor.txt"
+
+// OnionService is the metadata of the onion address of the site, with the fields of the outer layer of its
+// descriptor when it was read from the tor control port
+type OnionService struct {
+	Version         int        `json:"version"`
+	PublicKey       string     `json:"public_key,omitempty"`
+	ValidChecksum   bool       `json:"valid_checksum,omitempty"`
+	Lifetime        int        `json:"descriptor_lifetime,omitempty"`
+	RevisionCounter int64      `json:"revision_counter,omitempty"`
+	DescriptorTime  *time.Time `json:"descriptor_time,omitempty"`
+}
+
+// getOnionService decodes the onion address of the url, the v3 addresses have the public key of the service,
+// a checksum and the version
+func getOnionService(siteURL string) *OnionService {
+	parsedURL, err := url.Parse(siteURL)
+
+	if err != nil || !strings.HasSuffix(parsedURL.Hostname(), ".onion") {
+		return nil
+	}
+
+	labels := strings.Split(strings.TrimSuffix(parsedURL.Hostname(), ".onion"), ".")
+	address := strings.ToUpper(labels[len(labels)-1])
+
+	switch len(address) {
+	case 16:
+		return &OnionService{Version: 2}
+	case 56:
+		data, err := base32.StdEncoding.DecodeString(address)
+
+		if err != nil {
+			return nil
+		}
+
+		publicKey := data[:32]
+		checksum := data[32:34]
+		version := data[34]
+
+		hash := sha3.Sum256(append(append([]byte(".onion checksum"), publicKey...), version))
+
+		return &OnionService{
+			Version:       int(version),
+			PublicKey:     hex.EncodeToString(publicKey),
+			ValidChecksum: bytes.Equal(hash[:2], checksum),
+		}
+	}
+
+	return nil
+}
+
+// updateSiteOnionService saves the onion service metadata of the site and, with the tor control port, the
+// descriptor that tor used to connect to it
+func updateSiteOnionService(site *Site, siteDir string) {
+	service := getOnionService(site.URL)
+
+	if service == nil {
+		return
+	}
+
+	if configuration.TorControl != nil && service.Version == 3 {
+		descriptor, err := getOnionServiceDescriptor(site.URL)
+
+		if err != nil {
+			printError("Unable to get onion service descriptor:", err)
+		} else {
+			err = writeFile(siteDir+string(filepath.Separator)+onionDescriptorFileName, []byte(descriptor), fileMode)
+
+			if err != nil {
+				printError("Unable to save onion service descriptor:", err)
+			}
+
+			setOnionDescriptorFields(service, descriptor)
+		}
+	}
+
+	site.OnionService = service
+}
+
+// getOnionServiceDescriptor returns the descriptor of the service from the tor cache, it is there after the
+// site was fetched
+func getOnionServiceDescriptor(siteURL string) (string, error) {
+	parsedURL, err := url.Parse(siteURL)
+
+	if err != nil {
+		return "", err
+	}
+
+	labels := strings.Split(strings.TrimSuffix(parsedURL.Hostname(), ".onion"), ".")
+	replies, err := sendTorControlCommands(configuration.TorControl, "GETINFO hs/client/desc/id/"+labels[len(labels)-1])
+
+	if err != nil {
+		return "", err
+	}
+
+	lines := replies[0]
+
+	// the first line is the key of the value and the last one is the end of the reply
+	if len(lines) < 3 {
+		return "", errors.New("empty onion service descriptor")
+	}
+
+	return strings.Join(lines[1:len(lines)-1], "\n") + "\n", nil
+}
+
+func setOnionDescriptorFields(service *OnionService, descriptor string) {
+	for _, line := range strings.Split(descriptor, "\n") {
+		fields := strings.Fields(line)
+
+		if len(fields) != 2 {
+			continue
+		}
+
+		switch fields[0] {
+		case "descriptor-lifetime":
+			service.Lifetime, _ = strconv.Atoi(fields[1])
+		case "revision-counter":
+			service.RevisionCounter, _ = strconv.ParseInt(fields[1], 10, 64)
+		}
+	}
+
+	now := time.Now().UTC()
+	service.DescriptorTime = &now
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// output levels of the crawl messages, set by the -quiet and -verbose flags
+const (
+	outputLevelQuiet   = 0
+	outputLevelNormal  = 1
+	outputLevelVerbose = 2
+)
+
+const outputTimeLayout = "2006-01-02 15:04:05"
+
+const (
+	colorReset = "\033[0m"
+	colorRed   = "\033[31m"
+	colorGreen = "\033[32m"
+	colorGray  = "\033[90m"
+)
+
+var (
+	outputLevel = outputLevelNormal
+	noColor     = os.Getenv("NO_COLOR") != ""
+
+	// the messages are written to stderr when the events are written to stdout, so stdout only has the events
+	messagesToStderr bool
+)
+
+// printError prints an error message to stderr, the errors are printed in every output level
+func printError(values ...interface{}) {
+	printMessage(getErrorOutput(), "ERROR", colorRed, values...)
+}
+
+// printInfo prints the progress of the crawl, hidden by -quiet
+func printInfo(values ...interface{}) {
+	if outputLevel >= outputLevelNormal {
+		printMessage(getMessageOutput(), "INFO", "", values...)
+	}
+}
+
+// printSuccess is the printInfo of the final result of the crawl
+func printSuccess(values ...interface{}) {
+	if outputLevel >= outputLevelNormal {
+		printMessage(getMessageOutput(), "INFO", colorGreen, values...)
+	}
+}
+
+// printVerbose prints the detail of each request, only shown by -verbose
+func printVerbose(values ...interface{}) {
+	if outputLevel >= outputLevelVerbose {
+		printMessage(getMessageOutput(), "DEBUG", colorGray, values...)
+	}
+}
+
+// printMessage prints a message in one line with its time and level, so the crawl logs can be filtered by level.
+// The messages are written to the current stdout, that is replaced by the tui, or to stderr
+func printMessage(output *os.File, level string, color string, values ...interface{}) {
+	message := strings.TrimSuffix(fmt.Sprintln(values...), "\n")
+	prefix := fmt.Sprintf("%-5s", level)
+
+	if color != "" && isColorEnabled(output) {
+		prefix = color + prefix + colorReset
+	}
+
+	fmt.Fprintln(output, time.Now().Format(outputTimeLayout)+" "+prefix+" "+message)
+}
+
+func getMessageOutput() *os.File {
+	if messagesToStderr {
+		return os.Stderr
+	}
+
+	return os.Stdout
+}
+
+// getErrorOutput returns stderr for the errors, or the stdout of the tui while it shows the crawl output
+func getErrorOutput() *os.File {
+	if tuiProgram != nil {
+		return os.Stdout
+	}
+
+	return os.Stderr
+}
+
+// isColorEnabled returns if the levels written to the output are colored, only in terminals and without -no-color
+// or NO_COLOR
+func isColorEnabled(output *os.File) bool {
+	if noColor {
+		return false
+	}
+
+	info, err := output.Stat()
+
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// setupOutput sets the output level of the flags, -quiet wins over -verbose
+func setupOutput(quiet bool, verbose bool, disableColor bool) {
+	if verbose {
+		outputLevel = outputLevelVerbose
+	}
+
+	if quiet {
+		outputLevel = outputLevelQuiet
+	}
+
+	if disableColor {
+		noColor = true
+	}
+}
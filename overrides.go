@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+const environmentPrefix = "GO_TOR_CRAWLER_"
+
+type configurationOverride struct {
+	Path     string
+	Value    string
+	Source   string
+	original reflect.Value
+}
+
+// settingsFlag collects the repeated --set flags
+type settingsFlag []string
+
+var (
+	configurationSettings  settingsFlag
+	configurationOverrides []*configurationOverride
+)
+
+func (settings *settingsFlag) String() string {
+	return strings.Join(*settings, ", ")
+}
+
+func (settings *settingsFlag) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return errors.New("setting must be in the format path=value")
+	}
+
+	*settings = append(*settings, value)
+
+	return nil
+}
+
+// applyConfigurationOverrides changes the configuration with the environment variables and then with the --set
+// flags, the overridden values are not saved to the configuration file
+func applyConfigurationOverrides() error {
+	overrides := []*configurationOverride{}
+
+	for _, path := range getConfigurationPaths(reflect.TypeOf(ConfigurationFile{}), "") {
+		name := environmentPrefix + strings.ToUpper(strings.Replace(path, ".", "_", -1))
+
+		if value, exists := os.LookupEnv(name); exists {
+			overrides = append(overrides, &configurationOverride{Path: path, Value: value, Source: name})
+		}
+	}
+
+	for _, setting := range configurationSettings {
+		parts := strings.SplitN(setting, "=", 2)
+		overrides = append(overrides, &configurationOverride{Path: strings.TrimSpace(parts[0]), Value: parts[1], Source: "--set " + setting})
+	}
+
+	for _, override := range overrides {
+		// the file value of the setting, or of its parent setting, is restored on save
+		topLevelPath := strings.Split(override.Path, ".")[0]
+
+		if !isConfigurationPathOverridden(topLevelPath) {
+			field, err := getConfigurationField(configuration, topLevelPath)
+
+			if err != nil {
+				return errors.New(override.Source + ": " + err.Error())
+			}
+
+			override.original = reflect.New(field.Type()).Elem()
+			override.original.Set(field)
+			configurationOverrides = append(configurationOverrides, override)
+		}
+
+		field, err := getConfigurationField(configuration, override.Path)
+
+		if err != nil {
+			return errors.New(override.Source + ": " + err.Error())
+		}
+
+		err = setConfigurationFieldValue(field, override.Value)
+
+		if err != nil {
+			return errors.New(override.Source + ": " + err.Error())
+		}
+	}
+
+	return nil
+}
+
+// overrideConfigurationSetting sets the setting, the file value of its top level setting is kept to be restored on
+// save
+func overrideConfigurationSetting(path string, value string, source string) error {
+	topLevelPath := strings.Split(path, ".")[0]
+
+	if !isConfigurationPathOverridden(topLevelPath) {
+		field, err := getConfigurationField(configuration, topLevelPath)
+
+		if err != nil {
+			return err
+		}
+
+		original := reflect.New(field.Type()).Elem()
+		original.Set(field)
+		configurationOverrides = append(configurationOverrides, &configurationOverride{Path: path, Value: value, Source: source, original: original})
+	}
+
+	field, err := getConfigurationField(configuration, path)
+
+	if err != nil {
+		return err
+	}
+
+	return setConfigurationFieldValue(field, value)
+}
+
+func isConfigurationPathOverridden(topLevelPath string) bool {
+	for _, override := range configurationOverrides {
+		if strings.Split(override.Path, ".")[0] == topLevelPath {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getConfigurationPaths returns the json paths of the settings, like "timeouts.dial_seconds", the sites are state
+// and can't be overridden
+func getConfigurationPaths(structType reflect.Type, prefix string) []string {
+	result := []string{}
+
+	for index := 0; index < structType.NumField(); index++ {
+		field := structType.Field(index)
+		name := getJSONFieldName(field)
+
+		if name == "" || name == "sites" {
+			continue
+		}
+
+		fieldType := field.Type
+
+		if fieldType.Kind() == reflect.Ptr && fieldType.Elem().Kind() == reflect.Struct {
+			result = append(result, getConfigurationPaths(fieldType.Elem(), prefix+name+".")...)
+			continue
+		}
+
+		result = append(result, prefix+name)
+	}
+
+	return result
+}
+
+func getJSONFieldName(field reflect.StructField) string {
+	tag := strings.Split(field.Tag.Get("json"), ",")[0]
+
+	if tag == "-" || field.PkgPath != "" {
+		return ""
+	}
+
+	if tag == "" {
+		return field.Name
+	}
+
+	return tag
+}
+
+// getConfigurationField returns the configuration field of the path, creating the parent settings that are not
+// in the file, parent settings are copied so the file values can be restored on save
+func getConfigurationField(config *ConfigurationFile, path string) (reflect.Value, error) {
+	value := reflect.ValueOf(config).Elem()
+	names := strings.Split(path, ".")
+
+	for index, name := range names {
+		found := false
+
+		for fieldIndex := 0; fieldIndex < value.NumField(); fieldIndex++ {
+			if getJSONFieldName(value.Type().Field(fieldIndex)) == name && name != "sites" {
+				value = value.Field(fieldIndex)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return reflect.Value{}, errors.New("unknown setting: " + path)
+		}
+
+		if index == len(names)-1 {
+			return value, nil
+		}
+
+		if value.Kind() != reflect.Ptr || value.Type().Elem().Kind() != reflect.Struct {
+			return reflect.Value{}, errors.New("unknown setting: " + path)
+		}
+
+		parent := reflect.New(value.Type().Elem())
+
+		if !value.IsNil() {
+			parent.Elem().Set(value.Elem())
+		}
+
+		value.Set(parent)
+		value = parent.Elem()
+	}
+
+	return reflect.Value{}, errors.New("unknown setting: " + path)
+}
+
+// setConfigurationFieldValue sets strings as they are, lists of strings can be comma separated and the other
+// values are json
+func setConfigurationFieldValue(field reflect.Value, value string) error {
+	if field.Kind() == reflect.String {
+		field.SetString(value)
+		return nil
+	}
+
+	if field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String && !strings.HasPrefix(strings.TrimSpace(value), "[") {
+		values := []string{}
+
+		for _, item := range strings.Split(value, ",") {
+			if strings.TrimSpace(item) != "" {
+				values = append(values, strings.TrimSpace(item))
+			}
+		}
+
+		field.Set(reflect.ValueOf(values))
+		return nil
+	}
+
+	newValue := reflect.New(field.Type())
+	err := json.Unmarshal([]byte(value), newValue.Interface())
+
+	if err != nil {
+		return fmt.Errorf("invalid value %q: %v", value, err)
+	}
+
+	field.Set(newValue.Elem())
+
+	return nil
+}
+
+// getConfigurationToSave returns a copy of the configuration with the file values of the overridden settings, the
+// overridden parent settings are always copied before changed so the file values are not changed
+func getConfigurationToSave() *ConfigurationFile {
+	if len(configurationOverrides) == 0 {
+		return configuration
+	}
+
+	result := *configuration
+
+	for _, override := range configurationOverrides {
+		field, err := getConfigurationField(&result, strings.Split(override.Path, ".")[0])
+
+		if err == nil {
+			field.Set(override.original)
+		}
+	}
+
+	return &result
+}
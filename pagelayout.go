@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	pageLayoutFlat   = "flat"
+	pageLayoutMirror = "mirror"
+)
+
+const pagesIndexFileName = "pages.json"
+
+// the max length of a path segment, most file systems limit a name to 255 bytes
+const maxPageSegmentLength = 100
+
+var unsafePageSegmentPattern = regexp.MustCompile(`[^A-Za-z0-9._~-]+`)
+
+func isPageLayoutMirror() bool {
+	return configuration != nil && configuration.PageLayout == pageLayoutMirror
+}
+
+// getPageMirrorFileName returns the file of the page under the dirs of its url path, like wget -m: "/forum/topic"
+// is saved to "forum/topic.html" and "/forum/" to "forum/index.html". The query is added to the name and the
+// pages that are not html files get the html extension
+func getPageMirrorFileName(pageURL string) string {
+	parsedURL, err := url.Parse(pageURL)
+
+	if err != nil {
+		return getPageFileNameFromURL(pageURL)
+	}
+
+	segments := []string{}
+
+	for _, segment := range strings.Split(parsedURL.Path, "/") {
+		if segment = getPageSegment(segment); segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+
+	name := "index"
+
+	if len(segments) > 0 && !strings.HasSuffix(parsedURL.Path, "/") {
+		name = segments[len(segments)-1]
+		segments = segments[:len(segments)-1]
+	}
+
+	name = strings.TrimSuffix(name, ".html")
+
+	if parsedURL.RawQuery != "" {
+		name += "-" + getPageSegment(parsedURL.RawQuery)
+	}
+
+	if configuration.Deterministic {
+		name += "-" + getContentHash([]byte(normalizeURL(pageURL)))[:12]
+	}
+
+	return path.Join(append(segments, name+".html")...)
+}
+
+// getPageSegment returns the segment of the url path with only the characters that are safe in file names
+func getPageSegment(segment string) string {
+	segment = strings.Trim(unsafePageSegmentPattern.ReplaceAllString(segment, "-"), "-")
+
+	if len(segment) > maxPageSegmentLength {
+		segment = segment[:maxPageSegmentLength]
+	}
+
+	// the dot dirs would leave the pages dir
+	if strings.Trim(segment, ".") == "" {
+		return ""
+	}
+
+	return segment
+}
+
+// savePagesIndex saves the files of the archived pages by their url
+func savePagesIndex(site *Site, siteDir string) error {
+	index := map[string]string{}
+
+	if site.FetchSuccess {
+		index[site.URL] = "index.html"
+	}
+
+	for _, page := range site.Pages {
+		if page.FetchSuccess {
+			index[page.URL] = page.FileName
+		}
+	}
+
+	content, err := json.MarshalIndent(index, "", "\t")
+
+	if err != nil {
+		return err
+	}
+
+	return writeFile(filepath.Join(siteDir, pagesIndexFileName), content, fileMode)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strconv"
+)
+
+const (
+	defaultFileMode       os.FileMode = 0644
+	defaultDirMode        os.FileMode = 0755
+	groupReadableFileMode os.FileMode = 0640
+	groupReadableDirMode  os.FileMode = 0750
+)
+
+// the configuration file and its checkpoint are only readable by their owner, the configuration has the tokens and
+// passwords of the notifications, publishers and storage
+const configurationFileMode os.FileMode = 0600
+
+// PermissionsConfig sets the modes of the archive files and directories as octal strings, like "0640". The modes
+// are masked by the umask of the process like the modes of any created file, and "group_readable" makes the
+// archive readable by the group without access for the other users
+type PermissionsConfig struct {
+	FileMode      string `json:"file_mode,omitempty"`
+	DirMode       string `json:"dir_mode,omitempty"`
+	GroupReadable bool   `json:"group_readable,omitempty"`
+}
+
+// applyPermissions sets the modes of the created files and directories by the configuration
+func applyPermissions() error {
+	fileMode = defaultFileMode
+	dirMode = defaultDirMode
+
+	config := configuration.Permissions
+
+	if config == nil {
+		return nil
+	}
+
+	if config.GroupReadable {
+		fileMode = groupReadableFileMode
+		dirMode = groupReadableDirMode
+	}
+
+	var err error
+
+	if config.FileMode != "" {
+		fileMode, err = parseFileMode(config.FileMode)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if config.DirMode != "" {
+		dirMode, err = parseFileMode(config.DirMode)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func parseFileMode(value string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(value, 8, 32)
+
+	if err != nil || mode > 0777 {
+		return 0, errors.New("invalid mode: " + value)
+	}
+
+	return os.FileMode(mode), nil
+}
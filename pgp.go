@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/PuerkitoBio/goquery"
+)
+
+const pgpKeysDirName = "pgp"
+
+// paths where the sites usually publish their keys
+var pgpKeyPaths = []string{"/pgp.txt", "/pgp.asc", "/pgp", "/key.asc", "/publickey.asc"}
+
+var pgpKeyBlockRegexp = regexp.MustCompile(`(?s)-----BEGIN PGP PUBLIC KEY BLOCK-----.*?-----END PGP PUBLIC KEY BLOCK-----`)
+var pgpKeyLinkRegexp = regexp.MustCompile(`(?i)(\.asc$|pgp|gpg|public[-_]?key)`)
+
+// the key links fetched by site, the pages with many links that look like keys don't make a fetch for each one
+const maxPGPKeyLinks = 10
+
+type PGPKey struct {
+	Fingerprint string    `json:"fingerprint"`
+	KeyID       string    `json:"key_id"`
+	UserIDs     []string  `json:"user_ids,omitempty"`
+	Created     time.Time `json:"created"`
+	Sources     []string  `json:"sources"`
+}
+
+// getPGPKeyBlocksFromHTML returns the armored keys in the text of the page, the text is used since the keys are
+// usually in pre elements with escaped characters
+func getPGPKeyBlocksFromHTML(content []byte) []string {
+	doc, err := parseHTML(content)
+
+	if err != nil {
+		return nil
+	}
+
+	return getPGPKeyBlocksFromDocument(doc)
+}
+
+func getPGPKeyBlocksFromDocument(doc *goquery.Document) []string {
+	return pgpKeyBlockRegexp.FindAllString(doc.Text(), -1)
+}
+
+// getPGPKeyURLs returns the well-known key urls of the site and the links to keys found in its pages
+func getPGPKeyURLs(site *Site, links []*Link) []string {
+	result := []string{}
+	seen := map[string]bool{}
+
+	add := func(keyURL string) {
+		if !seen[normalizeURL(keyURL)] {
+			seen[normalizeURL(keyURL)] = true
+			result = append(result, keyURL)
+		}
+	}
+
+	siteURL, err := url.Parse(site.URL)
+
+	if err != nil {
+		return result
+	}
+
+	for _, path := range pgpKeyPaths {
+		add(siteURL.ResolveReference(&url.URL{Path: path}).String())
+	}
+
+	keyLinks := 0
+
+	for _, link := range links {
+		if keyLinks >= maxPGPKeyLinks {
+			break
+		}
+
+		linkURL, err := url.Parse(link.URL)
+
+		if err != nil || !isURLInScope(site, siteURL, link.URL) {
+			continue
+		}
+
+		if pgpKeyLinkRegexp.MatchString(linkURL.Path) && !seen[normalizeURL(link.URL)] {
+			add(link.URL)
+			keyLinks++
+		}
+	}
+
+	return result
+}
+
+// updateSitePGPKeys collects the keys published in the pages of the site, in the well-known key paths and in the
+// key links, saving each key by its fingerprint
+func updateSitePGPKeys(site *Site, siteDir string, seedDoc *goquery.Document, links []*Link, fetcher Fetcher) {
+	blocks := map[string][]string{}
+
+	for _, block := range getPGPKeyBlocksFromDocument(seedDoc) {
+		blocks[block] = append(blocks[block], site.URL)
+	}
+
+	for _, page := range site.Pages {
+		if !page.FetchSuccess {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(siteDir + string(filepath.Separator) + filepath.FromSlash(page.FileName))
+
+		if err != nil {
+			continue
+		}
+
+		for _, block := range getPGPKeyBlocksFromHTML(content) {
+			blocks[block] = append(blocks[block], page.URL)
+		}
+	}
+
+	for _, keyURL := range getPGPKeyURLs(site, links) {
+		content, _, err := fetchPage(fetcher, keyURL)
+
+		if err != nil {
+			continue
+		}
+
+		keyBlocks := pgpKeyBlockRegexp.FindAllString(string(content), -1)
+
+		// the key links can be html pages with the key
+		if len(keyBlocks) == 0 {
+			keyBlocks = getPGPKeyBlocksFromHTML(content)
+		}
+
+		for _, block := range keyBlocks {
+			blocks[block] = append(blocks[block], keyURL)
+		}
+	}
+
+	for block, sources := range blocks {
+		entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(block))
+
+		if err != nil {
+			printError("Unable to read site PGP key:", err)
+			continue
+		}
+
+		for _, entity := range entities {
+			key := getPGPKey(entity)
+			err = savePGPKey(siteDir, key, block)
+
+			if err != nil {
+				printError("Unable to save site PGP key:", err)
+				exitCrawl(exitCodeError)
+			}
+
+			addSitePGPKey(site, key, sources)
+		}
+	}
+}
+
+func getPGPKey(entity *openpgp.Entity) *PGPKey {
+	key := &PGPKey{
+		Fingerprint: fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint),
+		KeyID:       entity.PrimaryKey.KeyIdString(),
+		Created:     entity.PrimaryKey.CreationTime.UTC(),
+	}
+
+	for name := range entity.Identities {
+		key.UserIDs = append(key.UserIDs, name)
+	}
+
+	sort.Strings(key.UserIDs)
+
+	return key
+}
+
+func savePGPKey(siteDir string, key *PGPKey, block string) error {
+	keysDir := siteDir + string(filepath.Separator) + pgpKeysDirName
+	err := os.MkdirAll(keysDir, dirMode)
+
+	if err != nil {
+		return err
+	}
+
+	return writeFile(keysDir+string(filepath.Separator)+key.Fingerprint+".asc", []byte(block+"\n"), fileMode)
+}
+
+// addSitePGPKey adds the key to the site or the new sources of a key the site already has
+func addSitePGPKey(site *Site, key *PGPKey, sources []string) {
+	for _, siteKey := range site.PGPKeys {
+		if siteKey.Fingerprint != key.Fingerprint {
+			continue
+		}
+
+		for _, source := range sources {
+			if !hasString(siteKey.Sources, source) {
+				siteKey.Sources = append(siteKey.Sources, source)
+			}
+		}
+
+		return
+	}
+
+	for _, source := range sources {
+		if !hasString(key.Sources, source) {
+			key.Sources = append(key.Sources, source)
+		}
+	}
+
+	site.PGPKeys = append(site.PGPKeys, key)
+	emitEvent("site_pgp_key_found", site, site.URL, nil, map[string]interface{}{"fingerprint": key.Fingerprint, "user_ids": key.UserIDs})
+}
+
+func hasSamePGPKey(site *Site, otherSite *Site) bool {
+	for _, key := range site.PGPKeys {
+		for _, otherKey := range otherSite.PGPKeys {
+			if key.Fingerprint == otherKey.Fingerprint {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func hasString(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"math/bits"
+	"os"
+	"sort"
+	"strconv"
+)
+
+const perceptualHashSize = 32
+const perceptualHashLowSize = 8
+const defaultSimilarImageDistance = 10
+
+type SimilarImage struct {
+	Site  *Site
+	Image *Image
+	Hash  uint64
+}
+
+// the images above this number of pixels are not decoded, a small image can declare a size that needs more memory
+// than the crawl has
+const maxDecodedImagePixels = 50 * 1000 * 1000
+
+// decodeImageFile decodes the image of the file after checking its size in its header
+func decodeImageFile(fileName string) (image.Image, error) {
+	file, err := os.Open(fileName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(config.Width)*int64(config.Height) > maxDecodedImagePixels {
+		return nil, fmt.Errorf("image of %dx%d pixels is above the max of %d pixels", config.Width, config.Height, maxDecodedImagePixels)
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(file)
+
+	return img, err
+}
+
+func getImagePerceptualHash(fileName string) string {
+	img, err := decodeImageFile(fileName)
+
+	if err != nil {
+		return ""
+	}
+
+	hash := getPerceptualHash(img)
+
+	return fmt.Sprintf("%016x", hash)
+}
+
+func getPerceptualHash(img image.Image) uint64 {
+	// reduce the image to a small grayscale matrix
+	bounds := img.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+	pixels := make([][]float64, perceptualHashSize)
+
+	for y := 0; y < perceptualHashSize; y++ {
+		pixels[y] = make([]float64, perceptualHashSize)
+
+		for x := 0; x < perceptualHashSize; x++ {
+			// average the source block that maps to this pixel
+			x0 := bounds.Min.X + x*width/perceptualHashSize
+			x1 := bounds.Min.X + (x+1)*width/perceptualHashSize
+			y0 := bounds.Min.Y + y*height/perceptualHashSize
+			y1 := bounds.Min.Y + (y+1)*height/perceptualHashSize
+
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			if y1 <= y0 {
+				y1 = y0 + 1
+			}
+
+			sum := 0.0
+			count := 0
+
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					r, g, b, _ := img.At(sx, sy).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+					count++
+				}
+			}
+
+			pixels[y][x] = sum / float64(count)
+		}
+	}
+
+	// keep the low frequencies of the dct, without the dc term
+	dct := getDCT2D(pixels)
+	values := []float64{}
+
+	for y := 0; y < perceptualHashLowSize; y++ {
+		for x := 0; x < perceptualHashLowSize; x++ {
+			if x == 0 && y == 0 {
+				continue
+			}
+
+			values = append(values, dct[y][x])
+		}
+	}
+
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+
+	var hash uint64
+
+	for i, value := range values {
+		if value > median {
+			hash |= 1 << uint(i)
+		}
+	}
+
+	return hash
+}
+
+func getDCT2D(matrix [][]float64) [][]float64 {
+	size := len(matrix)
+	rows := make([][]float64, size)
+
+	for y := 0; y < size; y++ {
+		rows[y] = getDCT1D(matrix[y])
+	}
+
+	result := make([][]float64, size)
+
+	for y := range result {
+		result[y] = make([]float64, size)
+	}
+
+	column := make([]float64, size)
+
+	for x := 0; x < size; x++ {
+		for y := 0; y < size; y++ {
+			column[y] = rows[y][x]
+		}
+
+		transformed := getDCT1D(column)
+
+		for y := 0; y < size; y++ {
+			result[y][x] = transformed[y]
+		}
+	}
+
+	return result
+}
+
+func getDCT1D(values []float64) []float64 {
+	size := len(values)
+	result := make([]float64, size)
+
+	for k := 0; k < size; k++ {
+		sum := 0.0
+
+		for n := 0; n < size; n++ {
+			sum += values[n] * math.Cos(math.Pi/float64(size)*(float64(n)+0.5)*float64(k))
+		}
+
+		result[k] = sum
+	}
+
+	return result
+}
+
+func getPerceptualHashDistance(first uint64, second uint64) int {
+	return bits.OnesCount64(first ^ second)
+}
+
+func runFindSimilarCommand(args []string) {
+	if len(args) < 1 || len(args) > 2 {
+		fmt.Printf("Usage : %s find-similar <configuration file> [max distance] \n", os.Args[0])
+		os.Exit(exitCodeConfigError)
+	}
+
+	configurationFileName = args[0]
+	maxDistance := defaultSimilarImageDistance
+
+	if len(args) == 2 {
+		distance, err := strconv.Atoi(args[1])
+
+		if err != nil || distance < 0 {
+			fmt.Println("Invalid max distance:", args[1])
+			os.Exit(exitCodeConfigError)
+		}
+
+		maxDistance = distance
+	}
+
+	loadConfigurationFile()
+
+	// collect all hashed images
+	images := []*SimilarImage{}
+
+	for _, site := range configuration.Sites {
+		for _, siteImage := range site.Images {
+			if siteImage.PerceptualHash == "" {
+				continue
+			}
+
+			hash, err := strconv.ParseUint(siteImage.PerceptualHash, 16, 64)
+
+			if err != nil {
+				continue
+			}
+
+			images = append(images, &SimilarImage{Site: site, Image: siteImage, Hash: hash})
+		}
+	}
+
+	// group images using union find
+	parents := make([]int, len(images))
+
+	for i := range parents {
+		parents[i] = i
+	}
+
+	var find func(i int) int
+
+	find = func(i int) int {
+		if parents[i] != i {
+			parents[i] = find(parents[i])
+		}
+
+		return parents[i]
+	}
+
+	for i := 0; i < len(images); i++ {
+		for j := i + 1; j < len(images); j++ {
+			if getPerceptualHashDistance(images[i].Hash, images[j].Hash) <= maxDistance {
+				parents[find(i)] = find(j)
+			}
+		}
+	}
+
+	clusters := map[int][]*SimilarImage{}
+	clusterOrder := []int{}
+
+	for i, similarImage := range images {
+		root := find(i)
+
+		if _, exists := clusters[root]; !exists {
+			clusterOrder = append(clusterOrder, root)
+		}
+
+		clusters[root] = append(clusters[root], similarImage)
+	}
+
+	totalOfClusters := 0
+
+	for _, root := range clusterOrder {
+		cluster := clusters[root]
+
+		if len(cluster) < 2 {
+			continue
+		}
+
+		totalOfClusters++
+		fmt.Println(fmt.Sprintf("Cluster %d - %d images:", totalOfClusters, len(cluster)))
+
+		for _, similarImage := range cluster {
+			fmt.Println(fmt.Sprintf("  %016x %s/%s", similarImage.Hash, similarImage.Site.URL, similarImage.Image.URL))
+		}
+	}
+
+	if totalOfClusters == 0 {
+		fmt.Println("No similar images were found")
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+
+	_ "github.com/lib/pq"
+)
+
+// the migrations of the crawler nodes that share the database are serialized by this lock
+const postgresMigrationLockID = 7326071
+
+func openPostgresStorage(dsn string) (Storage, error) {
+	db, err := sql.Open("postgres", dsn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	storage := &SQLStorage{DB: db, Rebind: rebindDollar}
+	conn, err := db.Conn(context.Background())
+
+	if err == nil {
+		_, err = conn.ExecContext(context.Background(), `SELECT pg_advisory_lock($1)`, postgresMigrationLockID)
+
+		if err == nil {
+			err = storage.migrate()
+			conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, postgresMigrationLockID)
+		}
+
+		conn.Close()
+	}
+
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return storage, nil
+}
+
+// rebindDollar changes the ? placeholders to the numbered placeholders of postgresql
+func rebindDollar(query string) string {
+	result := strings.Builder{}
+	index := 0
+
+	for _, r := range query {
+		if r == '?' {
+			index++
+			result.WriteString("$" + strconv.Itoa(index))
+			continue
+		}
+
+		result.WriteRune(r)
+	}
+
+	return result.String()
+}
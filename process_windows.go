@@ -0,0 +1,19 @@
+//go:build windows
+// +build windows
+
+package main
+
+import "os"
+
+// isProcessAlive returns if the process of the pid is running, windows can only open the running processes
+func isProcessAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+
+	if err != nil {
+		return false
+	}
+
+	process.Release()
+
+	return true
+}
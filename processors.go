@@ -0,0 +1,316 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// FetchedContent is a fetched response for the processor of its content type, with its body in Content or already
+// saved to FileName
+type FetchedContent struct {
+	Site        *Site
+	SiteDir     string
+	URL         string
+	ContentType string
+	Content     []byte
+	FileName    string
+	Image       *Image
+
+	// set by the processors, the parsed html, and if the file was quarantined with its scan result
+	Document    *goquery.Document
+	Quarantined bool
+	ScanResult  string
+}
+
+// ContentProcessor handles the fetched content of a content type, the processors that save the content set the
+// name of its file
+type ContentProcessor func(content *FetchedContent) error
+
+// the processors by media type, "type/*" matches the media types of the type and "*/*" matches any media type
+var contentProcessors = map[string]ContentProcessor{
+	"text/html":             processHTMLContent,
+	"application/xhtml+xml": processHTMLContent,
+	"image/*":               processImageContent,
+	"application/json":      processJSONContent,
+	"text/*":                processTextContent,
+	"*/*":                   processBinaryContent,
+}
+
+// the extensions of the saved files by media type, the other ones come from the mime package
+var contentExtensions = map[string]string{
+	"application/json": ".json",
+	"image/jpeg":       ".jpg",
+	"text/plain":       ".txt",
+}
+
+// the processors that the configuration can set for a media type, by name
+var namedContentProcessors = map[string]ContentProcessor{
+	"html":   processHTMLContent,
+	"image":  processImageContent,
+	"json":   processJSONContent,
+	"text":   processTextContent,
+	"binary": processBinaryContent,
+}
+
+// registerContentProcessor sets the processor of the media type, like "application/pdf" or "video/*", replacing
+// the processor of the crawler
+func registerContentProcessor(mediaType string, processor ContentProcessor) {
+	contentProcessors[strings.ToLower(mediaType)] = processor
+}
+
+// setupContentProcessors registers the processors of the configuration by media type, like "text" for
+// "application/x-ndjson"
+func setupContentProcessors(processors map[string]string) error {
+	for mediaType, name := range processors {
+		processor, exists := namedContentProcessors[name]
+
+		if !exists {
+			return errors.New("unknown content processor for " + mediaType + ": " + name)
+		}
+
+		registerContentProcessor(mediaType, processor)
+	}
+
+	return nil
+}
+
+// getMediaType returns the media type of the content type without its parameters, like "text/html"
+func getMediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+
+	if err != nil {
+		return ""
+	}
+
+	return mediaType
+}
+
+// getContentProcessor returns the processor of the media type, of its type or the processor of any type
+func getContentProcessor(mediaType string) ContentProcessor {
+	if processor, exists := contentProcessors[mediaType]; exists {
+		return processor
+	}
+
+	if processor, exists := contentProcessors[strings.SplitN(mediaType, "/", 2)[0]+"/*"]; exists {
+		return processor
+	}
+
+	return contentProcessors["*/*"]
+}
+
+func isHTMLContentType(contentType string) bool {
+	mediaType := getMediaType(contentType)
+	return contentType == "" || mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// processFetchedContent sends the content to the processor of its type, the type of the content without one is
+// sniffed from its first bytes
+func processFetchedContent(content *FetchedContent) error {
+	if getMediaType(content.ContentType) == "" {
+		sniffedContent, err := getContentStart(content)
+
+		if err != nil {
+			return newStorageError(err)
+		}
+
+		content.ContentType = http.DetectContentType(sniffedContent)
+	}
+
+	processor := getContentProcessor(getMediaType(content.ContentType))
+
+	if processor == nil {
+		return errors.New("no processor for content type: " + content.ContentType)
+	}
+
+	return processor(content)
+}
+
+func getContentStart(content *FetchedContent) ([]byte, error) {
+	if content.Content != nil {
+		return content.Content, nil
+	}
+
+	file, err := os.Open(content.FileName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	buffer := make([]byte, sniffLength)
+	size, err := io.ReadFull(file, buffer)
+
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		err = nil
+	}
+
+	return buffer[:size], err
+}
+
+// getContentExtension returns the extension of the file of the content, the extension of the url when it has the
+// same type
+func getContentExtension(content *FetchedContent) string {
+	mediaType := getMediaType(content.ContentType)
+
+	if parsedURL, err := url.Parse(content.URL); err == nil {
+		extension := strings.ToLower(path.Ext(parsedURL.Path))
+
+		if extension != "" && getMediaType(mime.TypeByExtension(extension)) == mediaType {
+			return extension
+		}
+	}
+
+	if extension, exists := contentExtensions[mediaType]; exists {
+		return extension
+	}
+
+	if extensions, err := mime.ExtensionsByType(mediaType); err == nil && len(extensions) > 0 {
+		return extensions[0]
+	}
+
+	return ".bin"
+}
+
+// saveFetchedContent saves the body of the content with the extension of its type, the content already saved to
+// its file is kept
+func saveFetchedContent(content *FetchedContent, body []byte) error {
+	if content.Content == nil {
+		return nil
+	}
+
+	fileName := strings.TrimSuffix(content.FileName, filepath.Ext(content.FileName)) + getContentExtension(content)
+	err := os.MkdirAll(filepath.Dir(fileName), dirMode)
+
+	if err == nil {
+		err = writeFile(fileName, body, fileMode)
+	}
+
+	if err != nil {
+		return newStorageError(err)
+	}
+
+	content.FileName = fileName
+
+	return nil
+}
+
+// processHTMLContent parses the html, the pages save it with their links, frames and extractions
+func processHTMLContent(content *FetchedContent) error {
+	body := content.Content
+
+	if body == nil {
+		var err error
+
+		if body, err = ioutil.ReadFile(content.FileName); err != nil {
+			return newStorageError(err)
+		}
+	}
+
+	doc, err := parseHTML(body)
+
+	if err != nil {
+		return newParseError(err)
+	}
+
+	content.Document = doc
+
+	return nil
+}
+
+// processImageContent saves the image and gets the metadata, the perceptual hash and the thumbnail of the images
+// of the site
+func processImageContent(content *FetchedContent) error {
+	if err := saveFetchedContent(content, content.Content); err != nil {
+		return err
+	}
+
+	image := content.Image
+
+	if image == nil {
+		return nil
+	}
+
+	// get image metadata
+	if image.Metadata == nil {
+		image.Metadata = getImageMetadata(content.FileName)
+	}
+
+	// get image perceptual hash
+	if image.PerceptualHash == "" {
+		image.PerceptualHash = getImagePerceptualHash(content.FileName)
+	}
+
+	// create image thumbnail, the images that can't be decoded are recorded and not tried again
+	if configuration.ThumbnailMaxDimension > 0 && image.ThumbnailError == "" && isThumbnailSupported(content.FileName, content.ContentType) {
+		thumbnailFileName := getThumbnailFileName(content.SiteDir, image.URL)
+
+		if _, err := os.Stat(thumbnailFileName); err != nil {
+			err = createThumbnail(content.FileName, thumbnailFileName, configuration.ThumbnailMaxDimension)
+
+			if err != nil {
+				image.ThumbnailError = err.Error()
+				printError("Unable to create image thumbnail:", content.URL, err)
+				emitEvent("thumbnail_failed", content.Site, content.URL, err, nil)
+			}
+		}
+	}
+
+	return nil
+}
+
+// processJSONContent saves the json indented, or as it is when it is not valid
+func processJSONContent(content *FetchedContent) error {
+	if content.Content == nil {
+		return nil
+	}
+
+	prettyContent, err := getPrettyAPIContent(apiFormatJSON, content.Content)
+
+	if err != nil {
+		printError("Unable to format json, saving it as it is:", content.URL, err)
+	}
+
+	return saveFetchedContent(content, prettyContent)
+}
+
+func processTextContent(content *FetchedContent) error {
+	return saveFetchedContent(content, content.Content)
+}
+
+// processBinaryContent keeps the content in quarantine, it is never executable and is scanned with the ClamAV of
+// the quarantine configuration
+func processBinaryContent(content *FetchedContent) error {
+	if err := saveFetchedContent(content, content.Content); err != nil {
+		return err
+	}
+
+	err := os.Rename(content.FileName, content.FileName+quarantineSuffix)
+
+	if err != nil {
+		return newStorageError(err)
+	}
+
+	config := configuration.Quarantine
+
+	if config == nil {
+		config = &QuarantineConfig{}
+	}
+
+	fileName, scanResult, err := placeQuarantinedFile(content.FileName, content.ContentType, config)
+	content.FileName = fileName
+	content.ScanResult = scanResult
+	content.Quarantined = strings.HasSuffix(fileName, quarantineSuffix)
+
+	return err
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// profiles are presets of settings, they only change the settings that are not in the file or overridden
+var profiles = map[string]map[string]string{
+	"archive": {
+		"snapshots":                  "true",
+		"save_links":                 "true",
+		"max_depth":                  "3",
+		"max_pages":                  "500",
+		"site_retries":               "2",
+		"thumbnail_max_dimension":    "256",
+		"timeouts.idle_read_seconds": "60",
+		"timeouts.request_seconds":   "600",
+	},
+	"monitor": {
+		"snapshots":                      "true",
+		"site_retries":                   "3",
+		"notification_failure_threshold": "3",
+		"load_control.enabled":           "true",
+	},
+	"scrape": {
+		"scanners":             "all",
+		"save_links":           "true",
+		"max_depth":            "2",
+		"max_pages":            "200",
+		"concurrency":          "4",
+		"load_control.enabled": "true",
+	},
+	"screenshot": {
+		"snapshots":               "true",
+		"thumbnail_max_dimension": "512",
+		"concurrency":             "4",
+		"screenshots.enabled":     "true",
+	},
+}
+
+func getProfileNames() []string {
+	result := []string{}
+
+	for name := range profiles {
+		result = append(result, name)
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
+// applyProfile sets the profile settings that have no value, the profile values are not saved to the
+// configuration file
+func applyProfile(name string) error {
+	settings, exists := profiles[name]
+
+	if !exists {
+		return errors.New("unknown profile: " + name + " (profiles: " + strings.Join(getProfileNames(), ", ") + ")")
+	}
+
+	// sorted so parent settings are copied in the same order on every run
+	paths := []string{}
+
+	for path := range settings {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if !isConfigurationFieldEmpty(path) {
+			continue
+		}
+
+		if err := overrideConfigurationSetting(path, settings[path], "profile "+name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isConfigurationFieldEmpty checks the setting without creating its parent settings
+func isConfigurationFieldEmpty(path string) bool {
+	value := reflect.ValueOf(configuration).Elem()
+
+	for _, name := range strings.Split(path, ".") {
+		if value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				return true
+			}
+
+			value = value.Elem()
+		}
+
+		found := false
+
+		for fieldIndex := 0; fieldIndex < value.NumField(); fieldIndex++ {
+			if getJSONFieldName(value.Type().Field(fieldIndex)) == name {
+				value = value.Field(fieldIndex)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return value.IsZero()
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const projectEnvironmentName = environmentPrefix + "PROJECT"
+
+const configurationLockSuffix = ".lock"
+
+// a lock of the configuration file without the pid of its owner older than this was left by a crawl that stopped
+// while taking it
+const configurationLockStaleTime = 10 * time.Second
+
+// ProjectConfig is an archiving effort of the configuration file, with its own sites, output dir, crawl windows,
+// publishers and settings. The settings are the settings of the file for the project, like the --set flags
+type ProjectConfig struct {
+	Name         string             `json:"name"`
+	OutputDir    string             `json:"output_dir,omitempty"`
+	CrawlWindows []string           `json:"crawl_windows,omitempty"`
+	Publishers   []*PublisherConfig `json:"publishers,omitempty"`
+	Settings     map[string]string  `json:"settings,omitempty"`
+}
+
+// configurationProject is the project of the -project flag or of the environment, only its sites are crawled
+var configurationProject string
+
+func getProject(config *ConfigurationFile, name string) *ProjectConfig {
+	for _, project := range config.Projects {
+		if project.Name == name {
+			return project
+		}
+	}
+
+	return nil
+}
+
+func getProjectNames(config *ConfigurationFile) []string {
+	result := []string{}
+
+	for _, project := range config.Projects {
+		result = append(result, project.Name)
+	}
+
+	return result
+}
+
+// getProjectSettings returns the settings of the project with its output dir, crawl windows and publishers. The
+// projects without output dir are saved to a dir of their own, named by the project
+func getProjectSettings(config *ConfigurationFile, project *ProjectConfig) (map[string]string, error) {
+	result := map[string]string{}
+
+	for path, value := range project.Settings {
+		result[path] = value
+	}
+
+	result["output_dir"] = project.OutputDir
+
+	if project.OutputDir == "" {
+		outputDir := config.OutputDir
+
+		if outputDir == "" {
+			outputDir = "sites"
+		}
+
+		result["output_dir"] = outputDir + string(filepath.Separator) + project.Name
+	}
+
+	values := map[string]interface{}{}
+
+	if len(project.CrawlWindows) > 0 {
+		values["crawl_windows"] = project.CrawlWindows
+	}
+
+	if len(project.Publishers) > 0 {
+		values["publishers"] = project.Publishers
+	}
+
+	for path, value := range values {
+		valueJSON, err := json.Marshal(value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		result[path] = string(valueJSON)
+	}
+
+	return result, nil
+}
+
+// applyProject sets the settings of the selected project, before the environment variables and the --set flags
+// so they can still override them. The settings of the project are not saved to the configuration file
+func applyProject() error {
+	if configurationProject == "" {
+		configurationProject = os.Getenv(projectEnvironmentName)
+	}
+
+	if configurationProject == "" {
+		return nil
+	}
+
+	project := getProject(configuration, configurationProject)
+
+	if project == nil {
+		return errors.New("unknown project: " + configurationProject + " (projects: " + strings.Join(getProjectNames(configuration), ", ") + ")")
+	}
+
+	settings, err := getProjectSettings(configuration, project)
+
+	if err != nil {
+		return err
+	}
+
+	// sorted so parent settings are copied in the same order on every run
+	paths := []string{}
+
+	for path := range settings {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if err := overrideConfigurationSetting(path, settings[path], "project "+project.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lockConfigurationFile makes the loads and the saves of the projects of the configuration file one at a time, the
+// projects can be crawled at the same time by other processes. The lock has the pid of its owner, the lock of a
+// process that is not running is removed
+func lockConfigurationFile() (func(), error) {
+	lockFileName := configurationFileName + configurationLockSuffix
+
+	for {
+		file, err := os.OpenFile(lockFileName, os.O_CREATE|os.O_EXCL|os.O_WRONLY, fileMode)
+
+		if err == nil {
+			_, err = file.WriteString(strconv.Itoa(os.Getpid()))
+
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+
+			if err != nil {
+				os.Remove(lockFileName)
+				return nil, err
+			}
+
+			return func() { os.Remove(lockFileName) }, nil
+		}
+
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if isStaleConfigurationLock(lockFileName) {
+			os.Remove(lockFileName)
+			continue
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// isStaleConfigurationLock returns if the owner of the lock is not running, the lock without a pid is stale when it
+// is older than the time to write the pid
+func isStaleConfigurationLock(lockFileName string) bool {
+	content, err := ioutil.ReadFile(lockFileName)
+
+	if err != nil {
+		return false
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+
+	if err == nil && pid > 0 {
+		return !isProcessAlive(pid)
+	}
+
+	info, err := os.Stat(lockFileName)
+
+	return err == nil && time.Since(info.ModTime()) > configurationLockStaleTime
+}
+
+// isProjectSelected returns if a project is selected by the -project flag or by the environment, before the
+// configuration is loaded
+func isProjectSelected() bool {
+	return configurationProject != "" || os.Getenv(projectEnvironmentName) != ""
+}
+
+// getProjectConfigurationToSave returns the configuration file on disk with the sites of the project replaced by
+// the crawled ones, the other projects may have saved their sites since it was loaded. The new sites of the crawl
+// are added to the project
+func getProjectConfigurationToSave(config *ConfigurationFile) (*ConfigurationFile, error) {
+	content, err := ioutil.ReadFile(configurationFileName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	savedConfiguration, err := parseConfiguration(content)
+
+	if err != nil {
+		return nil, err
+	}
+
+	savedSites := map[string]bool{}
+	sites := map[string]*Site{}
+
+	for _, site := range savedConfiguration.Sites {
+		savedSites[site.URL] = true
+	}
+
+	for _, site := range config.Sites {
+		if !savedSites[site.URL] && site.Project == "" {
+			site.Project = configurationProject
+		}
+
+		if site.Project == configurationProject {
+			sites[site.URL] = site
+		}
+	}
+
+	result := *config
+	result.Sites = []*Site{}
+
+	for _, site := range savedConfiguration.Sites {
+		if site.Project != configurationProject {
+			result.Sites = append(result.Sites, site)
+		} else if crawledSite := sites[site.URL]; crawledSite != nil {
+			result.Sites = append(result.Sites, crawledSite)
+			delete(sites, site.URL)
+		}
+	}
+
+	for _, site := range config.Sites {
+		if sites[site.URL] != nil {
+			result.Sites = append(result.Sites, site)
+		}
+	}
+
+	return &result, nil
+}
+
+func runProjectsCommand(args []string) {
+	flags := flag.NewFlagSet("projects", flag.ExitOnError)
+	parallel := flags.Int("parallel", 0, "crawl this number of projects at the same time (0 for all)")
+	names := flags.String("projects", "", "only crawl these comma separated projects")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 || *parallel < 0 {
+		fmt.Printf("Usage : %s projects [-parallel n] [-projects a,b] <configuration file> [crawl flags] \n", os.Args[0])
+		os.Exit(exitCodeConfigError)
+	}
+
+	configurationFileName = flags.Arg(0)
+
+	content, err := ioutil.ReadFile(configurationFileName)
+
+	if err == nil {
+		configuration, err = parseConfiguration(content)
+	}
+
+	if err != nil {
+		fmt.Println("Unable to read configuration file:", err)
+		os.Exit(exitCodeConfigError)
+	}
+
+	jobs := []*BatchJob{}
+
+	for _, name := range getProjectNames(configuration) {
+		if *names == "" || hasString(getTags(*names), strings.ToLower(name)) {
+			jobs = append(jobs, &BatchJob{Name: name, ConfigurationFile: configurationFileName})
+		}
+	}
+
+	if len(jobs) == 0 {
+		fmt.Println("No project found:", configurationFileName)
+		os.Exit(exitCodeConfigError)
+	}
+
+	executable, err := os.Executable()
+
+	if err != nil {
+		fmt.Println("Unable to get crawler executable:", err)
+		os.Exit(exitCodeError)
+	}
+
+	// the projects wait for their own crawl windows, so they all run at the same time by default
+	if *parallel == 0 {
+		*parallel = len(jobs)
+	}
+
+	loadProjectJobConfigurations(jobs, content)
+
+	// the projects that run at the same time can't share the state of the crawl
+	if *parallel > 1 {
+		if err := isolateBatchJobs(jobs, flags.Args()[1:]); err != nil {
+			fmt.Println("Unable to run projects at the same time:", err)
+			os.Exit(exitCodeConfigError)
+		}
+	}
+
+	fmt.Println(fmt.Sprintf("Running %d projects, %d at a time...", len(jobs), *parallel))
+
+	var outputMutex sync.Mutex
+	var waitGroup sync.WaitGroup
+	slots := make(chan bool, *parallel)
+
+	for _, job := range jobs {
+		slots <- true
+		waitGroup.Add(1)
+
+		go func(job *BatchJob) {
+			defer waitGroup.Done()
+			defer func() { <-slots }()
+
+			runProjectJob(executable, job, flags.Args()[1:], &outputMutex)
+		}(job)
+	}
+
+	waitGroup.Wait()
+	failed := printBatchSummary(jobs)
+
+	if failed == len(jobs) {
+		os.Exit(exitCodeTotalFailure)
+	} else if failed > 0 {
+		os.Exit(exitCodePartialFailure)
+	}
+}
+
+// loadProjectJobConfigurations reads the configuration of each project with the settings of the project, the
+// projects with invalid settings fail without running
+func loadProjectJobConfigurations(jobs []*BatchJob, content []byte) {
+	for _, job := range jobs {
+		var err error
+		configuration, err = parseConfiguration(content)
+
+		if err == nil {
+			configurationOverrides = nil
+			configurationProject = job.Name
+			err = applyProject()
+		}
+
+		if err != nil {
+			job.Err = err
+			fmt.Println("Unable to apply project settings:", job.Name, err)
+			continue
+		}
+
+		job.Configuration = configuration
+	}
+
+	configurationProject = ""
+}
+
+// runProjectJob crawls the project in a new process, so the projects don't share state
+func runProjectJob(executable string, job *BatchJob, crawlArgs []string, outputMutex *sync.Mutex) {
+	if job.Err != nil {
+		return
+	}
+
+	args := append(getBatchJobArgs(job, crawlArgs), "-project", job.Name, job.ConfigurationFile)
+
+	stdout := &lineWriter{prefix: "[" + job.Name + "] ", output: os.Stdout, mutex: outputMutex}
+	stderr := &lineWriter{prefix: "[" + job.Name + "] ", output: os.Stderr, mutex: outputMutex}
+
+	command := exec.Command(executable, args...)
+	command.Stdout = stdout
+	command.Stderr = stderr
+
+	startedAt := time.Now()
+	job.Err = command.Run()
+	job.Duration = time.Since(startedAt)
+
+	stdout.Flush()
+	stderr.Flush()
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+)
+
+const publisherTypeKafka = "kafka"
+const publisherTypeNATS = "nats"
+
+type PublisherConfig struct {
+	Type           string   `json:"type"`
+	Brokers        []string `json:"brokers,omitempty"`
+	URL            string   `json:"url,omitempty"`
+	Topic          string   `json:"topic"`
+	IncludeContent bool     `json:"include_content,omitempty"`
+}
+
+// Publisher sends the messages of the fetched pages and assets to a streaming system
+type Publisher interface {
+	Publish(key string, message []byte) error
+	Close() error
+}
+
+// PublishedMessage is the event of a fetched page or asset, with the content when it is enabled
+type PublishedMessage struct {
+	*Event
+	ContentType string `json:"content_type,omitempty"`
+	Content     []byte `json:"content,omitempty"`
+}
+
+type configuredPublisher struct {
+	config    *PublisherConfig
+	publisher Publisher
+}
+
+var publishers []*configuredPublisher
+
+type KafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+func NewKafkaPublisher(config *PublisherConfig) (*KafkaPublisher, error) {
+	if len(config.Brokers) == 0 {
+		return nil, errors.New("kafka publisher needs brokers")
+	}
+
+	// messages of the same site go to the same partition, so they keep their order
+	writer := &kafka.Writer{
+		Addr:     kafka.TCP(config.Brokers...),
+		Topic:    config.Topic,
+		Balancer: &kafka.Hash{},
+		Async:    true,
+		Completion: func(messages []kafka.Message, err error) {
+			if err != nil {
+				printError("Unable to publish messages to kafka:", err)
+			}
+		},
+	}
+
+	return &KafkaPublisher{writer: writer}, nil
+}
+
+func (publisher *KafkaPublisher) Publish(key string, message []byte) error {
+	return publisher.writer.WriteMessages(context.Background(), kafka.Message{Key: []byte(key), Value: message})
+}
+
+func (publisher *KafkaPublisher) Close() error {
+	return publisher.writer.Close()
+}
+
+type NATSPublisher struct {
+	conn    *nats.Conn
+	subject string
+}
+
+func NewNATSPublisher(config *PublisherConfig) (*NATSPublisher, error) {
+	url := config.URL
+
+	if url == "" {
+		url = nats.DefaultURL
+	}
+
+	conn, err := nats.Connect(url, nats.Name("go-tor-crawler"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &NATSPublisher{conn: conn, subject: config.Topic}, nil
+}
+
+func (publisher *NATSPublisher) Publish(key string, message []byte) error {
+	return publisher.conn.Publish(publisher.subject, message)
+}
+
+func (publisher *NATSPublisher) Close() error {
+	err := publisher.conn.FlushTimeout(10 * time.Second)
+	publisher.conn.Close()
+
+	return err
+}
+
+func setupPublishers(configs []*PublisherConfig) error {
+	for _, config := range configs {
+		if config.Topic == "" {
+			closePublishers()
+			return errors.New("publisher needs a topic")
+		}
+
+		var publisher Publisher
+		var err error
+
+		switch config.Type {
+		case publisherTypeKafka:
+			publisher, err = NewKafkaPublisher(config)
+		case publisherTypeNATS:
+			publisher, err = NewNATSPublisher(config)
+		default:
+			err = errors.New("unknown publisher type: " + config.Type)
+		}
+
+		// the publishers already opened are closed, the crawl doesn't start
+		if err != nil {
+			closePublishers()
+			return err
+		}
+
+		publishers = append(publishers, &configuredPublisher{config: config, publisher: publisher})
+	}
+
+	return nil
+}
+
+// publishFetched sends the event of a fetched page or asset, the content is only read when a publisher
+// includes it
+func publishFetched(eventType string, site *Site, url string, data map[string]interface{}, getContent func() []byte) {
+	if len(publishers) == 0 {
+		return
+	}
+
+	message := &PublishedMessage{Event: &Event{Time: time.Now().UTC(), Type: eventType, Site: site.URL, Tags: site.Tags, URL: url, Data: data}}
+	messageJSON, err := json.Marshal(message)
+
+	if err != nil {
+		printError("Unable to create published message:", err)
+		return
+	}
+
+	var messageWithContentJSON []byte
+
+	for _, item := range publishers {
+		value := messageJSON
+
+		if item.config.IncludeContent {
+			if messageWithContentJSON == nil {
+				message.Content = getContent()
+				message.ContentType = http.DetectContentType(message.Content)
+				messageWithContentJSON, err = json.Marshal(message)
+
+				if err != nil {
+					printError("Unable to create published message:", err)
+					return
+				}
+			}
+
+			value = messageWithContentJSON
+		}
+
+		err = item.publisher.Publish(site.URL, value)
+
+		if err != nil {
+			printError("Unable to publish message:", err)
+		}
+	}
+}
+
+func getFileContent(fileName string) func() []byte {
+	return func() []byte {
+		content, _ := ioutil.ReadFile(fileName)
+		return content
+	}
+}
+
+func getBytesContent(content []byte) func() []byte {
+	return func() []byte {
+		return content
+	}
+}
+
+func closePublishers() {
+	for _, item := range publishers {
+		if err := item.publisher.Close(); err != nil {
+			printError("Unable to close publisher:", err)
+		}
+	}
+
+	publishers = nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const quarantineSuffix = ".quarantine"
+const clamAVChunkSize = 64 * 1024
+
+type QuarantineConfig struct {
+	Enabled      bool   `json:"enabled"`
+	ClamAVSocket string `json:"clamav_socket"`
+}
+
+// placeQuarantinedFile moves a downloaded file from its quarantine name to the final name when it is
+// a clean image, otherwise it stays with the quarantine suffix
+func placeQuarantinedFile(fileName string, contentType string, config *QuarantineConfig) (finalFileName string, scanResult string, err error) {
+	quarantineFileName := fileName + quarantineSuffix
+
+	// downloaded content must never be executable, the other bits are kept so the umask is respected
+	info, err := os.Stat(quarantineFileName)
+
+	if err == nil {
+		err = os.Chmod(quarantineFileName, info.Mode().Perm()&^0111)
+	}
+
+	if err != nil {
+		return quarantineFileName, "", err
+	}
+
+	if config.ClamAVSocket != "" {
+		scanResult, err = scanFileWithClamAV(quarantineFileName, config.ClamAVSocket)
+
+		if err != nil {
+			return quarantineFileName, "", err
+		}
+
+		if scanResult != "OK" {
+			return quarantineFileName, scanResult, nil
+		}
+	}
+
+	// the type was sniffed while the file was downloaded
+	if !strings.HasPrefix(contentType, "image/") {
+		return quarantineFileName, scanResult, nil
+	}
+
+	err = os.Rename(quarantineFileName, fileName)
+
+	if err != nil {
+		return quarantineFileName, scanResult, err
+	}
+
+	return fileName, scanResult, nil
+}
+
+func scanFileWithClamAV(fileName string, address string) (string, error) {
+	file, err := os.Open(fileName)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer file.Close()
+
+	// address can be a unix socket path or a host:port
+	network := "unix"
+
+	if !strings.HasPrefix(address, "/") {
+		network = "tcp"
+	}
+
+	conn, err := net.DialTimeout(network, address, timeout)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	_, err = conn.Write([]byte("zINSTREAM\x00"))
+
+	if err != nil {
+		return "", err
+	}
+
+	// send the file content in chunks prefixed by their size
+	buffer := make([]byte, clamAVChunkSize)
+	size := make([]byte, 4)
+
+	for {
+		read, err := file.Read(buffer)
+
+		if read > 0 {
+			binary.BigEndian.PutUint32(size, uint32(read))
+
+			if _, err := conn.Write(size); err != nil {
+				return "", err
+			}
+
+			if _, err := conn.Write(buffer[:read]); err != nil {
+				return "", err
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return "", err
+		}
+	}
+
+	binary.BigEndian.PutUint32(size, 0)
+
+	if _, err := conn.Write(size); err != nil {
+		return "", err
+	}
+
+	response, err := ioutil.ReadAll(conn)
+
+	if err != nil {
+		return "", err
+	}
+
+	// response is like "stream: OK" or "stream: Eicar-Signature FOUND"
+	result := string(bytes.TrimRight(response, "\x00\n"))
+	result = strings.TrimPrefix(result, "stream: ")
+
+	if strings.HasSuffix(result, "ERROR") {
+		return "", errors.New("clamav scan failed: " + result)
+	}
+
+	result = strings.TrimSuffix(result, " FOUND")
+
+	return result, nil
+}
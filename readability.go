@@ -0,0 +1,370 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// Article is the main content of a page, found with a readability algorithm, with its author and publish date
+type Article struct {
+	Title     string     `json:"title,omitempty"`
+	Author    string     `json:"author,omitempty"`
+	Published *time.Time `json:"published,omitempty"`
+	Excerpt   string     `json:"excerpt,omitempty"`
+	Words     int        `json:"words,omitempty"`
+
+	Text    string             `json:"-"`
+	Content *goquery.Selection `json:"-"`
+}
+
+// elements that are not part of the main content of a page
+const boilerplateSelector = "script, style, noscript, iframe, form, nav, header, footer, aside, [role=navigation], [role=banner], [role=contentinfo]"
+
+const articleExcerptLength = 200
+
+var (
+	unlikelyCandidateRegexp = regexp.MustCompile(`(?i)banner|breadcrumb|combx|comment|community|cookie|disqus|footer|header|menu|modal|nav|popup|related|remark|replies|share|shoutbox|sidebar|social|sponsor|widget|\bads?\b`)
+	maybeCandidateRegexp    = regexp.MustCompile(`(?i)and|article|body|column|content|entry|main|post|shadow|story|text`)
+	positiveClassRegexp     = regexp.MustCompile(`(?i)article|body|content|entry|hentry|main|page|post|story|text|blog`)
+	negativeClassRegexp     = regexp.MustCompile(`(?i)hidden|combx|comment|contact|footer|footnote|masthead|media|meta|promo|related|scroll|share|shoutbox|sidebar|social|sponsor|tags|widget`)
+	titleSeparatorRegexp    = regexp.MustCompile(`\s+[|\-–—:»]\s+`)
+)
+
+// layouts of the publish dates found in the pages, tried in order
+var articleDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+	"January 2, 2006",
+	"2 January 2006",
+}
+
+// getArticleFromHTML returns the article of the page, the document is changed since the boilerplate is removed
+// from it
+func getArticleFromHTML(content []byte) (*Article, error) {
+	doc, err := parseHTML(content)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return getArticle(doc), nil
+}
+
+// getArticleFromDocument returns the article of a shared document, the boilerplate is removed from a copy of it
+func getArticleFromDocument(doc *goquery.Document) *Article {
+	return getArticle(goquery.CloneDocument(doc))
+}
+
+func getArticle(doc *goquery.Document) *Article {
+	article := &Article{}
+
+	// the metadata is read before the boilerplate removal, since the json-ld data is in script elements
+	linkedData := getArticleLinkedData(doc)
+	article.Title = getArticleTitle(doc, linkedData)
+	article.Author = getArticleAuthor(doc, linkedData)
+	article.Published = getArticlePublished(doc, linkedData)
+
+	article.Content = getMainContent(doc)
+	article.Text = getCleanText(article.Content.Text())
+	article.Words = len(strings.Fields(article.Text))
+	article.Excerpt = getArticleExcerpt(article.Content)
+
+	return article
+}
+
+// getMainContent returns the element with the main content of the page, scoring the paragraphs by their text and
+// commas and giving the score to their parents, like the readability algorithm of the browsers
+func getMainContent(doc *goquery.Document) *goquery.Selection {
+	doc.Find(boilerplateSelector).Remove()
+
+	doc.Find("body *").Each(func(_ int, selection *goquery.Selection) {
+		names := getClassAndID(selection)
+
+		if names != "" && unlikelyCandidateRegexp.MatchString(names) && !maybeCandidateRegexp.MatchString(names) && !selection.Is("article, main") {
+			selection.Remove()
+		}
+	})
+
+	scores := map[*html.Node]float64{}
+	candidates := []*goquery.Selection{}
+
+	addScore := func(selection *goquery.Selection, score float64) {
+		if selection.Length() == 0 || selection.Is("html") {
+			return
+		}
+
+		node := selection.Get(0)
+
+		if _, ok := scores[node]; !ok {
+			scores[node] = getInitialScore(selection)
+			candidates = append(candidates, selection)
+		}
+
+		scores[node] += score
+	}
+
+	doc.Find("p, pre, td").Each(func(_ int, selection *goquery.Selection) {
+		text := getCleanText(selection.Text())
+
+		if len(text) < 25 {
+			return
+		}
+
+		score := 1 + float64(strings.Count(text, ",")) + math.Min(float64(len(text)/100), 3)
+
+		addScore(selection.Parent(), score)
+		addScore(selection.Parent().Parent(), score/2)
+	})
+
+	var result *goquery.Selection
+	bestScore := 0.0
+
+	for _, candidate := range candidates {
+		score := scores[candidate.Get(0)] * (1 - getLinkDensity(candidate))
+
+		if score > bestScore {
+			bestScore = score
+			result = candidate
+		}
+	}
+
+	if result != nil {
+		return result
+	}
+
+	if main := doc.Find("article, main, [role=main]").First(); main.Length() > 0 && getCleanText(main.Text()) != "" {
+		return main
+	}
+
+	return doc.Find("body")
+}
+
+func getClassAndID(selection *goquery.Selection) string {
+	class, _ := selection.Attr("class")
+	id, _ := selection.Attr("id")
+
+	return strings.TrimSpace(class + " " + id)
+}
+
+func getInitialScore(selection *goquery.Selection) float64 {
+	score := 0.0
+
+	switch goquery.NodeName(selection) {
+	case "article":
+		score += 10
+	case "div", "main", "section":
+		score += 5
+	case "pre", "td", "blockquote":
+		score += 3
+	case "form", "ol", "ul", "dl", "dd", "dt", "li", "address":
+		score -= 3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		score -= 5
+	}
+
+	names := getClassAndID(selection)
+
+	if positiveClassRegexp.MatchString(names) {
+		score += 25
+	}
+
+	if negativeClassRegexp.MatchString(names) {
+		score -= 25
+	}
+
+	return score
+}
+
+// getLinkDensity returns how much of the text of the element is link text
+func getLinkDensity(selection *goquery.Selection) float64 {
+	textLength := len(getCleanText(selection.Text()))
+
+	if textLength == 0 {
+		return 0
+	}
+
+	return float64(len(getCleanText(selection.Find("a").Text()))) / float64(textLength)
+}
+
+// getArticleLinkedData returns the json-ld objects of the page, the graph items are returned as objects too
+func getArticleLinkedData(doc *goquery.Document) []map[string]interface{} {
+	result := []map[string]interface{}{}
+
+	var add func(value interface{})
+
+	add = func(value interface{}) {
+		switch value := value.(type) {
+		case []interface{}:
+			for _, item := range value {
+				add(item)
+			}
+		case map[string]interface{}:
+			result = append(result, value)
+			add(value["@graph"])
+		}
+	}
+
+	doc.Find(`script[type="application/ld+json"]`).Each(func(_ int, selection *goquery.Selection) {
+		var value interface{}
+
+		if err := json.Unmarshal([]byte(selection.Text()), &value); err == nil {
+			add(value)
+		}
+	})
+
+	return result
+}
+
+func getLinkedDataString(linkedData []map[string]interface{}, key string) string {
+	for _, item := range linkedData {
+		if value := getLinkedDataName(item[key]); value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// getLinkedDataName returns the value of a json-ld property that can be a text, an object with a name or a list
+func getLinkedDataName(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return getCleanText(value)
+	case map[string]interface{}:
+		return getLinkedDataName(value["name"])
+	case []interface{}:
+		names := []string{}
+
+		for _, item := range value {
+			if name := getLinkedDataName(item); name != "" {
+				names = append(names, name)
+			}
+		}
+
+		return strings.Join(names, ", ")
+	}
+
+	return ""
+}
+
+func getMetaContent(doc *goquery.Document, selectors ...string) string {
+	for _, selector := range selectors {
+		if value := getCleanText(doc.Find(selector).First().AttrOr("content", "")); value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// getArticleTitle returns the title of the article without the site name that is usually added to the page title
+func getArticleTitle(doc *goquery.Document, linkedData []map[string]interface{}) string {
+	if title := getLinkedDataString(linkedData, "headline"); title != "" {
+		return title
+	}
+
+	if title := getMetaContent(doc, `meta[property="og:title"]`, `meta[name="twitter:title"]`); title != "" {
+		return title
+	}
+
+	title := getCleanText(doc.Find("title").First().Text())
+	parts := titleSeparatorRegexp.Split(title, -1)
+
+	if len(parts) > 1 && len(strings.Fields(parts[0])) >= 3 {
+		return parts[0]
+	}
+
+	return title
+}
+
+func getArticleAuthor(doc *goquery.Document, linkedData []map[string]interface{}) string {
+	if author := getLinkedDataString(linkedData, "author"); author != "" {
+		return author
+	}
+
+	if author := getMetaContent(doc, `meta[name="author"]`, `meta[property="article:author"]`, `meta[name="dc.creator"]`); author != "" {
+		return author
+	}
+
+	author := ""
+
+	doc.Find(`[rel="author"], [itemprop="author"], .byline, .author`).EachWithBreak(func(_ int, selection *goquery.Selection) bool {
+		text := strings.TrimPrefix(getCleanText(selection.Text()), "By ")
+
+		// long texts are blocks about the author and not the byline
+		if text != "" && len(text) < 100 {
+			author = text
+			return false
+		}
+
+		return true
+	})
+
+	return author
+}
+
+func getArticlePublished(doc *goquery.Document, linkedData []map[string]interface{}) *time.Time {
+	values := []string{
+		getLinkedDataString(linkedData, "datePublished"),
+		getMetaContent(doc, `meta[property="article:published_time"]`, `meta[name="date"]`, `meta[name="dc.date"]`, `meta[name="pubdate"]`, `meta[itemprop="datePublished"]`),
+		doc.Find(`[itemprop="datePublished"]`).First().AttrOr("datetime", ""),
+		doc.Find("time[datetime]").First().AttrOr("datetime", ""),
+	}
+
+	for _, value := range values {
+		if published := parseArticleDate(value); published != nil {
+			return published
+		}
+	}
+
+	return nil
+}
+
+func parseArticleDate(value string) *time.Time {
+	value = strings.TrimSpace(value)
+
+	if value == "" {
+		return nil
+	}
+
+	for _, layout := range articleDateLayouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			date = date.UTC()
+			return &date
+		}
+	}
+
+	return nil
+}
+
+// getArticleExcerpt returns the start of the first paragraph of the article
+func getArticleExcerpt(content *goquery.Selection) string {
+	text := ""
+
+	content.Find("p").EachWithBreak(func(_ int, selection *goquery.Selection) bool {
+		text = getCleanText(selection.Text())
+		return len(text) < 25
+	})
+
+	if text == "" {
+		text = getCleanText(content.Text())
+	}
+
+	if len(text) > articleExcerptLength {
+		text = strings.TrimSpace(strings.ToValidUTF8(text[:articleExcerptLength], "")) + "..."
+	}
+
+	return text
+}
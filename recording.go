@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+type RecordedResponse struct {
+	URL        string      `json:"url"`
+	Method     string      `json:"method,omitempty"`
+	Time       time.Time   `json:"time"`
+	StatusCode int         `json:"status_code,omitempty"`
+	Header     http.Header `json:"header,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// RecordingFetcher saves the raw responses of the fetcher to a directory, to be replayed later
+type RecordingFetcher struct {
+	Fetcher Fetcher
+	Dir     string
+}
+
+// ReplayFetcher answers the urls with the responses of a recording directory, without using the network
+type ReplayFetcher struct {
+	Dir string
+}
+
+var (
+	recordDir string
+	replayDir string
+)
+
+// isReplaying returns if the responses come from a record directory, the replayed requests don't reach the sites
+// or Tor, so they have no politeness delays and no new circuits
+func isReplaying() bool {
+	return replayDir != ""
+}
+
+func getRecordingFileName(dir string, url string) string {
+	return dir + string(filepath.Separator) + getContentHash([]byte(url))
+}
+
+// getRecordingKey returns the key of the recorded response, the POST requests have the body in the key so each
+// body has its response
+func getRecordingKey(method string, url string, body []byte) string {
+	if method == "" || method == "GET" {
+		return url
+	}
+
+	return method + " " + url + " " + getContentHash(body)
+}
+
+func (fetcher *RecordingFetcher) Get(ctx context.Context, url string) (*http.Response, error) {
+	return fetcher.record(&RecordedResponse{URL: url, Time: time.Now().UTC()}, nil, func() (*http.Response, error) {
+		return fetcher.Fetcher.Get(ctx, url)
+	})
+}
+
+func (fetcher *RecordingFetcher) Post(ctx context.Context, url string, contentType string, requestBody []byte) (*http.Response, error) {
+	return fetcher.record(&RecordedResponse{URL: url, Method: "POST", Time: time.Now().UTC()}, requestBody, func() (*http.Response, error) {
+		return fetcher.Fetcher.Post(ctx, url, contentType, requestBody)
+	})
+}
+
+func (fetcher *RecordingFetcher) record(recorded *RecordedResponse, requestBody []byte, fetch func() (*http.Response, error)) (*http.Response, error) {
+	response, err := fetch()
+	var body []byte
+
+	if err == nil {
+		body, err = ioutil.ReadAll(response.Body)
+		response.Body.Close()
+	}
+
+	if err != nil {
+		recorded.Error = err.Error()
+	} else {
+		recorded.StatusCode = response.StatusCode
+		recorded.Header = response.Header
+		response.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	if saveErr := saveRecordedResponse(fetcher.Dir, recorded, requestBody, body); saveErr != nil {
+		return nil, errors.New("unable to record response: " + saveErr.Error())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+func saveRecordedResponse(dir string, recorded *RecordedResponse, requestBody []byte, body []byte) error {
+	err := os.MkdirAll(dir, dirMode)
+
+	if err != nil {
+		return err
+	}
+
+	recordedJSON, err := json.MarshalIndent(recorded, "", "\t")
+
+	if err != nil {
+		return err
+	}
+
+	fileName := getRecordingFileName(dir, getRecordingKey(recorded.Method, recorded.URL, requestBody))
+	err = writeFile(fileName+".json", recordedJSON, fileMode)
+
+	if err != nil {
+		return err
+	}
+
+	return writeFile(fileName+".body", body, fileMode)
+}
+
+func (fetcher *ReplayFetcher) Get(ctx context.Context, url string) (*http.Response, error) {
+	return fetcher.replay(ctx, "GET", url, nil)
+}
+
+func (fetcher *ReplayFetcher) Post(ctx context.Context, url string, contentType string, body []byte) (*http.Response, error) {
+	return fetcher.replay(ctx, "POST", url, body)
+}
+
+func (fetcher *ReplayFetcher) replay(ctx context.Context, method string, url string, requestBody []byte) (*http.Response, error) {
+	fileName := getRecordingFileName(fetcher.Dir, getRecordingKey(method, url, requestBody))
+	recordedJSON, err := ioutil.ReadFile(fileName + ".json")
+
+	if err != nil {
+		return nil, errors.New("no recorded response for " + url)
+	}
+
+	recorded := &RecordedResponse{}
+	err = json.Unmarshal(recordedJSON, recorded)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// recorded failures fail again
+	if recorded.Error != "" {
+		return nil, errors.New(recorded.Error)
+	}
+
+	body, err := ioutil.ReadFile(fileName + ".body")
+
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, url, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Response{
+		Status:        strconv.Itoa(recorded.StatusCode) + " " + http.StatusText(recorded.StatusCode),
+		StatusCode:    recorded.StatusCode,
+		Header:        recorded.Header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       request,
+	}, nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// httpFetcher gets the urls without Tor, the test site is on the loopback
+type httpFetcher struct {
+	client *http.Client
+}
+
+func (fetcher *httpFetcher) Get(ctx context.Context, url string) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return fetcher.client.Do(request)
+}
+
+func (fetcher *httpFetcher) Post(ctx context.Context, url string, contentType string, body []byte) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader(string(body)))
+
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Content-Type", contentType)
+
+	return fetcher.client.Do(request)
+}
+
+var recordedSitePages = map[string]string{
+	"/":       `<html><head><title>Home</title></head><body><a href="/forum/">Forum</a> <a href="/about">About</a></body></html>`,
+	"/forum/": `<html><head><title>Forum</title></head><body><a href="/forum/topic?id=1">Topic</a> <a href="/">Home</a></body></html>`,
+	"/about":  `<html><head><title>About</title></head><body><p>About the site</p></body></html>`,
+}
+
+// crawlRecordingSite crawls the pages of the site with the fetcher to the site dir and returns the pages
+func crawlRecordingSite(t *testing.T, siteURL string, siteDir string, fetcher Fetcher) []*Page {
+	content, _, err := fetchPage(fetcher, siteURL)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := parseHTML(content)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	site := &Site{URL: siteURL, MaxDepth: 3}
+	crawlSitePages(site, siteDir, doc, fetcher, 0)
+
+	return site.Pages
+}
+
+// readDirFiles returns the content of the files of the dir by their relative names
+func readDirFiles(t *testing.T, dir string) map[string]string {
+	result := map[string]string{}
+
+	err := filepath.Walk(dir, func(fileName string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		content, err := ioutil.ReadFile(fileName)
+
+		if err != nil {
+			return err
+		}
+
+		relativeName, err := filepath.Rel(dir, fileName)
+		result[filepath.ToSlash(relativeName)] = string(content)
+
+		return err
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
+
+// TestReplayRecordedCrawl crawls a site with the responses recorded, replays the crawl from the recording with the
+// site down and compares the output of both crawls. The crawl delay is only waited by the recorded crawl
+func TestReplayRecordedCrawl(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		page, exists := recordedSitePages[request.URL.Path]
+
+		if !exists || page == "" {
+			http.NotFound(writer, request)
+			return
+		}
+
+		writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+		writer.Write([]byte(page))
+	}))
+
+	dir := t.TempDir()
+
+	previousClock := crawlerClock
+	previousCrawlDelay := crawlDelayOverride
+
+	defer func() {
+		configuration = nil
+		crawlerClock = previousClock
+		crawlDelayOverride = previousCrawlDelay
+		recordDir = ""
+		replayDir = ""
+	}()
+
+	configuration = &ConfigurationFile{}
+	crawlDelayOverride = 5 * time.Second
+
+	// the recorded crawl
+	recordDir = filepath.Join(dir, "recording")
+	recordClock := newFixedClock(time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC))
+	crawlerClock = recordClock
+
+	recordedPages := crawlRecordingSite(t, server.URL, filepath.Join(dir, "recorded"), &RecordingFetcher{Fetcher: &httpFetcher{client: server.Client()}, Dir: recordDir})
+
+	if len(recordedPages) != 3 {
+		t.Fatalf("the recorded crawl has %d pages, expected 3", len(recordedPages))
+	}
+
+	if recordClock.slept() == 0 {
+		t.Fatal("the recorded crawl didn't wait the crawl delay")
+	}
+
+	// the replayed crawl, without the site
+	server.Close()
+
+	replayDir = recordDir
+	recordDir = ""
+	replayClock := newFixedClock(time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC))
+	crawlerClock = replayClock
+
+	replayedPages := crawlRecordingSite(t, server.URL, filepath.Join(dir, "replayed"), newFetcher())
+
+	if replayClock.slept() != 0 {
+		t.Errorf("the replayed crawl waited %s", replayClock.slept())
+	}
+
+	if len(replayedPages) != len(recordedPages) {
+		t.Fatalf("the replayed crawl has %d pages, expected %d", len(replayedPages), len(recordedPages))
+	}
+
+	for index, page := range replayedPages {
+		recordedPage := recordedPages[index]
+
+		if page.URL != recordedPage.URL || page.FileName != recordedPage.FileName || page.StatusCode != recordedPage.StatusCode || page.FetchSuccess != recordedPage.FetchSuccess || page.ContentHash != recordedPage.ContentHash {
+			t.Errorf("the replayed page %+v is not the recorded page %+v", page, recordedPage)
+		}
+	}
+
+	recordedFiles := readDirFiles(t, filepath.Join(dir, "recorded"))
+	replayedFiles := readDirFiles(t, filepath.Join(dir, "replayed"))
+
+	if len(recordedFiles) == 0 || len(replayedFiles) != len(recordedFiles) {
+		t.Fatalf("the replayed crawl saved %d files, expected %d", len(replayedFiles), len(recordedFiles))
+	}
+
+	for fileName, content := range recordedFiles {
+		if replayedFiles[fileName] != content {
+			t.Errorf("the replayed file %s is not the recorded file", fileName)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const defaultFrontierTTL = time.Hour
+const defaultFrontierWait = 60 * time.Second
+
+type FrontierConfig struct {
+	Redis       string `json:"redis"`
+	RunID       string `json:"run_id,omitempty"`
+	TTLSeconds  int    `json:"ttl_seconds,omitempty"`
+	WaitSeconds int    `json:"wait_seconds,omitempty"`
+}
+
+// RedisFrontier keeps the visited set and the queue of a site in redis, the queue is a sorted set by depth, so
+// the processes that share it crawl each page once
+type RedisFrontier struct {
+	client *redis.Client
+	key    string
+	ttl    time.Duration
+	wait   time.Duration
+}
+
+// NewRedisFrontier returns the frontier of the site in the run, the run id is required so a later run doesn't find
+// the pages of the site already visited
+func NewRedisFrontier(config *FrontierConfig, siteURL string) (*RedisFrontier, error) {
+	if config.RunID == "" {
+		return nil, errors.New("the redis frontier needs a run_id")
+	}
+
+	options, err := redis.ParseURL(config.Redis)
+
+	if err != nil {
+		return nil, err
+	}
+
+	client := redis.NewClient(options)
+	err = client.Ping(context.Background()).Err()
+
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &RedisFrontier{
+		client: client,
+		key:    "go-tor-crawler:frontier:" + config.RunID + ":" + getContentHash([]byte(normalizeURL(siteURL))),
+		ttl:    getTimeout(config.TTLSeconds, defaultFrontierTTL),
+		wait:   getTimeout(config.WaitSeconds, defaultFrontierWait),
+	}, nil
+}
+
+func (frontier *RedisFrontier) Visit(url string) (bool, error) {
+	ctx := context.Background()
+	added, err := frontier.client.SAdd(ctx, frontier.key+":visited", normalizeURL(url)).Result()
+
+	if err != nil {
+		return false, err
+	}
+
+	// the frontier expires after some time without activity, so later runs crawl the site again
+	frontier.client.Expire(ctx, frontier.key+":visited", frontier.ttl)
+
+	return added == 1, nil
+}
+
+func (frontier *RedisFrontier) Push(item *pageQueueItem) error {
+	ctx := context.Background()
+	itemJSON, err := json.Marshal(item)
+
+	if err != nil {
+		return err
+	}
+
+	err = frontier.client.ZAdd(ctx, frontier.key+":queue", redis.Z{Score: float64(item.Depth), Member: string(itemJSON)}).Err()
+
+	if err != nil {
+		return err
+	}
+
+	frontier.client.Expire(ctx, frontier.key+":queue", frontier.ttl)
+
+	return nil
+}
+
+// Next waits for the pages of the other processes when the queue is empty, since their links can still be added
+func (frontier *RedisFrontier) Next() (*pageQueueItem, error) {
+	ctx := context.Background()
+	waitUntil := time.Now().Add(frontier.wait)
+
+	for {
+		values, err := frontier.client.ZPopMin(ctx, frontier.key+":queue", 1).Result()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(values) > 0 {
+			item := &pageQueueItem{}
+			err = json.Unmarshal([]byte(values[0].Member.(string)), item)
+
+			if err != nil {
+				return nil, err
+			}
+
+			frontier.client.Incr(ctx, frontier.key+":active")
+			frontier.client.Expire(ctx, frontier.key+":active", frontier.ttl)
+
+			return item, nil
+		}
+
+		active, err := frontier.client.Get(ctx, frontier.key+":active").Int()
+
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+
+		if active <= 0 || time.Now().After(waitUntil) {
+			return nil, nil
+		}
+
+		time.Sleep(time.Second)
+	}
+}
+
+func (frontier *RedisFrontier) Done(item *pageQueueItem) {
+	frontier.client.Decr(context.Background(), frontier.key+":active")
+}
+
+func (frontier *RedisFrontier) Close() error {
+	return frontier.client.Close()
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const defaultReplayProxyAddress = "127.0.0.1:8118"
+
+// ReplayProxy is an http proxy that answers the requests of archived urls from the archive, so the archived
+// sites can be browsed with their original urls, and optionally gets the other urls of the hosts of the sites
+// from Tor
+type ReplayProxy struct {
+	Index     *ArchiveIndex
+	Snapshot  string
+	Live      bool
+	LiveHosts map[string]bool
+	Fetcher   Fetcher
+}
+
+// getReplayProxyLiveHosts returns the hosts of the configured sites, the only hosts the live proxy connects to
+func getReplayProxyLiveHosts(sites []*Site) map[string]bool {
+	result := map[string]bool{}
+
+	for _, site := range sites {
+		if host := getURLHost(site.URL); host != "" {
+			result[host] = true
+		}
+	}
+
+	return result
+}
+
+// checkReplayProxyAddress returns an error when the live proxy would listen on other addresses than the loopback,
+// it would be an open proxy to Tor
+func checkReplayProxyAddress(address string) error {
+	host, _, err := net.SplitHostPort(address)
+
+	if err != nil {
+		return err
+	}
+
+	if !isLoopbackHost(host) {
+		return errors.New("the live replay proxy must listen on a loopback address, like 127.0.0.1:8118: " + address)
+	}
+
+	return nil
+}
+
+func (replayProxy *ReplayProxy) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if request.Method == http.MethodConnect {
+		replayProxy.serveTunnel(writer, request)
+		return
+	}
+
+	if !request.URL.IsAbs() {
+		http.Error(writer, "go-tor-crawler replay proxy, configure it as the http proxy of the browser", http.StatusBadRequest)
+		return
+	}
+
+	if request.Method == http.MethodGet || request.Method == http.MethodHead {
+		if fileName := replayProxy.getArchivedFileName(request.URL.String()); fileName != "" {
+			replayProxy.serveArchivedFile(writer, request, fileName)
+			return
+		}
+	}
+
+	if !replayProxy.Live || request.Method != http.MethodGet {
+		http.Error(writer, "not archived: "+request.URL.String(), http.StatusNotFound)
+		return
+	}
+
+	if !replayProxy.LiveHosts[getURLHost(request.URL.String())] {
+		http.Error(writer, "not a host of the sites: "+request.URL.Host, http.StatusForbidden)
+		return
+	}
+
+	response, err := replayProxy.Fetcher.Get(request.Context(), request.URL.String())
+
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	defer response.Body.Close()
+
+	for name, values := range response.Header {
+		for _, value := range values {
+			writer.Header().Add(name, value)
+		}
+	}
+
+	writer.WriteHeader(response.StatusCode)
+	io.Copy(writer, response.Body)
+}
+
+// getArchivedFileName returns the archive file of the url, the downloaded pages and images first and then the
+// files of the site dir with the same path, or an empty string when the url is not archived
+func (replayProxy *ReplayProxy) getArchivedFileName(rawURL string) string {
+	localPath, exists := replayProxy.Index.LocalPaths[normalizeURL(rawURL)]
+
+	if !exists {
+		siteDirName, exists := replayProxy.Index.SiteDirNames[getURLHost(rawURL)]
+
+		if !exists {
+			return ""
+		}
+
+		urlPath := strings.TrimPrefix(rawURL, getURLScheme(rawURL)+"://"+getURLHost(rawURL))
+		urlPath = strings.SplitN(strings.SplitN(urlPath, "?", 2)[0], "#", 2)[0]
+
+		if urlPath == "" || strings.HasSuffix(urlPath, "/") {
+			return ""
+		}
+
+		localPath = archiveSitesPath + siteDirName + urlPath
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(localPath, archiveSitesPath), "/", 2)
+
+	if len(parts) != 2 {
+		return ""
+	}
+
+	// the file of the snapshot is used when the snapshot has it
+	fileNames := []string{}
+
+	if replayProxy.Snapshot != "" {
+		fileNames = append(fileNames, "/"+parts[0]+"/"+snapshotsDirName+"/"+replayProxy.Snapshot+"/"+parts[1])
+	}
+
+	fileNames = append(fileNames, "/"+parts[0]+"/"+parts[1])
+
+	for _, fileName := range fileNames {
+		fileName = path.Clean(fileName)
+
+		// the paths of the urls can't leave the site dir, and the files flagged by the scanner are never served
+		if !strings.HasPrefix(fileName, "/"+parts[0]+"/") || strings.HasSuffix(fileName, quarantineSuffix) {
+			continue
+		}
+
+		file, err := http.Dir(replayProxy.Index.OutputDir).Open(fileName)
+
+		if err != nil {
+			continue
+		}
+
+		info, err := file.Stat()
+		file.Close()
+
+		if err == nil && !info.IsDir() {
+			return fileName
+		}
+	}
+
+	return ""
+}
+
+func (replayProxy *ReplayProxy) serveArchivedFile(writer http.ResponseWriter, request *http.Request, fileName string) {
+	file, err := http.Dir(replayProxy.Index.OutputDir).Open(fileName)
+
+	if err != nil {
+		http.NotFound(writer, request)
+		return
+	}
+
+	defer file.Close()
+
+	info, err := file.Stat()
+
+	if err != nil {
+		http.NotFound(writer, request)
+		return
+	}
+
+	writer.Header().Set("X-Archived", "true")
+	http.ServeContent(writer, request, filepath.Base(fileName), info.ModTime(), file)
+}
+
+// serveTunnel connects https requests to Tor, the archive only has the pages of the http urls
+func (replayProxy *ReplayProxy) serveTunnel(writer http.ResponseWriter, request *http.Request) {
+	if !replayProxy.Live {
+		http.Error(writer, "not archived: "+request.Host, http.StatusNotFound)
+		return
+	}
+
+	host, _, err := net.SplitHostPort(request.Host)
+
+	if err != nil || !replayProxy.LiveHosts[strings.ToLower(host)] {
+		http.Error(writer, "not a host of the sites: "+request.Host, http.StatusForbidden)
+		return
+	}
+
+	hijacker, ok := writer.(http.Hijacker)
+
+	if !ok {
+		http.Error(writer, "tunnels are not supported", http.StatusInternalServerError)
+		return
+	}
+
+	serverConn, err := getTorDialContext(getTimeout(getTimeoutsConfig().DialSeconds, timeout))(request.Context(), "tcp", request.Host)
+
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	clientConn, _, err := hijacker.Hijack()
+
+	if err != nil {
+		serverConn.Close()
+		return
+	}
+
+	clientConn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+
+	go copyConn(serverConn, clientConn)
+	copyConn(clientConn, serverConn)
+}
+
+func copyConn(destination net.Conn, source net.Conn) {
+	defer destination.Close()
+	defer source.Close()
+
+	io.Copy(destination, source)
+}
+
+func runReplayProxyCommand(args []string) {
+	flags := flag.NewFlagSet("replay-proxy", flag.ExitOnError)
+	live := flags.Bool("live", false, "get the urls that are not archived from Tor")
+	snapshot := flags.String("snapshot", "", "answer with the files of this snapshot")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		fmt.Printf("Usage : %s replay-proxy [-live] [-snapshot name] <configuration file> [address] \n", os.Args[0])
+		os.Exit(exitCodeConfigError)
+	}
+
+	configurationFileName = flags.Arg(0)
+	address := defaultReplayProxyAddress
+
+	if flags.NArg() == 2 {
+		address = flags.Arg(1)
+	}
+
+	if *snapshot != "" {
+		if _, err := time.Parse(snapshotNameLayout, *snapshot); err != nil {
+			fmt.Println("Invalid snapshot name:", *snapshot)
+			os.Exit(exitCodeConfigError)
+		}
+	}
+
+	if *live {
+		if err := checkReplayProxyAddress(address); err != nil {
+			fmt.Println("Invalid replay proxy address:", err)
+			os.Exit(exitCodeConfigError)
+		}
+	}
+
+	loadConfigurationFile()
+
+	currentDir, err := os.Getwd()
+
+	if err != nil {
+		fmt.Println("Unable to get current directory:", err)
+		os.Exit(exitCodeError)
+	}
+
+	replayProxy := &ReplayProxy{
+		Index:    newArchiveIndex(getOutputDir(currentDir)),
+		Snapshot: *snapshot,
+		Live:     *live,
+	}
+
+	if replayProxy.Live {
+		replayProxy.LiveHosts = getReplayProxyLiveHosts(configuration.Sites)
+	}
+
+	if replayProxy.Live {
+		err = setupTorDialer()
+
+		if err != nil {
+			fmt.Println("Unable to setup Tor proxy:", err)
+			os.Exit(exitCodeConfigError)
+		}
+
+		replayProxy.Fetcher = newFetcher()
+	}
+
+	fmt.Println(fmt.Sprintf("Replay proxy of %d sites on %s", len(configuration.Sites), address))
+
+	err = http.ListenAndServe(address, replayProxy)
+
+	if err != nil {
+		fmt.Println("Unable to serve replay proxy:", err)
+		os.Exit(exitCodeError)
+	}
+}
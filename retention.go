@@ -0,0 +1,159 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// RetentionConfig limits the snapshots of each site: a snapshot is kept when it is one of the last "keep_last"
+// snapshots or when it is newer than "keep_days" days. The last snapshot is always kept
+type RetentionConfig struct {
+	KeepLast int `json:"keep_last,omitempty"`
+	KeepDays int `json:"keep_days,omitempty"`
+}
+
+func (config *RetentionConfig) isEnabled() bool {
+	return config != nil && (config.KeepLast > 0 || config.KeepDays > 0)
+}
+
+// getPrunableSnapshots returns the snapshots that are not kept by the retention, the names are sorted from the
+// oldest to the newest
+func getPrunableSnapshots(snapshots []string, config *RetentionConfig, now time.Time) []string {
+	result := []string{}
+
+	if !config.isEnabled() {
+		return result
+	}
+
+	for index, snapshot := range snapshots {
+		if index == len(snapshots)-1 {
+			break
+		}
+
+		if config.KeepLast > 0 && index >= len(snapshots)-config.KeepLast {
+			continue
+		}
+
+		if config.KeepDays > 0 {
+			snapshotTime, err := time.Parse(snapshotNameLayout, snapshot)
+
+			if err != nil || now.Sub(snapshotTime) < time.Duration(config.KeepDays)*24*time.Hour {
+				continue
+			}
+		}
+
+		result = append(result, snapshot)
+	}
+
+	return result
+}
+
+// pruneSnapshots removes the snapshots of the site that are not kept by the retention. The files shared with the
+// newer snapshots are hard links, so they are kept by them
+func pruneSnapshots(siteDir string, config *RetentionConfig, dryRun bool) ([]string, error) {
+	snapshotsDir := filepath.Join(siteDir, snapshotsDirName)
+	snapshots := getPrunableSnapshots(getSnapshotNames(snapshotsDir), config, crawlerClock.Now().UTC())
+
+	if dryRun {
+		return snapshots, nil
+	}
+
+	for index, snapshot := range snapshots {
+		if err := os.RemoveAll(filepath.Join(snapshotsDir, snapshot)); err != nil {
+			return snapshots[:index], err
+		}
+	}
+
+	return snapshots, nil
+}
+
+// pruneSiteSnapshots is the automatic pruning of the crawl, done after each new snapshot of the site
+func pruneSiteSnapshots(siteDir string) {
+	if !configuration.SnapshotRetention.isEnabled() {
+		return
+	}
+
+	snapshots, err := pruneSnapshots(siteDir, configuration.SnapshotRetention, false)
+
+	if err != nil {
+		printError("Unable to prune site snapshots:", err)
+	}
+
+	if len(snapshots) > 0 {
+		printInfo(fmt.Sprintf("Pruned %d old snapshots", len(snapshots)))
+	}
+}
+
+func runPruneCommand(args []string) {
+	flags := flag.NewFlagSet("prune", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "only print the snapshots that would be removed")
+	keepLast := flags.Int("keep-last", -1, "keep the last snapshots of each site, instead of snapshot_retention.keep_last")
+	keepDays := flags.Int("keep-days", -1, "keep the snapshots of the last days, instead of snapshot_retention.keep_days")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fmt.Printf("Usage : %s prune [-dry-run] [-keep-last n] [-keep-days n] <configuration file> \n", os.Args[0])
+		os.Exit(exitCodeConfigError)
+	}
+
+	configurationFileName = flags.Arg(0)
+
+	loadConfigurationFile()
+
+	config := &RetentionConfig{}
+
+	if configuration.SnapshotRetention != nil {
+		*config = *configuration.SnapshotRetention
+	}
+
+	if *keepLast >= 0 {
+		config.KeepLast = *keepLast
+	}
+
+	if *keepDays >= 0 {
+		config.KeepDays = *keepDays
+	}
+
+	if !config.isEnabled() {
+		fmt.Println("No snapshot retention, set snapshot_retention or use -keep-last or -keep-days")
+		os.Exit(exitCodeConfigError)
+	}
+
+	currentDir, err := os.Getwd()
+
+	if err != nil {
+		fmt.Println("Unable to get current directory:", err)
+		os.Exit(exitCodeError)
+	}
+
+	outputDir := getOutputDir(currentDir)
+	totalOfSnapshots := 0
+	totalOfSites := 0
+
+	for _, site := range configuration.Sites {
+		snapshots, err := pruneSnapshots(outputDir+string(filepath.Separator)+getSiteDirName(site), config, *dryRun)
+
+		for _, snapshot := range snapshots {
+			fmt.Println(fmt.Sprintf("%s %s", site.URL, snapshot))
+		}
+
+		if err != nil {
+			fmt.Println("Unable to prune site snapshots:", site.URL, err)
+		}
+
+		if len(snapshots) > 0 {
+			totalOfSnapshots += len(snapshots)
+			totalOfSites++
+		}
+	}
+
+	if *dryRun {
+		fmt.Println(fmt.Sprintf("%d snapshots of %d sites would be pruned", totalOfSnapshots, totalOfSites))
+		return
+	}
+
+	fmt.Println(fmt.Sprintf("Pruned %d snapshots of %d sites", totalOfSnapshots, totalOfSites))
+}
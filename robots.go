@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	robotsPolicyIgnore     = "ignore"
+	robotsPolicyRespect    = "respect"
+	robotsPolicyRecordOnly = "record-only"
+)
+
+func isKnownRobotsPolicy(policy string) bool {
+	return policy == "" || policy == robotsPolicyIgnore || policy == robotsPolicyRespect || policy == robotsPolicyRecordOnly
+}
+
+// getRobotsPolicy returns the robots policy of the site, the sites without one use the configuration one and the
+// robots directives are ignored by default
+func getRobotsPolicy(site *Site) string {
+	if site.RobotsPolicy != "" {
+		return site.RobotsPolicy
+	}
+
+	if configuration.RobotsPolicy != "" {
+		return configuration.RobotsPolicy
+	}
+
+	return robotsPolicyIgnore
+}
+
+// getRobotsDirectivesFromDocument returns the directives of the robots meta tags of the page, "none" is the same of
+// "noindex" and "nofollow"
+func getRobotsDirectivesFromDocument(doc *goquery.Document) []string {
+	result := []string{}
+
+	doc.Find("meta[name]").Each(func(_ int, selection *goquery.Selection) {
+		if !strings.EqualFold(strings.TrimSpace(selection.AttrOr("name", "")), "robots") {
+			return
+		}
+
+		for _, directive := range strings.Split(selection.AttrOr("content", ""), ",") {
+			directive = strings.ToLower(strings.TrimSpace(directive))
+
+			if directive == "none" {
+				result = appendRobotsDirective(result, "noindex")
+				result = appendRobotsDirective(result, "nofollow")
+			} else if directive != "" {
+				result = appendRobotsDirective(result, directive)
+			}
+		}
+	})
+
+	return result
+}
+
+func appendRobotsDirective(directives []string, directive string) []string {
+	if hasString(directives, directive) {
+		return directives
+	}
+
+	return append(directives, directive)
+}
+
+func isNofollowLink(link *Link) bool {
+	return hasString(link.Rel, "nofollow")
+}
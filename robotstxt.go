@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const robotsTxtFileName = "robots.txt"
+const robotsTxtUserAgent = "go-tor-crawler"
+const defaultMaxCrawlDelay = 30
+
+type RobotsTxtConfig struct {
+	Enabled              bool `json:"enabled"`
+	CrawlDelay           bool `json:"crawl_delay,omitempty"`
+	MaxCrawlDelaySeconds int  `json:"max_crawl_delay_seconds,omitempty"`
+}
+
+// HostDelays keeps the delay between the requests of each host and the time of their last request
+type HostDelays struct {
+	mutex        sync.Mutex
+	delays       map[string]time.Duration
+	nextRequests map[string]time.Time
+}
+
+var hostDelays = &HostDelays{delays: map[string]time.Duration{}, nextRequests: map[string]time.Time{}}
+
+// crawlDelayOverride is the delay of the --crawl-delay flag, used for every host instead of the robots.txt ones
+var crawlDelayOverride time.Duration = -1
+
+func (hostDelays *HostDelays) setDelay(host string, delay time.Duration) {
+	hostDelays.mutex.Lock()
+	defer hostDelays.mutex.Unlock()
+
+	hostDelays.delays[host] = delay
+}
+
+// wait blocks until the delay of the host since its last request has passed, the requests of parallel downloads
+// of the same host are spaced by the delay too
+func (hostDelays *HostDelays) wait(rawURL string) {
+	host := getURLHost(rawURL)
+
+	hostDelays.mutex.Lock()
+
+	delay, exists := hostDelays.delays[host]
+
+	if crawlDelayOverride >= 0 {
+		delay, exists = crawlDelayOverride, true
+	}
+
+	if !exists || delay <= 0 {
+		hostDelays.mutex.Unlock()
+		return
+	}
+
+	now := crawlerClock.Now()
+	requestTime := hostDelays.nextRequests[host]
+
+	if requestTime.Before(now) {
+		requestTime = now
+	}
+
+	hostDelays.nextRequests[host] = requestTime.Add(delay)
+	hostDelays.mutex.Unlock()
+
+	crawlerClock.Sleep(requestTime.Sub(now))
+}
+
+// getCrawlDelayFromRobotsTxt returns the crawl delay of the group of the crawler, or of the group of every agent
+// when the crawler has no group
+func getCrawlDelayFromRobotsTxt(content []byte) (time.Duration, bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	agents := []string{}
+	inRules := false
+	delays := map[string]time.Duration{}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if index := strings.Index(line, "#"); index >= 0 {
+			line = line[:index]
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+
+		if len(parts) != 2 {
+			continue
+		}
+
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := strings.TrimSpace(parts[1])
+
+		switch name {
+		case "user-agent":
+			// the agents of a group are the lines before its rules
+			if inRules {
+				agents = []string{}
+				inRules = false
+			}
+
+			agents = append(agents, strings.ToLower(value))
+		case "crawl-delay":
+			inRules = true
+			seconds, err := strconv.ParseFloat(value, 64)
+
+			if err != nil || seconds < 0 {
+				continue
+			}
+
+			for _, agent := range agents {
+				delays[agent] = time.Duration(seconds * float64(time.Second))
+			}
+		default:
+			inRules = true
+		}
+	}
+
+	if delay, exists := delays[robotsTxtUserAgent]; exists {
+		return delay, true
+	}
+
+	delay, exists := delays["*"]
+
+	return delay, exists
+}
+
+// updateSiteRobotsTxt fetches and saves the robots.txt of the site, using its crawl delay for the requests to the
+// site host when it is enabled
+func updateSiteRobotsTxt(site *Site, siteDir string, fetcher Fetcher) {
+	siteURL, err := url.Parse(site.URL)
+
+	if err != nil {
+		return
+	}
+
+	robotsURL := siteURL.ResolveReference(&url.URL{Path: "/" + robotsTxtFileName}).String()
+	content, _, err := fetchPage(fetcher, robotsURL)
+
+	if err != nil {
+		site.CrawlDelay = 0
+		return
+	}
+
+	err = writeFile(siteDir+string(filepath.Separator)+robotsTxtFileName, content, fileMode)
+
+	if err != nil {
+		printError("Unable to save site robots.txt:", err)
+	}
+
+	delay, exists := getCrawlDelayFromRobotsTxt(content)
+
+	if !exists {
+		site.CrawlDelay = 0
+		return
+	}
+
+	site.CrawlDelay = delay.Seconds()
+
+	if !configuration.RobotsTxt.CrawlDelay {
+		return
+	}
+
+	maxDelay := getTimeout(configuration.RobotsTxt.MaxCrawlDelaySeconds, defaultMaxCrawlDelay*time.Second)
+
+	if delay > maxDelay {
+		printInfo(fmt.Sprintf("Site crawl delay of %s is above the max crawl delay, using %s", delay, maxDelay))
+		delay = maxDelay
+	}
+
+	hostDelays.setDelay(getURLHost(site.URL), delay)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// system directories where an archive must never be written, the output dir can't be one of them or be inside
+// one of them
+var sensitiveDirs = []string{"/bin", "/boot", "/dev", "/etc", "/lib", "/lib32", "/lib64", "/proc", "/sbin", "/sys", "/usr"}
+
+// directories shared by other programs or users, the output dir can't be one of them but can be inside them
+var sharedDirs = []string{"/", "/home", "/root", "/tmp", "/var"}
+
+// SandboxConfig hardens the crawl: it refuses to run as root unless "allow_root" is set and, with "landlock" on
+// linux, the crawl can only write to its output, working and temp dirs and the "write_paths", and can only
+// connect to the tor ports and the "connect_ports"
+type SandboxConfig struct {
+	AllowRoot    bool     `json:"allow_root,omitempty"`
+	Landlock     bool     `json:"landlock,omitempty"`
+	WritePaths   []string `json:"write_paths,omitempty"`
+	ConnectPorts []int    `json:"connect_ports,omitempty"`
+}
+
+// checkPrivileges refuses to crawl as root, a parser bug exploited by a hostile page would own the system
+func checkPrivileges() error {
+	if os.Geteuid() != 0 || (configuration.Sandbox != nil && configuration.Sandbox.AllowRoot) {
+		return nil
+	}
+
+	return errors.New("the crawler must not run as root, use an unprivileged user or set sandbox.allow_root")
+}
+
+// checkOutputDir refuses output dirs that are system or shared dirs, where the saved files could replace files
+// of the system or of other users
+func checkOutputDir(outputDir string) error {
+	dir, err := filepath.Abs(outputDir)
+
+	if err != nil {
+		return err
+	}
+
+	if resolvedDir, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolvedDir
+	}
+
+	if runtime.GOOS == "windows" {
+		if systemRoot := os.Getenv("SystemRoot"); systemRoot != "" && isPathInside(dir, systemRoot) {
+			return errors.New("output dir is inside the system dir: " + dir)
+		}
+
+		return nil
+	}
+
+	for _, sensitiveDir := range sensitiveDirs {
+		if isPathInside(dir, sensitiveDir) {
+			return errors.New("output dir is a system dir: " + dir)
+		}
+	}
+
+	homeDir, _ := os.UserHomeDir()
+
+	for _, sharedDir := range append(sharedDirs, homeDir) {
+		if sharedDir != "" && filepath.Clean(sharedDir) == dir {
+			return errors.New("output dir is a shared dir, use a dir inside it: " + dir)
+		}
+	}
+
+	return nil
+}
+
+func isPathInside(path string, dir string) bool {
+	relativePath, err := filepath.Rel(filepath.Clean(dir), path)
+	return err == nil && relativePath != ".." && !strings.HasPrefix(relativePath, ".."+string(filepath.Separator))
+}
+
+// getSandboxWritePaths returns the dirs where the crawl writes, the other paths are read only in the sandbox
+func getSandboxWritePaths(currentDir string, outputDir string) []string {
+	result := []string{currentDir, outputDir, os.TempDir(), filepath.Dir(configurationFileName)}
+
+	if recordDir != "" {
+		result = append(result, recordDir)
+	}
+
+	// sqlite writes its journal next to the database
+	if configuration.Database != nil && (configuration.Database.Driver == "" || configuration.Database.Driver == storageDriverSQLite) {
+		result = append(result, filepath.Dir(configuration.Database.DSN))
+	}
+
+	return append(result, configuration.Sandbox.WritePaths...)
+}
+
+// getSandboxConnectPorts returns the tcp ports the crawl connects to, the tor socks and control ports and the
+// configured ones
+func getSandboxConnectPorts() []int {
+	result := append([]int{}, configuration.Sandbox.ConnectPorts...)
+	addresses := []string{torProxyAddress}
+
+	if configuration.TorControl != nil {
+		addresses = append(addresses, configuration.TorControl.Address)
+	}
+
+	for _, address := range addresses {
+		if _, port, err := net.SplitHostPort(address); err == nil {
+			if value, err := strconv.Atoi(port); err == nil {
+				result = append(result, value)
+			}
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,136 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// the kernel struct of the port rules of the landlock network access (ABI 4), missing in x/sys
+type landlockNetPortAttr struct {
+	allowedAccess uint64
+	port          uint64
+}
+
+const landlockRuleNetPort = 2
+
+const landlockReadAccess = unix.LANDLOCK_ACCESS_FS_EXECUTE | unix.LANDLOCK_ACCESS_FS_READ_FILE | unix.LANDLOCK_ACCESS_FS_READ_DIR
+
+// filesystem access rights handled by each landlock ABI version
+var landlockFSAccessByABI = []uint64{
+	1: 0x1fff,
+	2: 0x1fff | unix.LANDLOCK_ACCESS_FS_REFER,
+	3: 0x1fff | unix.LANDLOCK_ACCESS_FS_REFER | unix.LANDLOCK_ACCESS_FS_TRUNCATE,
+	4: 0x1fff | unix.LANDLOCK_ACCESS_FS_REFER | unix.LANDLOCK_ACCESS_FS_TRUNCATE,
+	5: 0x1fff | unix.LANDLOCK_ACCESS_FS_REFER | unix.LANDLOCK_ACCESS_FS_TRUNCATE | unix.LANDLOCK_ACCESS_FS_IOCTL_DEV,
+}
+
+// applySandbox restricts the process with landlock: the whole filesystem is read only but the write paths, and
+// with ABI 4 the tcp connections are limited to the connect ports. The processes started later, like the
+// screenshot browser, are restricted too
+func applySandbox(writePaths []string, connectPorts []int) error {
+	abi, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, 0, 0, unix.LANDLOCK_CREATE_RULESET_VERSION)
+
+	if errno != 0 {
+		return errors.New("landlock is not supported by the kernel: " + errno.Error())
+	}
+
+	if int(abi) >= len(landlockFSAccessByABI) {
+		abi = uintptr(len(landlockFSAccessByABI) - 1)
+	}
+
+	fsAccess := landlockFSAccessByABI[abi]
+	rulesetAttr := unix.LandlockRulesetAttr{Access_fs: fsAccess}
+
+	if abi >= 4 {
+		rulesetAttr.Access_net = unix.LANDLOCK_ACCESS_NET_CONNECT_TCP
+	}
+
+	rulesetFD, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, uintptr(unsafe.Pointer(&rulesetAttr)), unsafe.Sizeof(rulesetAttr), 0)
+
+	if errno != 0 {
+		return errors.New("unable to create landlock ruleset: " + errno.Error())
+	}
+
+	defer unix.Close(int(rulesetFD))
+
+	err := addLandlockPathRule(int(rulesetFD), "/", landlockReadAccess)
+
+	if err != nil {
+		return err
+	}
+
+	for _, path := range writePaths {
+		if path == "" {
+			continue
+		}
+
+		err = addLandlockPathRule(int(rulesetFD), path, fsAccess)
+
+		// paths that don't exist yet can't be written after the sandbox
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if abi >= 4 {
+		for _, port := range connectPorts {
+			portAttr := landlockNetPortAttr{allowedAccess: unix.LANDLOCK_ACCESS_NET_CONNECT_TCP, port: uint64(port)}
+			_, _, errno = unix.Syscall6(unix.SYS_LANDLOCK_ADD_RULE, rulesetFD, landlockRuleNetPort, uintptr(unsafe.Pointer(&portAttr)), 0, 0, 0)
+
+			if errno != 0 {
+				return fmt.Errorf("unable to add landlock rule of port %d: %s", port, errno.Error())
+			}
+		}
+	} else {
+		printInfo("Landlock ABI", abi, "has no network rules, the connections are not restricted")
+	}
+
+	// the restriction must apply to all the threads of the go runtime, this fails in the builds with cgo
+	_, _, errno = syscall.AllThreadsSyscall(unix.SYS_PRCTL, unix.PR_SET_NO_NEW_PRIVS, 1, 0)
+
+	if errno != 0 {
+		return errors.New("unable to set no new privileges: " + errno.Error())
+	}
+
+	_, _, errno = syscall.AllThreadsSyscall(unix.SYS_LANDLOCK_RESTRICT_SELF, rulesetFD, 0, 0)
+
+	if errno != 0 {
+		return errors.New("unable to apply landlock ruleset: " + errno.Error())
+	}
+
+	return nil
+}
+
+func addLandlockPathRule(rulesetFD int, path string, access uint64) error {
+	fd, err := unix.Open(path, unix.O_PATH|unix.O_CLOEXEC, 0)
+
+	if err != nil {
+		return &os.PathError{Op: "open", Path: path, Err: err}
+	}
+
+	defer unix.Close(fd)
+
+	// files can't have the dir rights
+	var stat unix.Stat_t
+
+	if unix.Fstat(fd, &stat) == nil && stat.Mode&unix.S_IFMT != unix.S_IFDIR {
+		access &= unix.LANDLOCK_ACCESS_FS_EXECUTE | unix.LANDLOCK_ACCESS_FS_WRITE_FILE | unix.LANDLOCK_ACCESS_FS_READ_FILE | unix.LANDLOCK_ACCESS_FS_TRUNCATE | unix.LANDLOCK_ACCESS_FS_IOCTL_DEV
+	}
+
+	pathAttr := unix.LandlockPathBeneathAttr{Allowed_access: access, Parent_fd: int32(fd)}
+	_, _, errno := unix.Syscall6(unix.SYS_LANDLOCK_ADD_RULE, uintptr(rulesetFD), unix.LANDLOCK_RULE_PATH_BENEATH, uintptr(unsafe.Pointer(&pathAttr)), 0, 0, 0)
+
+	if errno != 0 {
+		return fmt.Errorf("unable to add landlock rule of %s: %s", path, errno.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "errors"
+
+func applySandbox(writePaths []string, connectPorts []int) error {
+	return errors.New("landlock is only supported on linux")
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+const safeViewSuffix = ".safe.html"
+
+// the policy of the safe view, in case a reference is missed by the sanitizer, only the local files and the data
+// urls are loaded
+const safeViewContentSecurityPolicy = "default-src 'self' data:; style-src 'self' 'unsafe-inline'; script-src 'none'; object-src 'none'; form-action 'none'; base-uri 'none'"
+
+// elements that run code or load other documents, they are removed with their content
+var sanitizedElements = map[string]bool{
+	"script": true, "object": true, "embed": true, "applet": true, "base": true, "portal": true,
+}
+
+// attributes with urls, they are removed when they reference other hosts
+var sanitizedURLAttributes = map[string]bool{
+	"href": true, "src": true, "srcset": true, "action": true, "formaction": true, "poster": true, "data": true,
+	"background": true, "cite": true, "longdesc": true, "ping": true, "manifest": true, "codebase": true,
+	"lowsrc": true, "dynsrc": true, "xlink:href": true,
+}
+
+// the urls of the styles, from url() and @import
+var styleURLPattern = regexp.MustCompile(`(?i)(?:url\(\s*|@import\s+)['"]?([^'")\s;]+)`)
+
+func getSafeViewFileName(htmlFileName string) string {
+	return strings.TrimSuffix(htmlFileName, ".html") + safeViewSuffix
+}
+
+// saveSafeViewFile saves the sanitized copy of the html file next to it
+func saveSafeViewFile(htmlFileName string, content []byte) error {
+	sanitizedContent, err := getSanitizedHTML(content)
+
+	if err != nil {
+		return err
+	}
+
+	return writeFile(getSafeViewFileName(htmlFileName), sanitizedContent, fileMode)
+}
+
+// getSanitizedHTML returns the html without scripts, event handlers, meta refreshes, plugins and references to
+// other hosts, so it can be opened without running code of the site or making requests. The local frames are
+// changed to their safe view
+func getSanitizedHTML(content []byte) ([]byte, error) {
+	doc, err := html.Parse(bytes.NewReader(content))
+
+	if err != nil {
+		return nil, err
+	}
+
+	var sanitizeNode func(node *html.Node)
+
+	sanitizeNode = func(node *html.Node) {
+		for child := node.FirstChild; child != nil; {
+			next := child.NextSibling
+
+			if child.Type == html.ElementNode && isSanitizedElement(child) {
+				node.RemoveChild(child)
+			} else {
+				sanitizeNode(child)
+			}
+
+			child = next
+		}
+
+		if node.Type == html.ElementNode {
+			node.Attr = getSanitizedAttributes(node)
+		}
+	}
+
+	sanitizeNode(doc)
+
+	if head := findElement(doc, "head"); head != nil {
+		policy := &html.Node{Type: html.ElementNode, Data: "meta", Attr: []html.Attribute{
+			{Key: "http-equiv", Val: "Content-Security-Policy"},
+			{Key: "content", Val: safeViewContentSecurityPolicy},
+		}}
+
+		head.InsertBefore(policy, head.FirstChild)
+	}
+
+	buffer := &bytes.Buffer{}
+
+	if err := html.Render(buffer, doc); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func isSanitizedElement(node *html.Node) bool {
+	name := strings.ToLower(node.Data)
+
+	if sanitizedElements[name] {
+		return true
+	}
+
+	switch name {
+	case "meta":
+		httpEquiv := strings.ToLower(getNodeAttribute(node, "http-equiv"))
+		return httpEquiv == "refresh" || httpEquiv == "set-cookie"
+	case "iframe", "frame":
+		return !isSafeReference(getNodeAttribute(node, "src"))
+	case "style":
+		return node.FirstChild != nil && !isSafeStyle(node.FirstChild.Data)
+	}
+
+	return false
+}
+
+func getSanitizedAttributes(node *html.Node) []html.Attribute {
+	result := []html.Attribute{}
+	isFrame := node.Data == "iframe" || node.Data == "frame"
+
+	for _, attribute := range node.Attr {
+		key := strings.ToLower(attribute.Key)
+
+		if attribute.Namespace != "" {
+			key = attribute.Namespace + ":" + key
+		}
+
+		switch {
+		case strings.HasPrefix(key, "on"):
+			continue
+		case key == "srcdoc":
+			continue
+		case key == "style" && !isSafeStyle(attribute.Val):
+			continue
+		case key == "srcset" && !isSafeSrcset(attribute.Val):
+			continue
+		case sanitizedURLAttributes[key] && key != "srcset" && !isSafeReference(attribute.Val):
+			continue
+		}
+
+		// the local frames are saved with their own safe view
+		if isFrame && key == "src" && strings.HasSuffix(strings.ToLower(attribute.Val), ".html") {
+			attribute.Val = getSafeViewFileName(attribute.Val)
+		}
+
+		result = append(result, attribute)
+	}
+
+	return result
+}
+
+// isSafeReference returns if the url is a reference to a local file, or an image data uri
+func isSafeReference(value string) bool {
+	value = strings.ToLower(strings.TrimSpace(value))
+
+	if strings.HasPrefix(value, "//") || strings.HasPrefix(value, "\\\\") {
+		return false
+	}
+
+	if strings.HasPrefix(value, "data:") {
+		return strings.HasPrefix(value, "data:image/") && !strings.HasPrefix(value, "data:image/svg")
+	}
+
+	return getURLScheme(value) == ""
+}
+
+func isSafeSrcset(value string) bool {
+	for _, candidate := range strings.Split(value, ",") {
+		if fields := strings.Fields(candidate); len(fields) > 0 && !isSafeReference(fields[0]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isSafeStyle(value string) bool {
+	lowerValue := strings.ToLower(value)
+
+	if strings.Contains(lowerValue, "expression(") || strings.Contains(lowerValue, "javascript:") {
+		return false
+	}
+
+	for _, match := range styleURLPattern.FindAllStringSubmatch(value, -1) {
+		if !isSafeReference(match[1]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func findElement(node *html.Node, name string) *html.Node {
+	if node.Type == html.ElementNode && node.Data == name {
+		return node
+	}
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if result := findElement(child, name); result != nil {
+			return result
+		}
+	}
+
+	return nil
+}
+
+// sanitizeSiteDir saves the safe view of every html file of the site dir, except the snapshots
+func sanitizeSiteDir(siteDir string) (int, error) {
+	result := 0
+
+	err := filepath.Walk(siteDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		if info.IsDir() {
+			if info.Name() == snapshotsDirName {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if !strings.HasSuffix(path, ".html") || strings.HasSuffix(path, safeViewSuffix) {
+			return nil
+		}
+
+		content, err := ioutil.ReadFile(path)
+
+		if err != nil {
+			return err
+		}
+
+		if err := saveSafeViewFile(path, content); err != nil {
+			return err
+		}
+
+		result++
+
+		return nil
+	})
+
+	return result, err
+}
+
+func runSanitizeCommand(args []string) {
+	flags := flag.NewFlagSet("sanitize", flag.ExitOnError)
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fmt.Printf("Usage : %s sanitize <configuration file> \n", os.Args[0])
+		os.Exit(exitCodeConfigError)
+	}
+
+	configurationFileName = flags.Arg(0)
+
+	loadConfigurationFile()
+
+	currentDir, err := os.Getwd()
+
+	if err != nil {
+		fmt.Println("Unable to get current directory:", err)
+		os.Exit(exitCodeError)
+	}
+
+	outputDir := getOutputDir(currentDir)
+	totalOfFiles := 0
+
+	for _, site := range configuration.Sites {
+		files, err := sanitizeSiteDir(outputDir + string(filepath.Separator) + getSiteDirName(site))
+
+		if err != nil {
+			fmt.Println("Unable to sanitize site files:", site.URL, err)
+		}
+
+		totalOfFiles += files
+	}
+
+	fmt.Println(fmt.Sprintf("Saved the safe view of %d html files", totalOfFiles))
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type CrawlWindow struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// parseCrawlWindow parses a local time window like "01:00-06:00", windows can cross midnight like "22:00-04:00"
+func parseCrawlWindow(value string) (*CrawlWindow, error) {
+	parts := strings.Split(value, "-")
+
+	if len(parts) != 2 {
+		return nil, errors.New("crawl window must be like 01:00-06:00: " + value)
+	}
+
+	start, err := parseTimeOfDay(parts[0])
+
+	if err != nil {
+		return nil, err
+	}
+
+	end, err := parseTimeOfDay(parts[1])
+
+	if err != nil {
+		return nil, err
+	}
+
+	// a window that starts when it ends would never be open
+	if start == end {
+		return nil, errors.New("crawl window must have a different start and end: " + value)
+	}
+
+	return &CrawlWindow{Start: start, End: end}, nil
+}
+
+func parseTimeOfDay(value string) (time.Duration, error) {
+	parsedTime, err := time.Parse("15:04", strings.TrimSpace(value))
+
+	if err != nil {
+		return 0, errors.New("invalid time of day: " + value)
+	}
+
+	return time.Duration(parsedTime.Hour())*time.Hour + time.Duration(parsedTime.Minute())*time.Minute, nil
+}
+
+func (window *CrawlWindow) Contains(timeOfDay time.Duration) bool {
+	if window.Start <= window.End {
+		return timeOfDay >= window.Start && timeOfDay < window.End
+	}
+
+	return timeOfDay >= window.Start || timeOfDay < window.End
+}
+
+func getTimeOfDay(now time.Time) time.Duration {
+	return time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute + time.Duration(now.Second())*time.Second
+}
+
+// getWaitForCrawlWindows returns how long to wait until one of the windows is open, zero when crawling is allowed now
+func getWaitForCrawlWindows(windows []*CrawlWindow, now time.Time) time.Duration {
+	if len(windows) == 0 {
+		return 0
+	}
+
+	timeOfDay := getTimeOfDay(now)
+	var wait time.Duration = -1
+
+	for _, window := range windows {
+		if window.Contains(timeOfDay) {
+			return 0
+		}
+
+		windowWait := window.Start - timeOfDay
+
+		if windowWait < 0 {
+			windowWait += 24 * time.Hour
+		}
+
+		if wait < 0 || windowWait < wait {
+			wait = windowWait
+		}
+	}
+
+	return wait
+}
+
+func waitForCrawlWindows(windows []*CrawlWindow) {
+	wait := getWaitForCrawlWindows(windows, crawlerClock.Now())
+
+	if wait <= 0 {
+		return
+	}
+
+	printInfo(fmt.Sprintf("Outside of crawl window, pausing until %s...", crawlerClock.Now().Add(wait).Format("15:04")))
+
+	// the wait is slept in steps, so an interrupted crawl doesn't wait for the window
+	for wait > 0 && !isCrawlAborted() {
+		if wait > time.Second {
+			wait = time.Second
+		}
+
+		crawlerClock.Sleep(wait)
+		wait = getWaitForCrawlWindows(windows, crawlerClock.Now())
+	}
+
+	if !isCrawlAborted() {
+		printInfo("Crawl window is open, resuming...")
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const screenshotFileName = "screenshot.png"
+const previousScreenshotFileName = "screenshot-previous.png"
+const defaultScreenshotBrowser = "chromium"
+const defaultScreenshotWidth = 1280
+const defaultScreenshotHeight = 800
+const defaultScreenshotTimeout = 60 * time.Second
+const defaultScreenshotDiffThreshold = 6
+
+// the screenshots are compared in a grid of blocks, a block changed when its mean luminance changed more than this
+const screenshotDiffGridSize = 32
+const screenshotDiffBlockThreshold = 16
+
+type ScreenshotConfig struct {
+	Enabled        bool   `json:"enabled"`
+	Browser        string `json:"browser,omitempty"`
+	Width          int    `json:"width,omitempty"`
+	Height         int    `json:"height,omitempty"`
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty"`
+	DiffThreshold  int    `json:"diff_threshold,omitempty"`
+}
+
+// ScreenshotDiff is the difference between the current and the previous screenshot of the site
+type ScreenshotDiff struct {
+	Distance        int     `json:"distance"`
+	ChangedArea     float64 `json:"changed_area"`
+	VisuallyChanged bool    `json:"visually_changed"`
+}
+
+func isScreenshotsEnabled() bool {
+	return configuration.Screenshots != nil && configuration.Screenshots.Enabled
+}
+
+// takeScreenshot opens the url in a headless browser that uses the tor proxy, the host names are resolved by
+// the proxy so the browser doesn't leak dns requests
+func takeScreenshot(siteURL string, fileName string) error {
+	config := configuration.Screenshots
+	browser := config.Browser
+
+	if browser == "" {
+		browser = defaultScreenshotBrowser
+	}
+
+	width := config.Width
+
+	if width <= 0 {
+		width = defaultScreenshotWidth
+	}
+
+	height := config.Height
+
+	if height <= 0 {
+		height = defaultScreenshotHeight
+	}
+
+	// the browser profile is temporary, so cookies and cache are not shared between sites
+	profileDir, err := ioutil.TempDir("", "go-tor-crawler-browser")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.RemoveAll(profileDir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), getTimeout(config.TimeoutSeconds, defaultScreenshotTimeout))
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, browser,
+		"--headless",
+		"--disable-gpu",
+		"--hide-scrollbars",
+		"--no-first-run",
+		"--incognito",
+		"--user-data-dir="+profileDir,
+		"--proxy-server=socks5://"+torProxyAddress,
+		"--host-resolver-rules=MAP * ~NOTFOUND , EXCLUDE "+strings.Split(torProxyAddress, ":")[0],
+		"--window-size="+strconv.Itoa(width)+","+strconv.Itoa(height),
+		"--screenshot="+fileName,
+		siteURL,
+	).CombinedOutput()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	if _, err := os.Stat(fileName); err != nil {
+		return errors.New("browser saved no screenshot")
+	}
+
+	return nil
+}
+
+// updateSiteScreenshot takes a new screenshot of the site and compares it with the previous one, which is kept
+// as the previous screenshot file
+func updateSiteScreenshot(site *Site, siteDir string) {
+	fileName := siteDir + string(filepath.Separator) + screenshotFileName
+	previousFileName := siteDir + string(filepath.Separator) + previousScreenshotFileName
+	newFileName := fileName + ".new"
+	site.ScreenshotDiff = nil
+
+	printInfo("Taking site screenshot...")
+
+	err := takeScreenshot(site.URL, newFileName)
+
+	if err != nil {
+		os.Remove(newFileName)
+		printError("Unable to take site screenshot:", err)
+		emitEvent("screenshot_failed", site, site.URL, err, nil)
+		return
+	}
+
+	hash := getImagePerceptualHash(newFileName)
+
+	if site.ScreenshotHash != "" && hash != "" {
+		site.ScreenshotDiff = getScreenshotDiff(site.ScreenshotHash, hash, fileName, newFileName)
+	}
+
+	if _, err := os.Stat(fileName); err == nil {
+		err = os.Rename(fileName, previousFileName)
+
+		if err != nil {
+			printError("Unable to save previous site screenshot:", err)
+		}
+	}
+
+	err = os.Rename(newFileName, fileName)
+
+	if err != nil {
+		printError("Unable to save site screenshot:", err)
+		return
+	}
+
+	site.ScreenshotHash = hash
+
+	if site.ScreenshotDiff != nil && site.ScreenshotDiff.VisuallyChanged {
+		printInfo(fmt.Sprintf("Site visually changed (distance %d, %.0f%% of the page)", site.ScreenshotDiff.Distance, site.ScreenshotDiff.ChangedArea))
+		emitEvent("site_visually_changed", site, site.URL, nil, map[string]interface{}{
+			"distance":     site.ScreenshotDiff.Distance,
+			"changed_area": site.ScreenshotDiff.ChangedArea,
+		})
+	}
+}
+
+func getScreenshotDiff(previousHash string, hash string, previousFileName string, fileName string) *ScreenshotDiff {
+	previousValue, err := strconv.ParseUint(previousHash, 16, 64)
+
+	if err != nil {
+		return nil
+	}
+
+	value, err := strconv.ParseUint(hash, 16, 64)
+
+	if err != nil {
+		return nil
+	}
+
+	threshold := configuration.Screenshots.DiffThreshold
+
+	if threshold <= 0 {
+		threshold = defaultScreenshotDiffThreshold
+	}
+
+	diff := &ScreenshotDiff{Distance: getPerceptualHashDistance(previousValue, value)}
+	diff.VisuallyChanged = diff.Distance > threshold
+	diff.ChangedArea = getScreenshotChangedArea(previousFileName, fileName)
+
+	return diff
+}
+
+// getScreenshotChangedArea returns the percentage of the page blocks whose luminance changed, the previous
+// screenshot may be missing when the site dir was cleaned
+func getScreenshotChangedArea(previousFileName string, fileName string) float64 {
+	previousGrid := getScreenshotGrid(previousFileName)
+	grid := getScreenshotGrid(fileName)
+
+	if previousGrid == nil || grid == nil {
+		return 0
+	}
+
+	changedBlocks := 0
+
+	for index := range grid {
+		difference := grid[index] - previousGrid[index]
+
+		if difference < 0 {
+			difference = -difference
+		}
+
+		if difference > screenshotDiffBlockThreshold {
+			changedBlocks++
+		}
+	}
+
+	return float64(changedBlocks) * 100 / float64(len(grid))
+}
+
+// getScreenshotGrid returns the mean luminance of each block of the image
+func getScreenshotGrid(fileName string) []float64 {
+	img, err := decodeImageFile(fileName)
+
+	if err != nil {
+		return nil
+	}
+
+	bounds := img.Bounds()
+
+	if bounds.Dx() < screenshotDiffGridSize || bounds.Dy() < screenshotDiffGridSize {
+		return nil
+	}
+
+	sums := make([]float64, screenshotDiffGridSize*screenshotDiffGridSize)
+	counts := make([]float64, len(sums))
+
+	// a pixel of every two is enough for the mean of the block
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += 2 {
+		row := (y - bounds.Min.Y) * screenshotDiffGridSize / bounds.Dy()
+
+		for x := bounds.Min.X; x < bounds.Max.X; x += 2 {
+			column := (x - bounds.Min.X) * screenshotDiffGridSize / bounds.Dx()
+			r, g, b, _ := img.At(x, y).RGBA()
+			index := row*screenshotDiffGridSize + column
+
+			sums[index] += (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 257
+			counts[index]++
+		}
+	}
+
+	for index := range sums {
+		if counts[index] > 0 {
+			sums[index] /= counts[index]
+		}
+	}
+
+	return sums
+}
+
+// printVisuallyChangedSites prints the sites whose screenshot changed since the previous crawl and returns
+// how many they are
+func printVisuallyChangedSites(sites []*Site) int {
+	changedSites := []*Site{}
+
+	for _, site := range sites {
+		if site.ScreenshotDiff != nil && site.ScreenshotDiff.VisuallyChanged {
+			changedSites = append(changedSites, site)
+		}
+	}
+
+	if len(changedSites) == 0 {
+		return 0
+	}
+
+	printInfo(fmt.Sprintf("%d sites visually changed since the previous screenshot:", len(changedSites)))
+
+	for _, site := range changedSites {
+		printInfo(fmt.Sprintf("  %s (distance %d, %.0f%% of the page)", site.URL, site.ScreenshotDiff.Distance, site.ScreenshotDiff.ChangedArea))
+	}
+
+	return len(changedSites)
+}
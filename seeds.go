@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// importSeeds adds the urls of a text file (one url per line), a csv file (with a header like
+// "url,max_depth,max_pages,path_prefix,max_bytes,crawl_feeds,tags,robots_policy") or stdin ("-") to the site list,
+// returning the number of sites added. Without format the csv files are found by their extension
+func importSeeds(fileName string, format string) (int, error) {
+	if format == "" && strings.EqualFold(filepath.Ext(fileName), ".csv") {
+		format = "csv"
+	}
+
+	if format != "" && format != "text" && format != "csv" {
+		return 0, fmt.Errorf("unknown seeds format: %s", format)
+	}
+
+	var reader io.Reader = os.Stdin
+
+	if fileName != "-" {
+		file, err := os.Open(fileName)
+
+		if err != nil {
+			return 0, err
+		}
+
+		defer file.Close()
+
+		reader = file
+	}
+
+	var sites []*Site
+	var err error
+
+	if format == "csv" {
+		sites, err = getSeedsFromCSV(reader)
+	} else {
+		sites, err = getSeedsFromText(reader)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	existingURLs := map[string]bool{}
+
+	for _, site := range configuration.Sites {
+		existingURLs[normalizeURL(site.URL)] = true
+	}
+
+	added := 0
+
+	for _, site := range sites {
+		if existingURLs[normalizeURL(site.URL)] {
+			continue
+		}
+
+		existingURLs[normalizeURL(site.URL)] = true
+		site.Project = configurationProject
+		configuration.Sites = append(configuration.Sites, site)
+		added++
+	}
+
+	return added, nil
+}
+
+func getSeedsFromText(reader io.Reader) ([]*Site, error) {
+	result := []*Site{}
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		seedURL, err := getSeedURL(line)
+
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+
+		result = append(result, &Site{URL: seedURL})
+	}
+
+	return result, scanner.Err()
+}
+
+func getSeedsFromCSV(reader io.Reader) ([]*Site, error) {
+	result := []*Site{}
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	csvReader.Comment = '#'
+	csvReader.TrimLeadingSpace = true
+
+	header, err := csvReader.Read()
+
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{}
+
+	for index, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(column))] = index
+	}
+
+	if _, exists := columns["url"]; !exists {
+		return nil, errors.New("csv header has no url column")
+	}
+
+	for {
+		record, err := csvReader.Read()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := csvReader.FieldPos(0)
+
+		value := func(column string) string {
+			index, exists := columns[column]
+
+			if !exists || index >= len(record) {
+				return ""
+			}
+
+			return strings.TrimSpace(record[index])
+		}
+
+		seedURL, err := getSeedURL(value("url"))
+
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+
+		site := &Site{URL: seedURL, PathPrefix: value("path_prefix")}
+
+		if tags := getTags(value("tags")); len(tags) > 0 {
+			site.Tags = tags
+		}
+
+		if site.MaxDepth, err = getSeedInt(value("max_depth")); err != nil {
+			return nil, fmt.Errorf("line %d: invalid max_depth: %v", line, err)
+		}
+
+		if site.MaxPages, err = getSeedInt(value("max_pages")); err != nil {
+			return nil, fmt.Errorf("line %d: invalid max_pages: %v", line, err)
+		}
+
+		maxBytes, err := getSeedInt(value("max_bytes"))
+
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid max_bytes: %v", line, err)
+		}
+
+		site.MaxBytes = int64(maxBytes)
+
+		if crawlFeeds := value("crawl_feeds"); crawlFeeds != "" {
+			if site.CrawlFeeds, err = strconv.ParseBool(crawlFeeds); err != nil {
+				return nil, fmt.Errorf("line %d: invalid crawl_feeds: %v", line, err)
+			}
+		}
+
+		if site.RobotsPolicy = value("robots_policy"); !isKnownRobotsPolicy(site.RobotsPolicy) {
+			return nil, fmt.Errorf("line %d: invalid robots_policy: %s", line, site.RobotsPolicy)
+		}
+
+		result = append(result, site)
+	}
+
+	return result, nil
+}
+
+func getSeedInt(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	return strconv.Atoi(value)
+}
+
+// getSeedURL accepts full urls and bare onion addresses, that are fetched with http
+func getSeedURL(value string) (string, error) {
+	value = strings.TrimSpace(value)
+
+	if value == "" {
+		return "", errors.New("empty url")
+	}
+
+	if !strings.Contains(value, "://") {
+		value = "http://" + value
+	}
+
+	scheme := getURLScheme(value)
+
+	if scheme != "http" && scheme != "https" {
+		return "", errors.New("invalid url: " + value)
+	}
+
+	if getURLHost(value) == "" {
+		return "", errors.New("invalid url: " + value)
+	}
+
+	return strings.TrimRight(value, "/"), nil
+}
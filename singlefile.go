@@ -0,0 +1,294 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const defaultInlineMaxBytes = 100 * 1024
+
+const singleFileChecksumsFileName = "SHA256SUMS"
+
+const singleFileExportDirName = "single"
+
+// the references annotated with their hash when they are not inlined
+var singleFileReferences = []struct {
+	Selector  string
+	Attribute string
+}{
+	{"img[src]", "src"},
+	{"link[href]", "href"},
+	{"script[src]", "src"},
+	{"iframe[src]", "src"},
+	{"frame[src]", "src"},
+	{"source[src]", "src"},
+	{"video[src]", "src"},
+	{"audio[src]", "src"},
+}
+
+// SingleFileExport counts the references of the exported pages
+type SingleFileExport struct {
+	Pages      int
+	Inlined    int
+	Annotated  int
+	Unresolved int
+}
+
+// getSRIHash returns the subresource integrity hash of the content
+func getSRIHash(content []byte) string {
+	hash := sha256.Sum256(content)
+	return "sha256-" + base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// getSingleFileLocalPath returns the archived file of the reference, the images are saved by their src without the
+// site url, other references are looked up by their path on the site
+func getSingleFileLocalPath(site *Site, siteDir string, pageURL string, value string) string {
+	value = strings.TrimSpace(value)
+
+	if value == "" || strings.HasPrefix(value, "#") || getURLScheme(value) == "data" {
+		return ""
+	}
+
+	candidates := []string{strings.TrimPrefix(strings.Replace(value, site.URL+"/", "", -1), "/")}
+
+	if baseURL, err := url.Parse(pageURL); err == nil {
+		if referenceURL, err := baseURL.Parse(value); err == nil && strings.EqualFold(referenceURL.Hostname(), baseURL.Hostname()) {
+			candidates = append(candidates, strings.TrimPrefix(referenceURL.Path, "/"))
+		}
+	}
+
+	for _, candidate := range candidates {
+		if candidate == "" || getURLScheme(candidate) != "" || strings.Contains(candidate, "..") {
+			continue
+		}
+
+		fileName := siteDir + string(filepath.Separator) + filepath.FromSlash(strings.SplitN(candidate, "?", 2)[0])
+
+		if info, err := os.Stat(fileName); err == nil && !info.IsDir() {
+			return fileName
+		}
+	}
+
+	return ""
+}
+
+// getSingleFileHTML inlines the archived stylesheets and the archived images up to the max size as data uris, the
+// other archived references get an integrity attribute with their hash
+func getSingleFileHTML(site *Site, siteDir string, pageURL string, content []byte, maxInlineBytes int64, result *SingleFileExport) ([]byte, error) {
+	doc, err := parseHTML(content)
+
+	if err != nil {
+		return nil, err
+	}
+
+	doc.Find("link[href]").Each(func(index int, link *goquery.Selection) {
+		if !strings.Contains(strings.ToLower(link.AttrOr("rel", "")), "stylesheet") {
+			return
+		}
+
+		fileName := getSingleFileLocalPath(site, siteDir, pageURL, link.AttrOr("href", ""))
+
+		if fileName == "" {
+			return
+		}
+
+		style, err := ioutil.ReadFile(fileName)
+
+		if err != nil {
+			return
+		}
+
+		link.ReplaceWithHtml("<style>" + strings.Replace(string(style), "</", "<\\/", -1) + "</style>")
+		result.Inlined++
+	})
+
+	doc.Find("img[src]").Each(func(index int, image *goquery.Selection) {
+		fileName := getSingleFileLocalPath(site, siteDir, pageURL, image.AttrOr("src", ""))
+
+		if fileName == "" {
+			return
+		}
+
+		info, err := os.Stat(fileName)
+
+		if err != nil || info.Size() > maxInlineBytes {
+			return
+		}
+
+		imageContent, err := ioutil.ReadFile(fileName)
+
+		if err != nil {
+			return
+		}
+
+		contentType := mime.TypeByExtension(strings.ToLower(filepath.Ext(fileName)))
+
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		image.SetAttr("src", "data:"+contentType+";base64,"+base64.StdEncoding.EncodeToString(imageContent))
+		image.SetAttr("integrity", getSRIHash(imageContent))
+		image.RemoveAttr("srcset")
+		result.Inlined++
+	})
+
+	for _, reference := range singleFileReferences {
+		doc.Find(reference.Selector).Each(func(index int, element *goquery.Selection) {
+			value := element.AttrOr(reference.Attribute, "")
+
+			if getURLScheme(value) == "data" || strings.HasPrefix(value, "#") {
+				return
+			}
+
+			fileName := getSingleFileLocalPath(site, siteDir, pageURL, value)
+
+			if fileName == "" {
+				result.Unresolved++
+				return
+			}
+
+			referenceContent, err := ioutil.ReadFile(fileName)
+
+			if err != nil {
+				result.Unresolved++
+				return
+			}
+
+			element.SetAttr("integrity", getSRIHash(referenceContent))
+			result.Annotated++
+		})
+	}
+
+	html, err := doc.Html()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(html), nil
+}
+
+// saveSingleFileChecksums writes the sha256 of the exported files in the format of sha256sum, so the captures can
+// be verified with "sha256sum -c"
+func saveSingleFileChecksums(exportDir string, checksums map[string]string) error {
+	fileNames := []string{}
+
+	for fileName := range checksums {
+		fileNames = append(fileNames, fileName)
+	}
+
+	sort.Strings(fileNames)
+
+	content := &strings.Builder{}
+
+	for _, fileName := range fileNames {
+		content.WriteString(checksums[fileName] + "  " + fileName + "\n")
+	}
+
+	return writeFile(filepath.Join(exportDir, singleFileChecksumsFileName), []byte(content.String()), fileMode)
+}
+
+func runExportSingleCommand(args []string) {
+	flags := flag.NewFlagSet("export-single", flag.ExitOnError)
+	maxInlineBytes := flags.Int64("max-inline-bytes", defaultInlineMaxBytes, "inline the images up to this size, the bigger ones are annotated with their hash")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 || flags.NArg() > 2 || *maxInlineBytes < 0 {
+		fmt.Printf("Usage : %s export-single [-max-inline-bytes n] <configuration file> [export dir] \n", os.Args[0])
+		os.Exit(exitCodeConfigError)
+	}
+
+	configurationFileName = flags.Arg(0)
+
+	loadConfigurationFile()
+
+	currentDir, err := os.Getwd()
+
+	if err != nil {
+		fmt.Println("Unable to get current directory:", err)
+		os.Exit(exitCodeError)
+	}
+
+	outputDir := getOutputDir(currentDir)
+	exportDir := outputDir + string(filepath.Separator) + singleFileExportDirName
+
+	if flags.NArg() == 2 {
+		exportDir = flags.Arg(1)
+	}
+
+	if err := os.MkdirAll(exportDir, dirMode); err != nil {
+		fmt.Println("Unable to create export directory:", err)
+		os.Exit(exitCodeError)
+	}
+
+	result := &SingleFileExport{}
+	checksums := map[string]string{}
+
+	for _, site := range configuration.Sites {
+		siteDir := outputDir + string(filepath.Separator) + getSiteDirName(site)
+
+		for _, resource := range getCDXResources([]*Site{site}, outputDir) {
+			if !strings.HasPrefix(resource.ContentType, "text/html") {
+				continue
+			}
+
+			content, err := ioutil.ReadFile(resource.FileName)
+
+			if err != nil {
+				fmt.Println("Unable to read archived page:", err)
+				continue
+			}
+
+			content, err = getSingleFileHTML(site, siteDir, resource.URL, content, *maxInlineBytes, result)
+
+			if err != nil {
+				fmt.Println("Unable to export page:", resource.URL, err)
+				continue
+			}
+
+			relativePath, err := filepath.Rel(outputDir, resource.FileName)
+
+			if err != nil {
+				fmt.Println("Unable to export page:", resource.URL, err)
+				continue
+			}
+
+			fileName := filepath.Join(exportDir, relativePath)
+			err = os.MkdirAll(filepath.Dir(fileName), dirMode)
+
+			if err == nil {
+				err = writeFile(fileName, content, fileMode)
+			}
+
+			if err != nil {
+				fmt.Println("Unable to save exported page:", err)
+				os.Exit(exitCodeError)
+			}
+
+			hash := sha256.Sum256(content)
+			checksums[filepath.ToSlash(relativePath)] = fmt.Sprintf("%x", hash)
+			result.Pages++
+		}
+	}
+
+	err = saveSingleFileChecksums(exportDir, checksums)
+
+	if err != nil {
+		fmt.Println("Unable to save checksums:", err)
+		os.Exit(exitCodeError)
+	}
+
+	fmt.Println(fmt.Sprintf("Exported %d pages to %s - %d references inlined, %d annotated with their hash, %d not archived", result.Pages, exportDir, result.Inlined, result.Annotated, result.Unresolved))
+}
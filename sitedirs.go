@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/metal3d/go-slugify"
+)
+
+const siteDirsFileName = "site-dirs.json"
+
+// the names of the site dirs made by the template, by site url, saved to the output dir so a site keeps its dir
+// when its title or the template changes
+var siteDirs = struct {
+	sync.Mutex
+	fileName string
+	names    map[string]string
+}{}
+
+// getSiteDirName returns the name of the dir of the site in the output dir. Without a template it is the slug of
+// the url, with a template the name is made once, unique in the output dir, and saved to the mapping file. The
+// sites with a request body have the hash of the request after the name, so each request has its own dir
+func getSiteDirName(site *Site) string {
+	if configuration == nil || configuration.SiteDirTemplate == "" {
+		return getSiteSlugWithRequest(site, getSiteSlug(site.URL))
+	}
+
+	siteDirs.Lock()
+	defer siteDirs.Unlock()
+
+	if err := loadSiteDirs(); err != nil {
+		printError("Unable to load site dirs:", err)
+		return getSiteSlugWithRequest(site, getSiteSlug(site.URL))
+	}
+
+	mappingKey := getSiteDirMappingKey(site)
+
+	if name, exists := siteDirs.names[mappingKey]; exists {
+		return name
+	}
+
+	// the files of the site are saved to the dir of its slug until its title is known
+	if isSiteDirNamePending(site) {
+		return getSiteSlugWithRequest(site, getSiteSlug(site.URL))
+	}
+
+	return addSiteDirName(site, mappingKey, getNewSiteDirName(site, true))
+}
+
+// getSiteDirMappingKey returns the key of the site in the mapping file, the sites fetched with a plain GET are saved
+// by their url
+func getSiteDirMappingKey(site *Site) string {
+	if requestHash := getSiteRequestHash(site); requestHash != "" {
+		return site.URL + "#" + requestHash
+	}
+
+	return site.URL
+}
+
+// addSiteDirName saves the name of the dir of the site to the mapping file
+func addSiteDirName(site *Site, mappingKey string, name string) string {
+	siteDirs.names[mappingKey] = name
+
+	if err := saveSiteDirs(); err != nil {
+		printError("Unable to save site dirs:", err)
+	}
+
+	return name
+}
+
+// isSiteDirNamePending returns if the name of the site dir waits for the title of the site, that is only known after
+// the site is parsed for the first time
+func isSiteDirNamePending(site *Site) bool {
+	return configuration != nil && strings.Contains(configuration.SiteDirTemplate, "${SITE_TITLE}") && site.Title == "" && !site.FetchSuccess
+}
+
+// nameParsedSiteDir names the dir of the site that waited for its title, once the title of the parsed site is set,
+// and moves the files saved to the dir of its slug to it. It returns the dir of the site
+func nameParsedSiteDir(site *Site, outputDir string, siteDir string) string {
+	if configuration == nil || configuration.SiteDirTemplate == "" {
+		return siteDir
+	}
+
+	siteDirs.Lock()
+	defer siteDirs.Unlock()
+
+	if err := loadSiteDirs(); err != nil {
+		printError("Unable to load site dirs:", err)
+		return siteDir
+	}
+
+	mappingKey := getSiteDirMappingKey(site)
+
+	if _, exists := siteDirs.names[mappingKey]; exists {
+		return siteDir
+	}
+
+	// the dir of the slug has the files of the previous attempts of the site, it is not kept as the name of the site
+	name := addSiteDirName(site, mappingKey, getNewSiteDirName(site, false))
+	newSiteDir := outputDir + string(filepath.Separator) + name
+
+	if newSiteDir == siteDir {
+		return siteDir
+	}
+
+	// the dir of the slug is only moved when no other site uses it
+	if _, err := os.Stat(siteDir); err == nil && !isSiteDirUsed(filepath.Base(siteDir)) {
+		if err := os.Rename(siteDir, newSiteDir); err != nil {
+			printError("Unable to move site dir:", siteDir, err)
+		}
+	}
+
+	return newSiteDir
+}
+
+// loadSiteDirs reads the mapping file of the output dir, once for each output dir
+func loadSiteDirs() error {
+	currentDir, err := os.Getwd()
+
+	if err != nil {
+		return err
+	}
+
+	fileName := getOutputDir(currentDir) + string(filepath.Separator) + siteDirsFileName
+
+	if siteDirs.fileName == fileName {
+		return nil
+	}
+
+	names := map[string]string{}
+	content, err := ioutil.ReadFile(fileName)
+
+	if err == nil {
+		err = json.Unmarshal(content, &names)
+	} else if os.IsNotExist(err) {
+		err = nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	siteDirs.fileName = fileName
+	siteDirs.names = names
+
+	return nil
+}
+
+func saveSiteDirs() error {
+	content, err := json.MarshalIndent(siteDirs.names, "", "\t")
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(siteDirs.fileName), dirMode); err != nil {
+		return err
+	}
+
+	return writeFile(siteDirs.fileName, content, fileMode)
+}
+
+// getNewSiteDirName expands the template for the site, the existing dir of the slug is kept when asked so the sites
+// crawled before the template keep their files. A number is added to the names used by other sites
+func getNewSiteDirName(site *Site, keepSlugDir bool) string {
+	outputDir := filepath.Dir(siteDirs.fileName)
+	slug := getSiteSlugWithRequest(site, getSiteSlug(site.URL))
+
+	if info, err := os.Stat(outputDir + string(filepath.Separator) + slug); keepSlugDir && err == nil && info.IsDir() && !isSiteDirUsed(slug) {
+		return slug
+	}
+
+	name := slugify.Marshal(expandVariables(configuration.SiteDirTemplate, site.URL))
+
+	if name == "" {
+		name = slug
+	} else {
+		name = getSiteSlugWithRequest(site, name)
+	}
+
+	result := name
+
+	for index := 2; isSiteDirUsed(result) || isReservedSiteDirName(result); index++ {
+		result = name + "-" + strconv.Itoa(index)
+	}
+
+	return result
+}
+
+// getSiteSlugWithRequest adds the hash of the request of the site to the name of its dir
+func getSiteSlugWithRequest(site *Site, name string) string {
+	if requestHash := getSiteRequestHash(site); requestHash != "" {
+		return name + "-" + requestHash
+	}
+
+	return name
+}
+
+func isSiteDirUsed(name string) bool {
+	for _, usedName := range siteDirs.names {
+		if usedName == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isReservedSiteDirName returns if the name is used by the output dir, like the dirs of the exports
+func isReservedSiteDirName(name string) bool {
+	return name == bundlesDirName || name == cdxExportDirName || name == singleFileExportDirName
+}
+
+// getURLPath returns the path of the url without the slashes of its ends, like "forum/topics"
+func getURLPath(rawURL string) string {
+	parsedURL, err := url.Parse(rawURL)
+
+	if err != nil {
+		return ""
+	}
+
+	return strings.Trim(parsedURL.Path, "/")
+}
+
+// getSiteTitle returns the title of the site of the configuration, or its host when it was not fetched yet
+func getSiteTitle(siteURL string) string {
+	if configuration != nil {
+		for _, site := range configuration.Sites {
+			if site.URL == siteURL && strings.TrimSpace(site.Title) != "" {
+				return strings.TrimSpace(site.Title)
+			}
+		}
+	}
+
+	return getURLHost(siteURL)
+}
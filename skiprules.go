@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// SkipRule skips the archiving of a response by its headers, before its body is downloaded. A rule skips when all
+// its conditions match
+type SkipRule struct {
+	MaxContentLength int64    `json:"max_content_length,omitempty"`
+	ContentTypes     []string `json:"content_types,omitempty"`
+	Header           string   `json:"header,omitempty"`
+	Pattern          string   `json:"pattern,omitempty"`
+}
+
+// SkipError is returned for the responses skipped by a rule
+type SkipError struct {
+	URL    string
+	Reason string
+}
+
+func (err *SkipError) Error() string {
+	return fmt.Sprintf("skipped by rule (%s) %s", err.Reason, err.URL)
+}
+
+// SkipLimit is the max_content_length of a rule that matches a response without length, the response is skipped
+// when its body reaches the limit
+type SkipLimit struct {
+	Bytes  int64
+	Reason string
+}
+
+// getSkipRules returns the skip rules of the site, the sites without rules use the configuration ones
+func getSkipRules(site *Site) []*SkipRule {
+	if len(site.SkipRules) > 0 {
+		return site.SkipRules
+	}
+
+	return configuration.SkipRules
+}
+
+// getSkipReason returns why the response is skipped by the rules, or an empty string when no rule matches. The
+// responses without length that match the other conditions of a rule with max_content_length have the lowest limit
+// of these rules, checked while their body is read
+func getSkipReason(rules []*SkipRule, response *http.Response) (string, *SkipLimit) {
+	var limit *SkipLimit
+
+	for _, rule := range rules {
+		reasons := []string{}
+		unknownLength := false
+
+		if rule.MaxContentLength > 0 {
+			if response.ContentLength < 0 {
+				unknownLength = true
+			} else if response.ContentLength <= rule.MaxContentLength {
+				continue
+			} else {
+				reasons = append(reasons, fmt.Sprintf("content length %d above %d", response.ContentLength, rule.MaxContentLength))
+			}
+		}
+
+		if len(rule.ContentTypes) > 0 {
+			contentType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+
+			if isSkipRuleContentType(rule.ContentTypes, contentType) {
+				continue
+			}
+
+			reasons = append(reasons, "content type "+contentType)
+		}
+
+		if rule.Header != "" {
+			value, matched := getSkipRuleHeader(rule, response.Header)
+
+			if !matched {
+				continue
+			}
+
+			reasons = append(reasons, fmt.Sprintf("header %s: %s", rule.Header, value))
+		}
+
+		if unknownLength {
+			if limit == nil || rule.MaxContentLength < limit.Bytes {
+				reasons = append([]string{fmt.Sprintf("content length above %d", rule.MaxContentLength)}, reasons...)
+				limit = &SkipLimit{Bytes: rule.MaxContentLength, Reason: strings.Join(reasons, ", ")}
+			}
+
+			continue
+		}
+
+		if len(reasons) > 0 {
+			return strings.Join(reasons, ", "), nil
+		}
+	}
+
+	return "", limit
+}
+
+// readSkipLimitedBody reads the page body, the body above the limit of the skip rules is not downloaded further and
+// its skip reason is returned instead
+func readSkipLimitedBody(body io.Reader, pageURL string, limit *SkipLimit) ([]byte, string, error) {
+	if limit == nil {
+		content, err := readPageBody(body, pageURL)
+		return content, "", err
+	}
+
+	// one more byte tells if the body is above the limit
+	content, err := readPageBody(io.LimitReader(body, limit.Bytes+1), pageURL)
+
+	if err == nil && int64(len(content)) > limit.Bytes {
+		return nil, limit.Reason, nil
+	}
+
+	return content, "", err
+}
+
+// isSkipRuleContentType checks if the content type is one of the accepted ones, like "text/html" or "text/*"
+func isSkipRuleContentType(contentTypes []string, contentType string) bool {
+	for _, accepted := range contentTypes {
+		accepted = strings.ToLower(strings.TrimSpace(accepted))
+
+		if accepted == contentType || (strings.HasSuffix(accepted, "/*") && strings.HasPrefix(contentType, strings.TrimSuffix(accepted, "*"))) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getSkipRuleHeader returns the value of the header of the rule, it matches when it is present and, with a
+// pattern, when one of its values matches the pattern
+func getSkipRuleHeader(rule *SkipRule, header http.Header) (string, bool) {
+	for _, value := range header.Values(rule.Header) {
+		if rule.Pattern == "" {
+			return value, true
+		}
+
+		if matched, err := regexp.MatchString(rule.Pattern, value); err == nil && matched {
+			return value, true
+		}
+	}
+
+	return "", false
+}
+
+// fetchSitePage is the fetchPage of the pages of the site, with the content type of the response. The responses
+// skipped by the site rules are closed before their body is downloaded
+func fetchSitePage(site *Site, fetcher Fetcher, pageURL string) ([]byte, string, int, error) {
+	response, err := getURL(fetcher, pageURL)
+
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	defer response.Body.Close()
+
+	reason, limit := getSkipReason(getSkipRules(site), response)
+
+	if reason != "" {
+		return nil, "", response.StatusCode, &SkipError{URL: pageURL, Reason: reason}
+	}
+
+	if !isSuccessStatusCode(response.StatusCode) {
+		return nil, "", response.StatusCode, &StatusError{URL: pageURL, StatusCode: response.StatusCode}
+	}
+
+	content, reason, err := readSkipLimitedBody(response.Body, pageURL, limit)
+
+	if reason != "" {
+		return nil, "", response.StatusCode, &SkipError{URL: pageURL, Reason: reason}
+	}
+
+	return content, response.Header.Get("Content-Type"), response.StatusCode, err
+}
+
+// getSkipRulesError returns the problem of the rules for the configuration validation
+func getSkipRulesError(rules []*SkipRule) string {
+	for _, rule := range rules {
+		if rule == nil || (rule.MaxContentLength <= 0 && len(rule.ContentTypes) == 0 && rule.Header == "") {
+			return "skip rules need a max_content_length, content_types or header"
+		}
+
+		if rule.Pattern != "" && rule.Header == "" {
+			return "skip rule pattern needs a header"
+		}
+
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			return "invalid skip rule pattern: " + err.Error()
+		}
+	}
+
+	return ""
+}
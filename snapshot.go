@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const snapshotsDirName = "snapshots"
+const snapshotNameLayout = "20060102T150405Z"
+
+// createSnapshot copies the current site files to a dated snapshot directory, files that didn't change
+// since the previous snapshot are hard linked to it so each snapshot only costs the delta in disk space
+func createSnapshot(siteDir string) (string, error) {
+	snapshotsDir := filepath.Join(siteDir, snapshotsDirName)
+	previousSnapshotDir := ""
+
+	if snapshots := getSnapshotNames(snapshotsDir); len(snapshots) > 0 {
+		previousSnapshotDir = filepath.Join(snapshotsDir, snapshots[len(snapshots)-1])
+	}
+
+	snapshotName := crawlerClock.Now().UTC().Format(snapshotNameLayout)
+	snapshotDir := filepath.Join(snapshotsDir, snapshotName)
+	linkedFiles := 0
+	copiedFiles := 0
+
+	err := filepath.Walk(siteDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if path == snapshotsDir {
+			return filepath.SkipDir
+		}
+
+		relativePath, err := filepath.Rel(siteDir, path)
+
+		if err != nil {
+			return err
+		}
+
+		targetPath := filepath.Join(snapshotDir, relativePath)
+
+		if info.IsDir() {
+			return os.MkdirAll(targetPath, dirMode)
+		}
+
+		// snapshot files are never linked to the live files, since those are rewritten in place
+		if previousSnapshotDir != "" {
+			previousPath := filepath.Join(previousSnapshotDir, relativePath)
+
+			if isSameFileContent(path, previousPath) {
+				if err := os.Link(previousPath, targetPath); err == nil {
+					linkedFiles++
+					return nil
+				}
+			}
+		}
+
+		copiedFiles++
+
+		return copyFile(path, targetPath)
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	printInfo(fmt.Sprintf("Snapshot %s created - %d files linked, %d files copied", snapshotName, linkedFiles, copiedFiles))
+
+	return snapshotName, nil
+}
+
+func getSnapshotNames(snapshotsDir string) []string {
+	result := []string{}
+	files, err := ioutil.ReadDir(snapshotsDir)
+
+	if err != nil {
+		return result
+	}
+
+	for _, file := range files {
+		if !file.IsDir() {
+			continue
+		}
+
+		if _, err := time.Parse(snapshotNameLayout, file.Name()); err == nil {
+			result = append(result, file.Name())
+		}
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
+func isSameFileContent(firstFileName string, secondFileName string) bool {
+	firstInfo, err := os.Stat(firstFileName)
+
+	if err != nil {
+		return false
+	}
+
+	secondInfo, err := os.Stat(secondFileName)
+
+	if err != nil || firstInfo.Size() != secondInfo.Size() {
+		return false
+	}
+
+	firstHash, err := getFileHash(firstFileName)
+
+	if err != nil {
+		return false
+	}
+
+	secondHash, err := getFileHash(secondFileName)
+
+	if err != nil {
+		return false
+	}
+
+	return bytes.Equal(firstHash, secondHash)
+}
+
+func getFileHash(fileName string) ([]byte, error) {
+	file, err := os.Open(fileName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	hash := sha256.New()
+
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, err
+	}
+
+	return hash.Sum(nil), nil
+}
+
+func copyFile(sourceFileName string, targetFileName string) error {
+	source, err := os.Open(sourceFileName)
+
+	if err != nil {
+		return err
+	}
+
+	defer source.Close()
+
+	target, err := createFile(targetFileName, fileMode)
+
+	if err != nil {
+		return err
+	}
+
+	defer target.Close()
+
+	_, err = io.Copy(target, source)
+
+	if err != nil {
+		return err
+	}
+
+	return target.Close()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const softErrorEmpty = "empty"
+const softErrorNotFound = "not_found"
+const softErrorParked = "parked"
+
+// pages with more text than this are real content even if they have some of the phrases
+const softErrorMaxTextLength = 1024
+
+var notFoundPhrases = []string{
+	"404",
+	"not found",
+	"page does not exist",
+	"page doesn't exist",
+	"no such page",
+	"no longer available",
+	"has been removed",
+	"has been seized",
+	"site is offline",
+	"onion site not found",
+}
+
+var parkedPhrases = []string{
+	"welcome to nginx",
+	"apache2 ubuntu default page",
+	"apache2 debian default page",
+	"test page for the apache",
+	"it works!",
+	"lighttpd placeholder page",
+	"default web page",
+	"this domain is parked",
+	"domain is for sale",
+	"under construction",
+	"coming soon",
+}
+
+// getSoftErrorFromDocument classifies pages that are returned with success but are errors, like empty pages,
+// "not found" pages and hosting placeholders, and returns an empty string for real pages
+func getSoftErrorFromDocument(doc *goquery.Document) string {
+	title := strings.ToLower(getCleanText(doc.Find("title").Text()))
+	heading := strings.ToLower(getCleanText(getVisibleText(doc.Find("h1").First())))
+	text := strings.ToLower(getCleanText(getVisibleText(doc.Find("body"))))
+
+	if text == "" && title == "" && doc.Find("img, a[href], form, iframe, frame").Length() == 0 {
+		return softErrorEmpty
+	}
+
+	if len(text) > softErrorMaxTextLength {
+		return ""
+	}
+
+	parked := append(parkedPhrases, configuration.ParkedPhrases...)
+
+	for _, phrase := range parked {
+		if phrase != "" && (strings.Contains(title, strings.ToLower(phrase)) || strings.Contains(text, strings.ToLower(phrase))) {
+			return softErrorParked
+		}
+	}
+
+	notFound := append(notFoundPhrases, configuration.NotFoundPhrases...)
+
+	for _, phrase := range notFound {
+		if phrase != "" && (strings.Contains(title, strings.ToLower(phrase)) || strings.Contains(heading, strings.ToLower(phrase))) {
+			return softErrorNotFound
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"database/sql"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openSQLiteStorage(fileName string) (Storage, error) {
+	db, err := sql.Open("sqlite3", fileName+"?_busy_timeout=5000")
+
+	if err != nil {
+		return nil, err
+	}
+
+	// sqlite has one writer, so the connections are not shared by the writes
+	db.SetMaxOpenConns(1)
+
+	storage := &SQLStorage{DB: db, Rebind: rebindNone}
+	err = storage.migrate()
+
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return storage, nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const defaultStatsTop = 10
+
+// the request of the errors of net/http, like Get "http://example.onion":
+var statsRequestErrorPattern = regexp.MustCompile(`^[A-Z]+ "[^"]*": `)
+
+// CrawlStats aggregates the sites of the configuration file, their history and their files
+type CrawlStats struct {
+	Sites          int          `json:"sites"`
+	FetchedSites   int          `json:"fetched_sites"`
+	SuccessRate    float64      `json:"success_rate"`
+	Attempts       int          `json:"attempts"`
+	FailedAttempts int          `json:"failed_attempts"`
+	AverageLatency int64        `json:"average_latency_ms"`
+	Pages          int          `json:"pages"`
+	Images         int          `json:"images"`
+	TotalBytes     int64        `json:"total_bytes"`
+	BytesPerSite   int64        `json:"bytes_per_site"`
+	TopErrors      []*StatsItem `json:"top_errors"`
+	LargestAssets  []*StatsItem `json:"largest_assets"`
+}
+
+// StatsItem is an error reason with its count or an asset with its size
+type StatsItem struct {
+	Name  string `json:"name"`
+	Value int64  `json:"value"`
+}
+
+// getCrawlStats returns the stats of the sites, the history gives the attempts, latencies and errors and the site
+// dirs give the sizes
+func getCrawlStats(sites []*Site, outputDir string, top int) *CrawlStats {
+	stats := &CrawlStats{Sites: len(sites)}
+	errorCounts := map[string]int64{}
+	assets := []*StatsItem{}
+	var totalLatency int64
+	latencies := 0
+
+	for _, site := range sites {
+		if site.FetchSuccess {
+			stats.FetchedSites++
+		}
+
+		stats.Pages += len(site.Pages)
+		stats.Images += len(site.Images)
+
+		history, err := getSiteHistory(site)
+
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Println("Unable to read site history:", site.URL, err)
+		}
+
+		for _, entry := range history {
+			stats.Attempts++
+
+			if entry.LatencyMillis > 0 {
+				totalLatency += entry.LatencyMillis
+				latencies++
+			}
+
+			if !entry.Success {
+				stats.FailedAttempts++
+				errorCounts[getStatsErrorReason(site, entry)]++
+			}
+		}
+
+		siteDir := outputDir + string(filepath.Separator) + getSiteDirName(site)
+
+		filepath.Walk(siteDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return nil
+			}
+
+			stats.TotalBytes += info.Size()
+
+			if relativePath, err := filepath.Rel(outputDir, path); err == nil {
+				assets = append(assets, &StatsItem{Name: filepath.ToSlash(relativePath), Value: info.Size()})
+			}
+
+			// only the biggest files are kept, archives can have millions of files
+			if len(assets) > top*100 {
+				assets = getTopStatsItems(assets, top)
+			}
+
+			return nil
+		})
+	}
+
+	if stats.Sites > 0 {
+		stats.SuccessRate = float64(stats.FetchedSites) / float64(stats.Sites)
+		stats.BytesPerSite = stats.TotalBytes / int64(stats.Sites)
+	}
+
+	if latencies > 0 {
+		stats.AverageLatency = totalLatency / int64(latencies)
+	}
+
+	stats.TopErrors = []*StatsItem{}
+
+	for reason, count := range errorCounts {
+		stats.TopErrors = append(stats.TopErrors, &StatsItem{Name: reason, Value: count})
+	}
+
+	stats.TopErrors = getTopStatsItems(stats.TopErrors, top)
+	stats.LargestAssets = getTopStatsItems(assets, top)
+
+	return stats
+}
+
+// getStatsErrorReason groups the failures by their tor error class, status code or soft error, the other
+// errors by their message without the request and the site url
+func getStatsErrorReason(site *Site, entry *SiteHistoryEntry) string {
+	if entry.TorErrorClass != "" {
+		return entry.TorErrorClass
+	}
+
+	if entry.SoftError != "" {
+		return "soft error: " + entry.SoftError
+	}
+
+	if entry.StatusCode > 0 {
+		return "status code " + strconv.Itoa(entry.StatusCode)
+	}
+
+	reason := statsRequestErrorPattern.ReplaceAllString(entry.Error, "")
+
+	return strings.TrimSpace(strings.Replace(reason, site.URL, "", -1))
+}
+
+// getTopStatsItems returns the items with the biggest values, in order
+func getTopStatsItems(items []*StatsItem, top int) []*StatsItem {
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Value != items[j].Value {
+			return items[i].Value > items[j].Value
+		}
+
+		return items[i].Name < items[j].Name
+	})
+
+	if len(items) > top {
+		items = items[:top]
+	}
+
+	return items
+}
+
+func runStatsCommand(args []string) {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	useJSON := flags.Bool("json", false, "print the stats as json")
+	top := flags.Int("top", defaultStatsTop, "number of error reasons and assets to show")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 || *top < 1 {
+		fmt.Printf("Usage : %s stats [-json] [-top n] <configuration file> \n", os.Args[0])
+		os.Exit(exitCodeConfigError)
+	}
+
+	configurationFileName = flags.Arg(0)
+
+	loadConfigurationFile()
+
+	currentDir, err := os.Getwd()
+
+	if err != nil {
+		fmt.Println("Unable to get current directory:", err)
+		os.Exit(exitCodeError)
+	}
+
+	stats := getCrawlStats(configuration.Sites, getOutputDir(currentDir), *top)
+
+	if *useJSON {
+		statsJSON, err := json.MarshalIndent(stats, "", "\t")
+
+		if err != nil {
+			fmt.Println("Unable to get stats:", err)
+			os.Exit(exitCodeError)
+		}
+
+		fmt.Println(string(statsJSON))
+		return
+	}
+
+	fmt.Println(fmt.Sprintf("Sites: %d, %d fetched (%.0f%%)", stats.Sites, stats.FetchedSites, stats.SuccessRate*100))
+	fmt.Println(fmt.Sprintf("Attempts: %d, %d failed", stats.Attempts, stats.FailedAttempts))
+	fmt.Println(fmt.Sprintf("Average latency: %d ms", stats.AverageLatency))
+	fmt.Println(fmt.Sprintf("Pages: %d, images: %d", stats.Pages, stats.Images))
+	fmt.Println(fmt.Sprintf("Total size: %s, %s per site", formatBytes(stats.TotalBytes), formatBytes(stats.BytesPerSite)))
+
+	if len(stats.TopErrors) > 0 {
+		fmt.Println("Top errors:")
+
+		for _, item := range stats.TopErrors {
+			fmt.Println(fmt.Sprintf("  %6d  %s", item.Value, item.Name))
+		}
+	}
+
+	if len(stats.LargestAssets) > 0 {
+		fmt.Println("Largest assets:")
+
+		for _, item := range stats.LargestAssets {
+			fmt.Println(fmt.Sprintf("  %10s  %s", formatBytes(item.Value), item.Name))
+		}
+	}
+}
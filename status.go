@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const errorsDirName = "errors"
+
+type StatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (err *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d from %s", err.StatusCode, err.URL)
+}
+
+// isSuccessStatusCode checks if the status code is 2xx or one of the configured accepted status codes
+func isSuccessStatusCode(statusCode int) bool {
+	if statusCode >= 200 && statusCode <= 299 {
+		return true
+	}
+
+	for _, acceptedStatusCode := range configuration.AcceptedStatusCodes {
+		if acceptedStatusCode == statusCode {
+			return true
+		}
+	}
+
+	return false
+}
+
+// saveErrorPage saves the body of an error response to the errors directory of the site with the error name, like
+// the status code, so it doesn't replace the site index.html
+func saveErrorPage(siteDir string, name string, content []byte) error {
+	errorsDir := siteDir + string(filepath.Separator) + errorsDirName
+	err := os.MkdirAll(errorsDir, dirMode)
+
+	if err != nil {
+		return err
+	}
+
+	return writeFile(errorsDir+string(filepath.Separator)+name+".html", content, fileMode)
+}
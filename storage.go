@@ -0,0 +1,383 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const storageDriverSQLite = "sqlite"
+const storageDriverPostgres = "postgres"
+
+type DatabaseConfig struct {
+	Driver string `json:"driver,omitempty"`
+	DSN    string `json:"dsn"`
+}
+
+// Storage saves the crawl metadata of the sites, their pages, images, links and findings, so it can be
+// queried with sql
+type Storage interface {
+	SaveSite(site *Site, siteDir string, links []*Link, findings map[string][]string) error
+	Query(query string) ([]string, [][]string, error)
+	Close() error
+}
+
+// SQLStorage is the storage of the sql databases (sqlite and postgresql), the queries are written with ?
+// placeholders and rebound to the placeholders of the database
+type SQLStorage struct {
+	DB     *sql.DB
+	Rebind func(query string) string
+}
+
+// the schema changes are applied in order and never changed, new changes are added to the end
+var storageMigrations = []string{
+	`CREATE TABLE sites (
+		url TEXT PRIMARY KEY,
+		title TEXT,
+		language TEXT,
+		tags TEXT,
+		categories TEXT,
+		fetch_success BOOLEAN,
+		status_code INTEGER,
+		soft_error TEXT,
+		content_hash TEXT,
+		favicon_hash TEXT,
+		last_success TIMESTAMP,
+		last_failure TIMESTAMP,
+		updated_at TIMESTAMP
+	)`,
+	`CREATE TABLE pages (
+		site_url TEXT NOT NULL,
+		url TEXT NOT NULL,
+		depth INTEGER,
+		file_name TEXT,
+		status_code INTEGER,
+		content_hash TEXT,
+		title TEXT,
+		text TEXT,
+		fetched_at TIMESTAMP,
+		PRIMARY KEY (site_url, url)
+	)`,
+	`CREATE TABLE images (
+		site_url TEXT NOT NULL,
+		url TEXT NOT NULL,
+		fetch_success BOOLEAN,
+		perceptual_hash TEXT,
+		quarantined BOOLEAN,
+		scan_result TEXT,
+		PRIMARY KEY (site_url, url)
+	)`,
+	`CREATE TABLE links (
+		site_url TEXT NOT NULL,
+		page_url TEXT,
+		url TEXT NOT NULL,
+		text TEXT,
+		title TEXT,
+		context TEXT
+	)`,
+	`CREATE TABLE findings (
+		site_url TEXT NOT NULL,
+		scanner TEXT NOT NULL,
+		value TEXT NOT NULL,
+		PRIMARY KEY (site_url, scanner, value)
+	)`,
+	`CREATE INDEX links_url ON links (url)`,
+	`CREATE INDEX findings_value ON findings (value)`,
+	`ALTER TABLE pages ADD COLUMN author TEXT`,
+	`ALTER TABLE pages ADD COLUMN published TIMESTAMP`,
+	`ALTER TABLE pages ADD COLUMN article_text TEXT`,
+}
+
+var storage Storage
+
+func openStorage(config *DatabaseConfig) (Storage, error) {
+	if config == nil || config.DSN == "" {
+		return nil, nil
+	}
+
+	dsn := expandVariables(config.DSN, "")
+
+	switch config.Driver {
+	case "", storageDriverSQLite:
+		return openSQLiteStorage(dsn)
+	case storageDriverPostgres:
+		return openPostgresStorage(dsn)
+	}
+
+	return nil, errors.New("unknown database driver: " + config.Driver)
+}
+
+func rebindNone(query string) string {
+	return query
+}
+
+// migrate applies the schema changes that were not applied to the database
+func (storage *SQLStorage) migrate() error {
+	_, err := storage.DB.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`)
+
+	if err != nil {
+		return err
+	}
+
+	version := 0
+	err = storage.DB.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+
+	if err != nil {
+		return err
+	}
+
+	for index := version; index < len(storageMigrations); index++ {
+		tx, err := storage.DB.Begin()
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(storageMigrations[index])
+
+		if err == nil {
+			_, err = tx.Exec(storage.Rebind(`INSERT INTO schema_migrations (version) VALUES (?)`), index+1)
+		}
+
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %v", index+1, err)
+		}
+
+		err = tx.Commit()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SaveSite replaces the metadata of the site with its current state
+func (storage *SQLStorage) SaveSite(site *Site, siteDir string, links []*Link, findings map[string][]string) error {
+	tx, err := storage.DB.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	err = storage.saveSite(tx, site, siteDir, links, findings)
+
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (storage *SQLStorage) saveSite(tx *sql.Tx, site *Site, siteDir string, links []*Link, findings map[string][]string) error {
+	var lastSuccess, lastFailure sql.NullTime
+
+	if site.Availability != nil {
+		lastSuccess = getNullTime(site.Availability.LastSuccess)
+		lastFailure = getNullTime(site.Availability.LastFailure)
+	}
+
+	_, err := tx.Exec(storage.Rebind(`INSERT INTO sites (url, title, language, tags, categories, fetch_success, status_code, soft_error, content_hash, favicon_hash, last_success, last_failure, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (url) DO UPDATE SET title = excluded.title, language = excluded.language, tags = excluded.tags, categories = excluded.categories,
+		fetch_success = excluded.fetch_success, status_code = excluded.status_code, soft_error = excluded.soft_error, content_hash = excluded.content_hash,
+		favicon_hash = excluded.favicon_hash, last_success = excluded.last_success, last_failure = excluded.last_failure, updated_at = excluded.updated_at`),
+		site.URL, site.Title, site.Language, strings.Join(site.Tags, ","), strings.Join(site.Categories, ","), site.FetchSuccess, site.StatusCode,
+		site.SoftError, site.ContentHash, site.FaviconHash, lastSuccess, lastFailure, time.Now().UTC())
+
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"pages", "images", "links", "findings"} {
+		_, err = tx.Exec(storage.Rebind(`DELETE FROM `+table+` WHERE site_url = ?`), site.URL)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	// the site page is saved as the page of depth 0
+	pages := []*Page{{URL: site.URL, FileName: "index.html", FetchSuccess: site.FetchSuccess, StatusCode: site.StatusCode, ContentHash: site.ContentHash, FetchedAt: lastSuccess.Time}}
+
+	for _, page := range append(pages, site.Pages...) {
+		if !page.FetchSuccess {
+			continue
+		}
+
+		text, article := getStoragePageText(siteDir + string(filepath.Separator) + filepath.FromSlash(page.FileName))
+		published := sql.NullTime{}
+
+		if article.Published != nil {
+			published = getNullTime(*article.Published)
+		}
+
+		_, err = tx.Exec(storage.Rebind(`INSERT INTO pages (site_url, url, depth, file_name, status_code, content_hash, title, text, fetched_at, author, published, article_text) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (site_url, url) DO NOTHING`),
+			site.URL, page.URL, page.Depth, page.FileName, page.StatusCode, page.ContentHash, article.Title, text, getNullTime(page.FetchedAt), article.Author, published, article.Text)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, image := range site.Images {
+		_, err = tx.Exec(storage.Rebind(`INSERT INTO images (site_url, url, fetch_success, perceptual_hash, quarantined, scan_result) VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT (site_url, url) DO NOTHING`),
+			site.URL, image.URL, image.FetchSuccess, image.PerceptualHash, image.Quarantined, image.ScanResult)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, link := range links {
+		_, err = tx.Exec(storage.Rebind(`INSERT INTO links (site_url, page_url, url, text, title, context) VALUES (?, ?, ?, ?, ?, ?)`),
+			site.URL, link.Page, link.URL, link.Text, link.Title, link.Context)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	for scanner, values := range findings {
+		for _, value := range values {
+			_, err = tx.Exec(storage.Rebind(`INSERT INTO findings (site_url, scanner, value) VALUES (?, ?, ?) ON CONFLICT (site_url, scanner, value) DO NOTHING`),
+				site.URL, scanner, value)
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Query runs the sql and returns the column names and the rows as text
+func (storage *SQLStorage) Query(query string) ([]string, [][]string, error) {
+	rows, err := storage.DB.Query(query)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := [][]string{}
+
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+
+		for index := range values {
+			pointers[index] = &values[index]
+		}
+
+		err = rows.Scan(pointers...)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		row := make([]string, len(columns))
+
+		for index, value := range values {
+			switch value := value.(type) {
+			case nil:
+				row[index] = ""
+			case []byte:
+				row[index] = string(value)
+			case time.Time:
+				row[index] = value.UTC().Format(time.RFC3339)
+			default:
+				row[index] = fmt.Sprint(value)
+			}
+		}
+
+		result = append(result, row)
+	}
+
+	return columns, result, rows.Err()
+}
+
+func (storage *SQLStorage) Close() error {
+	return storage.DB.Close()
+}
+
+func getNullTime(value time.Time) sql.NullTime {
+	return sql.NullTime{Time: value, Valid: !value.IsZero()}
+}
+
+// getStoragePageText returns the visible text of a saved page and its article, the article text has no menus and
+// footers
+func getStoragePageText(fileName string) (string, *Article) {
+	content, err := ioutil.ReadFile(fileName)
+
+	if err != nil {
+		return "", &Article{}
+	}
+
+	doc, err := parseHTML(content)
+
+	if err != nil {
+		return "", &Article{}
+	}
+
+	article := getArticleFromDocument(doc)
+	doc.Find("script, style, noscript").Remove()
+
+	return getCleanText(doc.Find("body").Text()), article
+}
+
+func runQueryCommand(args []string) {
+	if len(args) != 2 {
+		fmt.Printf("Usage : %s query <configuration file> <sql> \n", os.Args[0])
+		os.Exit(exitCodeConfigError)
+	}
+
+	configurationFileName = args[0]
+	loadConfigurationFile()
+
+	querier, err := openStorage(configuration.Database)
+
+	if err == nil && querier == nil {
+		err = errors.New("configuration file has no database")
+	}
+
+	if err != nil {
+		fmt.Println("Unable to open database:", err)
+		os.Exit(exitCodeError)
+	}
+
+	defer querier.Close()
+
+	columns, rows, err := querier.Query(args[1])
+
+	if err != nil {
+		fmt.Println("Unable to run query:", err)
+		os.Exit(exitCodeError)
+	}
+
+	fmt.Println(strings.Join(columns, "\t"))
+
+	for _, row := range rows {
+		fmt.Println(strings.Join(row, "\t"))
+	}
+
+	fmt.Println(fmt.Sprintf("%d rows", len(rows)))
+}
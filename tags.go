@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const untaggedGroupName = "untagged"
+
+// selectedTags are the tags of the --tags flag, only the sites with one of them are crawled
+var selectedTags []string
+
+// getTags splits a list of tags separated by commas, semicolons or spaces
+func getTags(value string) []string {
+	result := []string{}
+
+	for _, tag := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' || r == ' ' }) {
+		result = append(result, strings.ToLower(tag))
+	}
+
+	return result
+}
+
+func hasSiteTag(site *Site, tag string) bool {
+	for _, siteTag := range site.Tags {
+		if strings.EqualFold(siteTag, tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isSiteSelected checks if the site is in the selected project and has one of the selected tags, every approved
+// site of the project is selected without tags
+func isSiteSelected(site *Site) bool {
+	if !isSiteApproved(site) || site.Project != configurationProject {
+		return false
+	}
+
+	if len(selectedTags) == 0 {
+		return true
+	}
+
+	for _, tag := range selectedTags {
+		if hasSiteTag(site, tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func getSelectedSites(sites []*Site) []*Site {
+	result := []*Site{}
+
+	for _, site := range sites {
+		if isSiteSelected(site) {
+			result = append(result, site)
+		}
+	}
+
+	return result
+}
+
+// getSiteGroups groups the sites by tag, sites with many tags are in many groups and sites without tags are in
+// the untagged group
+func getSiteGroups(sites []*Site) map[string][]*Site {
+	result := map[string][]*Site{}
+
+	for _, site := range sites {
+		if len(site.Tags) == 0 {
+			result[untaggedGroupName] = append(result[untaggedGroupName], site)
+			continue
+		}
+
+		for _, tag := range site.Tags {
+			tag = strings.ToLower(tag)
+			result[tag] = append(result[tag], site)
+		}
+	}
+
+	return result
+}
+
+func getSiteGroupNames(groups map[string][]*Site) []string {
+	result := []string{}
+
+	for name := range groups {
+		result = append(result, name)
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
+// getTagSummary prints the fetched sites of each tag and returns them for the crawl summary
+func getTagSummary(sites []*Site) map[string]interface{} {
+	result := map[string]interface{}{}
+	groups := getSiteGroups(sites)
+
+	// sites without tags have no summary when no site has tags
+	if len(groups) == 1 && groups[untaggedGroupName] != nil {
+		return result
+	}
+
+	for _, name := range getSiteGroupNames(groups) {
+		fetchedSites := 0
+
+		for _, site := range groups[name] {
+			if site.FetchSuccess {
+				fetchedSites++
+			}
+		}
+
+		printInfo(fmt.Sprintf("Tag %s - %d of %d sites fetched", name, fetchedSites, len(groups[name])))
+
+		result[name] = map[string]interface{}{
+			"sites":         len(groups[name]),
+			"fetched_sites": fetchedSites,
+		}
+	}
+
+	return result
+}
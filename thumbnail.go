@@ -0,0 +1,132 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// getThumbnailFileName returns the file of the thumbnail of the image in the thumbs dir of the site, the thumbnails
+// of the jpeg images are jpeg and the other ones are png, named by their format
+func getThumbnailFileName(siteDir string, imageURL string) string {
+	fileName := siteDir + string(filepath.Separator) + thumbnailsDirName + string(filepath.Separator) + imageURL
+	extension := strings.ToLower(filepath.Ext(fileName))
+
+	if extension == ".jpg" || extension == ".jpeg" {
+		return fileName
+	}
+
+	return strings.TrimSuffix(fileName, filepath.Ext(fileName)) + ".png"
+}
+
+// isThumbnailSupported returns if the image can be decoded for a thumbnail, the svg images are not raster images
+func isThumbnailSupported(fileName string, contentType string) bool {
+	return getMediaType(contentType) != "image/svg+xml" && !strings.EqualFold(filepath.Ext(fileName), ".svg")
+}
+
+func createThumbnail(fileName string, thumbnailFileName string, maxDimension int) error {
+	img, err := decodeImageFile(fileName)
+
+	if err != nil {
+		return err
+	}
+
+	thumbnail := resizeImage(img, maxDimension)
+
+	err = os.MkdirAll(filepath.Dir(thumbnailFileName), dirMode)
+
+	if err != nil {
+		return err
+	}
+
+	out, err := createFile(thumbnailFileName, fileMode)
+
+	if err != nil {
+		return err
+	}
+
+	defer out.Close()
+
+	// the format of the thumbnail is the format of its name
+	if extension := strings.ToLower(filepath.Ext(thumbnailFileName)); extension == ".jpg" || extension == ".jpeg" {
+		err = jpeg.Encode(out, thumbnail, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(out, thumbnail)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return out.Close()
+}
+
+func resizeImage(img image.Image, maxDimension int) image.Image {
+	bounds := img.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	if width <= maxDimension && height <= maxDimension {
+		return img
+	}
+
+	// keep the aspect ratio
+	newWidth := maxDimension
+	newHeight := maxDimension
+
+	if width > height {
+		newHeight = height * maxDimension / width
+	} else {
+		newWidth = width * maxDimension / height
+	}
+
+	if newWidth < 1 {
+		newWidth = 1
+	}
+
+	if newHeight < 1 {
+		newHeight = 1
+	}
+
+	result := image.NewRGBA(image.Rect(0, 0, newWidth, newHeight))
+
+	for y := 0; y < newHeight; y++ {
+		for x := 0; x < newWidth; x++ {
+			// average the source block that maps to this pixel
+			x0 := bounds.Min.X + x*width/newWidth
+			x1 := bounds.Min.X + (x+1)*width/newWidth
+			y0 := bounds.Min.Y + y*height/newHeight
+			y1 := bounds.Min.Y + (y+1)*height/newHeight
+
+			var r, g, b, a, count uint64
+
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					sr, sg, sb, sa := img.At(sx, sy).RGBA()
+					r += uint64(sr)
+					g += uint64(sg)
+					b += uint64(sb)
+					a += uint64(sa)
+					count++
+				}
+			}
+
+			if count == 0 {
+				continue
+			}
+
+			result.Set(x, y, color.RGBA64{
+				R: uint16(r / count),
+				G: uint16(g / count),
+				B: uint16(b / count),
+				A: uint16(a / count),
+			})
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+const defaultTLSHandshakeTimeout = 10 * time.Second
+
+var errStalledTransfer = errors.New("transfer stalled")
+
+type TimeoutsConfig struct {
+	DialSeconds           int `json:"dial_seconds,omitempty"`
+	TLSHandshakeSeconds   int `json:"tls_handshake_seconds,omitempty"`
+	ResponseHeaderSeconds int `json:"response_header_seconds,omitempty"`
+	IdleReadSeconds       int `json:"idle_read_seconds,omitempty"`
+	RequestSeconds        int `json:"request_seconds,omitempty"`
+}
+
+// watchdogTransport cancels the requests whose body has no progress for the idle timeout
+type watchdogTransport struct {
+	transport   http.RoundTripper
+	idleTimeout time.Duration
+}
+
+type watchdogBody struct {
+	io.ReadCloser
+	timer       *time.Timer
+	idleTimeout time.Duration
+	cancel      context.CancelFunc
+	stalled     int32
+}
+
+func getTimeout(seconds int, defaultTimeout time.Duration) time.Duration {
+	if seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	return defaultTimeout
+}
+
+func getTimeoutsConfig() *TimeoutsConfig {
+	if configuration == nil || configuration.Timeouts == nil {
+		return &TimeoutsConfig{}
+	}
+
+	return configuration.Timeouts
+}
+
+// getTorDialContext returns a dial function that limits the socks connection and handshake to the dial timeout
+func getTorDialContext(dialTimeout time.Duration) func(ctx context.Context, network string, address string) (net.Conn, error) {
+	return func(ctx context.Context, network string, address string) (net.Conn, error) {
+		if err := checkConnection(networkTransportSOCKS, network, address); err != nil {
+			return nil, err
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+		defer cancel()
+
+		// only the proxy is resolved locally, the hostname of the address is sent to it
+		ctx = withLocalLookup(ctx, torProxyAddress)
+
+		// the retries on a new circuit use their own socks credentials
+		if isolation := getCircuitIsolation(ctx); isolation != "" {
+			dialer, err := proxy.SOCKS5("tcp", torProxyAddress, &proxy.Auth{User: isolation, Password: isolation}, proxy.Direct)
+
+			if err != nil {
+				return nil, err
+			}
+
+			return dialer.(proxy.ContextDialer).DialContext(ctx, network, address)
+		}
+
+		if contextDialer, ok := torDialer.(proxy.ContextDialer); ok {
+			return contextDialer.DialContext(ctx, network, address)
+		}
+
+		return torDialer.Dial(network, address)
+	}
+}
+
+func (transport *watchdogTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(request.Context())
+	response, err := transport.transport.RoundTrip(request.WithContext(ctx))
+
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	body := &watchdogBody{
+		ReadCloser:  response.Body,
+		idleTimeout: transport.idleTimeout,
+		cancel:      cancel,
+	}
+
+	body.timer = time.AfterFunc(transport.idleTimeout, func() {
+		atomic.StoreInt32(&body.stalled, 1)
+		cancel()
+	})
+
+	response.Body = body
+
+	return response, nil
+}
+
+func (body *watchdogBody) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+
+	if n > 0 {
+		body.timer.Reset(body.idleTimeout)
+	}
+
+	if err != nil && err != io.EOF && atomic.LoadInt32(&body.stalled) == 1 {
+		err = errStalledTransfer
+	}
+
+	return n, err
+}
+
+func (body *watchdogBody) Close() error {
+	body.timer.Stop()
+	err := body.ReadCloser.Close()
+	body.cancel()
+
+	return err
+}
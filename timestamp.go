@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+const timestampQueryContentType = "application/timestamp-query"
+
+const timestampTokenExtension = ".tsr"
+
+var oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+
+// the structures of RFC 3161, only the fields read by the crawler
+
+type timestampAlgorithm struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+type timestampMessageImprint struct {
+	HashAlgorithm timestampAlgorithm
+	HashedMessage []byte
+}
+
+type timestampRequest struct {
+	Version        int
+	MessageImprint timestampMessageImprint
+	Nonce          *big.Int `asn1:"optional"`
+	CertReq        bool     `asn1:"optional,default:false"`
+}
+
+type timestampStatus struct {
+	Status       int
+	StatusString []string       `asn1:"optional,utf8"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+type timestampResponse struct {
+	Status         timestampStatus
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type timestampContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type timestampSignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo timestampEncapContentInfo
+}
+
+type timestampEncapContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     []byte `asn1:"explicit,tag:0"`
+}
+
+type timestampInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint timestampMessageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+}
+
+// newTimestampClient returns the client of the timestamp authority, through Tor or directly for clearnet authorities
+func newTimestampClient() *http.Client {
+	if configuration.Evidence.TimestampViaTor {
+		return newTorHTTPClient()
+	}
+
+	dialContext := getDirectDialContext(getTimeout(getTimeoutsConfig().DialSeconds, timeout))
+
+	return newHTTPClient(&http.Transport{DialContext: dialContext})
+}
+
+// getTimestampToken submits the sha256 of the content to the timestamp authority and returns its response, that
+// can be verified with "openssl ts -verify", and the time of the token
+func getTimestampToken(client *http.Client, authorityURL string, content []byte) ([]byte, time.Time, error) {
+	hash := sha256.Sum256(content)
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	request, err := asn1.Marshal(timestampRequest{
+		Version:        1,
+		MessageImprint: timestampMessageImprint{HashAlgorithm: timestampAlgorithm{Algorithm: oidSHA256, Parameters: asn1.NullRawValue}, HashedMessage: hash[:]},
+		Nonce:          nonce,
+		CertReq:        true,
+	})
+
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	response, err := client.Post(authorityURL, timestampQueryContentType, bytes.NewReader(request))
+
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		return nil, time.Time{}, fmt.Errorf("timestamp authority returned status code %d", response.StatusCode)
+	}
+
+	reply, err := ioutil.ReadAll(response.Body)
+
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	info, err := parseTimestampResponse(reply)
+
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	if !bytes.Equal(info.MessageImprint.HashedMessage, hash[:]) {
+		return nil, time.Time{}, errors.New("timestamp token is not for the manifest hash")
+	}
+
+	return reply, info.GenTime, nil
+}
+
+// parseTimestampResponse returns the info of the token of a granted response
+func parseTimestampResponse(reply []byte) (*timestampInfo, error) {
+	response := &timestampResponse{}
+
+	if _, err := asn1.Unmarshal(reply, response); err != nil {
+		return nil, err
+	}
+
+	// granted or granted with modifications
+	if response.Status.Status != 0 && response.Status.Status != 1 {
+		return nil, fmt.Errorf("timestamp request was rejected with status %d %v", response.Status.Status, response.Status.StatusString)
+	}
+
+	contentInfo := &timestampContentInfo{}
+
+	if _, err := asn1.Unmarshal(response.TimeStampToken.FullBytes, contentInfo); err != nil {
+		return nil, err
+	}
+
+	signedData := &timestampSignedData{}
+
+	if _, err := asn1.Unmarshal(contentInfo.Content.Bytes, signedData); err != nil {
+		return nil, err
+	}
+
+	info := &timestampInfo{}
+
+	if _, err := asn1.Unmarshal(signedData.EncapContentInfo.Content, info); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// saveManifestTimestamp saves the token of the timestamp authority next to the manifest
+func saveManifestTimestamp(manifestFileName string, content []byte) error {
+	token, genTime, err := getTimestampToken(newTimestampClient(), configuration.Evidence.TimestampAuthority, content)
+
+	if err != nil {
+		return err
+	}
+
+	err = writeFile(manifestFileName+timestampTokenExtension, token, fileMode)
+
+	if err != nil {
+		return err
+	}
+
+	printInfo("Manifest timestamped by the timestamp authority at", genTime.UTC().Format(time.RFC3339))
+
+	return nil
+}
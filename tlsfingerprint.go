@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+// the tls client hellos of the browsers, made by uTLS, the randomized one has no ALPN
+var tlsFingerprints = map[string]utls.ClientHelloID{
+	"chrome":     utls.HelloChrome_Auto,
+	"firefox":    utls.HelloFirefox_Auto,
+	"safari":     utls.HelloSafari_Auto,
+	"ios":        utls.HelloIOS_Auto,
+	"edge":       utls.HelloEdge_Auto,
+	"randomized": utls.HelloRandomizedNoALPN,
+}
+
+func isKnownTLSFingerprint(fingerprint string) bool {
+	_, exists := tlsFingerprints[fingerprint]
+	return fingerprint == "" || exists
+}
+
+func isTLSFingerprintConfigured() bool {
+	if configuration == nil {
+		return false
+	}
+
+	if configuration.TLSFingerprint != "" {
+		return true
+	}
+
+	for _, site := range configuration.Sites {
+		if site.TLSFingerprint != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getHostTLSFingerprint returns the fingerprint of the site of the host, or the fingerprint of the configuration
+func getHostTLSFingerprint(host string) string {
+	host = strings.ToLower(host)
+
+	for _, site := range configuration.Sites {
+		if site.TLSFingerprint != "" && getURLHost(site.URL) == host {
+			return site.TLSFingerprint
+		}
+	}
+
+	return configuration.TLSFingerprint
+}
+
+// setupTLSFingerprint makes the tls connections of the transport with the client hello of the fingerprint of each
+// host, the hosts without a fingerprint keep the go tls. The transports with a proxy, like I2P, make their own tls
+// connections through it
+func setupTLSFingerprint(transport *http.Transport) {
+	if !isTLSFingerprintConfigured() || transport.Proxy != nil || transport.DialContext == nil {
+		return
+	}
+
+	dialContext := transport.DialContext
+	handshakeTimeout := transport.TLSHandshakeTimeout
+
+	transport.DialTLSContext = func(ctx context.Context, network string, address string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(address)
+
+		if err != nil {
+			return nil, err
+		}
+
+		conn, err := dialContext(ctx, network, address)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if handshakeTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, handshakeTimeout)
+			defer cancel()
+		}
+
+		tlsConn, err := newFingerprintTLSConn(ctx, conn, host, getHostTLSFingerprint(host), transport.TLSClientConfig)
+
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		return tlsConn, nil
+	}
+}
+
+// newFingerprintTLSConn makes the tls handshake with the client hello of the fingerprint. The http transport can
+// only use HTTP/2 on go tls connections, so the browser client hellos only offer HTTP/1.1 with ALPN
+func newFingerprintTLSConn(ctx context.Context, conn net.Conn, host string, fingerprint string, tlsConfig *tls.Config) (net.Conn, error) {
+	insecureSkipVerify := tlsConfig != nil && tlsConfig.InsecureSkipVerify
+
+	if fingerprint == "" {
+		config := &tls.Config{}
+
+		if tlsConfig != nil {
+			config = tlsConfig.Clone()
+		}
+
+		config.ServerName = host
+		config.NextProtos = getALPNProtocols()
+		tlsConn := tls.Client(conn, config)
+
+		return tlsConn, tlsConn.HandshakeContext(ctx)
+	}
+
+	clientHelloID, exists := tlsFingerprints[fingerprint]
+
+	if !exists {
+		return nil, errors.New("unknown tls fingerprint: " + fingerprint)
+	}
+
+	config := &utls.Config{ServerName: host, InsecureSkipVerify: insecureSkipVerify}
+
+	if clientHelloID == utls.HelloRandomizedNoALPN {
+		uconn := utls.UClient(conn, config, clientHelloID)
+		return uconn, uconn.HandshakeContext(ctx)
+	}
+
+	spec, err := utls.UTLSIdToSpec(clientHelloID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, extension := range spec.Extensions {
+		if alpn, ok := extension.(*utls.ALPNExtension); ok {
+			alpn.AlpnProtocols = []string{"http/1.1"}
+		}
+	}
+
+	uconn := utls.UClient(conn, config, utls.HelloCustom)
+
+	if err := uconn.ApplyPreset(&spec); err != nil {
+		return nil, err
+	}
+
+	return uconn, uconn.HandshakeContext(ctx)
+}
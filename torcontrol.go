@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+)
+
+const defaultTorControlAddress = "127.0.0.1:9051"
+
+type TorControlConfig struct {
+	Address    string `json:"address"`
+	Password   string `json:"password,omitempty"`
+	CookieFile string `json:"cookie_file,omitempty"`
+	Circuits   bool   `json:"circuits,omitempty"`
+}
+
+// sendTorControlCommands authenticates on the tor control port and sends the commands, returning the reply
+// lines of each command
+func sendTorControlCommands(config *TorControlConfig, commands ...string) ([][]string, error) {
+	if config == nil {
+		return nil, errors.New("tor control port is not configured")
+	}
+
+	address := config.Address
+
+	if address == "" {
+		address = defaultTorControlAddress
+	}
+
+	conn, err := net.DialTimeout("tcp", address, 10*time.Second)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	authentication := "AUTHENTICATE"
+
+	if config.CookieFile != "" {
+		cookie, err := ioutil.ReadFile(config.CookieFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		authentication += " " + hex.EncodeToString(cookie)
+	} else if config.Password != "" {
+		authentication += " \"" + strings.Replace(strings.Replace(config.Password, "\\", "\\\\", -1), "\"", "\\\"", -1) + "\""
+	}
+
+	reader := bufio.NewReader(conn)
+	result := [][]string{}
+
+	for index, command := range append([]string{authentication}, commands...) {
+		_, err = fmt.Fprintf(conn, "%s\r\n", command)
+
+		if err != nil {
+			return nil, err
+		}
+
+		lines, err := readTorControlReply(reader)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if index > 0 {
+			result = append(result, lines)
+		}
+	}
+
+	fmt.Fprintf(conn, "QUIT\r\n")
+
+	return result, nil
+}
+
+// readTorControlReply reads the lines of a reply until the end line ("250 OK"), data lines ("250+") are read
+// until the "." line
+func readTorControlReply(reader *bufio.Reader) ([]string, error) {
+	lines := []string{}
+
+	for {
+		line, err := reader.ReadString('\n')
+
+		if err != nil {
+			return nil, err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+
+		if len(line) < 4 {
+			return nil, errors.New("invalid tor control reply: " + line)
+		}
+
+		if !strings.HasPrefix(line, "2") {
+			return nil, errors.New("tor control error: " + line)
+		}
+
+		lines = append(lines, line[4:])
+
+		switch line[3] {
+		case ' ':
+			return lines, nil
+		case '+':
+			for {
+				dataLine, err := reader.ReadString('\n')
+
+				if err != nil {
+					return nil, err
+				}
+
+				dataLine = strings.TrimRight(dataLine, "\r\n")
+
+				if dataLine == "." {
+					break
+				}
+
+				lines = append(lines, strings.TrimPrefix(dataLine, "."))
+			}
+		}
+	}
+}
+
+// requestNewTorCircuits asks tor to use new circuits for the next connections
+func requestNewTorCircuits(config *TorControlConfig) error {
+	_, err := sendTorControlCommands(config, "SIGNAL NEWNYM")
+	return err
+}
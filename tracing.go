@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const tracingServiceName = "go-tor-crawler"
+
+type TracingConfig struct {
+	Enabled      bool   `json:"enabled"`
+	OTLPEndpoint string `json:"otlp_endpoint"`
+	ServiceName  string `json:"service_name"`
+}
+
+type Span struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Name         string
+	Start        time.Time
+	Finish       time.Time
+	Attributes   map[string]string
+	Error        string
+}
+
+type Tracer struct {
+	Config *TracingConfig
+	spans  []*Span
+	mutex  sync.Mutex
+}
+
+type tracedBody struct {
+	io.ReadCloser
+	span        *Span
+	requestSpan *Span
+	bytes       int64
+}
+
+var (
+	tracer          *Tracer
+	currentSiteSpan *Span
+)
+
+func setupTracing(config *TracingConfig) {
+	if config == nil || !config.Enabled {
+		return
+	}
+
+	if config.OTLPEndpoint == "" {
+		config.OTLPEndpoint = "http://127.0.0.1:4318/v1/traces"
+	}
+
+	if config.ServiceName == "" {
+		config.ServiceName = tracingServiceName
+	}
+
+	tracer = &Tracer{Config: config}
+}
+
+func startSpan(name string, parent *Span) *Span {
+	if tracer == nil {
+		return nil
+	}
+
+	span := &Span{
+		SpanID:     getRandomHex(8),
+		Name:       name,
+		Start:      time.Now(),
+		Attributes: map[string]string{},
+	}
+
+	if parent != nil {
+		span.TraceID = parent.TraceID
+		span.ParentSpanID = parent.SpanID
+	} else {
+		span.TraceID = getRandomHex(16)
+	}
+
+	return span
+}
+
+func (span *Span) SetAttribute(key string, value string) {
+	if span == nil {
+		return
+	}
+
+	span.Attributes[key] = value
+}
+
+func (span *Span) SetError(err error) {
+	if span == nil || err == nil {
+		return
+	}
+
+	span.Error = err.Error()
+}
+
+func (span *Span) End() {
+	if span == nil || !span.Finish.IsZero() {
+		return
+	}
+
+	span.Finish = time.Now()
+
+	tracer.mutex.Lock()
+	tracer.spans = append(tracer.spans, span)
+	tracer.mutex.Unlock()
+}
+
+// getTracedURL does a GET request recording spans for each phase of the request when tracing is enabled
+func getTracedURL(ctx context.Context, client *http.Client, url string) (*http.Response, error) {
+	return doTracedRequest(ctx, client, "GET", url, "", nil)
+}
+
+// postTracedURL does a POST request with the body, recording spans like getTracedURL
+func postTracedURL(ctx context.Context, client *http.Client, url string, contentType string, body []byte) (*http.Response, error) {
+	return doTracedRequest(ctx, client, "POST", url, contentType, body)
+}
+
+func doTracedRequest(ctx context.Context, client *http.Client, method string, url string, contentType string, body []byte) (*http.Response, error) {
+	var bodyReader io.Reader
+
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, url, bodyReader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+
+	setAssetProbe(request)
+
+	if tracer == nil {
+		return client.Do(request)
+	}
+
+	requestSpan := startSpan(method+" "+url, currentSiteSpan)
+	requestSpan.SetAttribute("http.method", method)
+	requestSpan.SetAttribute("http.url", url)
+
+	// hostnames are resolved by the socks proxy, so dns time is part of the connect span
+	var connectSpan, tlsSpan, waitSpan *Span
+
+	clientTrace := &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			connectSpan = startSpan("socks connect", requestSpan)
+			connectSpan.SetAttribute("net.peer.name", hostPort)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			connectSpan.SetAttribute("net.conn.reused", strconv.FormatBool(info.Reused))
+			connectSpan.End()
+		},
+		TLSHandshakeStart: func() {
+			tlsSpan = startSpan("tls handshake", requestSpan)
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			tlsSpan.SetError(err)
+			tlsSpan.End()
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			waitSpan = startSpan("time to first byte", requestSpan)
+		},
+		GotFirstResponseByte: func() {
+			waitSpan.End()
+		},
+	}
+
+	request = request.WithContext(httptrace.WithClientTrace(request.Context(), clientTrace))
+	response, err := client.Do(request)
+
+	if err != nil {
+		connectSpan.End()
+		waitSpan.End()
+		requestSpan.SetError(err)
+		requestSpan.End()
+		return nil, err
+	}
+
+	requestSpan.SetAttribute("http.status_code", strconv.Itoa(response.StatusCode))
+
+	// the body read span ends the request span when the body is closed
+	response.Body = &tracedBody{
+		ReadCloser:  response.Body,
+		span:        startSpan("body read", requestSpan),
+		requestSpan: requestSpan,
+	}
+
+	return response, nil
+}
+
+func (body *tracedBody) Read(p []byte) (int, error) {
+	read, err := body.ReadCloser.Read(p)
+	body.bytes += int64(read)
+
+	if err != nil && err != io.EOF {
+		body.span.SetError(err)
+	}
+
+	return read, err
+}
+
+func (body *tracedBody) Close() error {
+	body.span.SetAttribute("http.response_content_length", strconv.FormatInt(body.bytes, 10))
+	body.span.End()
+	body.requestSpan.End()
+
+	return body.ReadCloser.Close()
+}
+
+func getRandomHex(size int) string {
+	buffer := make([]byte, size)
+	crawlerRandom.Read(buffer)
+	return hex.EncodeToString(buffer)
+}
+
+// exportSpans sends the finished spans to the otlp http endpoint as json
+func exportSpans() {
+	if tracer == nil {
+		return
+	}
+
+	tracer.mutex.Lock()
+	spans := tracer.spans
+	tracer.spans = nil
+	tracer.mutex.Unlock()
+
+	if len(spans) == 0 {
+		return
+	}
+
+	otlpSpans := []map[string]interface{}{}
+
+	for _, span := range spans {
+		attributes := []map[string]interface{}{}
+
+		for key, value := range span.Attributes {
+			attributes = append(attributes, map[string]interface{}{
+				"key":   key,
+				"value": map[string]interface{}{"stringValue": value},
+			})
+		}
+
+		// status code 1 is ok and 2 is error
+		status := map[string]interface{}{"code": 1}
+
+		if span.Error != "" {
+			status = map[string]interface{}{"code": 2, "message": span.Error}
+		}
+
+		otlpSpans = append(otlpSpans, map[string]interface{}{
+			"traceId":           span.TraceID,
+			"spanId":            span.SpanID,
+			"parentSpanId":      span.ParentSpanID,
+			"name":              span.Name,
+			"kind":              3,
+			"startTimeUnixNano": strconv.FormatInt(span.Start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(span.Finish.UnixNano(), 10),
+			"attributes":        attributes,
+			"status":            status,
+		})
+	}
+
+	payload := map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": []interface{}{
+						map[string]interface{}{
+							"key":   "service.name",
+							"value": map[string]interface{}{"stringValue": tracer.Config.ServiceName},
+						},
+					},
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": tracingServiceName},
+						"spans": otlpSpans,
+					},
+				},
+			},
+		},
+	}
+
+	payloadJSON, err := json.Marshal(payload)
+
+	if err != nil {
+		printError("Unable to encode tracing spans:", err)
+		return
+	}
+
+	// the collector is local, so spans are not sent through tor, the connection is checked by the network policy
+	client := &http.Client{Timeout: timeout, Transport: &http.Transport{DialContext: getDirectDialContext(timeout)}}
+	response, err := client.Post(tracer.Config.OTLPEndpoint, "application/json", bytes.NewReader(payloadJSON))
+
+	if err != nil {
+		printError("Unable to export tracing spans:", err)
+		return
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		printError("Unable to export tracing spans, collector returned:", response.Status)
+	}
+}
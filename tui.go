@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const tuiVisibleSites = 10
+const tuiVisibleLogs = 6
+const tuiProgressBarWidth = 20
+
+type tuiSite struct {
+	URL              string
+	Status           string
+	Images           int
+	DownloadedImages int
+	FailedImages     int
+}
+
+type tuiModel struct {
+	sites        []*tuiSite
+	sitesByURL   map[string]*tuiSite
+	totalOfSites int
+	doneSites    int
+	errors       int
+	bytes        int64
+	start        time.Time
+	torStatus    string
+	logs         []string
+	width        int
+	interrupted  bool
+}
+
+type tuiLogMsg string
+type tuiTorStatusMsg string
+type tuiTickMsg time.Time
+
+var (
+	tuiProgram *tea.Program
+	tuiDone    chan struct{}
+	tuiStdout  *os.File
+)
+
+func startTUI(proxyAddress string) error {
+	// the crawl output is shown inside the tui instead of the terminal
+	reader, writer, err := os.Pipe()
+
+	if err != nil {
+		return err
+	}
+
+	tuiStdout = os.Stdout
+	os.Stdout = writer
+
+	model := &tuiModel{
+		sitesByURL: map[string]*tuiSite{},
+		start:      time.Now(),
+		torStatus:  "checking",
+		width:      80,
+	}
+
+	tuiProgram = tea.NewProgram(model, tea.WithOutput(tuiStdout), tea.WithAltScreen())
+	tuiDone = make(chan struct{})
+
+	go func() {
+		scanner := bufio.NewScanner(reader)
+
+		for scanner.Scan() {
+			tuiProgram.Send(tuiLogMsg(scanner.Text()))
+		}
+	}()
+
+	go func() {
+		for {
+			status := "down"
+			conn, err := net.DialTimeout("tcp", proxyAddress, 3*time.Second)
+
+			if err == nil {
+				status = "up"
+				conn.Close()
+			}
+
+			tuiProgram.Send(tuiTorStatusMsg(status))
+			time.Sleep(5 * time.Second)
+		}
+	}()
+
+	go func() {
+		_, err := tuiProgram.Run()
+
+		os.Stdout = tuiStdout
+		close(tuiDone)
+
+		if err != nil {
+			printError("Unable to run TUI:", err)
+		}
+
+		// the tui was closed by the user before the crawl finished, the main loop saves the configuration and exits
+		if model.interrupted {
+			interruptCrawl()
+		}
+	}()
+
+	return nil
+}
+
+func stopTUI() {
+	if tuiProgram == nil {
+		return
+	}
+
+	tuiProgram.Quit()
+	<-tuiDone
+	tuiProgram = nil
+}
+
+func sendTUIEvent(event *Event) {
+	if tuiProgram == nil {
+		return
+	}
+
+	tuiProgram.Send(event)
+}
+
+func (model *tuiModel) Init() tea.Cmd {
+	return tuiTick()
+}
+
+func tuiTick() tea.Cmd {
+	return tea.Tick(time.Second, func(t time.Time) tea.Msg {
+		return tuiTickMsg(t)
+	})
+}
+
+func (model *tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" || msg.String() == "q" {
+			model.interrupted = true
+			return model, tea.Quit
+		}
+	case tea.WindowSizeMsg:
+		model.width = msg.Width
+	case tuiTickMsg:
+		return model, tuiTick()
+	case tuiTorStatusMsg:
+		model.torStatus = string(msg)
+	case tuiLogMsg:
+		model.logs = append(model.logs, string(msg))
+
+		if len(model.logs) > tuiVisibleLogs {
+			model.logs = model.logs[len(model.logs)-tuiVisibleLogs:]
+		}
+	case *Event:
+		model.updateWithEvent(msg)
+	}
+
+	return model, nil
+}
+
+func (model *tuiModel) updateWithEvent(event *Event) {
+	site := model.sitesByURL[event.Site]
+
+	if site == nil && event.Site != "" {
+		site = &tuiSite{URL: event.Site, Status: "waiting"}
+		model.sitesByURL[event.Site] = site
+		model.sites = append(model.sites, site)
+	}
+
+	switch event.Type {
+	case "site_started":
+		site.Status = "fetching"
+		model.totalOfSites = getEventInt(event, "total")
+	case "page_fetched", "feed_entry_fetched":
+		model.bytes += int64(getEventInt(event, "bytes"))
+	case "site_images_found":
+		site.Images = getEventInt(event, "images")
+		site.Status = "downloading"
+	case "asset_fetched":
+		site.DownloadedImages++
+		model.bytes += int64(getEventInt(event, "bytes"))
+	case "asset_failed":
+		site.FailedImages++
+		model.errors++
+	case "site_failed":
+		site.Status = "failed"
+		model.errors++
+		model.doneSites++
+	case "site_skipped":
+		site.Status = "skipped"
+		model.doneSites++
+	case "site_completed":
+		site.Status = "done"
+
+		if success, _ := event.Data["success"].(bool); !success {
+			site.Status = "partial"
+		}
+
+		site.Images = getEventInt(event, "images")
+		site.DownloadedImages = getEventInt(event, "downloaded_images")
+		model.doneSites++
+	}
+}
+
+func getEventInt(event *Event, key string) int {
+	switch value := event.Data[key].(type) {
+	case int:
+		return value
+	case int64:
+		return int(value)
+	case float64:
+		return int(value)
+	}
+
+	return 0
+}
+
+func (model *tuiModel) View() string {
+	var view strings.Builder
+
+	elapsed := time.Since(model.start).Seconds()
+	throughput := 0.0
+
+	if elapsed > 0 {
+		throughput = float64(model.bytes) / elapsed
+	}
+
+	view.WriteString(fmt.Sprintf("go-tor-crawler  sites %d/%d  errors %d  downloaded %s  throughput %s/s  tor proxy: %s\n\n",
+		model.doneSites, model.totalOfSites, model.errors, formatBytes(model.bytes), formatBytes(int64(throughput)), model.torStatus))
+
+	// only the last sites fit in the screen
+	sites := model.sites
+
+	if len(sites) > tuiVisibleSites {
+		sites = sites[len(sites)-tuiVisibleSites:]
+	}
+
+	for _, site := range sites {
+		view.WriteString(fmt.Sprintf("%-11s %s %d/%d images", site.Status, getProgressBar(site.DownloadedImages, site.Images), site.DownloadedImages, site.Images))
+
+		if site.FailedImages > 0 {
+			view.WriteString(fmt.Sprintf(" (%d failed)", site.FailedImages))
+		}
+
+		view.WriteString("  " + site.URL + "\n")
+	}
+
+	view.WriteString("\n")
+
+	for _, log := range model.logs {
+		if model.width > 0 && len(log) > model.width {
+			log = log[:model.width]
+		}
+
+		view.WriteString(log + "\n")
+	}
+
+	view.WriteString("\npress q to quit\n")
+
+	return view.String()
+}
+
+func getProgressBar(value int, total int) string {
+	filled := tuiProgressBarWidth
+
+	if total > 0 {
+		filled = value * tuiProgressBarWidth / total
+	}
+
+	return "[" + strings.Repeat("#", filled) + strings.Repeat(".", tuiProgressBarWidth-filled) + "]"
+}
+
+func formatBytes(bytes int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	value := float64(bytes)
+	unit := 0
+
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
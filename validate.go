@@ -0,0 +1,537 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var onionHostPattern = regexp.MustCompile(`^(?:[a-z0-9-]+\.)*(?:[a-z2-7]{56}|[a-z2-7]{16})\.onion$`)
+
+// ValidationError is a problem of the configuration file, the warnings are printed but don't make the file invalid
+type ValidationError struct {
+	Line    int
+	Column  int
+	Path    string
+	Message string
+	Warning bool
+}
+
+func (err *ValidationError) Error() string {
+	position := ""
+
+	if err.Warning {
+		position = "warning: "
+	}
+
+	if err.Line > 0 {
+		position += fmt.Sprintf("line %d, column %d: ", err.Line, err.Column)
+	}
+
+	if err.Path != "" {
+		return position + err.Path + ": " + err.Message
+	}
+
+	return position + err.Message
+}
+
+// parseConfiguration reads the configuration strictly, unknown fields and wrong types are errors with their
+// line and column instead of being ignored
+func parseConfiguration(content []byte) (*ConfigurationFile, error) {
+	result := &ConfigurationFile{}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(result)
+
+	if err == nil {
+		return result, nil
+	}
+
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+
+	if errors.As(err, &syntaxError) {
+		line, column := getLineAndColumn(content, syntaxError.Offset)
+		return nil, &ValidationError{Line: line, Column: column, Message: syntaxError.Error()}
+	}
+
+	if errors.As(err, &typeError) {
+		line, column := getLineAndColumn(content, typeError.Offset)
+		message := fmt.Sprintf("expected %s but found %s", typeError.Type.String(), typeError.Value)
+		return nil, &ValidationError{Line: line, Column: column, Path: typeError.Field, Message: message}
+	}
+
+	// unknown fields are reported after the field is read
+	if strings.HasPrefix(err.Error(), "json: unknown field ") {
+		field := strings.TrimPrefix(err.Error(), "json: unknown field ")
+		offset := bytes.LastIndex(content[:decoder.InputOffset()], []byte(field))
+		line, column := getLineAndColumn(content, int64(offset+1))
+		return nil, &ValidationError{Line: line, Column: column, Message: "unknown field " + field}
+	}
+
+	return nil, err
+}
+
+// validateConfiguration returns the errors of a configuration content, first the format errors and then the
+// invalid values
+func validateConfiguration(content []byte) []error {
+	result := []error{}
+	config, err := parseConfiguration(content)
+
+	if err != nil {
+		return append(result, err)
+	}
+
+	siteOffsets := getSiteOffsets(content)
+
+	addSiteProblem := func(index int, message string, warning bool) {
+		validationError := &ValidationError{Path: fmt.Sprintf("sites[%d]", index), Message: message, Warning: warning}
+
+		if index < len(siteOffsets) {
+			validationError.Line, validationError.Column = getLineAndColumn(content, siteOffsets[index])
+		}
+
+		result = append(result, validationError)
+	}
+
+	addSiteError := func(index int, message string) {
+		addSiteProblem(index, message, false)
+	}
+
+	if len(config.Sites) == 0 {
+		result = append(result, &ValidationError{Path: "sites", Message: "site list is empty"})
+	}
+
+	siteURLs := map[string]int{}
+
+	for index, site := range config.Sites {
+		if site == nil || strings.TrimSpace(site.URL) == "" {
+			addSiteError(index, "missing url")
+			continue
+		}
+
+		// urls of other networks are checked by their gateways
+		if isGatewayURL(site.URL) {
+			continue
+		}
+
+		scheme := getURLScheme(site.URL)
+
+		if scheme != "http" && scheme != "https" {
+			addSiteError(index, "url must start with http:// or https://: "+site.URL)
+			continue
+		}
+
+		host := getURLHost(site.URL)
+
+		if host == "" {
+			addSiteError(index, "url has no host: "+site.URL)
+			continue
+		}
+
+		if strings.HasSuffix(host, ".onion") && !onionHostPattern.MatchString(host) {
+			addSiteError(index, "malformed onion address: "+host)
+		}
+
+		// the crawl skips the duplicates, so they are only warnings
+		if firstIndex, exists := siteURLs[getSiteKey(site)]; exists {
+			addSiteProblem(index, fmt.Sprintf("url is a duplicate of sites[%d] and is skipped by the crawl: %s", firstIndex, site.URL), true)
+		} else {
+			siteURLs[getSiteKey(site)] = index
+		}
+
+		if !isKnownRobotsPolicy(site.RobotsPolicy) {
+			addSiteError(index, "unknown robots policy: "+site.RobotsPolicy)
+		}
+
+		if site.Method != "" && site.Method != "GET" && site.Method != "POST" {
+			addSiteError(index, "method must be GET or POST: "+site.Method)
+		}
+
+		if site.Method != "POST" && (site.Body != "" || site.ContentType != "") {
+			addSiteError(index, "body and content_type need the POST method")
+		}
+
+		if site.API != nil && site.API.Format != "" && site.API.Format != apiFormatJSON && site.API.Format != apiFormatXML {
+			addSiteError(index, "api format must be json or xml: "+site.API.Format)
+		}
+
+		if site.API != nil && site.API.NextLink != "" && !strings.HasPrefix(site.API.NextLink, "$") {
+			addSiteError(index, "api next_link must be a JSONPath starting with $: "+site.API.NextLink)
+		}
+
+		if site.Approval != "" && site.Approval != approvalPending && site.Approval != approvalRejected {
+			addSiteError(index, "approval must be pending or rejected: "+site.Approval)
+		}
+
+		if !isKnownTLSFingerprint(site.TLSFingerprint) {
+			addSiteError(index, "unknown tls fingerprint: "+site.TLSFingerprint)
+		}
+
+		if site.Project != "" && getProject(config, site.Project) == nil {
+			addSiteError(index, "unknown project: "+site.Project)
+		}
+
+		if site.MaxDepth < 0 || site.MaxPages < 0 || site.MaxBytes < 0 {
+			addSiteError(index, "max_depth, max_pages and max_bytes can't be negative")
+		}
+
+		for _, rule := range site.ExtractionRules {
+			if rule == nil || rule.Name == "" || (rule.Selector == "" && rule.XPath == "") {
+				addSiteError(index, "extraction rules need a name and a selector or xpath")
+				break
+			}
+		}
+
+		if message := getSkipRulesError(site.SkipRules); message != "" {
+			addSiteError(index, message)
+		}
+	}
+
+	for _, scannerName := range config.Scanners {
+		if !isKnownScanner(scannerName) {
+			result = append(result, &ValidationError{Path: "scanners", Message: "unknown scanner: " + scannerName})
+		}
+	}
+
+	if _, exists := profiles[config.Profile]; config.Profile != "" && !exists {
+		result = append(result, &ValidationError{Path: "profile", Message: "unknown profile: " + config.Profile})
+	}
+
+	if config.AssetProbe != "" && config.AssetProbe != assetProbeHead && config.AssetProbe != assetProbeRange {
+		result = append(result, &ValidationError{Path: "asset_probe", Message: "asset probe must be head or range: " + config.AssetProbe})
+	} else if config.AssetProbe != "" && config.MaxAssetBytes <= 0 {
+		result = append(result, &ValidationError{Path: "asset_probe", Message: "asset probe needs max_asset_bytes"})
+	}
+
+	if config.PageLayout != "" && config.PageLayout != pageLayoutFlat && config.PageLayout != pageLayoutMirror {
+		result = append(result, &ValidationError{Path: "page_layout", Message: "page layout must be flat or mirror: " + config.PageLayout})
+	}
+
+	if !isKnownTLSFingerprint(config.TLSFingerprint) {
+		result = append(result, &ValidationError{Path: "tls_fingerprint", Message: "unknown tls fingerprint: " + config.TLSFingerprint})
+	}
+
+	projectNames := map[string]bool{}
+
+	for index, project := range config.Projects {
+		path := fmt.Sprintf("projects[%d]", index)
+
+		if project == nil || project.Name == "" || strings.ContainsAny(project.Name, `/\.`) {
+			result = append(result, &ValidationError{Path: path, Message: "project name is required and can't have slashes or dots"})
+			continue
+		}
+
+		if projectNames[project.Name] {
+			result = append(result, &ValidationError{Path: path, Message: "duplicated project: " + project.Name})
+		}
+
+		projectNames[project.Name] = true
+
+		for _, value := range project.CrawlWindows {
+			if _, err := parseCrawlWindow(value); err != nil {
+				result = append(result, &ValidationError{Path: path + ".crawl_windows", Message: err.Error()})
+			}
+		}
+
+		// the settings are checked on an empty configuration
+		for settingPath, value := range project.Settings {
+			field, err := getConfigurationField(&ConfigurationFile{}, settingPath)
+
+			if err == nil {
+				err = setConfigurationFieldValue(field, value)
+			}
+
+			if err != nil {
+				result = append(result, &ValidationError{Path: path + ".settings." + settingPath, Message: err.Error()})
+			}
+		}
+	}
+
+	for class, policy := range config.ErrorPolicies {
+		path := "error_policies." + class
+
+		if !isKnownErrorClass(class) {
+			result = append(result, &ValidationError{Path: path, Message: "unknown error class: " + class})
+		} else if policy == nil || !isKnownErrorAction(policy.Action) {
+			result = append(result, &ValidationError{Path: path, Message: "error action must be retry, skip or abort"})
+		}
+	}
+
+	if !isKnownRobotsPolicy(config.RobotsPolicy) {
+		result = append(result, &ValidationError{Path: "robots_policy", Message: "unknown policy: " + config.RobotsPolicy})
+	}
+
+	if config.ManagedTor != nil {
+		for _, transport := range config.ManagedTor.Transports {
+			if transport == nil || len(transport.Names) == 0 || transport.Path == "" {
+				result = append(result, &ValidationError{Path: "managed_tor.transports", Message: "pluggable transports need names and a path"})
+				break
+			}
+		}
+	}
+
+	if message := getSkipRulesError(config.SkipRules); message != "" {
+		result = append(result, &ValidationError{Path: "skip_rules", Message: message})
+	}
+
+	if config.Permissions != nil {
+		if _, err := parseFileMode(config.Permissions.FileMode); config.Permissions.FileMode != "" && err != nil {
+			result = append(result, &ValidationError{Path: "permissions.file_mode", Message: err.Error()})
+		}
+
+		if _, err := parseFileMode(config.Permissions.DirMode); config.Permissions.DirMode != "" && err != nil {
+			result = append(result, &ValidationError{Path: "permissions.dir_mode", Message: err.Error()})
+		}
+	}
+
+	if config.Sandbox != nil {
+		for _, port := range config.Sandbox.ConnectPorts {
+			if port <= 0 || port > 65535 {
+				result = append(result, &ValidationError{Path: "sandbox.connect_ports", Message: fmt.Sprintf("invalid port: %d", port)})
+			}
+		}
+	}
+
+	if config.SnapshotRetention != nil {
+		if config.SnapshotRetention.KeepLast < 0 {
+			result = append(result, &ValidationError{Path: "snapshot_retention.keep_last", Message: "must not be negative"})
+		}
+
+		if config.SnapshotRetention.KeepDays < 0 {
+			result = append(result, &ValidationError{Path: "snapshot_retention.keep_days", Message: "must not be negative"})
+		}
+	}
+
+	if config.Checkpoints != nil {
+		if config.Checkpoints.EveryPages < 0 {
+			result = append(result, &ValidationError{Path: "checkpoints.every_pages", Message: "must not be negative"})
+		}
+
+		if config.Checkpoints.EverySeconds < 0 {
+			result = append(result, &ValidationError{Path: "checkpoints.every_seconds", Message: "must not be negative"})
+		}
+	}
+
+	if config.Evidence != nil {
+		if config.Evidence.KeyFile == "" && config.Evidence.TimestampAuthority == "" {
+			result = append(result, &ValidationError{Path: "evidence", Message: "needs a key file or a timestamp authority"})
+		}
+
+		if config.Evidence.KeyFile != "" && config.Evidence.KeyType != evidenceKeyTypePGP && config.Evidence.KeyType != evidenceKeyTypeMinisign {
+			result = append(result, &ValidationError{Path: "evidence.key_type", Message: "key type must be pgp or minisign: " + config.Evidence.KeyType})
+		}
+	}
+
+	if err := checkControlAddress(config.ControlSocket); config.ControlSocket != "" && err != nil {
+		result = append(result, &ValidationError{Path: "control_socket", Message: err.Error()})
+	}
+
+	for mediaType, name := range config.ContentProcessors {
+		if _, exists := namedContentProcessors[name]; !exists {
+			result = append(result, &ValidationError{Path: "content_processors." + mediaType, Message: "processor must be html, image, json, text or binary: " + name})
+		}
+	}
+
+	if config.Frontier != nil && config.Frontier.Redis != "" && config.Frontier.RunID == "" {
+		result = append(result, &ValidationError{Path: "frontier.run_id", Message: "the redis frontier needs a run_id"})
+	}
+
+	if config.NetworkPolicy != nil {
+		switch config.NetworkPolicy.Mode {
+		case "", networkPolicySOCKSOnly, networkPolicyOnionOnly:
+		default:
+			result = append(result, &ValidationError{Path: "network_policy.mode", Message: "unknown mode: " + config.NetworkPolicy.Mode})
+		}
+	}
+
+	if config.Writes != nil {
+		switch config.Writes.Fsync {
+		case "", fsyncNever, fsyncFile, fsyncSite:
+		default:
+			result = append(result, &ValidationError{Path: "writes.fsync", Message: "unknown fsync policy: " + config.Writes.Fsync})
+		}
+	}
+
+	if config.DataURIMode != "" && config.DataURIMode != dataURIModeDecode {
+		result = append(result, &ValidationError{Path: "data_uri_mode", Message: "unknown mode: " + config.DataURIMode})
+	}
+
+	for _, value := range config.CrawlWindows {
+		if _, err := parseCrawlWindow(value); err != nil {
+			result = append(result, &ValidationError{Path: "crawl_windows", Message: err.Error()})
+		}
+	}
+
+	if config.Database != nil && config.Database.Driver != "" && config.Database.Driver != storageDriverSQLite && config.Database.Driver != storageDriverPostgres {
+		result = append(result, &ValidationError{Path: "database.driver", Message: "unknown database driver: " + config.Database.Driver})
+	}
+
+	for index, rule := range config.Categories {
+		if rule == nil || rule.Name == "" || len(rule.Keywords) == 0 {
+			result = append(result, &ValidationError{Path: fmt.Sprintf("categories[%d]", index), Message: "category rules need a name and keywords"})
+		}
+	}
+
+	for index, publisher := range config.Publishers {
+		if publisher.Type != publisherTypeKafka && publisher.Type != publisherTypeNATS {
+			result = append(result, &ValidationError{Path: fmt.Sprintf("publishers[%d]", index), Message: "unknown publisher type: " + publisher.Type})
+		} else if publisher.Topic == "" {
+			result = append(result, &ValidationError{Path: fmt.Sprintf("publishers[%d]", index), Message: "missing topic"})
+		}
+	}
+
+	for index, engine := range config.SearchEngines {
+		if engine == nil || !strings.Contains(engine.URL, searchEngineQueryPlaceholder) {
+			result = append(result, &ValidationError{Path: fmt.Sprintf("search_engines[%d]", index), Message: "url needs the " + searchEngineQueryPlaceholder + " placeholder"})
+		} else if engine.Format != "" && engine.Format != searchEngineFormatHTML && engine.Format != searchEngineFormatJSON {
+			result = append(result, &ValidationError{Path: fmt.Sprintf("search_engines[%d]", index), Message: "format must be html or json: " + engine.Format})
+		}
+	}
+
+	for index, notification := range config.Notifications {
+		switch notification.Type {
+		case notificationTypeWebhook, notificationTypeTelegram, notificationTypeEmail:
+		default:
+			result = append(result, &ValidationError{Path: fmt.Sprintf("notifications[%d]", index), Message: "unknown notification type: " + notification.Type})
+		}
+	}
+
+	return result
+}
+
+func isKnownScanner(name string) bool {
+	if name == "all" {
+		return true
+	}
+
+	for _, scanner := range scanners {
+		if scanner.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getSiteOffsets returns the offset of each site object in the configuration content
+func getSiteOffsets(content []byte) []int64 {
+	result := []int64{}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return result
+	}
+
+	for decoder.More() {
+		key, err := decoder.Token()
+
+		if err != nil {
+			return result
+		}
+
+		if key != "sites" {
+			var value json.RawMessage
+
+			if decoder.Decode(&value) != nil {
+				return result
+			}
+
+			continue
+		}
+
+		if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+			return result
+		}
+
+		for decoder.More() {
+			result = append(result, skipWhitespace(content, decoder.InputOffset()))
+
+			var value json.RawMessage
+
+			if decoder.Decode(&value) != nil {
+				return result
+			}
+		}
+
+		return result
+	}
+
+	return result
+}
+
+func skipWhitespace(content []byte, offset int64) int64 {
+	for offset < int64(len(content)) && strings.ContainsRune(" \t\r\n,", rune(content[offset])) {
+		offset++
+	}
+
+	return offset
+}
+
+// getLineAndColumn converts a content offset to a line and column starting at 1
+func getLineAndColumn(content []byte, offset int64) (int, int) {
+	if offset > int64(len(content)) {
+		offset = int64(len(content))
+	}
+
+	if offset < 0 {
+		offset = 0
+	}
+
+	line := 1 + bytes.Count(content[:offset], []byte("\n"))
+	column := int(offset) - bytes.LastIndex(content[:offset], []byte("\n"))
+
+	return line, column
+}
+
+func runConfigValidateCommand(args []string) {
+	if len(args) != 1 {
+		printConfigUsage()
+		os.Exit(exitCodeConfigError)
+	}
+
+	content, err := ioutil.ReadFile(args[0])
+
+	if err != nil {
+		fmt.Println("Unable to read configuration file:", err)
+		os.Exit(exitCodeConfigError)
+	}
+
+	// urls are normalized with the file settings, when they can be read
+	configuration = &ConfigurationFile{}
+
+	if config, err := parseConfiguration(content); err == nil {
+		configuration = config
+	}
+
+	validationErrors := validateConfiguration(content)
+	totalOfErrors := 0
+
+	for _, validationError := range validationErrors {
+		fmt.Println(args[0] + ": " + validationError.Error())
+
+		var problem *ValidationError
+
+		if !errors.As(validationError, &problem) || !problem.Warning {
+			totalOfErrors++
+		}
+	}
+
+	if totalOfErrors > 0 {
+		fmt.Println(fmt.Sprintf("Configuration file has %d errors", totalOfErrors))
+		os.Exit(exitCodeConfigError)
+	}
+
+	if len(validationErrors) > 0 {
+		fmt.Println(fmt.Sprintf("Configuration file is valid, with %d warnings", len(validationErrors)))
+		return
+	}
+
+	fmt.Println("Configuration file is valid")
+}
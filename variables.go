@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var variablePattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// the time of the run, all the variables of a run have the same date
+var runStartedAt = crawlerClock.Now().UTC()
+
+// expandVariables replaces the ${NAME} variables of a configuration value: the run variables (DATE, TIME,
+// DATETIME, CONFIG_NAME), the site variables (SITE_URL, SITE_HOST, SITE_SLUG) when there is a site, then the
+// configuration "variables" and the environment. Unknown variables are kept, so a typo is seen in the result
+func expandVariables(value string, siteURL string) string {
+	return expandVariablesWith(value, siteURL, true)
+}
+
+func expandVariablesWith(value string, siteURL string, withConfigVariables bool) string {
+	if !strings.Contains(value, "${") {
+		return value
+	}
+
+	return variablePattern.ReplaceAllStringFunc(value, func(match string) string {
+		name := variablePattern.FindStringSubmatch(match)[1]
+
+		if result, exists := getVariable(name, siteURL, withConfigVariables); exists {
+			return result
+		}
+
+		return match
+	})
+}
+
+func getVariable(name string, siteURL string, withConfigVariables bool) (string, bool) {
+	switch name {
+	case "DATE":
+		return runStartedAt.Format("2006-01-02"), true
+	case "TIME":
+		return runStartedAt.Format("150405"), true
+	case "DATETIME":
+		return runStartedAt.Format("20060102-150405"), true
+	case "CONFIG_NAME":
+		return strings.TrimSuffix(filepath.Base(configurationFileName), filepath.Ext(configurationFileName)), true
+	}
+
+	if siteURL != "" {
+		switch name {
+		case "SITE_URL":
+			return siteURL, true
+		case "SITE_HOST":
+			return getURLHost(siteURL), true
+		case "SITE_SLUG":
+			return getSiteSlug(siteURL), true
+		case "SITE_PATH":
+			return getURLPath(siteURL), true
+		case "SITE_TITLE":
+			return getSiteTitle(siteURL), true
+		}
+	}
+
+	if withConfigVariables && configuration != nil {
+		if value, exists := configuration.Variables[name]; exists {
+			// the configuration variables can use the run, site and environment variables
+			return expandVariablesWith(value, siteURL, false), true
+		}
+	}
+
+	return os.LookupEnv(name)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	fsyncNever = "never"
+	fsyncFile  = "file"
+	fsyncSite  = "site"
+)
+
+const defaultWriteBufferSize = 64 * 1024
+
+// WritesConfig sets the buffer of the saved files and when they are synced to the disk: never (the system writes
+// them later), after each file, or once after each site, so crawls saving many small assets are not slowed by
+// a sync on every file
+type WritesConfig struct {
+	BufferSize int    `json:"buffer_size,omitempty"`
+	Fsync      string `json:"fsync,omitempty"`
+}
+
+var (
+	pendingSyncFiles = map[string]bool{}
+	pendingSyncMutex sync.Mutex
+)
+
+func getFsyncPolicy() string {
+	if configuration == nil || configuration.Writes == nil || configuration.Writes.Fsync == "" {
+		return fsyncNever
+	}
+
+	return configuration.Writes.Fsync
+}
+
+func getWriteBufferSize() int {
+	if configuration == nil || configuration.Writes == nil || configuration.Writes.BufferSize <= 0 {
+		return defaultWriteBufferSize
+	}
+
+	return configuration.Writes.BufferSize
+}
+
+// BufferedFile is a file of the archive written through a buffer, that is synced by the fsync policy when closed
+type BufferedFile struct {
+	file   *os.File
+	writer *bufio.Writer
+}
+
+func createFile(fileName string, perm os.FileMode) (*BufferedFile, error) {
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &BufferedFile{file: file, writer: bufio.NewWriterSize(file, getWriteBufferSize())}, nil
+}
+
+func (bufferedFile *BufferedFile) Write(data []byte) (int, error) {
+	return bufferedFile.writer.Write(data)
+}
+
+// Close flushes the buffer and syncs the file by the fsync policy, closing it again does nothing
+func (bufferedFile *BufferedFile) Close() error {
+	if bufferedFile.file == nil {
+		return nil
+	}
+
+	file := bufferedFile.file
+	bufferedFile.file = nil
+	err := bufferedFile.writer.Flush()
+
+	if err == nil {
+		err = syncWrittenFile(file)
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// writeFile is the ioutil.WriteFile of the archive files, with the write buffer and the fsync policy
+func writeFile(fileName string, content []byte, perm os.FileMode) error {
+	file, err := createFile(fileName, perm)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(content)
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// writeFileAtomically writes the content to a temporary file of the same dir and renames it to the file, the readers
+// of the file get the old or the new content and never a part of it
+func writeFileAtomically(fileName string, content []byte, perm os.FileMode) error {
+	file, err := ioutil.TempFile(filepath.Dir(fileName), filepath.Base(fileName)+".*.tmp")
+
+	if err != nil {
+		return err
+	}
+
+	temporaryFileName := file.Name()
+	_, err = file.Write(content)
+
+	if err == nil {
+		err = file.Chmod(perm)
+	}
+
+	if err == nil {
+		err = file.Sync()
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(temporaryFileName, fileName)
+	}
+
+	if err != nil {
+		os.Remove(temporaryFileName)
+	}
+
+	return err
+}
+
+func syncWrittenFile(file *os.File) error {
+	switch getFsyncPolicy() {
+	case fsyncFile:
+		if err := file.Sync(); err != nil {
+			return err
+		}
+
+		// the new name of the file is only durable with its directory
+		return syncDir(filepath.Dir(file.Name()))
+	case fsyncSite:
+		pendingSyncMutex.Lock()
+		pendingSyncFiles[file.Name()] = true
+		pendingSyncMutex.Unlock()
+	}
+
+	return nil
+}
+
+// syncPendingFiles syncs the files written since the last call and their directories, with the site fsync policy
+// it runs after each site
+func syncPendingFiles() {
+	pendingSyncMutex.Lock()
+	fileNames := pendingSyncFiles
+	pendingSyncFiles = map[string]bool{}
+	pendingSyncMutex.Unlock()
+
+	dirs := map[string]bool{}
+
+	for fileName := range fileNames {
+		dirs[filepath.Dir(fileName)] = true
+		file, err := os.OpenFile(fileName, os.O_WRONLY, 0)
+
+		if err != nil {
+			// files removed after they were written don't need the sync
+			if !os.IsNotExist(err) {
+				printError("Unable to sync file:", err)
+			}
+
+			continue
+		}
+
+		if err := file.Sync(); err != nil {
+			printError("Unable to sync file:", err)
+		}
+
+		file.Close()
+	}
+
+	for dir := range dirs {
+		if err := syncDir(dir); err != nil && !os.IsNotExist(err) {
+			printError("Unable to sync directory:", err)
+		}
+	}
+}